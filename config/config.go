@@ -5,8 +5,11 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"reflect"
 	"runtime/debug"
+	"strconv"
 	"strings"
 
 	"github.com/exoscale/multiconfig"
@@ -22,6 +25,8 @@ type loaderConfig struct {
 	flagLoader      *multiconfig.FlagLoader
 	interfaceLoader *multiconfig.InterfaceLoader
 	validate        *validator.Validate
+	debug           io.Writer
+	strictFlags     bool
 }
 
 // WithValidator replaces the built-in validator with a user supplied one
@@ -55,6 +60,8 @@ func WithLegacyFlags() Option {
 //  4. Environment variables
 //  5. CLI flags
 //
+// With the --config-debug flag or WithDebug, the arguments of the flag loader and the resolved flag values are written out before validation
+// String values of the form file://<path> are then replaced by the content of the file at path, without its trailing newlines
 // After loading, Load will validate the values with the functions passed into the `validate` struct tag
 // If any value doesn't pass validation, a user readable error will be returned.
 func Load(s any, args []string, opts ...Option) error {
@@ -68,6 +75,8 @@ func Load(s any, args []string, opts ...Option) error {
 		// If we have no support for BuildInfo, just continue as usual
 	}
 
+	debugFlagPassed, args := debugRequested(args)
+
 	// Before loading any config, we want to check if the user has provided
 	// a config file path through a CLI flag
 	configPath, newArgs, err := getConfigPath(args)
@@ -100,6 +109,17 @@ func Load(s any, args []string, opts ...Option) error {
 		conf.validate = validator.New()
 	}
 
+	if debugFlagPassed && conf.debug == nil {
+		conf.debug = flag.CommandLine.Output()
+	}
+
+	conf.flagLoader.Args = negateBoolFlags(s, conf.flagLoader)
+	if conf.strictFlags {
+		if err := checkStrictFlags(s, conf.flagLoader); err != nil {
+			return err
+		}
+	}
+
 	var loader multiconfig.Loader
 	// If a path to a configuration file is provided, add it to the chain
 	if configPath != "" {
@@ -109,13 +129,22 @@ func Load(s any, args []string, opts ...Option) error {
 		loader = multiconfig.MultiLoader(conf.tagLoader, conf.interfaceLoader, conf.envLoader, conf.flagLoader)
 	}
 
-	if err := loader.Load(s); err == flag.ErrHelp {
+	err = loader.Load(s)
+	// The values are written before the file values are read, so their content doesn't end up in the output
+	if conf.debug != nil && err != flag.ErrHelp {
+		writeDebug(conf.debug, s, conf.flagLoader)
+	}
+	if err == flag.ErrHelp {
 		// Asking for help should not return an error result code
 		os.Exit(0)
 	} else if err != nil {
 		return err
 	}
 
+	if err := loadFileValues(s); err != nil {
+		return err
+	}
+
 	if err := registerValidators(conf.validate); err != nil {
 		return err
 	}
@@ -239,6 +268,47 @@ func getConfigPath(args []string) (string, []string, error) {
 	return configPath, newArgs, nil
 }
 
+// negateBoolFlags returns the args of the flag loader with the negated bool flags, eg: --no-feature,
+// replaced by their regular form, eg: --feature=false
+// A flag is only negated when the struct has a bool option of that name, and no option named like the negated flag
+// Does not modify the input
+func negateBoolFlags(s any, loader *multiconfig.FlagLoader) []string {
+	flags := map[string]reflect.Kind{}
+	for _, f := range resolveFlags(s, loader) {
+		flags[f.name] = f.kind
+	}
+
+	newArgs := make([]string, 0, len(loader.Args))
+	for i, arg := range loader.Args {
+		if arg == "--" {
+			return append(newArgs, loader.Args[i:]...)
+		}
+		dashes := arg[:len(arg)-len(strings.TrimLeft(arg, "-"))]
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, dashes), "=")
+		positive, negated := strings.CutPrefix(name, "no-")
+		if dashes == "" || !negated || flags[positive] != reflect.Bool {
+			newArgs = append(newArgs, arg)
+			continue
+		}
+		if _, exists := flags[name]; exists {
+			newArgs = append(newArgs, arg)
+			continue
+		}
+		enabled := true
+		if hasValue {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				// Reported by the flag loader
+				newArgs = append(newArgs, arg)
+				continue
+			}
+			enabled = b
+		}
+		newArgs = append(newArgs, fmt.Sprintf("%s%s=%t", dashes, positive, !enabled))
+	}
+	return newArgs
+}
+
 // versionRequested will return true if the args contain the special --version or -v flags
 func versionRequested(args []string) bool {
 	for _, arg := range args {
@@ -1,9 +1,11 @@
 package config
 
 import (
+	"bytes"
 	"os"
 	"testing"
 
+	"github.com/exoscale/multiconfig"
 	"github.com/go-playground/validator/v10"
 	"github.com/stretchr/testify/assert"
 )
@@ -428,3 +430,141 @@ func TestLoadWithOptions(t *testing.T) {
 		}
 	})
 }
+
+func TestConfigDebug(t *testing.T) {
+	type Config struct {
+		Name   string `default:"Default"`
+		Nested struct {
+			RootCAFile string
+			Port       int `validate:"port"`
+		}
+	}
+
+	t.Run("Should list the args and the resolved flags", func(t *testing.T) {
+		args := []string{"conf", "--nested.root-ca-file", "ca.pem", "--nested.port=70000"}
+
+		out := &bytes.Buffer{}
+		config := Config{}
+		// The output is written before validation
+		assert.Error(t, Load(&config, args, WithDebug(out)))
+		assert.Equal(t, `config: flag loader args: ["--nested.root-ca-file" "ca.pem" "--nested.port=70000"]
+config: resolved flags:
+  --name=Default
+  --nested.root-ca-file=ca.pem (set)
+  --nested.port=70000 (set)
+`, out.String())
+	})
+
+	t.Run("Should list the unknown flags", func(t *testing.T) {
+		args := []string{"conf", "--nested-port=80"}
+
+		out := &bytes.Buffer{}
+		config := Config{}
+		assert.Error(t, Load(&config, args, WithDebug(out)))
+		assert.Contains(t, out.String(), "  --nested.port=0\n  --nested-port (unknown)\n")
+	})
+
+	t.Run("Should remove the config-debug flag from the args", func(t *testing.T) {
+		requested, args := debugRequested([]string{"conf", "--config-debug", "--name", "foo"})
+		assert.True(t, requested)
+		assert.Equal(t, []string{"conf", "--name", "foo"}, args)
+
+		requested, args = debugRequested([]string{"conf", "--name", "foo"})
+		assert.False(t, requested)
+		assert.Equal(t, []string{"conf", "--name", "foo"}, args)
+	})
+}
+
+func TestBoolFlags(t *testing.T) {
+	type Config struct {
+		Enabled bool `default:"true"`
+		Nested  struct {
+			Verbose bool
+		}
+		Name string
+	}
+
+	t.Run("Should set a bare bool flag to true", func(t *testing.T) {
+		config := Config{}
+		if assert.NoError(t, Load(&config, []string{"conf", "--nested.verbose"})) {
+			assert.True(t, config.Nested.Verbose)
+		}
+	})
+
+	t.Run("Should set a bool flag to false", func(t *testing.T) {
+		config := Config{}
+		if assert.NoError(t, Load(&config, []string{"conf", "--enabled=false"})) {
+			assert.False(t, config.Enabled)
+		}
+	})
+
+	t.Run("Should not use the positional argument after a bool flag as its value", func(t *testing.T) {
+		config := Config{}
+		if assert.NoError(t, Load(&config, []string{"conf", "--nested.verbose", "false"})) {
+			assert.True(t, config.Nested.Verbose)
+		}
+	})
+
+	t.Run("Should stop parsing at the positional argument after a bool flag", func(t *testing.T) {
+		config := Config{}
+		if assert.NoError(t, Load(&config, []string{"conf", "--nested.verbose", "migrate", "up", "--name", "foo"})) {
+			assert.True(t, config.Nested.Verbose)
+			assert.Empty(t, config.Name)
+		}
+	})
+
+	t.Run("Should skip the value of the other flags", func(t *testing.T) {
+		config := Config{}
+		if assert.NoError(t, Load(&config, []string{"conf", "--name", "foo", "--nested.verbose"})) {
+			assert.Equal(t, "foo", config.Name)
+			assert.True(t, config.Nested.Verbose)
+		}
+	})
+}
+
+func TestNegatedBoolFlags(t *testing.T) {
+	type Config struct {
+		Feature bool `default:"true"`
+		Nested  struct {
+			Verbose bool
+		}
+		NoCache bool
+		Cache   bool `default:"true"`
+		Name    string
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected func(*Config) bool
+	}{
+		{"Should keep the default", []string{"conf"}, func(c *Config) bool { return c.Feature }},
+		{"Should disable a default true flag", []string{"conf", "--no-feature"}, func(c *Config) bool { return !c.Feature }},
+		{"Should support a single dash", []string{"conf", "-no-feature"}, func(c *Config) bool { return !c.Feature }},
+		{"Should negate the value", []string{"conf", "--no-feature=false"}, func(c *Config) bool { return c.Feature }},
+		{"Should still support the regular form", []string{"conf", "--feature=false"}, func(c *Config) bool { return !c.Feature }},
+		{"Should negate nested flags", []string{"conf", "--nested.verbose", "--no-nested.verbose"}, func(c *Config) bool { return !c.Nested.Verbose }},
+		{"Should prefer an existing option", []string{"conf", "--no-cache"}, func(c *Config) bool { return c.NoCache && c.Cache }},
+		{"Should apply the last flag", []string{"conf", "--no-feature", "--feature"}, func(c *Config) bool { return c.Feature }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{}
+			if assert.NoError(t, Load(&config, tt.args)) {
+				assert.True(t, tt.expected(&config))
+			}
+		})
+	}
+
+	t.Run("Should not negate other flags", func(t *testing.T) {
+		config := Config{}
+		assert.Error(t, Load(&config, []string{"conf", "--no-name"}))
+		assert.Error(t, Load(&config, []string{"conf", "--no-feature=maybe"}))
+	})
+
+	t.Run("Should not negate the args after the terminator", func(t *testing.T) {
+		loader := &multiconfig.FlagLoader{Args: []string{"--no-feature", "--", "--no-feature"}, CamelCase: true, StructSeparator: "."}
+		assert.Equal(t, []string{"--feature=false", "--", "--no-feature"}, negateBoolFlags(&Config{}, loader))
+	})
+}
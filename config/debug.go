@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/exoscale/multiconfig"
+	"github.com/fatih/camelcase"
+)
+
+// debugFlag enables the debug output of Load, see WithDebug
+const debugFlag = "config-debug"
+
+// WithDebug writes the arguments passed to the flag loader and the resolved flag values to w
+// The same output is written to the output of flag.CommandLine when the --config-debug flag is passed
+func WithDebug(w io.Writer) Option {
+	return func(conf *loaderConfig) {
+		conf.debug = w
+	}
+}
+
+// debugRequested returns true if the args contain the --config-debug flag, along with args without it
+// Does not modify the input
+func debugRequested(args []string) (bool, []string) {
+	requested := false
+	newArgs := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "--"+debugFlag || arg == "-"+debugFlag {
+			requested = true
+			continue
+		}
+		newArgs = append(newArgs, arg)
+	}
+	return requested, newArgs
+}
+
+// resolvedFlag is a flag generated by the flag loader, with its value after loading
+type resolvedFlag struct {
+	name  string
+	kind  reflect.Kind
+	value any
+}
+
+// resolveFlags lists the flags the flag loader generates for s, with their current values
+// It follows the naming rules of multiconfig.FlagLoader
+func resolveFlags(s any, loader *multiconfig.FlagLoader) []resolvedFlag {
+	separator := loader.StructSeparator
+	if separator == "" {
+		separator = "-"
+	}
+
+	var result []resolvedFlag
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		if prefix != "" {
+			prefix += separator
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Name
+			if loader.CamelCase {
+				name = strings.Join(camelcase.Split(name), "-")
+			}
+			if field.Type.Kind() == reflect.Struct {
+				walk(prefix+name, v.Field(i))
+				continue
+			}
+			result = append(result, resolvedFlag{strings.ToLower(prefix + name), field.Type.Kind(), v.Field(i).Interface()})
+		}
+	}
+	walk(loader.Prefix, reflect.Indirect(reflect.ValueOf(s)))
+	return result
+}
+
+// argFlagNames returns the names of the flags present in args
+func argFlagNames(args []string) map[string]bool {
+	names := map[string]bool{}
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		names[name] = true
+	}
+	return names
+}
+
+// writeDebug writes the args of the flag loader and the flags resolved from s to w
+// Flags passed in args are marked as set, flags in args which the loader doesn't generate as unknown
+func writeDebug(w io.Writer, s any, loader *multiconfig.FlagLoader) {
+	fmt.Fprintf(w, "config: flag loader args: %q\n", loader.Args)
+
+	set := argFlagNames(loader.Args)
+	fmt.Fprintln(w, "config: resolved flags:")
+	for _, f := range resolveFlags(s, loader) {
+		suffix := ""
+		if set[f.name] {
+			suffix = " (set)"
+			delete(set, f.name)
+		}
+		fmt.Fprintf(w, "  --%s=%v%s\n", f.name, f.value, suffix)
+	}
+	for _, arg := range loader.Args {
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && set[name] {
+			fmt.Fprintf(w, "  --%s (unknown)\n", name)
+			delete(set, name)
+		}
+	}
+}
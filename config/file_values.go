@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// filePrefix marks a string value that must be replaced by the content of the file at the given path
+const filePrefix = "file://"
+
+// fromFileTag is the struct tag enabling the file:// indirection on a field, eg: `fromFile:"true"`
+const fromFileTag = "fromFile"
+
+// loadFileValues replaces the string values of s starting with file:// by the content of the file
+// at the path that follows, without its trailing newlines
+// This supports secrets mounted as files, eg: `--db.password=file:///run/secrets/db_password`
+// Only the fields tagged with `fromFile:"true"` are replaced, so legitimate file:// values, eg: a sqlite DSN, are kept
+// It walks nested structs, pointers to structs and slices of strings
+func loadFileValues(s any) error {
+	v := reflect.ValueOf(s)
+	return loadFileValuesInto(v, v.Elem().Type().Name(), false)
+}
+
+func loadFileValuesInto(v reflect.Value, namespace string, fromFile bool) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return loadFileValuesInto(v.Elem(), namespace, fromFile)
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			tagged := t.Field(i).Tag.Get(fromFileTag) == "true"
+			if err := loadFileValuesInto(v.Field(i), namespace+"."+t.Field(i).Name, tagged); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		for i := range v.Len() {
+			if err := loadFileValuesInto(v.Index(i), fmt.Sprintf("%s[%d]", namespace, i), fromFile); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		path, ok := strings.CutPrefix(v.String(), filePrefix)
+		if !fromFile || !ok || !v.CanSet() {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Configuration error: '%s' could not be read from file: %w", namespace, err)
+		}
+		v.SetString(strings.TrimRight(string(content), "\r\n"))
+	}
+	return nil
+}
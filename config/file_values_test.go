@@ -0,0 +1,61 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadFileValues(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "db_password")
+	assert.NoError(t, os.WriteFile(secret, []byte("s3cr3t\n"), 0o600))
+
+	type Database struct {
+		Password string `validate:"required" fromFile:"true"`
+		DSN      string
+	}
+	type Config struct {
+		Database Database
+		Token    *string  `fromFile:"true"`
+		Keys     []string `fromFile:"true"`
+		Plain    string   `default:"value"`
+	}
+
+	t.Run("Should load a value from the file of a file:// value, without its trailing newline", func(t *testing.T) {
+		t.Setenv("CONFIG_DATABASE_PASSWORD", "file://"+secret)
+
+		config := Config{}
+		if assert.NoError(t, Load(&config, []string{"conf", "--keys", "a,file://" + secret})) {
+			assert.Equal(t, "s3cr3t", config.Database.Password)
+			assert.Equal(t, []string{"a", "s3cr3t"}, config.Keys)
+			assert.Equal(t, "value", config.Plain)
+		}
+	})
+
+	t.Run("Should return an error when the file is missing", func(t *testing.T) {
+		missing := filepath.Join(dir, "missing")
+
+		config := Config{}
+		err := Load(&config, []string{"conf", "--database.password", "file://" + missing})
+		assert.ErrorContains(t, err, "Configuration error: 'Config.Database.Password' could not be read from file: open "+missing)
+	})
+
+	t.Run("Should load values behind pointers", func(t *testing.T) {
+		token := "file://" + secret
+		config := Config{Token: &token}
+		assert.NoError(t, loadFileValues(&config))
+		assert.Equal(t, "s3cr3t", *config.Token)
+	})
+
+	t.Run("Should leave the file:// values of the untagged fields untouched", func(t *testing.T) {
+		config := Config{}
+		args := []string{"conf", "--database.password", "pass", "--database.dsn", "file:///var/lib/app.db?_pragma=foreign_keys(1)", "--plain", "file://" + secret}
+		if assert.NoError(t, Load(&config, args)) {
+			assert.Equal(t, "file:///var/lib/app.db?_pragma=foreign_keys(1)", config.Database.DSN)
+			assert.Equal(t, "file://"+secret, config.Plain)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/exoscale/multiconfig"
+)
+
+// WithStrictFlags checks the flags before loading, and returns an error naming the closest known flag
+// when one of them doesn't match any option, eg: "unknown flag --endpint, did you mean --endpoint?"
+// It also returns an error when a flag follows a positional argument: the flag package stops parsing at the
+// first positional argument, so these flags would otherwise be silently ignored
+func WithStrictFlags() Option {
+	return func(conf *loaderConfig) {
+		conf.strictFlags = true
+	}
+}
+
+// checkStrictFlags returns an error for the first flag of the args of the flag loader which doesn't match any option of s,
+// or which follows a positional argument
+// Bool flags don't take the next argument as their value: in "--enabled foo", foo is a positional argument
+func checkStrictFlags(s any, loader *multiconfig.FlagLoader) error {
+	flags := map[string]reflect.Kind{}
+	for _, f := range resolveFlags(s, loader) {
+		flags[f.name] = f.kind
+	}
+
+	positional := ""
+	for i := 0; i < len(loader.Args); i++ {
+		arg := loader.Args[i]
+		if arg == "--" {
+			return nil
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if positional == "" {
+				positional = arg
+			}
+			continue
+		}
+		if positional != "" {
+			return fmt.Errorf("flag %s follows the positional argument %q and would be ignored", arg, positional)
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name == "h" || name == "help" {
+			continue
+		}
+		kind, known := flags[name]
+		if !known {
+			if closest := closestFlag(name, flags); closest != "" {
+				return fmt.Errorf("unknown flag --%s, did you mean --%s?", name, closest)
+			}
+			return fmt.Errorf("unknown flag --%s", name)
+		}
+		if !hasValue && kind != reflect.Bool {
+			// Skip the value of the flag
+			i++
+		}
+	}
+	return nil
+}
+
+// closestFlag returns the known flag with the smallest edit distance to name,
+// or the empty string when none is close enough to be a typo
+func closestFlag(name string, flags map[string]reflect.Kind) string {
+	closest := ""
+	best := len(name)/2 + 1
+	for flag := range flags {
+		d := levenshtein(name, flag)
+		if d < best || (d == best && closest != "" && flag < closest) {
+			closest, best = flag, d
+		}
+	}
+	return closest
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithStrictFlags(t *testing.T) {
+	type Config struct {
+		Endpoint string
+		Enabled  bool
+		Nested   struct {
+			RootCAFile string
+		}
+	}
+
+	t.Run("Should name the closest known flag", func(t *testing.T) {
+		config := Config{}
+		err := Load(&config, []string{"conf", "--endpint=localhost"}, WithStrictFlags())
+		assert.EqualError(t, err, "unknown flag --endpint, did you mean --endpoint?")
+
+		err = Load(&config, []string{"conf", "--nested-root-ca-file", "ca.pem"}, WithStrictFlags())
+		assert.EqualError(t, err, "unknown flag --nested-root-ca-file, did you mean --nested.root-ca-file?")
+	})
+
+	t.Run("Should not suggest unrelated flags", func(t *testing.T) {
+		config := Config{}
+		err := Load(&config, []string{"conf", "--verbose"}, WithStrictFlags())
+		assert.EqualError(t, err, "unknown flag --verbose")
+	})
+
+	t.Run("Should return an error when a flag follows a positional argument", func(t *testing.T) {
+		config := Config{}
+		err := Load(&config, []string{"conf", "--enabled", "migrate", "--endpoint", "localhost"}, WithStrictFlags())
+		assert.EqualError(t, err, `flag --endpoint follows the positional argument "migrate" and would be ignored`)
+	})
+
+	t.Run("Should accept the known flags", func(t *testing.T) {
+		config := Config{}
+		args := []string{"conf", "--enabled", "--endpoint", "localhost", "--no-enabled", "--nested.root-ca-file=ca.pem"}
+		if assert.NoError(t, Load(&config, args, WithStrictFlags())) {
+			assert.Equal(t, "localhost", config.Endpoint)
+			assert.False(t, config.Enabled)
+			assert.Equal(t, "ca.pem", config.Nested.RootCAFile)
+		}
+	})
+}
+
+func TestLevenshtein(t *testing.T) {
+	assert.Equal(t, 0, levenshtein("endpoint", "endpoint"))
+	assert.Equal(t, 1, levenshtein("endpint", "endpoint"))
+	assert.Equal(t, 3, levenshtein("kitten", "sitting"))
+	assert.Equal(t, 4, levenshtein("", "port"))
+}
@@ -3,6 +3,7 @@ package fxauthorizer
 import (
 	"github.com/exoscale/stelling/fxauthorizer/interceptor"
 	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/exoscale/stelling/fxlogging/summary"
 	"go.uber.org/fx"
 )
 
@@ -27,6 +28,7 @@ func NewModule(conf AuthorizerConfig) fx.Option {
 			fx.Annotate(conf, fx.As(new(AuthorizerConfig))),
 			fx.Private,
 		),
+		summary.Provide("authorizer", nil),
 	)
 }
 
@@ -53,7 +55,7 @@ func NewAuthorizer(conf AuthorizerConfig) (interceptor.Authorizer, error) {
 const GrpcInterceptorWeight uint = 70
 
 func NewGrpcAuthorizerServerInterceptors(a interceptor.Authorizer) (*fxgrpc.UnaryServerInterceptor, *fxgrpc.StreamServerInterceptor) {
-	unaryIx := &fxgrpc.UnaryServerInterceptor{Weight: GrpcInterceptorWeight, Interceptor: interceptor.NewAuthorizerUnaryServerInterceptor(a)}
-	streamIx := &fxgrpc.StreamServerInterceptor{Weight: GrpcInterceptorWeight, Interceptor: interceptor.NewAuthorizerStreamServerInterceptor(a)}
+	unaryIx := &fxgrpc.UnaryServerInterceptor{Name: "authorizer", Weight: GrpcInterceptorWeight, Interceptor: interceptor.NewAuthorizerUnaryServerInterceptor(a)}
+	streamIx := &fxgrpc.StreamServerInterceptor{Name: "authorizer", Weight: GrpcInterceptorWeight, Interceptor: interceptor.NewAuthorizerStreamServerInterceptor(a)}
 	return unaryIx, streamIx
 }
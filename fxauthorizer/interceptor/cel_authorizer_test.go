@@ -7,6 +7,7 @@ import (
 	"crypto/x509/pkix"
 	"errors"
 	"math/big"
+	"net/url"
 	"testing"
 
 	"github.com/coreos/go-oidc/v3/oidc"
@@ -165,6 +166,18 @@ func makeCert(tb testing.TB, name string) *x509.Certificate {
 	}
 }
 
+func makeSpiffeCert(tb testing.TB, uris ...string) *x509.Certificate {
+	tb.Helper()
+
+	cert := makeCert(tb, "workload")
+	for _, u := range uris {
+		parsed, err := url.Parse(u)
+		require.NoError(tb, err)
+		cert.URIs = append(cert.URIs, parsed)
+	}
+	return cert
+}
+
 func TestCelAuthorizerCheck(t *testing.T) {
 	cases := []struct {
 		name         string
@@ -219,6 +232,38 @@ func TestCelAuthorizerCheck(t *testing.T) {
 			expected: false,
 			theError: "policy denied",
 		},
+		// SPIFFE based attribute tests
+		{
+			name:     "Should allow if the spiffe id matches",
+			rule:     "request.tls.spiffe_id == \"spiffe://td/ns/prod/sa/api\"",
+			service:  "MyService",
+			tls:      makeSpiffeCert(t, "https://example.com", "spiffe://td/ns/prod/sa/api"),
+			expected: true,
+		},
+		{
+			name:     "Should deny if the spiffe id does not match",
+			rule:     "request.tls.spiffe_id == \"spiffe://td/ns/prod/sa/api\"",
+			service:  "MyService",
+			tls:      makeSpiffeCert(t, "spiffe://td/ns/dev/sa/api"),
+			expected: false,
+			theError: "policy denied",
+		},
+		{
+			name:     "Should deny if the certificate has no spiffe id",
+			rule:     "request.tls.spiffe_id == \"spiffe://td/ns/prod/sa/api\"",
+			service:  "MyService",
+			tls:      makeSpiffeCert(t, "https://example.com"),
+			expected: false,
+			theError: "policy denied",
+		},
+		{
+			name:     "Should deny if the certificate has multiple spiffe ids",
+			rule:     "request.tls.spiffe_id == \"spiffe://td/ns/prod/sa/api\"",
+			service:  "MyService",
+			tls:      makeSpiffeCert(t, "spiffe://td/ns/prod/sa/api", "spiffe://td/ns/prod/sa/other"),
+			expected: false,
+			theError: "policy denied",
+		},
 		// Metadata/header based attribute tests
 		{
 			name:     "Should allow if metadata expression matches",
@@ -48,6 +48,7 @@ func NewTLS(cert *x509.Certificate) *TLS {
 		EmailAddresses: cert.EmailAddresses,
 		IpAddresses:    ipaddresses(cert.IPAddresses),
 		Uris:           uris(cert.URIs),
+		SpiffeId:       spiffeID(cert.URIs),
 	}
 }
 
@@ -84,3 +85,19 @@ func uris(input []*url.URL) []string {
 
 	return output
 }
+
+// spiffeID returns the SPIFFE ID of an X509-SVID
+// An SVID must contain exactly one spiffe URI SAN, so it returns an empty string otherwise
+func spiffeID(input []*url.URL) string {
+	id := ""
+	for _, u := range input {
+		if u.Scheme != "spiffe" {
+			continue
+		}
+		if id != "" {
+			return ""
+		}
+		id = u.String()
+	}
+	return id
+}
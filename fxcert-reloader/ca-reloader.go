@@ -0,0 +1,233 @@
+package fxcert_reloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/exoscale/stelling/fxmetrics/reloads"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultCAReloadInterval is the time between 2 CA bundle reloads used by the stelling modules
+// It is also used when a CAReloaderConfig does not set a ReloadInterval
+const DefaultCAReloadInterval = 1 * time.Minute
+
+type CAReloaderConfig struct {
+	// Path is a pem encoded CA bundle, or a directory of pem encoded CA bundles
+	Path string
+	// The time between 2 reloads
+	// Defaults to DefaultCAReloadInterval when unset
+	ReloadInterval time.Duration `default:"1m"`
+}
+
+func (c *CAReloaderConfig) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if c == nil {
+		return nil
+	}
+
+	enc.AddString("path", c.Path)
+	enc.AddDuration("reload-interval", c.ReloadInterval)
+
+	return nil
+}
+
+// readCABundle returns the content of the pem file at path, or the concatenated content
+// of all regular files in the directory at path, in lexical order
+func readCABundle(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return os.ReadFile(path)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var bundle bytes.Buffer
+	for _, e := range entries {
+		// Skip directories and hidden files, such as the ..data links created by kubernetes
+		if (!e.Type().IsRegular() && e.Type()&os.ModeSymlink == 0) || e.Name()[0] == '.' {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(path, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		bundle.Write(content)
+		bundle.WriteString("\n")
+	}
+	return bundle.Bytes(), nil
+}
+
+// LoadCertPool loads a pem encoded CA bundle, or all the pem encoded CA bundles in a directory
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	bundle, err := readCABundle(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if ok := pool.AppendCertsFromPEM(bundle); !ok {
+		return nil, fmt.Errorf("failed to parse CA bundle: %s", path)
+	}
+	return pool, nil
+}
+
+// CAReloader periodically reloads a CA bundle from a file or directory
+// The reloader must be explicitly started and stopped
+// It is meant to be used with MakeServerTLS and the WithClientCAReloader option
+type CAReloader struct {
+	pool   *x509.CertPool
+	digest [sha256.Size]byte
+	conf   *CAReloaderConfig
+	logger *zap.Logger
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+	sync.RWMutex
+}
+
+// NewCAReloader returns a CAReloader for the bundle at conf.Path
+// This function will try to eagerly load the bundle and will error out if that fails
+func NewCAReloader(conf *CAReloaderConfig, logger *zap.Logger) (*CAReloader, error) {
+	if conf.ReloadInterval <= 0 {
+		withDefault := *conf
+		withDefault.ReloadInterval = DefaultCAReloadInterval
+		conf = &withDefault
+	}
+	r := &CAReloader{
+		conf:   conf,
+		logger: logger.With(zap.Object("ca", conf)),
+	}
+	r.logger.Info("Loading CA bundle")
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Pool returns the currently loaded CA pool
+// If reloading fails, this method will return the last valid pool
+func (r *CAReloader) Pool() *x509.CertPool {
+	r.RLock()
+	defer r.RUnlock()
+	return r.pool
+}
+
+// Reload loads the bundle from disk and replaces the current pool if it changed
+// Each reload is counted by the config_reloads_total metric, with the "ca" component
+func (r *CAReloader) Reload() error {
+	err := r.load()
+	reloads.Observe("ca", err)
+	return err
+}
+
+func (r *CAReloader) load() error {
+	bundle, err := readCABundle(r.conf.Path)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(bundle)
+
+	r.RLock()
+	unchanged := r.pool != nil && digest == r.digest
+	r.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	pool := x509.NewCertPool()
+	if ok := pool.AppendCertsFromPEM(bundle); !ok {
+		return fmt.Errorf("failed to parse CA bundle: %s", r.conf.Path)
+	}
+
+	r.Lock()
+	if r.pool != nil {
+		r.logger.Info("CA bundle changed")
+	}
+	r.pool = pool
+	r.digest = digest
+	r.Unlock()
+	return nil
+}
+
+// Start spawns a go routine that periodically reloads the bundle
+func (r *CAReloader) Start(ctx context.Context) error {
+	r.logger.Info("Starting CA reloader")
+
+	progCtx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.wg.Add(1)
+	go func() {
+		ticker := time.NewTicker(r.conf.ReloadInterval)
+		defer ticker.Stop()
+		defer r.wg.Done()
+		for {
+			select {
+			case <-progCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := r.Reload(); err != nil {
+				// We are assuming the error is transient and will try to
+				// reload on the next tick
+				r.logger.Error("Failed to reload CA bundle", zap.Error(err))
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops the reloader and cleans up any resources
+func (r *CAReloader) Stop(ctx context.Context) error {
+	r.logger.Info("Stopping CA reloader")
+	r.cancel()
+	r.wg.Wait()
+	return nil
+}
+
+func ProvideCAReloader(lc fx.Lifecycle, conf *CAReloaderConfig, logger *zap.Logger) (*CAReloader, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	reloader, err := NewCAReloader(conf, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: reloader.Start,
+		OnStop:  reloader.Stop,
+	})
+
+	return reloader, nil
+}
+
+// WithClientCAReloader makes the server require and verify client certificates against the current pool of the reloader
+// New CAs take effect for new connections without a restart
+func WithClientCAReloader(r *CAReloader) ServerTLSOption {
+	return func(c *tls.Config) {
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+		c.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			conf := c.Clone()
+			conf.GetConfigForClient = nil
+			conf.ClientCAs = r.Pool()
+			return conf, nil
+		}
+	}
+}
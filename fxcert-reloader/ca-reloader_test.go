@@ -0,0 +1,170 @@
+package fxcert_reloader
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return &testCA{cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a keypair signed by the CA
+func (ca *testCA) issue(t *testing.T, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestLoadCertPool(t *testing.T) {
+	ca1, ca2 := newTestCA(t, "ca1"), newTestCA(t, "ca2")
+
+	t.Run("Should load all the bundles in a directory", func(t *testing.T) {
+		dir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "ca1.pem"), ca1.pem, 0o600))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "ca2.pem"), ca2.pem, 0o600))
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, "nested"), 0o700))
+
+		pool, err := LoadCertPool(dir)
+		assert.NoError(t, err)
+		expected := x509.NewCertPool()
+		expected.AddCert(ca1.cert)
+		expected.AddCert(ca2.cert)
+		assert.True(t, expected.Equal(pool))
+	})
+
+	t.Run("Should ignore hidden files", func(t *testing.T) {
+		dir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "ca1.pem"), ca1.pem, 0o600))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, ".ca2.pem"), ca2.pem, 0o600))
+
+		pool, err := LoadCertPool(dir)
+		assert.NoError(t, err)
+		expected := x509.NewCertPool()
+		expected.AddCert(ca1.cert)
+		assert.True(t, expected.Equal(pool))
+	})
+
+	t.Run("Should return an error if the bundle contains no certificate", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := LoadCertPool(dir)
+		assert.Error(t, err)
+	})
+}
+
+func TestCAReloader(t *testing.T) {
+	ca1, ca2 := newTestCA(t, "ca1"), newTestCA(t, "ca2")
+	serverCert := ca1.issue(t, x509.ExtKeyUsageServerAuth)
+	clientCert := ca2.issue(t, x509.ExtKeyUsageClientAuth)
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ca1.pem"), ca1.pem, 0o600))
+
+	r, err := NewCAReloader(&CAReloaderConfig{Path: dir, ReloadInterval: time.Hour}, zaptest.NewLogger(t))
+	assert.NoError(t, err)
+
+	tlsConf, err := MakeServerTLS(&CertReloader{cert: &serverCert}, "", WithClientCAReloader(r))
+	assert.NoError(t, err)
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", tlsConf)
+	assert.NoError(t, err)
+	t.Cleanup(func() { lis.Close() }) //nolint:errcheck
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()           //nolint:errcheck
+				conn.(*tls.Conn).Handshake() //nolint:errcheck
+				conn.Write([]byte("ok"))     //nolint:errcheck
+			}()
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca1.cert)
+	dial := func() error {
+		conn, err := tls.Dial("tcp", lis.Addr().String(), &tls.Config{
+			RootCAs:      roots,
+			Certificates: []tls.Certificate{clientCert},
+		})
+		if err != nil {
+			return err
+		}
+		defer conn.Close() //nolint:errcheck
+		// With TLS 1.3 the client certificate is only verified after the client handshake completed
+		_, err = conn.Read(make([]byte, 2))
+		return err
+	}
+
+	t.Run("Should reject a client signed by an unknown CA", func(t *testing.T) {
+		assert.Error(t, dial())
+	})
+
+	t.Run("Should accept the client once its CA is added to the directory", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "ca2.pem"), ca2.pem, 0o600))
+		assert.NoError(t, r.Reload())
+		assert.NoError(t, dial())
+	})
+
+	t.Run("Should use the default reload interval when unset", func(t *testing.T) {
+		conf := &CAReloaderConfig{Path: dir}
+		r, err := NewCAReloader(conf, zaptest.NewLogger(t))
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultCAReloadInterval, r.conf.ReloadInterval)
+		assert.Zero(t, conf.ReloadInterval)
+
+		assert.NoError(t, r.Start(context.Background()))
+		assert.NoError(t, r.Stop(context.Background()))
+	})
+}
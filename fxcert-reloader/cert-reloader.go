@@ -4,24 +4,32 @@ package fxcert_reloader
 import (
 	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"fmt"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/exoscale/stelling/fxmetrics/reloads"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
+// DefaultReloadInterval is the time between 2 certificate reloads used by the stelling modules
+// It is also used when a CertReloaderConfig does not set a ReloadInterval
+const DefaultReloadInterval = 1 * time.Hour
+
 type CertReloaderConfig struct {
 	// CertFile is the path to a pem encoded certificate
 	CertFile string
 	// KeyFile is the path to a pem encoded private key
 	KeyFile string
 	// The time minimum time between 2 reloads
+	// Defaults to DefaultReloadInterval when unset
 	ReloadInterval time.Duration `default:"1h"`
+	// PollInterval is the time between 2 checks of the modification time of the files
+	// When it is set, the KeyPair is also reloaded as soon as a change is detected
+	PollInterval time.Duration
 }
 
 func (c *CertReloaderConfig) MarshalLogObject(enc zapcore.ObjectEncoder) error {
@@ -32,6 +40,9 @@ func (c *CertReloaderConfig) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	enc.AddString("cert-file", c.CertFile)
 	enc.AddString("key-file", c.KeyFile)
 	enc.AddDuration("reload-interval", c.ReloadInterval)
+	if c.PollInterval > 0 {
+		enc.AddDuration("poll-interval", c.PollInterval)
+	}
 
 	return nil
 }
@@ -40,11 +51,12 @@ func (c *CertReloaderConfig) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 // The reloader must be explicitly started and stopped
 // The GetCertificate() method can be used in a tls.Config
 type CertReloader struct {
-	cert   *tls.Certificate
-	conf   *CertReloaderConfig
-	logger *zap.Logger
-	wg     sync.WaitGroup
-	cancel context.CancelFunc
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+	conf     *CertReloaderConfig
+	logger   *zap.Logger
+	wg       sync.WaitGroup
+	cancel   context.CancelFunc
 	sync.RWMutex
 }
 
@@ -75,24 +87,28 @@ func (c *CertReloader) Start(ctx context.Context) error {
 	go func() {
 		ticker := time.NewTicker(c.conf.ReloadInterval)
 		defer ticker.Stop()
+		// A nil channel blocks forever: polling is disabled unless configured
+		var poll <-chan time.Time
+		if c.conf.PollInterval > 0 {
+			pollTicker := time.NewTicker(c.conf.PollInterval)
+			defer pollTicker.Stop()
+			poll = pollTicker.C
+		}
 		defer c.wg.Done()
 		for {
 			select {
 			case <-progCtx.Done():
 				return
 			case <-ticker.C:
+			case <-poll:
+				if !c.changed() {
+					continue
+				}
 			}
-			c.logger.Info("Reloading certificate")
-			cert, err := tls.LoadX509KeyPair(c.conf.CertFile, c.conf.KeyFile)
-			if err != nil {
+			if err := c.Reload(); err != nil {
 				// We are assuming the error is transient and will try to
 				// reload on the next tick
-				// TODO: expose a count of this as metric?
 				c.logger.Error("Failed to reload certificate", zap.Error(err))
-			} else {
-				c.Lock()
-				c.cert = &cert
-				c.Unlock()
 			}
 		}
 	}()
@@ -100,6 +116,51 @@ func (c *CertReloader) Start(ctx context.Context) error {
 	return nil
 }
 
+// Reload loads the KeyPair from disk and replaces the current one
+// It is called periodically once the reloader is started, but can also be called
+// directly to pick up a rotation without waiting for the next tick
+// If loading fails, the current KeyPair is kept
+// Each reload is counted by the config_reloads_total metric, with the "cert" component
+func (c *CertReloader) Reload() error {
+	c.logger.Info("Reloading certificate")
+	// The modification times are read first, so a change made while loading is picked up by the next poll
+	modTimes, _ := keyPairModTimes(c.conf)
+	cert, err := tls.LoadX509KeyPair(c.conf.CertFile, c.conf.KeyFile)
+	reloads.Observe("cert", err)
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	c.cert = &cert
+	c.modTimes = modTimes
+	c.Unlock()
+	return nil
+}
+
+// changed returns true if the modification time of the cert or key file differs from the loaded KeyPair
+func (c *CertReloader) changed() bool {
+	modTimes, err := keyPairModTimes(c.conf)
+	if err != nil {
+		// The files may be in the middle of a rotation: the next poll will tell
+		return false
+	}
+	c.RLock()
+	defer c.RUnlock()
+	return modTimes != c.modTimes
+}
+
+func keyPairModTimes(conf *CertReloaderConfig) ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, f := range []string{conf.CertFile, conf.KeyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
 // Stop stops the reloader and cleans up any resources
 func (c *CertReloader) Stop(ctx context.Context) error {
 	c.logger.Info("Stopping reloader")
@@ -111,18 +172,25 @@ func (c *CertReloader) Stop(ctx context.Context) error {
 // NewCertReloader returns a CertReloader for a KeyPair
 // This function will try to eagerly load the KeyPair and will error out if that fails
 func NewCertReloader(conf *CertReloaderConfig, logger *zap.Logger) (*CertReloader, error) {
+	if conf.ReloadInterval <= 0 {
+		withDefault := *conf
+		withDefault.ReloadInterval = DefaultReloadInterval
+		conf = &withDefault
+	}
 	logger = logger.With(zap.Object("cert", conf))
 
 	logger.Info("Loading certificate")
+	modTimes, _ := keyPairModTimes(conf)
 	cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
 	if err != nil {
 		return nil, err
 	}
 
 	return &CertReloader{
-		cert:   &cert,
-		conf:   conf,
-		logger: logger,
+		cert:     &cert,
+		modTimes: modTimes,
+		conf:     conf,
+		logger:   logger,
 	}, nil
 }
 
@@ -143,22 +211,102 @@ func ProvideCertReloader(lc fx.Lifecycle, conf *CertReloaderConfig, logger *zap.
 	return reloader, nil
 }
 
+// ServerTLSOption customizes the *tls.Config produced by MakeServerTLS
+type ServerTLSOption func(*tls.Config)
+
+// WithMinVersion sets the minimum TLS version accepted by the server
+func WithMinVersion(version uint16) ServerTLSOption {
+	return func(c *tls.Config) {
+		c.MinVersion = version
+	}
+}
+
+// WithCipherSuites restricts the cipher suites accepted by the server
+// Note that the TLS 1.3 cipher suites are not configurable
+func WithCipherSuites(suites []uint16) ServerTLSOption {
+	return func(c *tls.Config) {
+		c.CipherSuites = suites
+	}
+}
+
+// WithNextProtos sets the application protocols the server supports, in order of preference, for ALPN negotiation
+func WithNextProtos(protos []string) ServerTLSOption {
+	return func(c *tls.Config) {
+		c.NextProtos = protos
+	}
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion converts a version such as "1.2" to its crypto/tls constant
+func ParseTLSVersion(version string) (uint16, error) {
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version: %s", version)
+	}
+	return v, nil
+}
+
+// ParseCipherSuites converts cipher suite names such as TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 to their crypto/tls constants
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	known := map[string]uint16{}
+	for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[s.Name] = s.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS cipher suite: %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ServerTLSOptions returns the options for MakeServerTLS matching the given configuration
+// Empty values keep the crypto/tls defaults
+func ServerTLSOptions(minVersion string, cipherSuites []string) ([]ServerTLSOption, error) {
+	opts := []ServerTLSOption{}
+	if minVersion != "" {
+		v, err := ParseTLSVersion(minVersion)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithMinVersion(v))
+	}
+	if len(cipherSuites) > 0 {
+		ids, err := ParseCipherSuites(cipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithCipherSuites(ids))
+	}
+	return opts, nil
+}
+
 // MakeServerTLS produces a *tls.Config using a cert reloader and additional config
-// TODO: expose more TLS options?
-func MakeServerTLS(r *CertReloader, clientCAFile string) (*tls.Config, error) {
+// The clientCAFile can be a pem encoded CA bundle or a directory of bundles, which are loaded once
+// Use the WithClientCAReloader option instead to pick up changes to the client CAs
+func MakeServerTLS(r *CertReloader, clientCAFile string, opts ...ServerTLSOption) (*tls.Config, error) {
 	tlsConf := &tls.Config{
 		GetCertificate: r.GetCertificate,
 	}
+	for _, o := range opts {
+		o(tlsConf)
+	}
 
 	if clientCAFile != "" {
-		certPool := x509.NewCertPool()
-		ca, err := os.ReadFile(clientCAFile)
+		certPool, err := LoadCertPool(clientCAFile)
 		if err != nil {
 			return nil, err
 		}
-		if ok := certPool.AppendCertsFromPEM(ca); !ok {
-			return nil, fmt.Errorf("failed to parse ClientCAFile: %s", clientCAFile)
-		}
 		tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
 		tlsConf.ClientCAs = certPool
 	}
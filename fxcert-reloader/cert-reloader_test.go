@@ -2,11 +2,15 @@ package fxcert_reloader
 
 import (
 	"context"
+	"crypto/tls"
 	"crypto/x509"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/exoscale/stelling/fxmetrics/reloads"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -331,3 +335,150 @@ func TestCertReloader(t *testing.T) {
 		assert.NotEmpty(t, logs.FilterMessage("Failed to reload certificate"))
 	})
 }
+
+func TestCertReloaderReload(t *testing.T) {
+	writeFiles := func(t *testing.T, dir, cert, key string) (string, string) {
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		assert.NoError(t, os.WriteFile(certFile, []byte(cert), 0o600))
+		assert.NoError(t, os.WriteFile(keyFile, []byte(key), 0o600))
+		return certFile, keyFile
+	}
+	commonName := func(t *testing.T, r *CertReloader) string {
+		cert, err := r.GetCertificate(nil)
+		assert.NoError(t, err)
+		pCert, err := x509.ParseCertificate(cert.Certificate[0])
+		assert.NoError(t, err)
+		return pCert.Subject.CommonName
+	}
+
+	t.Run("Should reload the cert on demand without waiting for the next tick", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeFiles(t, dir, certFile1, keyFile1)
+		reloader, err := NewCertReloader(&CertReloaderConfig{CertFile: certFile, KeyFile: keyFile, ReloadInterval: time.Hour}, zaptest.NewLogger(t))
+		assert.NoError(t, err)
+		assert.NoError(t, reloader.Start(context.Background()))
+		defer reloader.Stop(context.Background()) //nolint:errcheck
+		assert.Equal(t, "warp-agent", commonName(t, reloader))
+
+		writeFiles(t, dir, certFile2, keyFile2)
+		assert.NoError(t, reloader.Reload())
+		assert.Equal(t, "server2.example.net", commonName(t, reloader))
+	})
+
+	t.Run("Should keep the current cert if reloading on demand fails", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeFiles(t, dir, certFile1, keyFile1)
+		reloader, err := NewCertReloader(&CertReloaderConfig{CertFile: certFile, KeyFile: keyFile, ReloadInterval: time.Hour}, zaptest.NewLogger(t))
+		assert.NoError(t, err)
+
+		writeFiles(t, dir, "foobar", keyFile2)
+		assert.Error(t, reloader.Reload())
+		assert.Equal(t, "warp-agent", commonName(t, reloader))
+	})
+
+	t.Run("Should count the failed reloads", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeFiles(t, dir, certFile1, keyFile1)
+		reloader, err := NewCertReloader(&CertReloaderConfig{CertFile: certFile, KeyFile: keyFile, ReloadInterval: time.Hour}, zaptest.NewLogger(t))
+		assert.NoError(t, err)
+		failures := reloadsValue(t, "cert", reloads.OutcomeFailure)
+		successes := reloadsValue(t, "cert", reloads.OutcomeSuccess)
+
+		writeFiles(t, dir, "foobar", keyFile2)
+		assert.Error(t, reloader.Reload())
+		assert.Equal(t, failures+1, reloadsValue(t, "cert", reloads.OutcomeFailure))
+		assert.Equal(t, successes, reloadsValue(t, "cert", reloads.OutcomeSuccess))
+	})
+
+	t.Run("Should reload the cert when polling detects a change of modification time", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeFiles(t, dir, certFile1, keyFile1)
+		conf := &CertReloaderConfig{CertFile: certFile, KeyFile: keyFile, ReloadInterval: time.Hour, PollInterval: 10 * time.Millisecond}
+		reloader, err := NewCertReloader(conf, zaptest.NewLogger(t))
+		assert.NoError(t, err)
+		assert.NoError(t, reloader.Start(context.Background()))
+		defer reloader.Stop(context.Background()) //nolint:errcheck
+
+		// The periodic reload is an hour away: only polling can pick up the change
+		writeFiles(t, dir, certFile2, keyFile2)
+		future := time.Now().Add(time.Minute)
+		assert.NoError(t, os.Chtimes(certFile, future, future))
+		assert.Eventually(t, func() bool { return commonName(t, reloader) == "server2.example.net" }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Should not reload the cert when the modification times are unchanged", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeFiles(t, dir, certFile1, keyFile1)
+		past := time.Now().Add(-time.Minute)
+		assert.NoError(t, os.Chtimes(certFile, past, past))
+		assert.NoError(t, os.Chtimes(keyFile, past, past))
+		conf := &CertReloaderConfig{CertFile: certFile, KeyFile: keyFile, ReloadInterval: time.Hour, PollInterval: 10 * time.Millisecond}
+		reloader, err := NewCertReloader(conf, zaptest.NewLogger(t))
+		assert.NoError(t, err)
+		assert.NoError(t, reloader.Start(context.Background()))
+		defer reloader.Stop(context.Background()) //nolint:errcheck
+
+		writeFiles(t, dir, certFile2, keyFile2)
+		assert.NoError(t, os.Chtimes(certFile, past, past))
+		assert.NoError(t, os.Chtimes(keyFile, past, past))
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, "warp-agent", commonName(t, reloader))
+	})
+
+	t.Run("Should use the default reload interval when unset", func(t *testing.T) {
+		certFile, keyFile := writeFiles(t, t.TempDir(), certFile1, keyFile1)
+		conf := &CertReloaderConfig{CertFile: certFile, KeyFile: keyFile}
+		reloader, err := NewCertReloader(conf, zaptest.NewLogger(t))
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultReloadInterval, reloader.conf.ReloadInterval)
+		assert.Zero(t, conf.ReloadInterval)
+
+		assert.NoError(t, reloader.Start(context.Background()))
+		assert.NoError(t, reloader.Stop(context.Background()))
+	})
+}
+
+// reloadsValue returns the value of the config_reloads_total counter for the given labels
+func reloadsValue(t *testing.T, component, outcome string) float64 {
+	m := &dto.Metric{}
+	assert.NoError(t, reloads.Total.WithLabelValues(component, outcome).Write(m))
+	return m.GetCounter().GetValue()
+}
+
+func TestMakeServerTLS(t *testing.T) {
+	t.Run("Should keep the crypto/tls defaults without options", func(t *testing.T) {
+		opts, err := ServerTLSOptions("", nil)
+		assert.NoError(t, err)
+
+		conf, err := MakeServerTLS(&CertReloader{}, "", opts...)
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(0), conf.MinVersion)
+		assert.Nil(t, conf.CipherSuites)
+	})
+
+	t.Run("Should apply the configured min version and cipher suites", func(t *testing.T) {
+		opts, err := ServerTLSOptions("1.3", []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"})
+		assert.NoError(t, err)
+
+		conf, err := MakeServerTLS(&CertReloader{}, "", opts...)
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(tls.VersionTLS13), conf.MinVersion)
+		assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}, conf.CipherSuites)
+	})
+
+	t.Run("Should apply the configured ALPN protocols", func(t *testing.T) {
+		conf, err := MakeServerTLS(&CertReloader{}, "", WithNextProtos([]string{"h2", "acme-tls/1"}))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"h2", "acme-tls/1"}, conf.NextProtos)
+	})
+
+	t.Run("Should reject unknown versions", func(t *testing.T) {
+		_, err := ServerTLSOptions("1.4", nil)
+		assert.ErrorContains(t, err, "unknown TLS version")
+	})
+
+	t.Run("Should reject unknown cipher suites", func(t *testing.T) {
+		_, err := ServerTLSOptions("", []string{"TLS_NOT_A_CIPHER"})
+		assert.ErrorContains(t, err, "unknown TLS cipher suite")
+	})
+}
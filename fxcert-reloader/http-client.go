@@ -0,0 +1,83 @@
+package fxcert_reloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// NewHTTPClient returns an *http.Client configured with the TLS settings of conf
+// When a CertFile is set, the returned CertReloader provides the client certificate:
+// it is not started, the caller is responsible for registering its lifecycle hooks
+func NewHTTPClient(conf ClientConfig, logger *zap.Logger) (*http.Client, *CertReloader, error) {
+	var r *CertReloader
+	if c := conf.ClientTLSConfig(); c.CertFile != "" {
+		var err error
+		r, err = NewCertReloader(&CertReloaderConfig{
+			CertFile:       c.CertFile,
+			KeyFile:        c.KeyFile,
+			ReloadInterval: DefaultReloadInterval,
+		}, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	client, err := MakeHTTPClient(conf, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, r, nil
+}
+
+// MakeHTTPClient returns an *http.Client configured with the TLS settings of conf
+// The client certificate is provided by r, when it is not nil
+func MakeHTTPClient(conf ClientConfig, r *CertReloader) (*http.Client, error) {
+	c := conf.ClientTLSConfig()
+	tlsConf := &tls.Config{
+		InsecureSkipVerify: c.InsecureConnection,
+	}
+	if r != nil {
+		tlsConf.GetClientCertificate = r.GetClientCertificate
+	}
+	if c.RootCAFile != "" {
+		certPool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, err
+		}
+		ca, err := os.ReadFile(c.RootCAFile)
+		if err != nil {
+			return nil, err
+		}
+		if ok := certPool.AppendCertsFromPEM(ca); !ok {
+			return nil, fmt.Errorf("failed to parse RootCAFile: %s", c.RootCAFile)
+		}
+		tlsConf.RootCAs = certPool
+	}
+
+	// The defaults mirror http.DefaultTransport, which can't be cloned safely as it may have been replaced
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConf,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   30 * time.Second,
+	}, nil
+}
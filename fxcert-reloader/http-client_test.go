@@ -0,0 +1,84 @@
+package fxcert_reloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+// writeCert writes cert as a pem encoded keypair in dir
+func writeCert(t *testing.T, dir, name string, cert tls.Certificate) (string, string) {
+	t.Helper()
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	assert.NoError(t, err)
+	certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600))
+	return certFile, keyFile
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, os.WriteFile(caFile, ca.pem, 0o600))
+	certFile, keyFile := writeCert(t, dir, "client", ca.issue(t, x509.ExtKeyUsageClientAuth))
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, x509.ExtKeyUsageServerAuth)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    x509.NewCertPool(),
+	}
+	server.TLS.ClientCAs.AddCert(ca.cert)
+	server.StartTLS()
+	defer server.Close()
+
+	t.Run("Should use the client certificate and root CA of the config", func(t *testing.T) {
+		conf := &ClientTLS{CertFile: certFile, KeyFile: keyFile, RootCAFile: caFile}
+		client, r, err := NewHTTPClient(conf, zaptest.NewLogger(t))
+		assert.NoError(t, err)
+		assert.NotNil(t, r)
+
+		tlsConf := client.Transport.(*http.Transport).TLSClientConfig
+		assert.False(t, tlsConf.InsecureSkipVerify)
+		assert.NotNil(t, tlsConf.GetClientCertificate)
+		assert.NotNil(t, tlsConf.RootCAs)
+		assert.NotZero(t, client.Timeout)
+
+		resp, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NoError(t, resp.Body.Close())
+	})
+
+	t.Run("Should not return a reloader without a client certificate", func(t *testing.T) {
+		client, r, err := NewHTTPClient(&ClientTLS{RootCAFile: caFile}, zaptest.NewLogger(t))
+		assert.NoError(t, err)
+		assert.Nil(t, r)
+		assert.Nil(t, client.Transport.(*http.Transport).TLSClientConfig.GetClientCertificate)
+
+		// The server requires a client certificate
+		_, err = client.Get(server.URL)
+		assert.Error(t, err)
+	})
+
+	t.Run("Should skip server validation for insecure connections", func(t *testing.T) {
+		client, _, err := NewHTTPClient(&ClientTLS{InsecureConnection: true}, zaptest.NewLogger(t))
+		assert.NoError(t, err)
+		assert.True(t, client.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
+	})
+
+	t.Run("Should return an error if the certificate can't be loaded", func(t *testing.T) {
+		_, _, err := NewHTTPClient(&ClientTLS{CertFile: caFile, KeyFile: filepath.Join(dir, "missing.pem")}, zaptest.NewLogger(t))
+		assert.Error(t, err)
+	})
+}
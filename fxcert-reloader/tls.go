@@ -0,0 +1,82 @@
+package fxcert_reloader
+
+import (
+	"go.uber.org/zap/zapcore"
+)
+
+// ClientTLS and ServerTLS are the reference definitions of the TLS settings of the stelling configs
+// The configs copy their fields and validation tags, rather than embedding them, because the
+// config loader would add a level to their flags and environment variables: eg: --client.client-tls.cert-file
+// Each config exposes its settings as a ClientTLS or ServerTLS, through ClientTLSConfig or ServerTLSConfig
+
+// ClientConfig describes the TLS settings of a client
+type ClientConfig interface {
+	ClientTLSConfig() *ClientTLS
+}
+
+type ClientTLS struct {
+	// InsecureConnection disables the validation of the server certificate
+	InsecureConnection bool
+	// CertFile is the path to the pem encoded TLS certificate
+	CertFile string `validate:"required_with=KeyFile,omitempty,file"`
+	// KeyFile is the path to the pem encoded private key of the TLS certificate
+	KeyFile string `validate:"required_with=CertFile,omitempty,file"`
+	// RootCAFile is the path to a pem encoded CA cert bundle used to validate server connections
+	// It is added to the system pool
+	RootCAFile string `validate:"omitempty,file"`
+}
+
+func (c *ClientTLS) ClientTLSConfig() *ClientTLS {
+	return c
+}
+
+func (c *ClientTLS) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if c == nil {
+		return nil
+	}
+
+	enc.AddBool("insecure-connection", c.InsecureConnection)
+	if !c.InsecureConnection {
+		enc.AddString("cert-file", c.CertFile)
+		enc.AddString("key-file", c.KeyFile)
+		enc.AddString("root-ca-file", c.RootCAFile)
+	}
+
+	return nil
+}
+
+// ServerConfig describes the TLS settings of a server
+type ServerConfig interface {
+	ServerTLSConfig() *ServerTLS
+}
+
+type ServerTLS struct {
+	// TLS indicates whether the server exposes with TLS
+	TLS bool
+	// CertFile is the path to the pem encoded TLS certificate
+	// It must be unset when TLS is disabled, so a misconfiguration does not silently serve plaintext
+	CertFile string `validate:"required_if=TLS true,excluded_without=TLS,omitempty,file"`
+	// KeyFile is the path to the pem encoded private key of the TLS certificate
+	KeyFile string `validate:"required_if=TLS true,excluded_without=TLS,omitempty,file"`
+	// ClientCAFile is the path to a pem encoded CA cert bundle, or a directory of bundles, used to validate clients
+	ClientCAFile string `validate:"excluded_without=TLS,omitempty,file|dir"`
+}
+
+func (s *ServerTLS) ServerTLSConfig() *ServerTLS {
+	return s
+}
+
+func (s *ServerTLS) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if s == nil {
+		return nil
+	}
+
+	enc.AddBool("tls", s.TLS)
+	if s.TLS {
+		enc.AddString("cert-file", s.CertFile)
+		enc.AddString("key-file", s.KeyFile)
+		enc.AddString("client-ca-file", s.ClientCAFile)
+	}
+
+	return nil
+}
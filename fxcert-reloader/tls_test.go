@@ -0,0 +1,118 @@
+package fxcert_reloader_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	reloader "github.com/exoscale/stelling/fxcert-reloader"
+	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/exoscale/stelling/fxhttp"
+	"github.com/exoscale/stelling/fxlogging"
+	"github.com/exoscale/stelling/fxmetrics"
+	"github.com/exoscale/stelling/fxtracing"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+// The configs copy the fields of ClientTLS and ServerTLS: these tests ensure their validation does not drift
+
+func TestClientTLSValidation(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.pem")
+	assert.NoError(t, os.WriteFile(file, []byte("pem"), 0o600))
+	missing := filepath.Join(dir, "missing.pem")
+
+	configs := map[string]func(reloader.ClientTLS) any{
+		"fxgrpc.Client": func(c reloader.ClientTLS) any {
+			return &fxgrpc.Client{
+				InsecureConnection: c.InsecureConnection, CertFile: c.CertFile, KeyFile: c.KeyFile, RootCAFile: c.RootCAFile,
+				Endpoint: "localhost:8080",
+			}
+		},
+		"fxgrpc.ConnManagerOpts": func(c reloader.ClientTLS) any {
+			return &fxgrpc.ConnManagerOpts{
+				InsecureConnection: c.InsecureConnection, CertFile: c.CertFile, KeyFile: c.KeyFile, RootCAFile: c.RootCAFile,
+			}
+		},
+		"fxmetrics.PushMetrics": func(c reloader.ClientTLS) any {
+			return &fxmetrics.PushMetrics{
+				InsecureConnection: c.InsecureConnection, CertFile: c.CertFile, KeyFile: c.KeyFile, RootCAFile: c.RootCAFile,
+			}
+		},
+		"fxtracing.Tracing": func(c reloader.ClientTLS) any {
+			return &fxtracing.Tracing{
+				InsecureConnection: c.InsecureConnection, CertFile: c.CertFile, KeyFile: c.KeyFile, RootCAFile: c.RootCAFile,
+				Enabled: true, Endpoint: "localhost:4317",
+			}
+		},
+		"fxlogging.OtlpLogs": func(c reloader.ClientTLS) any {
+			return &fxlogging.OtlpLogs{
+				InsecureConnection: c.InsecureConnection, CertFile: c.CertFile, KeyFile: c.KeyFile, RootCAFile: c.RootCAFile,
+				Enabled: true, Endpoint: "localhost:4317",
+			}
+		},
+	}
+
+	cases := []struct {
+		name  string
+		conf  reloader.ClientTLS
+		valid bool
+	}{
+		{"Should accept the system roots", reloader.ClientTLS{}, true},
+		{"Should accept an insecure connection", reloader.ClientTLS{InsecureConnection: true}, true},
+		{"Should accept a RootCAFile", reloader.ClientTLS{RootCAFile: file}, true},
+		{"Should accept a client certificate", reloader.ClientTLS{CertFile: file, KeyFile: file, RootCAFile: file}, true},
+		{"Should reject a CertFile without KeyFile", reloader.ClientTLS{CertFile: file}, false},
+		{"Should reject a KeyFile without CertFile", reloader.ClientTLS{KeyFile: file}, false},
+		{"Should reject a missing RootCAFile", reloader.ClientTLS{RootCAFile: missing}, false},
+	}
+
+	validate := validator.New()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.valid, validate.Struct(&tc.conf) == nil, "reloader.ClientTLS")
+			for name, newConf := range configs {
+				assert.Equal(t, tc.valid, validate.Struct(newConf(tc.conf)) == nil, name)
+			}
+		})
+	}
+}
+
+func TestServerTLSValidation(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.pem")
+	assert.NoError(t, os.WriteFile(file, []byte("pem"), 0o600))
+
+	configs := map[string]func(reloader.ServerTLS) any{
+		"fxgrpc.Server": func(s reloader.ServerTLS) any {
+			return &fxgrpc.Server{TLS: s.TLS, CertFile: s.CertFile, KeyFile: s.KeyFile, ClientCAFile: s.ClientCAFile, Address: "localhost:0"}
+		},
+		"fxhttp.Server": func(s reloader.ServerTLS) any {
+			return &fxhttp.Server{TLS: s.TLS, CertFile: s.CertFile, KeyFile: s.KeyFile, ClientCAFile: s.ClientCAFile, Address: "localhost:0"}
+		},
+	}
+
+	cases := []struct {
+		name  string
+		conf  reloader.ServerTLS
+		valid bool
+	}{
+		{"Should accept a plaintext server", reloader.ServerTLS{}, true},
+		{"Should accept a TLS server", reloader.ServerTLS{TLS: true, CertFile: file, KeyFile: file}, true},
+		{"Should accept a ClientCAFile directory", reloader.ServerTLS{TLS: true, CertFile: file, KeyFile: file, ClientCAFile: dir}, true},
+		{"Should reject a TLS server without KeyFile", reloader.ServerTLS{TLS: true, CertFile: file}, false},
+		{"Should reject a plaintext server with a CertFile", reloader.ServerTLS{CertFile: file, KeyFile: file}, false},
+		{"Should reject a plaintext server with a ClientCAFile", reloader.ServerTLS{ClientCAFile: file}, false},
+	}
+
+	validate := validator.New()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.valid, validate.Struct(&tc.conf) == nil, "reloader.ServerTLS")
+			for name, newConf := range configs {
+				assert.Equal(t, tc.valid, validate.Struct(newConf(tc.conf)) == nil, name)
+			}
+		})
+	}
+}
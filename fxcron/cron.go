@@ -0,0 +1,319 @@
+// Package fxcron provides a convenient way to run jobs periodically in an fx system.
+package fxcron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/exoscale/stelling/fxjob"
+	"github.com/exoscale/stelling/fxlogging/summary"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// JobGroup is the value group of the jobs run by the module
+const JobGroup = `group:"cron_jobs"`
+
+// Module runs each job of the JobGroup on its own schedule
+var Module = fx.Module(
+	"cron",
+	fx.Provide(
+		fx.Annotate(NewSchedulers, fx.ParamTags(JobGroup, ``, `optional:"true"`)),
+		fx.Private,
+	),
+	fx.Invoke(StartSchedulers),
+)
+
+// NewJobModule provides the fxjob.Job returned by the constructor to the JobGroup, with the schedule of conf
+// The job is only visible to the module, so the system can schedule several of them
+func NewJobModule(conf CronConfig, constructor any) fx.Option {
+	name := jobName(conf.CronConfig())
+	return fx.Module(
+		"cron-"+name,
+		fx.Provide(
+			fx.Annotate(constructor, fx.As(new(fxjob.Job))),
+			fx.Private,
+		),
+		fx.Provide(
+			fx.Annotate(
+				func(job fxjob.Job) *Job { return NewJob(conf, job) },
+				fx.ResultTags(JobGroup),
+			),
+		),
+		summary.Provide("cron:"+name, conf.CronConfig()),
+	)
+}
+
+const (
+	// OverlapSkip drops a run when the previous one is still going
+	OverlapSkip = "skip"
+	// OverlapQueue delays a run until the previous one is done
+	// At most one run is queued: further runs are skipped
+	OverlapQueue = "queue"
+)
+
+type CronConfig interface {
+	CronConfig() *Cron
+}
+
+type Cron struct {
+	// Name identifies the job in the logs and metrics
+	// It must be unique among the jobs of the system
+	Name string `default:"cron"`
+	// Schedule is a standard 5 field cron expression, a descriptor like @hourly, or @every <duration>
+	Schedule string `validate:"required"`
+	// Overlap is the policy applied when a run is due while the previous one is still going
+	Overlap string `default:"skip" validate:"omitempty,oneof=skip queue"`
+}
+
+func (c *Cron) CronConfig() *Cron {
+	return c
+}
+
+// jobName returns the Name of the job, or its default when unset
+func jobName(c *Cron) string {
+	if c.Name == "" {
+		return "cron"
+	}
+	return c.Name
+}
+
+func (c *Cron) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if c == nil {
+		return nil
+	}
+
+	enc.AddString("name", c.Name)
+	enc.AddString("schedule", c.Schedule)
+	enc.AddString("overlap", c.Overlap)
+
+	return nil
+}
+
+// Job is a job run on the schedule of its Cron
+type Job struct {
+	// Cron is the schedule of the job
+	Cron *Cron
+	// Job is run on each activation of the schedule
+	Job fxjob.Job
+}
+
+// NewJob returns a Job running job with the schedule of conf
+func NewJob(conf CronConfig, job fxjob.Job) *Job {
+	return &Job{Cron: conf.CronConfig(), Job: job}
+}
+
+// Scheduler runs a job on a schedule
+type Scheduler struct {
+	name     string
+	overlap  string
+	schedule Schedule
+	job      fxjob.Job
+	logger   *zap.Logger
+
+	runs     *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+
+	// running holds a token while a run is going
+	running chan struct{}
+	// queued holds a token while a run waits for the previous one
+	queued chan struct{}
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSchedulers creates a Scheduler for each job
+// The names of the jobs must be unique, as they label their metrics
+func NewSchedulers(jobs []*Job, logger *zap.Logger, reg prometheus.Registerer) ([]*Scheduler, error) {
+	names := map[string]bool{}
+	schedulers := make([]*Scheduler, 0, len(jobs))
+	for _, job := range jobs {
+		name := jobName(job.Cron)
+		if names[name] {
+			return nil, fmt.Errorf("duplicate cron job name %q", name)
+		}
+		names[name] = true
+
+		s, err := NewScheduler(job, logger, reg)
+		if err != nil {
+			return nil, fmt.Errorf("cron job %q: %w", name, err)
+		}
+		schedulers = append(schedulers, s)
+	}
+	return schedulers, nil
+}
+
+// NewScheduler creates a Scheduler for the job
+// Metrics are only registered when reg is not nil, they are shared by the schedulers of the system
+func NewScheduler(job *Job, logger *zap.Logger, reg prometheus.Registerer) (*Scheduler, error) {
+	schedule, err := ParseSchedule(job.Cron.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	name := jobName(job.Cron)
+	s := &Scheduler{
+		name:     name,
+		overlap:  job.Cron.Overlap,
+		schedule: schedule,
+		job:      job.Job,
+		logger:   logger.With(zap.String("cron.job", name)),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cron_runs_total",
+			Help: "Number of scheduled runs of a cron job, by result (success, failure or skipped).",
+		}, []string{"job", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "cron_run_duration_seconds",
+			Help: "Duration of the runs of a cron job.",
+		}, []string{"job"}),
+		running: make(chan struct{}, 1),
+		queued:  make(chan struct{}, 1),
+	}
+	if reg != nil {
+		if s.runs, err = register(reg, s.runs); err != nil {
+			return nil, err
+		}
+		if s.duration, err = register(reg, s.duration); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// register registers c, or returns the existing collector if another scheduler registered it first
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) (C, error) {
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(C); ok {
+				return existing, nil
+			}
+		}
+		return c, err
+	}
+	return c, nil
+}
+
+// StartSchedulers registers the lifecycle hooks of the Schedulers
+func StartSchedulers(lc fx.Lifecycle, schedulers []*Scheduler) {
+	for _, s := range schedulers {
+		lc.Append(fx.Hook{
+			OnStart: s.Start,
+			OnStop:  s.Stop,
+		})
+	}
+}
+
+// Start schedules the runs of the job in the background
+func (s *Scheduler) Start(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.loop(ctx)
+	}()
+	return nil
+}
+
+// Stop cancels the ongoing runs and waits for them to return
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context) {
+	for {
+		next := s.schedule.Next(time.Now())
+		if next.IsZero() {
+			s.logger.Warn("Cron schedule has no next activation")
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.trigger(ctx)
+	}
+}
+
+// trigger starts a run, taking the overlap policy into account
+func (s *Scheduler) trigger(ctx context.Context) {
+	select {
+	case s.running <- struct{}{}:
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.run(ctx)
+		}()
+		return
+	default:
+	}
+
+	if s.overlap == OverlapQueue {
+		select {
+		case s.queued <- struct{}{}:
+			s.logger.Info("Previous cron run is still going: queueing run")
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				select {
+				case s.running <- struct{}{}:
+					<-s.queued
+					s.run(ctx)
+				case <-ctx.Done():
+					<-s.queued
+				}
+			}()
+			return
+		default:
+		}
+	}
+
+	s.logger.Warn("Previous cron run is still going: skipping run")
+	s.runs.WithLabelValues(s.name, "skipped").Inc()
+}
+
+// run executes the job once and releases the running token
+func (s *Scheduler) run(ctx context.Context) {
+	defer func() { <-s.running }()
+
+	start := time.Now()
+	s.logger.Info("Cron run started")
+	err := s.job.Run(ctx)
+	elapsed := time.Since(start)
+
+	s.duration.WithLabelValues(s.name).Observe(elapsed.Seconds())
+	if err != nil {
+		s.runs.WithLabelValues(s.name, "failure").Inc()
+		s.logger.Error("Cron run failed", zap.Duration("duration", elapsed), zap.Error(err))
+		return
+	}
+	s.runs.WithLabelValues(s.name, "success").Inc()
+	s.logger.Info("Cron run finished", zap.Duration("duration", elapsed))
+}
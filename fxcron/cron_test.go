@@ -0,0 +1,174 @@
+package fxcron
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/exoscale/stelling/fxjob"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// runsTotal returns the value of cron_runs_total for the given job and result
+func runsTotal(t *testing.T, reg *prometheus.Registry, job, result string) float64 {
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() != "cron_runs_total" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["job"] == job && labels["result"] == result {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+// jobModule provides job with the schedule of conf
+func jobModule(conf *Cron, job fxjob.JobFunc) fx.Option {
+	return NewJobModule(conf, func() fxjob.JobFunc { return job })
+}
+
+func newTestSystem(t *testing.T, reg *prometheus.Registry, jobs ...fx.Option) *fxtest.App {
+	return fxtest.New(
+		t,
+		Module,
+		fx.Options(jobs...),
+		fx.Provide(zap.NewNop),
+		fx.Supply(fx.Annotate(reg, fx.As(new(prometheus.Registerer)))),
+	)
+}
+
+func TestScheduler(t *testing.T) {
+	t.Run("Should run the job on schedule", func(t *testing.T) {
+		var count atomic.Int32
+		reg := prometheus.NewRegistry()
+		app := newTestSystem(t, reg, jobModule(&Cron{Name: "test", Schedule: "@every 10ms"}, func(context.Context) error {
+			count.Add(1)
+			return nil
+		}))
+		app.RequireStart()
+
+		require.Eventually(t, func() bool { return count.Load() >= 3 }, time.Second, 5*time.Millisecond)
+		app.RequireStop()
+		require.GreaterOrEqual(t, runsTotal(t, reg, "test", "success"), float64(3))
+	})
+
+	t.Run("Should skip runs while the previous one is going", func(t *testing.T) {
+		var count, concurrent, maxConcurrent atomic.Int32
+		reg := prometheus.NewRegistry()
+		app := newTestSystem(t, reg, jobModule(&Cron{Schedule: "@every 5ms", Overlap: OverlapSkip}, func(ctx context.Context) error {
+			count.Add(1)
+			c := concurrent.Add(1)
+			defer concurrent.Add(-1)
+			if c > maxConcurrent.Load() {
+				maxConcurrent.Store(c)
+			}
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}))
+		app.RequireStart()
+
+		require.Eventually(t, func() bool { return runsTotal(t, reg, "cron", "skipped") >= 3 }, time.Second, 5*time.Millisecond)
+		app.RequireStop()
+		require.Equal(t, int32(1), maxConcurrent.Load())
+		require.LessOrEqual(t, count.Load(), int32(2))
+	})
+
+	t.Run("Should queue a single run while the previous one is going", func(t *testing.T) {
+		var count atomic.Int32
+		release := make(chan struct{})
+		reg := prometheus.NewRegistry()
+		app := newTestSystem(t, reg, jobModule(&Cron{Schedule: "@every 5ms", Overlap: OverlapQueue}, func(ctx context.Context) error {
+			if count.Add(1) == 1 {
+				<-release
+			}
+			return nil
+		}))
+		app.RequireStart()
+
+		// The first run blocks: one run is queued and the others are skipped
+		require.Eventually(t, func() bool { return runsTotal(t, reg, "cron", "skipped") >= 2 }, time.Second, 5*time.Millisecond)
+		require.Equal(t, int32(1), count.Load())
+		close(release)
+
+		require.Eventually(t, func() bool { return count.Load() >= 2 }, time.Second, 5*time.Millisecond)
+		app.RequireStop()
+	})
+
+	t.Run("Should cancel the ongoing run on shutdown", func(t *testing.T) {
+		started := make(chan struct{}, 1)
+		var canceled atomic.Bool
+		app := newTestSystem(t, prometheus.NewRegistry(), jobModule(&Cron{Schedule: "@every 5ms"}, func(ctx context.Context) error {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-ctx.Done()
+			canceled.Store(true)
+			return ctx.Err()
+		}))
+		app.RequireStart()
+		<-started
+
+		app.RequireStop()
+		require.True(t, canceled.Load())
+	})
+
+	t.Run("Should fail to start with an invalid schedule", func(t *testing.T) {
+		app := fx.New(
+			Module,
+			jobModule(&Cron{Schedule: "not a schedule"}, func(context.Context) error { return nil }),
+			fx.NopLogger,
+			fx.Provide(zap.NewNop),
+		)
+		require.ErrorContains(t, app.Err(), "expected 5 fields")
+	})
+
+	t.Run("Should run each job on its own schedule", func(t *testing.T) {
+		var fast, slow atomic.Int32
+		reg := prometheus.NewRegistry()
+		app := newTestSystem(t, reg,
+			jobModule(&Cron{Name: "fast", Schedule: "@every 10ms"}, func(context.Context) error {
+				fast.Add(1)
+				return nil
+			}),
+			jobModule(&Cron{Name: "slow", Schedule: "@every 50ms"}, func(context.Context) error {
+				slow.Add(1)
+				return errors.New("failed")
+			}),
+		)
+		app.RequireStart()
+
+		require.Eventually(t, func() bool { return slow.Load() >= 2 }, time.Second, 5*time.Millisecond)
+		app.RequireStop()
+		require.Greater(t, fast.Load(), slow.Load())
+		require.Equal(t, float64(fast.Load()), runsTotal(t, reg, "fast", "success"))
+		require.Equal(t, float64(slow.Load()), runsTotal(t, reg, "slow", "failure"))
+		require.Zero(t, runsTotal(t, reg, "slow", "success"))
+	})
+
+	t.Run("Should fail to start with duplicate job names", func(t *testing.T) {
+		noop := func(context.Context) error { return nil }
+		app := fx.New(
+			Module,
+			jobModule(&Cron{Name: "cleanup", Schedule: "@hourly"}, noop),
+			jobModule(&Cron{Name: "cleanup", Schedule: "@daily"}, noop),
+			fx.NopLogger,
+			fx.Provide(zap.NewNop),
+		)
+		require.ErrorContains(t, app.Err(), `duplicate cron job name "cleanup"`)
+	})
+}
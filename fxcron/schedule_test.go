@@ -0,0 +1,62 @@
+package fxcron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	// A monday
+	from := time.Date(2024, time.January, 15, 10, 30, 45, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		spec     string
+		expected time.Time
+	}{
+		{name: "Should run every minute", spec: "* * * * *", expected: time.Date(2024, time.January, 15, 10, 31, 0, 0, time.UTC)},
+		{name: "Should support steps", spec: "*/15 * * * *", expected: time.Date(2024, time.January, 15, 10, 45, 0, 0, time.UTC)},
+		{name: "Should support lists", spec: "5,20 * * * *", expected: time.Date(2024, time.January, 15, 11, 5, 0, 0, time.UTC)},
+		{name: "Should support ranges", spec: "0 9-17 * * *", expected: time.Date(2024, time.January, 15, 11, 0, 0, 0, time.UTC)},
+		{name: "Should roll over to the next day", spec: "0 3 * * *", expected: time.Date(2024, time.January, 16, 3, 0, 0, 0, time.UTC)},
+		{name: "Should support days of the week", spec: "0 0 * * 5", expected: time.Date(2024, time.January, 19, 0, 0, 0, 0, time.UTC)},
+		{name: "Should treat 7 as sunday", spec: "0 0 * * 7", expected: time.Date(2024, time.January, 21, 0, 0, 0, 0, time.UTC)},
+		{name: "Should match either day field when both are set", spec: "0 0 1 * 3", expected: time.Date(2024, time.January, 17, 0, 0, 0, 0, time.UTC)},
+		{name: "Should roll over to the next year", spec: "0 0 1 1 *", expected: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "Should support descriptors", spec: "@hourly", expected: time.Date(2024, time.January, 15, 11, 0, 0, 0, time.UTC)},
+		{name: "Should support intervals", spec: "@every 90s", expected: time.Date(2024, time.January, 15, 10, 32, 15, 0, time.UTC)},
+		{name: "Should return the zero time if the schedule never matches", spec: "0 0 30 2 *", expected: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSchedule(tt.spec)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, s.Next(from))
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{name: "Should reject missing fields", spec: "* * * *"},
+		{name: "Should reject out of range values", spec: "60 * * * *"},
+		{name: "Should reject inverted ranges", spec: "* 5-1 * * *"},
+		{name: "Should reject invalid steps", spec: "*/0 * * * *"},
+		{name: "Should reject invalid values", spec: "a * * * *"},
+		{name: "Should reject invalid intervals", spec: "@every soon"},
+		{name: "Should reject negative intervals", spec: "@every -1s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSchedule(tt.spec)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package fxgrpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RequireClientCertInterceptorWeight places the interceptor after the observability interceptors
+// so rejected requests are still logged, traced and counted, and before the authorizer
+const RequireClientCertInterceptorWeight uint = 65
+
+// checkClientCert returns an Unauthenticated error if the peer did not present a certificate
+// that was verified against the client CA of the server
+func checkClientCert(ctx context.Context) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing peer information")
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 {
+		return status.Error(codes.Unauthenticated, "a verified client certificate is required")
+	}
+	return nil
+}
+
+// NewRequireClientCertInterceptors returns server interceptors that reject any request without a verified client certificate
+// It guards against a TLS misconfiguration that would let unauthenticated requests through
+func NewRequireClientCertInterceptors() (*UnaryServerInterceptor, *StreamServerInterceptor) {
+	unaryIx := &UnaryServerInterceptor{
+		Name:   "require-client-cert",
+		Weight: RequireClientCertInterceptorWeight,
+		Interceptor: func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := checkClientCert(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		},
+	}
+	streamIx := &StreamServerInterceptor{
+		Name:   "require-client-cert",
+		Weight: RequireClientCertInterceptorWeight,
+		Interceptor: func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkClientCert(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		},
+	}
+	return unaryIx, streamIx
+}
@@ -0,0 +1,281 @@
+package fxgrpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type testPKI struct {
+	caFile, serverCert, serverKey, clientCert, clientKey string
+}
+
+// writeKeyPair creates a certificate signed by parent (self signed if nil) and writes it to dir
+func writeKeyPair(t *testing.T, dir, name string, tmpl *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+"-key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return cert, key, certFile, keyFile
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	dir := t.TempDir()
+	notAfter := time.Now().Add(time.Hour)
+	p := &testPKI{}
+
+	ca, caKey, caFile, _ := writeKeyPair(t, dir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	p.caFile = caFile
+
+	_, _, p.serverCert, p.serverKey = writeKeyPair(t, dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "server"},
+		NotAfter:     notAfter,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+
+	_, _, p.clientCert, p.clientKey = writeKeyPair(t, dir, "client", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	return p
+}
+
+func freeAddress(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close() //nolint:errcheck
+	return lis.Addr().String()
+}
+
+// getFeatureCode starts a server with the given config and returns the status code of a call made by the client
+func getFeatureCode(t *testing.T, serverConf *Server, clientConf *Client, opts ...fx.Option) codes.Code {
+	app := fxtest.New(
+		t,
+		NewServerModule(serverConf),
+		fx.Supply(zap.NewNop()),
+		fx.Provide(func() pb.RouteGuideServer { return &pb.UnimplementedRouteGuideServer{} }),
+		fx.Invoke(pb.RegisterRouteGuideServer, StartGrpcServer),
+		fx.Options(opts...),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	clientConf.Endpoint = serverConf.Address
+	conn, err := NewGrpcClient(clientConf, zap.NewNop(), nil, nil)
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	_, err = pb.NewRouteGuideClient(conn).GetFeature(context.Background(), &pb.Point{})
+	return status.Code(err)
+}
+
+func TestRequireClientCert(t *testing.T) {
+	pki := newTestPKI(t)
+
+	t.Run("Should reject a call without a client cert", func(t *testing.T) {
+		// The client CA is missing, so the TLS handshake does not verify the client
+		serverConf := &Server{
+			Address:           freeAddress(t),
+			TLS:               true,
+			CertFile:          pki.serverCert,
+			KeyFile:           pki.serverKey,
+			RequireClientCert: true,
+		}
+		code := getFeatureCode(t, serverConf, &Client{RootCAFile: pki.caFile})
+		require.Equal(t, codes.Unauthenticated, code)
+	})
+
+	t.Run("Should pass a call with a valid client cert", func(t *testing.T) {
+		serverConf := &Server{
+			Address:           freeAddress(t),
+			TLS:               true,
+			CertFile:          pki.serverCert,
+			KeyFile:           pki.serverKey,
+			ClientCAFile:      pki.caFile,
+			RequireClientCert: true,
+		}
+		code := getFeatureCode(t, serverConf, &Client{RootCAFile: pki.caFile, CertFile: pki.clientCert, KeyFile: pki.clientKey})
+		// The handler is reached
+		require.Equal(t, codes.Unimplemented, code)
+	})
+}
+
+func TestWithServerCredentials(t *testing.T) {
+	pki := newTestPKI(t)
+	cert, err := tls.LoadX509KeyPair(pki.serverCert, pki.serverKey)
+	require.NoError(t, err)
+	creds := WithServerCredentials(credentials.NewTLS(&tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return &cert, nil },
+	}))
+
+	t.Run("Should serve TLS with the provided credentials", func(t *testing.T) {
+		code := getFeatureCode(t, &Server{Address: freeAddress(t)}, &Client{RootCAFile: pki.caFile}, creds)
+		require.Equal(t, codes.Unimplemented, code)
+	})
+
+	t.Run("Should not use the cert files when credentials are provided", func(t *testing.T) {
+		// The client does not trust the certificate of the files
+		other := newTestPKI(t)
+		serverConf := &Server{Address: freeAddress(t), TLS: true, CertFile: other.serverCert, KeyFile: other.serverKey}
+		code := getFeatureCode(t, serverConf, &Client{RootCAFile: pki.caFile}, creds)
+		require.Equal(t, codes.Unimplemented, code)
+	})
+
+	t.Run("Should not load the cert files when credentials are provided", func(t *testing.T) {
+		missing := filepath.Join(t.TempDir(), "missing.pem")
+		serverConf := &Server{Address: freeAddress(t), TLS: true, CertFile: missing, KeyFile: missing, ClientCAFile: missing}
+		code := getFeatureCode(t, serverConf, &Client{RootCAFile: pki.caFile}, creds)
+		require.Equal(t, codes.Unimplemented, code)
+	})
+
+	t.Run("Should only use the credentials of the server with the same name", func(t *testing.T) {
+		publicAddress, adminAddress := freeAddress(t), freeAddress(t)
+		app := fxtest.New(
+			t,
+			NewServerModule(&Server{Address: publicAddress}),
+			NewServerModule(&Server{Address: adminAddress}, WithServerModuleName("admin")),
+			WithNamedServerCredentials("admin", credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}})),
+			fx.Supply(zap.NewNop()),
+			fx.Invoke(
+				func(s grpc.ServiceRegistrar) { pb.RegisterRouteGuideServer(s, &pb.UnimplementedRouteGuideServer{}) },
+				fx.Annotate(
+					func(s grpc.ServiceRegistrar) { pb.RegisterRouteGuideServer(s, &pb.UnimplementedRouteGuideServer{}) },
+					fx.ParamTags(`name:"admin"`),
+				),
+				StartGrpcServer,
+				fx.Annotate(StartGrpcServer, fx.ParamTags(``, ``, `name:"admin"`)),
+			),
+		)
+		app.RequireStart()
+		defer app.RequireStop()
+
+		getFeature := func(t *testing.T, clientConf *Client) codes.Code {
+			conn, err := NewGrpcClient(clientConf, zap.NewNop(), nil, nil)
+			require.NoError(t, err)
+			defer conn.Close() //nolint:errcheck
+			_, err = pb.NewRouteGuideClient(conn).GetFeature(context.Background(), &pb.Point{})
+			return status.Code(err)
+		}
+		require.Equal(t, codes.Unimplemented, getFeature(t, &Client{InsecureConnection: true, Endpoint: publicAddress}))
+		require.Equal(t, codes.Unimplemented, getFeature(t, &Client{RootCAFile: pki.caFile, Endpoint: adminAddress}))
+	})
+}
+
+func TestALPNProtocols(t *testing.T) {
+	pki := newTestPKI(t)
+	ca, err := os.ReadFile(pki.caFile)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(ca))
+
+	// negotiate starts a server with the given ALPN protocols and returns the one negotiated by a client offering protos
+	negotiate := func(t *testing.T, serverProtos []string, protos ...string) string {
+		conf := &Server{Address: freeAddress(t), TLS: true, CertFile: pki.serverCert, KeyFile: pki.serverKey, ALPNProtocols: serverProtos}
+		app := fxtest.New(t, NewServerModule(conf), fx.Supply(zap.NewNop()), fx.Invoke(StartGrpcServer))
+		app.RequireStart()
+		defer app.RequireStop()
+
+		conn, err := tls.Dial("tcp", conf.Address, &tls.Config{RootCAs: roots, NextProtos: protos})
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+		return conn.ConnectionState().NegotiatedProtocol
+	}
+
+	t.Run("Should negotiate h2 by default", func(t *testing.T) {
+		require.Equal(t, "h2", negotiate(t, nil, "h2"))
+	})
+
+	t.Run("Should negotiate the configured protocols", func(t *testing.T) {
+		require.Equal(t, "acme-tls/1", negotiate(t, []string{"acme-tls/1"}, "acme-tls/1"))
+	})
+
+	t.Run("Should keep h2 along the configured protocols", func(t *testing.T) {
+		require.Equal(t, "h2", negotiate(t, []string{"acme-tls/1"}, "h2"))
+	})
+}
+
+func TestCheckClientCert(t *testing.T) {
+	cases := []struct {
+		name     string
+		ctx      context.Context
+		expected codes.Code
+	}{
+		{
+			name:     "Should reject requests without peer",
+			ctx:      context.Background(),
+			expected: codes.Unauthenticated,
+		},
+		{
+			name:     "Should reject requests without TLS",
+			ctx:      peer.NewContext(context.Background(), &peer.Peer{}),
+			expected: codes.Unauthenticated,
+		},
+		{
+			name: "Should reject unverified certificates",
+			ctx: peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{{}},
+			}}}),
+			expected: codes.Unauthenticated,
+		},
+		{
+			name: "Should accept verified certificates",
+			ctx: peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{{}},
+				VerifiedChains:   [][]*x509.Certificate{{{}}},
+			}}}),
+			expected: codes.OK,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, status.Code(checkClientCert(tc.ctx)))
+		})
+	}
+}
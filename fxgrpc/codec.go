@@ -1,7 +1,10 @@
 package fxgrpc
 
 import (
+	"fmt"
+	"sync/atomic"
 
+	"go.uber.org/fx"
 	// use the v2 proto package we can continue serializing
 	// messages from our dependencies that don't use vtproto
 	"google.golang.org/grpc/encoding"
@@ -9,6 +12,8 @@ import (
 	// so that it can be replaced.
 	_ "google.golang.org/grpc/encoding/proto"
 	"google.golang.org/grpc/mem"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
 )
 
 // Name is the name registered for the proto compressor.
@@ -22,15 +27,37 @@ type vtprotoMessage interface {
 
 type codec struct {
 	fallback encoding.CodecV2
+	// pool holds the serialized messages, see WithBufferPool
+	pool atomic.Pointer[mem.BufferPool]
 }
 
-func (codec) Name() string { return Name }
+func (*codec) Name() string { return Name }
 
-// For the moment there's no way for consumer of stelling to change the memory pool used to hold serialized messages
-// But I'm not sure there's really a need for that
+// defaultBufferPool holds the serialized messages, unless another pool is set with WithBufferPool
 var defaultBufferPool = mem.DefaultBufferPool()
 
+// registeredCodec is the codec registered for the proto content-subtype, in place of the one of grpc
+var registeredCodec = &codec{fallback: encoding.GetCodecV2(Name)}
+
+// WithBufferPool makes the proto codec take the buffers of the messages it serializes, and of the received messages
+// it deserializes, from pool
+// Like the grpc logger, the codec is global: the pool applies to all the grpc servers and clients of the process,
+// for the requests of the proto content-subtype only. The other codecs, registered or forced, don't use it.
+// The buffers of the transport, which reads the messages from the connections, still come from the default pool of grpc
+func WithBufferPool(pool mem.BufferPool) fx.Option {
+	return fx.Invoke(func() { registeredCodec.setPool(pool) })
+}
+
+func (c *codec) setPool(pool mem.BufferPool) {
+	c.pool.Store(&pool)
+}
+
+func (c *codec) bufferPool() mem.BufferPool {
+	return *c.pool.Load()
+}
+
 func (c *codec) Marshal(v any) (mem.BufferSlice, error) {
+	pool := c.bufferPool()
 	if m, ok := v.(vtprotoMessage); ok {
 		size := m.SizeVT()
 		if mem.IsBelowBufferPoolingThreshold(size) {
@@ -40,29 +67,70 @@ func (c *codec) Marshal(v any) (mem.BufferSlice, error) {
 			}
 			return mem.BufferSlice{mem.SliceBuffer(buf)}, nil
 		}
-		buf := defaultBufferPool.Get(size)
+		buf := pool.Get(size)
 		if _, err := m.MarshalToSizedBufferVT((*buf)[:size]); err != nil {
-			defaultBufferPool.Put(buf)
+			pool.Put(buf)
 			return nil, err
 		}
-		return mem.BufferSlice{mem.NewBuffer(buf, defaultBufferPool)}, nil
+		return mem.BufferSlice{mem.NewBuffer(buf, pool)}, nil
+	}
+	if pool == defaultBufferPool {
+		return c.fallback.Marshal(v)
 	}
 
-	return c.fallback.Marshal(v)
+	// The fallback serializes into the default pool
+	m := messageV2Of(v)
+	if m == nil {
+		return nil, fmt.Errorf("proto: failed to marshal, message is %T, want proto.Message", v)
+	}
+	size := proto.Size(m)
+	if mem.IsBelowBufferPoolingThreshold(size) {
+		buf, err := proto.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		return mem.BufferSlice{mem.SliceBuffer(buf)}, nil
+	}
+	buf := pool.Get(size)
+	if _, err := (proto.MarshalOptions{}).MarshalAppend((*buf)[:0], m); err != nil {
+		pool.Put(buf)
+		return nil, err
+	}
+	return mem.BufferSlice{mem.NewBuffer(buf, pool)}, nil
 }
 
 func (c *codec) Unmarshal(data mem.BufferSlice, v any) error {
+	pool := c.bufferPool()
 	if m, ok := v.(vtprotoMessage); ok {
-		buf := data.MaterializeToBuffer(defaultBufferPool)
+		buf := data.MaterializeToBuffer(pool)
 		defer buf.Free()
 		return m.UnmarshalVT(buf.ReadOnlyData())
 	}
+	if pool == defaultBufferPool {
+		return c.fallback.Unmarshal(data, v)
+	}
 
-	return c.fallback.Unmarshal(data, v)
+	m := messageV2Of(v)
+	if m == nil {
+		return fmt.Errorf("proto: failed to unmarshal, message is %T, want proto.Message", v)
+	}
+	buf := data.MaterializeToBuffer(pool)
+	defer buf.Free()
+	return proto.Unmarshal(buf.ReadOnlyData(), m)
+}
+
+// messageV2Of returns v as a proto.Message, or nil if it isn't a proto message
+func messageV2Of(v any) proto.Message {
+	switch v := v.(type) {
+	case protoadapt.MessageV1:
+		return protoadapt.MessageV2Of(v)
+	case protoadapt.MessageV2:
+		return v
+	}
+	return nil
 }
 
 func init() {
-	encoding.RegisterCodecV2(&codec{
-		fallback: encoding.GetCodecV2("proto"),
-	})
+	registeredCodec.setPool(defaultBufferPool)
+	encoding.RegisterCodecV2(registeredCodec)
 }
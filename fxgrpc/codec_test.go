@@ -0,0 +1,60 @@
+package fxgrpc
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+	"google.golang.org/grpc/encoding"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/mem"
+)
+
+// countingPool counts the buffers taken from the default pool
+type countingPool struct {
+	gets atomic.Int32
+}
+
+func (p *countingPool) Get(length int) *[]byte {
+	p.gets.Add(1)
+	return mem.DefaultBufferPool().Get(length)
+}
+
+func (p *countingPool) Put(buf *[]byte) {
+	mem.DefaultBufferPool().Put(buf)
+}
+
+func TestWithBufferPool(t *testing.T) {
+	pool := &countingPool{}
+	app := fxtest.New(t, WithBufferPool(pool))
+	t.Cleanup(func() { registeredCodec.setPool(defaultBufferPool) })
+	app.RequireStart()
+	app.RequireStop()
+
+	codec := encoding.GetCodecV2(Name)
+	// The note is above the pooling threshold of grpc
+	note := &pb.RouteNote{Message: strings.Repeat("a", 4096)}
+
+	t.Run("Should serialize the messages into the pool", func(t *testing.T) {
+		data, err := codec.Marshal(note)
+		require.NoError(t, err)
+		defer data.Free()
+		require.EqualValues(t, 1, pool.gets.Load())
+
+		got := &pb.RouteNote{}
+		require.NoError(t, codec.Unmarshal(data, got))
+		require.Equal(t, note.GetMessage(), got.GetMessage())
+	})
+
+	t.Run("Should go back to the default pool", func(t *testing.T) {
+		registeredCodec.setPool(defaultBufferPool)
+		before := pool.gets.Load()
+
+		data, err := codec.Marshal(note)
+		require.NoError(t, err)
+		defer data.Free()
+		require.Equal(t, before, pool.gets.Load())
+	})
+}
@@ -0,0 +1,7 @@
+package fxgrpc
+
+import (
+	// Registering the gzip compressor is enough for servers to accept gzip compressed requests
+	// Clients enable it with the Compression option
+	_ "google.golang.org/grpc/encoding/gzip"
+)
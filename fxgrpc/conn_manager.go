@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"sync"
+	"sync/atomic"
 
 	fxcert_reloader "github.com/exoscale/stelling/fxcert-reloader"
+	"github.com/exoscale/stelling/fxlogging/summary"
 	"go.uber.org/fx"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 )
 
 func NewConnManagerModule(conf ConnManagerConfig) fx.Option {
@@ -51,6 +55,7 @@ func NewConnManagerModule(conf ConnManagerConfig) fx.Option {
 		fx.Provide(
 			ProvideConnManager,
 		),
+		summary.Provide("grpc-conn-manager", nil),
 	)
 }
 
@@ -62,39 +67,81 @@ type ConnManagerOpts struct {
 	// InsecureConnection indicates whether TLS needs to be disabled when connecting to the grpc server
 	InsecureConnection bool
 	// CertFile is the path to the pem encoded TLS certificate
-	CertFile string `validate:"omitempty,file"`
+	CertFile string `validate:"required_with=KeyFile,omitempty,file"`
 	// KeyFile is the path to the pem encoded private key of the TLS certificate
 	KeyFile string `validate:"required_with=CertFile,omitempty,file"`
 	// RootCAFile is the  path to a pem encoded CA bundle used to validate server connections
 	RootCAFile string `validate:"omitempty,file"`
+	// MaxConns bounds the number of connections held by the manager
+	// When it is reached, the least recently used connection is closed before a new one is created
+	// The number of connections is not bounded when it is unset
+	MaxConns int `validate:"gte=0"`
 }
 
 func (c *ConnManagerOpts) ConnManagerConfig() *ConnManagerOpts {
 	return c
 }
 
+func (c *ConnManagerOpts) ClientTLSConfig() *fxcert_reloader.ClientTLS {
+	return &fxcert_reloader.ClientTLS{
+		InsecureConnection: c.InsecureConnection,
+		CertFile:           c.CertFile,
+		KeyFile:            c.KeyFile,
+		RootCAFile:         c.RootCAFile,
+	}
+}
+
 // ConnManager is a cache of grpc.ClientConn's
 // Users of the manager should leave the lifecycle of the
 // underlying gRPC connections entirely up to the manager
 type ConnManager struct {
-	lock sync.RWMutex
-	idx  map[string]*grpc.ClientConn
-	opts []grpc.DialOption
+	lock     sync.RWMutex
+	idx      map[connKey]*managedConn
+	opts     []grpc.DialOption
+	maxConns int
+	// uses orders the uses of the connections, so the least recently used one can be evicted
+	uses atomic.Int64
+}
+
+// connKey identifies a connection of the manager
+type connKey struct {
+	address   string
+	authority string
+}
+
+// managedConn is a connection of the manager, with the order of its last use
+type managedConn struct {
+	conn    *grpc.ClientConn
+	lastUse atomic.Int64
+}
+
+// ConnManagerOption configures a ConnManager
+type ConnManagerOption func(*ConnManager)
+
+// WithMaxConns bounds the number of connections held by the manager, see ConnManagerOpts.MaxConns
+func WithMaxConns(n int) ConnManagerOption {
+	return func(m *ConnManager) {
+		m.maxConns = n
+	}
 }
 
-func NewConnManager(opts []grpc.DialOption) *ConnManager {
-	return &ConnManager{
-		idx:  make(map[string]*grpc.ClientConn),
+func NewConnManager(opts []grpc.DialOption, managerOpts ...ConnManagerOption) *ConnManager {
+	m := &ConnManager{
+		idx:  make(map[connKey]*managedConn),
 		opts: opts,
 	}
+	for _, opt := range managerOpts {
+		opt(m)
+	}
+	return m
 }
 
 func (m *ConnManager) Stop(ctx context.Context) error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 	var errs error
-	for _, conn := range m.idx {
-		if err := conn.Close(); err != nil {
+	for _, c := range m.idx {
+		if err := c.conn.Close(); err != nil {
 			errs = errors.Join(errs, err)
 		}
 	}
@@ -105,6 +152,7 @@ type ConnManagerParams struct {
 	fx.In
 
 	Lc                 fx.Lifecycle
+	Conf               ConnManagerConfig
 	Opts               []grpc.DialOption             `group:"grpc_client_options"`
 	Reloader           *fxcert_reloader.CertReloader `optional:"true" name:"grpc_conn_manager"`
 	UnaryInterceptors  []*UnaryClientInterceptor     `group:"unary_client_interceptor"`
@@ -115,37 +163,162 @@ func ProvideConnManager(p ConnManagerParams) *ConnManager {
 	if p.Reloader != nil {
 		p.Lc.Append(fx.Hook{OnStart: p.Reloader.Start, OnStop: p.Reloader.Stop})
 	}
-	output := NewConnManager(append(
-		p.Opts,
-		WithUnaryClientInterceptors(p.UnaryInterceptors),
-		WithStreamClientInterceptors(p.StreamInterceptors),
-	))
+	output := NewConnManager(
+		append(
+			p.Opts,
+			WithUnaryClientInterceptors(p.UnaryInterceptors),
+			WithStreamClientInterceptors(p.StreamInterceptors),
+		),
+		WithMaxConns(p.Conf.ConnManagerConfig().MaxConns),
+	)
 	p.Lc.Append(fx.Hook{OnStop: output.Stop})
 	return output
 }
 
+// Get returns the connection to address, creating it if needed
+// A connection which was shut down, eg: closed by a user of the manager, is transparently replaced
+// Connections in TransientFailure are kept: grpc reconnects them with a backoff
 func (m *ConnManager) Get(address string) (*grpc.ClientConn, error) {
+	return m.GetWithOpts(address)
+}
+
+// GetOption configures the connection returned by ConnManager.GetWithOpts
+type GetOption func(*connKey)
+
+// WithAuthority sets the :authority of the requests of the connection, which is also the server name verified over TLS
+// This lets a single manager reach several virtual-hosted backends behind the same address, eg: an SNI-terminating proxy
+// The authority must be a host, optionally followed by a port
+func WithAuthority(authority string) GetOption {
+	return func(k *connKey) {
+		k.authority = authority
+	}
+}
+
+// validateAuthority rejects authorities which are not a host with an optional port
+func validateAuthority(authority string) error {
+	u, err := url.Parse("//" + authority)
+	if err != nil || u.Host != authority || u.Hostname() == "" || u.User != nil {
+		return fmt.Errorf("invalid authority %q: expected a host with an optional port", authority)
+	}
+	return nil
+}
+
+// GetWithOpts returns the connection to address with the given options, creating it if needed
+// Connections are cached by address and options, eg: the same address with two authorities uses two connections
+func (m *ConnManager) GetWithOpts(address string, opts ...GetOption) (*grpc.ClientConn, error) {
+	key := connKey{address: address}
+	for _, opt := range opts {
+		opt(&key)
+	}
+	if key.authority != "" {
+		if err := validateAuthority(key.authority); err != nil {
+			return nil, err
+		}
+	}
 	m.lock.RLock()
-	conn, ok := m.idx[address]
+	c, ok := m.idx[key]
 	m.lock.RUnlock()
-	if !ok {
-		return m.createConnection(address)
+	if !ok || c.conn.GetState() == connectivity.Shutdown {
+		return m.createConnection(key)
 	}
-	return conn, nil
+	c.lastUse.Store(m.uses.Add(1))
+	return c.conn, nil
 }
 
-func (m *ConnManager) createConnection(address string) (*grpc.ClientConn, error) {
+func (m *ConnManager) createConnection(key connKey) (*grpc.ClientConn, error) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 	// Check again, to avoid a race condition where we try to create the same connection concurrently
-	conn, ok := m.idx[address]
-	if ok {
-		return conn, nil
+	c, ok := m.idx[key]
+	if ok && c.conn.GetState() != connectivity.Shutdown {
+		c.lastUse.Store(m.uses.Add(1))
+		return c.conn, nil
 	}
-	conn, err := grpc.NewClient(address, m.opts...)
+	opts := m.opts
+	if key.authority != "" {
+		opts = append(append([]grpc.DialOption(nil), opts...), grpc.WithAuthority(key.authority))
+	}
+	conn, err := grpc.NewClient(key.address, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("clientManager: createConnection: %w", err)
 	}
-	m.idx[address] = conn
+	if !ok && m.maxConns > 0 && len(m.idx) >= m.maxConns {
+		m.evictLRU()
+	}
+	c = &managedConn{conn: conn}
+	c.lastUse.Store(m.uses.Add(1))
+	m.idx[key] = c
 	return conn, nil
 }
+
+// evictLRU closes and removes the least recently used connection
+// The caller must hold the write lock
+func (m *ConnManager) evictLRU() {
+	var lru connKey
+	var lruUse int64
+	found := false
+	for key, c := range m.idx {
+		if use := c.lastUse.Load(); !found || use < lruUse {
+			lru, lruUse, found = key, use, true
+		}
+	}
+	// The connection may still be used by a caller of Get: closing it makes its requests fail with codes.Canceled
+	m.idx[lru].conn.Close() //nolint:errcheck
+	delete(m.idx, lru)
+}
+
+// Len returns the number of connections held by the manager
+func (m *ConnManager) Len() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return len(m.idx)
+}
+
+type warmupConfig struct {
+	waitForReady bool
+}
+
+// WarmupOption configures ConnManager.Warmup
+type WarmupOption func(*warmupConfig)
+
+// WithWaitForReady makes Warmup wait until the connections are ready
+func WithWaitForReady() WarmupOption {
+	return func(c *warmupConfig) {
+		c.waitForReady = true
+	}
+}
+
+// Warmup concurrently creates the connections to the given addresses, so the first requests do not pay the dial cost
+// The connections start connecting in the background, unless WithWaitForReady is set: Warmup then waits until they
+// are ready, or ctx is done.
+// The errors of all the addresses are joined
+func (m *ConnManager) Warmup(ctx context.Context, addresses []string, opts ...WarmupOption) error {
+	conf := &warmupConfig{}
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	errs := make([]error, len(addresses))
+	var wg sync.WaitGroup
+	for i, address := range addresses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := m.Get(address)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if !conf.waitForReady {
+				conn.Connect()
+				return
+			}
+			if state, ok := connectAndWait(ctx, conn); !ok {
+				errs[i] = fmt.Errorf("failed to connect to %s (last state: %s): %w", address, state, ctx.Err())
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
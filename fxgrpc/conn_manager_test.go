@@ -1,12 +1,22 @@
 package fxgrpc
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxtest"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/metadata"
 )
 
 func TestNewConnManagerModule(t *testing.T) {
@@ -22,5 +32,161 @@ func TestNewConnManagerModule(t *testing.T) {
 	defer app.RequireStart().RequireStop()
 }
 
+func TestConnManagerWarmup(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	go server.Serve(lis) //nolint:errcheck
+	defer server.Stop()
+
+	port := lis.Addr().(*net.TCPAddr).Port
+	addresses := []string{lis.Addr().String(), fmt.Sprintf("localhost:%d", port)}
+
+	t.Run("Should create and cache the connections", func(t *testing.T) {
+		m := NewConnManager([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())})
+		defer m.Stop(context.Background()) //nolint:errcheck
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, m.Warmup(ctx, addresses, WithWaitForReady()))
+		require.Equal(t, 2, m.Len())
+
+		for _, address := range addresses {
+			conn, err := m.Get(address)
+			require.NoError(t, err)
+			require.Equal(t, connectivity.Ready, conn.GetState())
+		}
+		require.Equal(t, 2, m.Len())
+	})
+
+	t.Run("Should not wait for the connections by default", func(t *testing.T) {
+		m := NewConnManager([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())})
+		defer m.Stop(context.Background()) //nolint:errcheck
+
+		require.NoError(t, m.Warmup(context.Background(), []string{freeAddress(t)}))
+		require.Equal(t, 1, m.Len())
+	})
+
+	t.Run("Should join the errors of the addresses", func(t *testing.T) {
+		m := NewConnManager([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())})
+		defer m.Stop(context.Background()) //nolint:errcheck
+
+		unreachable := []string{freeAddress(t), freeAddress(t)}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err := m.Warmup(ctx, append(unreachable, addresses[0]), WithWaitForReady())
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		for _, address := range unreachable {
+			require.ErrorContains(t, err, address)
+		}
+		require.NotContains(t, err.Error(), addresses[0])
+		require.Equal(t, 3, m.Len())
+	})
+}
+
+func TestConnManagerRedial(t *testing.T) {
+	m := NewConnManager([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())})
+	defer m.Stop(context.Background()) //nolint:errcheck
+	address := freeAddress(t)
+
+	t.Run("Should replace a connection which was shut down", func(t *testing.T) {
+		conn, err := m.Get(address)
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+		require.Equal(t, connectivity.Shutdown, conn.GetState())
+
+		redialed, err := m.Get(address)
+		require.NoError(t, err)
+		require.NotSame(t, conn, redialed)
+		require.NotEqual(t, connectivity.Shutdown, redialed.GetState())
+		require.Equal(t, 1, m.Len())
+	})
+
+	t.Run("Should keep a live connection", func(t *testing.T) {
+		conn, err := m.Get(address)
+		require.NoError(t, err)
+		again, err := m.Get(address)
+		require.NoError(t, err)
+		require.Same(t, conn, again)
+	})
+}
+
+func TestConnManagerMaxConns(t *testing.T) {
+	m := NewConnManager([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, WithMaxConns(2))
+	defer m.Stop(context.Background()) //nolint:errcheck
+	first, second, third := freeAddress(t), freeAddress(t), freeAddress(t)
+
+	t.Run("Should evict and close the least recently used connection", func(t *testing.T) {
+		firstConn, err := m.Get(first)
+		require.NoError(t, err)
+		secondConn, err := m.Get(second)
+		require.NoError(t, err)
+		// Using the first connection again makes the second one the least recently used
+		_, err = m.Get(first)
+		require.NoError(t, err)
+
+		_, err = m.Get(third)
+		require.NoError(t, err)
+		require.Equal(t, 2, m.Len())
+		require.Equal(t, connectivity.Shutdown, secondConn.GetState())
+		require.NotEqual(t, connectivity.Shutdown, firstConn.GetState())
+
+		again, err := m.Get(first)
+		require.NoError(t, err)
+		require.Same(t, firstConn, again)
+	})
+}
+
 // TODO: implement a test that tries to concurrently get connections
 // We can spawn a small server on localhost to target
+
+func TestConnManagerAuthority(t *testing.T) {
+	authorities := make(chan string, 10)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			authorities <- strings.Join(md.Get(":authority"), ",")
+			return handler(ctx, req)
+		},
+	))
+	pb.RegisterRouteGuideServer(server, echoRouteGuideServer{})
+	go server.Serve(lis) //nolint:errcheck
+	defer server.Stop()
+
+	m := NewConnManager([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())})
+	defer m.Stop(context.Background()) //nolint:errcheck
+	address := lis.Addr().String()
+
+	authority := func(t *testing.T, opts ...GetOption) string {
+		t.Helper()
+		conn, err := m.GetWithOpts(address, opts...)
+		require.NoError(t, err)
+		_, err = pb.NewRouteGuideClient(conn).GetFeature(context.Background(), &pb.Point{})
+		require.NoError(t, err)
+		return <-authorities
+	}
+
+	t.Run("Should set the authority of each target", func(t *testing.T) {
+		require.Equal(t, "a.example.com", authority(t, WithAuthority("a.example.com")))
+		require.Equal(t, "b.example.com:443", authority(t, WithAuthority("b.example.com:443")))
+		require.Equal(t, address, authority(t))
+		require.Equal(t, 3, m.Len())
+	})
+
+	t.Run("Should reuse the connection of a target", func(t *testing.T) {
+		first, err := m.GetWithOpts(address, WithAuthority("a.example.com"))
+		require.NoError(t, err)
+		second, err := m.GetWithOpts(address, WithAuthority("a.example.com"))
+		require.NoError(t, err)
+		require.Same(t, first, second)
+	})
+
+	t.Run("Should reject an invalid authority", func(t *testing.T) {
+		for _, authority := range []string{"a.example.com/path", "user@a.example.com", ":443", "a b"} {
+			_, err := m.GetWithOpts(address, WithAuthority(authority))
+			require.Error(t, err, authority)
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package fxgrpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DeadlineFloorInterceptorWeight places the interceptor after the logging, metrics and tracing interceptors,
+// so the calls it short-circuits are still observed
+const DeadlineFloorInterceptorWeight uint = 90
+
+// checkDeadlineFloor fails when the deadline of the context leaves less than floor to the call
+// Contexts without a deadline are not bounded
+func checkDeadlineFloor(ctx context.Context, method string, floor time.Duration) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	if remaining := time.Until(deadline); remaining < floor {
+		return status.Errorf(codes.DeadlineExceeded, "remaining deadline %s of %s is below the floor of %s", remaining, method, floor)
+	}
+	return nil
+}
+
+// NewDeadlineFloorInterceptors returns client interceptors that fail the calls with codes.DeadlineExceeded,
+// without sending them, when their remaining deadline is below floor
+// This avoids issuing calls which are bound to fail, eg: at the end of a chain of calls which inherit their deadline
+func NewDeadlineFloorInterceptors(floor time.Duration) (*UnaryClientInterceptor, *StreamClientInterceptor) {
+	unaryIx := &UnaryClientInterceptor{
+		Name:   "deadline-floor",
+		Weight: DeadlineFloorInterceptorWeight,
+		Interceptor: func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			if err := checkDeadlineFloor(ctx, method, floor); err != nil {
+				return err
+			}
+			return invoker(ctx, method, req, reply, cc, opts...)
+		},
+	}
+	streamIx := &StreamClientInterceptor{
+		Name:   "deadline-floor",
+		Weight: DeadlineFloorInterceptorWeight,
+		Interceptor: func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			if err := checkDeadlineFloor(ctx, method, floor); err != nil {
+				return nil, err
+			}
+			return streamer(ctx, desc, cc, method, opts...)
+		},
+	}
+	return unaryIx, streamIx
+}
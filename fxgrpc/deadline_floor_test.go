@@ -0,0 +1,75 @@
+package fxgrpc
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestDeadlineFloor(t *testing.T) {
+	var received atomic.Int64
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			received.Add(1)
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			received.Add(1)
+			return handler(srv, ss)
+		}),
+	)
+	pb.RegisterRouteGuideServer(server, echoRouteGuideServer{})
+	go server.Serve(lis) //nolint:errcheck
+	defer server.Stop()
+
+	conn, err := NewGrpcClient(
+		&Client{InsecureConnection: true, Endpoint: "passthrough:///bufnet", DeadlineFloor: 100 * time.Millisecond},
+		zap.NewNop(), nil, nil,
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+	)
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+	client := pb.NewRouteGuideClient(conn)
+
+	t.Run("Should short-circuit a call below the floor", func(t *testing.T) {
+		received.Store(0)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := client.GetFeature(ctx, &pb.Point{})
+		require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		require.Contains(t, status.Convert(err).Message(), "below the floor")
+
+		_, err = client.RecordRoute(ctx)
+		require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		require.Zero(t, received.Load())
+	})
+
+	t.Run("Should send a call above the floor", func(t *testing.T) {
+		received.Store(0)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		_, err := client.GetFeature(ctx, &pb.Point{})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), received.Load())
+	})
+
+	t.Run("Should send a call without deadline", func(t *testing.T) {
+		received.Store(0)
+		_, err := client.GetFeature(context.Background(), &pb.Point{})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), received.Load())
+	})
+}
@@ -0,0 +1,116 @@
+package fxgrpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+)
+
+// drainLogInterval is the interval at which the progress of a graceful stop is logged
+var drainLogInterval = 5 * time.Second
+
+// ServerStatsGroup is the value group of the ServerStats of the grpc servers of the system
+// The metrics module exposes their counts as gauges
+const ServerStatsGroup = `group:"grpc_server_stats"`
+
+// ServerStats is a stats.Handler counting the open connections and in-flight requests of a grpc server
+// It lets the server log the progress of a graceful stop
+type ServerStats struct {
+	connections atomic.Int64
+	inFlight    atomic.Int64
+	// methods holds the *atomic.Int64 counting the in-flight requests of each full method name
+	methods sync.Map
+}
+
+type methodInFlightCtxKey struct{}
+
+func NewServerStats() *ServerStats {
+	return &ServerStats{}
+}
+
+// Connections returns the number of transport connections currently open on the server
+func (s *ServerStats) Connections() int64 {
+	return s.connections.Load()
+}
+
+// InFlightRequests returns the number of requests currently being handled by the server
+func (s *ServerStats) InFlightRequests() int64 {
+	return s.inFlight.Load()
+}
+
+// InFlightRequestsByMethod returns the number of requests currently being handled by the server, by full method name
+// The methods which were called once are kept, with a count of 0
+func (s *ServerStats) InFlightRequestsByMethod() map[string]int64 {
+	methods := map[string]int64{}
+	s.methods.Range(func(method, count any) bool {
+		methods[method.(string)] = count.(*atomic.Int64).Load()
+		return true
+	})
+	return methods
+}
+
+func (s *ServerStats) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	count, ok := s.methods.Load(info.FullMethodName)
+	if !ok {
+		count, _ = s.methods.LoadOrStore(info.FullMethodName, &atomic.Int64{})
+	}
+	return context.WithValue(ctx, methodInFlightCtxKey{}, count)
+}
+
+func (s *ServerStats) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	count, _ := ctx.Value(methodInFlightCtxKey{}).(*atomic.Int64)
+	switch rs.(type) {
+	case *stats.Begin:
+		s.inFlight.Add(1)
+		if count != nil {
+			count.Add(1)
+		}
+	case *stats.End:
+		s.inFlight.Add(-1)
+		if count != nil {
+			count.Add(-1)
+		}
+	}
+}
+
+func (s *ServerStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (s *ServerStats) HandleConn(_ context.Context, cs stats.ConnStats) {
+	switch cs.(type) {
+	case *stats.ConnBegin:
+		s.connections.Add(1)
+	case *stats.ConnEnd:
+		s.connections.Add(-1)
+	}
+}
+
+// gracefulStop stops the server gracefully, logging the connections and requests left to drain until it is done
+func gracefulStop(s *grpc.Server, st *ServerStats, logger *zap.Logger) {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(drainLogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			logger.Info(
+				"Draining gRPC server",
+				zap.Int64("connections", st.Connections()),
+				zap.Int64("in_flight_requests", st.InFlightRequests()),
+			)
+		}
+	}
+}
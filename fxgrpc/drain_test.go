@@ -0,0 +1,75 @@
+package fxgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGracefulStop(t *testing.T) {
+	interval := drainLogInterval
+	drainLogInterval = 10 * time.Millisecond
+	defer func() { drainLogInterval = interval }()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	slowHandler := func(srv any, stream grpc.ServerStream) error {
+		close(started)
+		<-release
+		return nil
+	}
+
+	stats := NewServerStats()
+	server := grpc.NewServer(grpc.StatsHandler(stats), grpc.UnknownServiceHandler(slowHandler))
+	lis := bufconn.Listen(1024 * 1024)
+	go server.Serve(lis) //nolint:errcheck
+
+	conn, err := NewGrpcClient(
+		&Client{InsecureConnection: true, Endpoint: "passthrough:///bufnet"},
+		zap.NewNop(), nil, nil,
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+	)
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	stream, err := conn.NewStream(context.Background(), &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, "/unknown.Service/Method")
+	require.NoError(t, err)
+	require.NoError(t, stream.CloseSend())
+	<-started
+	require.Equal(t, int64(1), stats.Connections())
+	require.Equal(t, int64(1), stats.InFlightRequests())
+	require.Equal(t, map[string]int64{"/unknown.Service/Method": 1}, stats.InFlightRequestsByMethod())
+
+	core, logs := observer.New(zap.InfoLevel)
+	stopped := make(chan struct{})
+	go func() {
+		gracefulStop(server, stats, zap.New(core))
+		close(stopped)
+	}()
+
+	t.Run("Should log the requests left to drain while stopping", func(t *testing.T) {
+		require.Eventually(t, func() bool { return logs.FilterMessage("Draining gRPC server").Len() > 0 }, time.Second, 5*time.Millisecond)
+		entry := logs.FilterMessage("Draining gRPC server").All()[0]
+		require.Equal(t, int64(1), entry.ContextMap()["connections"])
+		require.Equal(t, int64(1), entry.ContextMap()["in_flight_requests"])
+	})
+
+	t.Run("Should return once the requests are drained", func(t *testing.T) {
+		close(release)
+		_ = stream.RecvMsg(&struct{}{})
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the server did not stop")
+		}
+		require.Equal(t, int64(0), stats.InFlightRequests())
+		require.Equal(t, map[string]int64{"/unknown.Service/Method": 0}, stats.InFlightRequestsByMethod())
+		require.Equal(t, int64(0), stats.Connections())
+	})
+}
@@ -2,20 +2,27 @@
 package fxgrpc
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
+	"runtime/debug"
 	"time"
 
 	reloader "github.com/exoscale/stelling/fxcert-reloader"
 	zapgrpc "github.com/exoscale/stelling/fxlogging/grpc"
+	"github.com/exoscale/stelling/fxlogging/summary"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 // TODO: refactor constructors in terms of DialOptions
@@ -28,7 +35,12 @@ func NewClientModule(conf ClientConfig) fx.Option {
 		"grpc-client",
 		fx.Supply(fx.Annotate(conf, fx.As(new(ClientConfig))), fx.Private),
 		fx.Provide(ProvideGrpcClient),
-		fx.Invoke(zapgrpc.SetGrpcLogger),
+		fx.Invoke(
+			setGrpcLogger(conf.GrpcClientConfig().DisableGrpcLogger),
+			LogClientInterceptorChain,
+		),
+		summary.ProvideFunc(clientSummary("", conf)),
+		provideReadinessGate("", "", conf),
 	)
 }
 
@@ -45,10 +57,28 @@ func NewNamedClientModule(name string, conf ClientConfig) fx.Option {
 		fx.Provide(
 			fx.Annotate(ProvideGrpcClient, fx.ResultTags(nameTag)),
 		),
-		fx.Invoke(zapgrpc.SetGrpcLogger),
+		fx.Invoke(
+			setGrpcLogger(conf.GrpcClientConfig().DisableGrpcLogger),
+			LogClientInterceptorChain,
+		),
+		summary.ProvideFunc(clientSummary(name, conf)),
+		provideReadinessGate(name, nameTag, conf),
 	)
 }
 
+// WithDialOption adds the given options to the grpc clients of the system
+// This is the supported way to customize the clients: they are applied after the options set by the client module, so they can override them
+func WithDialOption(opts ...grpc.DialOption) fx.Option {
+	provides := make([]any, 0, len(opts))
+	for _, opt := range opts {
+		provides = append(provides, fx.Annotate(
+			func() grpc.DialOption { return opt },
+			fx.ResultTags(`group:"grpc_client_options"`),
+		))
+	}
+	return fx.Provide(provides...)
+}
+
 type ClientConfig interface {
 	GrpcClientConfig() *Client
 }
@@ -57,30 +87,95 @@ type Client struct {
 	// InsecureConnection indicates whether TLS needs to be disabled when connecting to the grpc server
 	InsecureConnection bool
 	// CertFile is the path to the pem encoded TLS certificate
-	CertFile string `validate:"omitempty,file"`
+	CertFile string `validate:"required_with=KeyFile,omitempty,file"`
 	// KeyFile is the path to the pem encoded private key of the TLS certificate
 	KeyFile string `validate:"required_with=CertFile,omitempty,file"`
 	// RootCAFile is the  path to a pem encoded CA bundle used to validate server connections
 	RootCAFile string `validate:"omitempty,file"`
 	// Endpoint is IP or hostname or scheme for the target gRPC server
+	// An endpoint of the form srv://_grpc._tcp.service.domain is resolved from the SRV records of that name
 	Endpoint string `validate:"required"`
+	// BlockingDial makes the client connect when the system starts, rather than on the first request
+	// The system fails to start if the connection isn't ready within the DialTimeout
+	BlockingDial bool
+	// DialTimeout is the maximum time to wait for the connection when BlockingDial is set
+	DialTimeout time.Duration `default:"5s"`
+	// LoadBalancingPolicy is the policy used to pick a backend when the Endpoint resolves to multiple addresses
+	LoadBalancingPolicy string `default:"pick_first" validate:"omitempty,oneof=pick_first round_robin"`
+	// Compression is the name of the compressor used for all requests (eg: gzip)
+	// Requests are not compressed when it is unset
+	Compression string `validate:"omitempty,oneof=gzip"`
+	// UserAgent identifies the client to the server, in front of the grpc-go user agent
+	// Defaults to the name of the executable and its vcs revision when unset
+	UserAgent string
+	// ServiceName identifies the calling service to the server, through the peer.service request metadata
+	// It takes precedence over the name set by the logging module, which defaults to OTEL_SERVICE_NAME or the name of the executable
+	ServiceName string
+	// DeadlineFloor fails the calls with codes.DeadlineExceeded, without sending them, when their remaining deadline is lower
+	// It is disabled when unset
+	DeadlineFloor time.Duration `validate:"gte=0"`
+	// ReadinessTimeout makes the health module report NOT_SERVING until the connection is ready
+	// A connection which isn't ready within this duration is logged, and keeps the system NOT_SERVING until it is
+	// It is disabled when unset
+	ReadinessTimeout time.Duration `validate:"gte=0"`
+	// ReadyAfterReadinessTimeout makes the health module report SERVING once the ReadinessTimeout expires,
+	// even if the connection isn't ready
+	ReadyAfterReadinessTimeout bool
+	// DisableGrpcLogger keeps the global grpc logger, rather than replacing it with the logger of the system
+	// It must be set on all the grpc modules of the system, as any of them replaces it
+	DisableGrpcLogger bool
 }
 
 func (c *Client) GrpcClientConfig() *Client {
 	return c
 }
 
+// ClientTLSConfig allows the TLS settings of the client to be reused, eg: with fxcert_reloader.NewHTTPClient
+func (c *Client) ClientTLSConfig() *reloader.ClientTLS {
+	return &reloader.ClientTLS{
+		InsecureConnection: c.InsecureConnection,
+		CertFile:           c.CertFile,
+		KeyFile:            c.KeyFile,
+		RootCAFile:         c.RootCAFile,
+	}
+}
+
 func (c *Client) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	if c == nil {
 		return nil
 	}
 
 	enc.AddString("endpoint", c.Endpoint)
-	enc.AddBool("insecure-connection", c.InsecureConnection)
-	if !c.InsecureConnection {
-		enc.AddString("cert-file", c.CertFile)
-		enc.AddString("key-file", c.KeyFile)
-		enc.AddString("root-ca-file", c.RootCAFile)
+	if err := c.ClientTLSConfig().MarshalLogObject(enc); err != nil {
+		return err
+	}
+	if c.LoadBalancingPolicy != "" {
+		enc.AddString("load-balancing-policy", c.LoadBalancingPolicy)
+	}
+	if c.Compression != "" {
+		enc.AddString("compression", c.Compression)
+	}
+	if c.UserAgent != "" {
+		enc.AddString("user-agent", c.UserAgent)
+	}
+	if c.ServiceName != "" {
+		enc.AddString("service-name", c.ServiceName)
+	}
+	if c.BlockingDial {
+		enc.AddBool("blocking-dial", c.BlockingDial)
+		enc.AddDuration("dial-timeout", c.DialTimeout)
+	}
+	if c.DeadlineFloor > 0 {
+		enc.AddDuration("deadline-floor", c.DeadlineFloor)
+	}
+	if c.ReadinessTimeout > 0 {
+		enc.AddDuration("readiness-timeout", c.ReadinessTimeout)
+	}
+	if c.ReadyAfterReadinessTimeout {
+		enc.AddBool("ready-after-readiness-timeout", c.ReadyAfterReadinessTimeout)
+	}
+	if c.DisableGrpcLogger {
+		enc.AddBool("disable-grpc-logger", c.DisableGrpcLogger)
 	}
 
 	return nil
@@ -119,7 +214,7 @@ func MakeClientTLS(c ClientConfig, logger *zap.Logger) (credentials.TransportCre
 		r, err := reloader.NewCertReloader(&reloader.CertReloaderConfig{
 			CertFile:       conf.CertFile,
 			KeyFile:        conf.KeyFile,
-			ReloadInterval: 1 * time.Hour,
+			ReloadInterval: reloader.DefaultReloadInterval,
 		}, logger)
 		if err != nil {
 			return nil, nil, err
@@ -160,15 +255,17 @@ func NewGrpcClient(conf ClientConfig, logger *zap.Logger, ui []*UnaryClientInter
 		return nil, err
 	}
 
-	opts := []grpc.DialOption{
-		grpc.WithTransportCredentials(creds),
-		WithUnaryClientInterceptors(ui),
-		WithStreamClientInterceptors(si),
+	conn, err := grpc.NewClient(conf.GrpcClientConfig().Endpoint, clientDialOptions(conf.GrpcClientConfig(), creds, ui, si, dOpts)...)
+	if err != nil {
+		return nil, err
 	}
-	// Add the externally supplied options last: this allows the user to override any options we may have set already
-	opts = append(opts, dOpts...)
-
-	return grpc.NewClient(conf.GrpcClientConfig().Endpoint, opts...)
+	if conf.GrpcClientConfig().BlockingDial {
+		if err := waitForReady(context.Background(), conn, conf.GrpcClientConfig()); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
 }
 
 func ProvideGrpcClient(p GrpcClientParams) (grpc.ClientConnInterface, error) {
@@ -180,13 +277,142 @@ func ProvideGrpcClient(p GrpcClientParams) (grpc.ClientConnInterface, error) {
 		p.Lc.Append(fx.Hook{OnStart: r.Start, OnStop: r.Stop})
 	}
 
+	conn, err := grpc.NewClient(p.Conf.GrpcClientConfig().Endpoint, clientDialOptions(p.Conf.GrpcClientConfig(), creds, p.UnaryInterceptors, p.StreamInterceptors, p.ClientOpts)...)
+	if err != nil {
+		return nil, err
+	}
+	if p.Conf.GrpcClientConfig().BlockingDial {
+		p.Lc.Append(fx.Hook{
+			OnStart: func(ctx context.Context) error {
+				return waitForReady(ctx, conn, p.Conf.GrpcClientConfig())
+			},
+		})
+	}
+	return conn, nil
+}
+
+// defaultServiceConfig returns the service config used when the resolver doesn't provide one
+func defaultServiceConfig(conf *Client) string {
+	if conf.LoadBalancingPolicy == "" {
+		return ""
+	}
+	return fmt.Sprintf(`{"loadBalancingConfig": [{%q: {}}]}`, conf.LoadBalancingPolicy)
+}
+
+// setGrpcLogger returns an Invoke function installing the logger of the system as the global grpc logger, unless disabled
+func setGrpcLogger(disabled bool) func(*zap.Logger) {
+	return func(logger *zap.Logger) {
+		if !disabled {
+			zapgrpc.SetGrpcLogger(logger)
+		}
+	}
+}
+
+// waitForReady connects the client and waits until the connection is ready
+// The wait is bounded by both ctx, typically the start context of the system, and the DialTimeout
+func waitForReady(ctx context.Context, conn *grpc.ClientConn, conf *Client) error {
+	dialCtx := ctx
+	if conf.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithTimeout(ctx, conf.DialTimeout)
+		defer cancel()
+	}
+
+	if state, ok := connectAndWait(dialCtx, conn); !ok {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("aborted connecting to %s (last state: %s): %w", conf.Endpoint, state, err)
+		}
+		return fmt.Errorf("failed to connect to %s within %s (last state: %s): %w", conf.Endpoint, conf.DialTimeout, state, dialCtx.Err())
+	}
+	return nil
+}
+
+// connectAndWait connects the client and waits until the connection is ready or ctx is done
+// It returns the last state of the connection, and whether it is ready
+func connectAndWait(ctx context.Context, conn *grpc.ClientConn) (connectivity.State, bool) {
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return state, true
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return state, false
+		}
+	}
+}
+
+// PeerServiceMDKey is the request metadata identifying the calling service
+const PeerServiceMDKey = "peer.service"
+
+func newPeerServiceUnaryClientInterceptor(name string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, PeerServiceMDKey, name)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func newPeerServiceStreamClientInterceptor(name string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = metadata.AppendToOutgoingContext(ctx, PeerServiceMDKey, name)
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// defaultUserAgent returns the name of the executable and its vcs revision, eg: my-service/0123abcd
+func defaultUserAgent() string {
+	name := "undefined"
+	if pathName, err := os.Executable(); err == nil && pathName != "" {
+		name = filepath.Base(pathName)
+	}
+	version := "undefined"
+	// info.Main.Version is `(devel)` unless the binary is installed through go install
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, item := range info.Settings {
+			if item.Key == "vcs.revision" {
+				version = item.Value
+				break
+			}
+		}
+	}
+	return name + "/" + version
+}
+
+// clientDialOptions assembles the dial options shared by NewGrpcClient and ProvideGrpcClient
+// This guarantees both produce the same interceptor chain for the same input
+func clientDialOptions(conf *Client, creds credentials.TransportCredentials, ui []*UnaryClientInterceptor, si []*StreamClientInterceptor, dOpts []grpc.DialOption) []grpc.DialOption {
+	userAgent := conf.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent()
+	}
 	opts := []grpc.DialOption{
 		grpc.WithTransportCredentials(creds),
-		WithUnaryClientInterceptors(p.UnaryInterceptors),
-		WithStreamClientInterceptors(p.StreamInterceptors),
+		grpc.WithUserAgent(userAgent),
+		grpc.WithResolvers(newSRVResolverBuilder(net.DefaultResolver.LookupSRV)),
+	}
+	if conf.ServiceName != "" {
+		// Installed ahead of the interceptor chain, so it runs before the ones of the logging module
+		opts = append(opts,
+			grpc.WithChainUnaryInterceptor(newPeerServiceUnaryClientInterceptor(conf.ServiceName)),
+			grpc.WithChainStreamInterceptor(newPeerServiceStreamClientInterceptor(conf.ServiceName)),
+		)
+	}
+	if conf.DeadlineFloor > 0 {
+		// Installed directly, rather than through the group, so it only applies to this client
+		u, s := NewDeadlineFloorInterceptors(conf.DeadlineFloor)
+		ui = append(append([]*UnaryClientInterceptor(nil), ui...), u)
+		si = append(append([]*StreamClientInterceptor(nil), si...), s)
+	}
+	opts = append(opts,
+		WithUnaryClientInterceptors(ui),
+		WithStreamClientInterceptors(si),
+	)
+	if sc := defaultServiceConfig(conf); sc != "" {
+		opts = append(opts, grpc.WithDefaultServiceConfig(sc))
+	}
+	if conf.Compression != "" {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(conf.Compression)))
 	}
 	// Add the externally supplied options last: this allows the user to override any options we may have set already
-	opts = append(opts, p.ClientOpts...)
-
-	return grpc.NewClient(p.Conf.GrpcClientConfig().Endpoint, opts...)
+	return append(opts, dOpts...)
 }
@@ -0,0 +1,387 @@
+package fxgrpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// recordingInterceptors returns interceptors that record their name when invoked
+func recordingInterceptors(order *[]string, weights ...uint) ([]*UnaryClientInterceptor, []*StreamClientInterceptor) {
+	ui := make([]*UnaryClientInterceptor, 0, len(weights))
+	si := make([]*StreamClientInterceptor, 0, len(weights))
+	for i, weight := range weights {
+		name := fmt.Sprintf("%d-%d", i, weight)
+		ui = append(ui, &UnaryClientInterceptor{
+			Weight: weight,
+			Interceptor: func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+				*order = append(*order, name)
+				return invoker(ctx, method, req, reply, cc, opts...)
+			},
+		})
+		si = append(si, &StreamClientInterceptor{
+			Weight: weight,
+			Interceptor: func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				*order = append(*order, name)
+				return streamer(ctx, desc, cc, method, opts...)
+			},
+		})
+	}
+	return ui, si
+}
+
+// terminatingOptions adds interceptors at the end of the chain that never reach the network,
+// so the interceptor chain can be tested without a server
+var terminatingOptions = []grpc.DialOption{
+	grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return nil
+	}),
+	grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, nil
+	}),
+}
+
+func TestClientInterceptorOrder(t *testing.T) {
+	conf := &Client{InsecureConnection: true, Endpoint: "passthrough:///localhost:0"}
+	weights := []uint{60, 30, 50, 49, 70}
+	expected := []string{"1-30", "3-49", "2-50", "0-60", "4-70"}
+
+	t.Run("Should order interceptors by weight in NewGrpcClient", func(t *testing.T) {
+		order := []string{}
+		ui, si := recordingInterceptors(&order, weights...)
+		conn, err := NewGrpcClient(conf, zaptest.NewLogger(t), ui, si, terminatingOptions...)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		require.NoError(t, conn.Invoke(context.Background(), "/test/Method", nil, nil))
+		require.Equal(t, expected, order)
+
+		order = order[:0]
+		_, err = conn.NewStream(context.Background(), &grpc.StreamDesc{}, "/test/Method")
+		require.NoError(t, err)
+		require.Equal(t, expected, order)
+	})
+
+	t.Run("Should order interceptors by weight in ProvideGrpcClient", func(t *testing.T) {
+		order := []string{}
+		ui, si := recordingInterceptors(&order, weights...)
+		conn, err := ProvideGrpcClient(GrpcClientParams{
+			Lc:                 fxtest.NewLifecycle(t),
+			Conf:               conf,
+			Logger:             zaptest.NewLogger(t),
+			UnaryInterceptors:  ui,
+			StreamInterceptors: si,
+			ClientOpts:         terminatingOptions,
+		})
+		require.NoError(t, err)
+		defer conn.(*grpc.ClientConn).Close()
+
+		require.NoError(t, conn.Invoke(context.Background(), "/test/Method", nil, nil))
+		require.Equal(t, expected, order)
+
+		order = order[:0]
+		_, err = conn.NewStream(context.Background(), &grpc.StreamDesc{}, "/test/Method")
+		require.NoError(t, err)
+		require.Equal(t, expected, order)
+	})
+}
+
+func TestBlockingDial(t *testing.T) {
+	deadAddress := func(t *testing.T) string {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := lis.Addr().String()
+		require.NoError(t, lis.Close())
+		return addr
+	}
+
+	t.Run("Should fail to start when the endpoint is unreachable", func(t *testing.T) {
+		conf := &Client{InsecureConnection: true, Endpoint: deadAddress(t), BlockingDial: true, DialTimeout: 200 * time.Millisecond}
+		lc := fxtest.NewLifecycle(t)
+		conn, err := ProvideGrpcClient(GrpcClientParams{Lc: lc, Conf: conf, Logger: zaptest.NewLogger(t)})
+		require.NoError(t, err)
+		defer conn.(*grpc.ClientConn).Close()
+
+		start := time.Now()
+		err = lc.Start(context.Background())
+		require.Error(t, err)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Contains(t, err.Error(), conf.Endpoint)
+		require.Less(t, time.Since(start), 2*time.Second)
+	})
+
+	t.Run("Should abort the dial when the start context is cancelled", func(t *testing.T) {
+		conf := &Client{InsecureConnection: true, Endpoint: deadAddress(t), BlockingDial: true, DialTimeout: time.Minute}
+		lc := fxtest.NewLifecycle(t)
+		conn, err := ProvideGrpcClient(GrpcClientParams{Lc: lc, Conf: conf, Logger: zaptest.NewLogger(t)})
+		require.NoError(t, err)
+		defer conn.(*grpc.ClientConn).Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+		start := time.Now()
+		err = lc.Start(ctx)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Contains(t, err.Error(), "aborted connecting to "+conf.Endpoint)
+		require.Less(t, time.Since(start), 2*time.Second)
+	})
+
+	t.Run("Should be bounded by the deadline of the start context", func(t *testing.T) {
+		conf := &Client{InsecureConnection: true, Endpoint: deadAddress(t), BlockingDial: true, DialTimeout: time.Minute}
+		lc := fxtest.NewLifecycle(t)
+		conn, err := ProvideGrpcClient(GrpcClientParams{Lc: lc, Conf: conf, Logger: zaptest.NewLogger(t)})
+		require.NoError(t, err)
+		defer conn.(*grpc.ClientConn).Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err = lc.Start(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Less(t, time.Since(start), 2*time.Second)
+	})
+
+	t.Run("Should start when the endpoint is reachable", func(t *testing.T) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		srv := grpc.NewServer()
+		go srv.Serve(lis) //nolint:errcheck
+		defer srv.Stop()
+
+		conf := &Client{InsecureConnection: true, Endpoint: lis.Addr().String(), BlockingDial: true, DialTimeout: 5 * time.Second}
+		lc := fxtest.NewLifecycle(t)
+		conn, err := ProvideGrpcClient(GrpcClientParams{Lc: lc, Conf: conf, Logger: zaptest.NewLogger(t)})
+		require.NoError(t, err)
+		defer conn.(*grpc.ClientConn).Close()
+
+		require.NoError(t, lc.Start(context.Background()))
+		require.Equal(t, connectivity.Ready, conn.(*grpc.ClientConn).GetState())
+		require.NoError(t, lc.Stop(context.Background()))
+	})
+
+	t.Run("Should not connect on start by default", func(t *testing.T) {
+		conf := &Client{InsecureConnection: true, Endpoint: deadAddress(t)}
+		lc := fxtest.NewLifecycle(t)
+		conn, err := ProvideGrpcClient(GrpcClientParams{Lc: lc, Conf: conf, Logger: zaptest.NewLogger(t)})
+		require.NoError(t, err)
+		defer conn.(*grpc.ClientConn).Close()
+
+		require.NoError(t, lc.Start(context.Background()))
+		require.Equal(t, connectivity.Idle, conn.(*grpc.ClientConn).GetState())
+		require.NoError(t, lc.Stop(context.Background()))
+	})
+
+	t.Run("Should fail NewGrpcClient when the endpoint is unreachable", func(t *testing.T) {
+		conf := &Client{InsecureConnection: true, Endpoint: deadAddress(t), BlockingDial: true, DialTimeout: 200 * time.Millisecond}
+		_, err := NewGrpcClient(conf, zaptest.NewLogger(t), nil, nil)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestLoadBalancingPolicy(t *testing.T) {
+	cases := []struct {
+		name     string
+		policy   string
+		expected string
+	}{
+		{
+			name:     "Should not set a service config without a policy",
+			policy:   "",
+			expected: "",
+		},
+		{
+			name:     "Should set the pick_first policy",
+			policy:   "pick_first",
+			expected: `{"loadBalancingConfig": [{"pick_first": {}}]}`,
+		},
+		{
+			name:     "Should set the round_robin policy",
+			policy:   "round_robin",
+			expected: `{"loadBalancingConfig": [{"round_robin": {}}]}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &Client{InsecureConnection: true, Endpoint: "dns:///localhost:0", LoadBalancingPolicy: tc.policy}
+			require.Equal(t, tc.expected, defaultServiceConfig(conf))
+
+			noPolicy := clientDialOptions(&Client{}, nil, nil, nil, nil)
+			opts := clientDialOptions(conf, nil, nil, nil, nil)
+			if tc.expected == "" {
+				require.Len(t, opts, len(noPolicy))
+			} else {
+				require.Len(t, opts, len(noPolicy)+1)
+			}
+
+			// grpc validates the service config when creating the client
+			conn, err := NewGrpcClient(conf, zaptest.NewLogger(t), nil, nil)
+			require.NoError(t, err)
+			require.NoError(t, conn.Close())
+		})
+	}
+
+	t.Run("Should reject unknown policies", func(t *testing.T) {
+		conf := &Client{Endpoint: "localhost:8080", LoadBalancingPolicy: "random"}
+		err := validator.New().Struct(conf)
+		require.Error(t, err)
+	})
+}
+
+type compressionRouteGuideServer struct {
+	pb.UnimplementedRouteGuideServer
+}
+
+func (s *compressionRouteGuideServer) GetFeature(ctx context.Context, req *pb.Point) (*pb.Feature, error) {
+	return &pb.Feature{Name: strings.Repeat("compressible ", 1000), Location: req}, nil
+}
+
+// payloadRecorder is a stats.Handler which records the payloads received by the client
+type payloadRecorder struct {
+	lock     sync.Mutex
+	payloads []*stats.InPayload
+}
+
+func (r *payloadRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (r *payloadRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (r *payloadRecorder) HandleConn(context.Context, stats.ConnStats) {}
+
+func (r *payloadRecorder) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if p, ok := s.(*stats.InPayload); ok {
+		r.lock.Lock()
+		r.payloads = append(r.payloads, p)
+		r.lock.Unlock()
+	}
+}
+
+func TestCompression(t *testing.T) {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	pb.RegisterRouteGuideServer(srv, &compressionRouteGuideServer{})
+	go srv.Serve(lis) //nolint:errcheck
+	defer srv.Stop()
+
+	for _, compression := range []string{"", "gzip"} {
+		t.Run(fmt.Sprintf("Should round-trip requests with compression %q", compression), func(t *testing.T) {
+			recorder := &payloadRecorder{}
+			conf := &Client{InsecureConnection: true, Endpoint: "passthrough://bufconn", Compression: compression}
+			conn, err := NewGrpcClient(conf, zaptest.NewLogger(t), nil, nil,
+				grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+				grpc.WithStatsHandler(recorder),
+			)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			resp, err := pb.NewRouteGuideClient(conn).GetFeature(context.Background(), &pb.Point{Latitude: 42})
+			require.NoError(t, err)
+			require.Equal(t, int32(42), resp.Location.Latitude)
+
+			// The server compresses the response with the compressor used by the request
+			recorder.lock.Lock()
+			defer recorder.lock.Unlock()
+			require.Len(t, recorder.payloads, 1)
+			if compression == "" {
+				require.Equal(t, recorder.payloads[0].Length, recorder.payloads[0].CompressedLength)
+			} else {
+				require.Less(t, recorder.payloads[0].CompressedLength, recorder.payloads[0].Length)
+			}
+		})
+	}
+}
+
+func TestWithDialOption(t *testing.T) {
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	go server.Serve(lis) //nolint:errcheck
+	defer server.Stop()
+
+	dialed := make(chan string, 1)
+	dialer := func(_ context.Context, addr string) (net.Conn, error) {
+		dialed <- addr
+		return lis.Dial()
+	}
+
+	var conn grpc.ClientConnInterface
+	app := fxtest.New(
+		t,
+		fx.Supply(zap.NewNop()),
+		NewClientModule(&Client{InsecureConnection: true, Endpoint: "passthrough:///bufnet"}),
+		WithDialOption(grpc.WithContextDialer(dialer)),
+		fx.Populate(&conn),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	err := conn.Invoke(context.Background(), "/test.Service/Method", &emptypb.Empty{}, &emptypb.Empty{})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+	require.Equal(t, "bufnet", <-dialed)
+}
+
+func TestUserAgent(t *testing.T) {
+	lis := bufconn.Listen(1024 * 1024)
+	userAgents := make(chan string, 1)
+	server := grpc.NewServer(grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		userAgents <- strings.Join(md.Get("user-agent"), ",")
+		return nil
+	}))
+	go server.Serve(lis) //nolint:errcheck
+	defer server.Stop()
+
+	userAgent := func(t *testing.T, conf *Client) string {
+		t.Helper()
+		conn, err := NewGrpcClient(conf, zaptest.NewLogger(t), nil, nil,
+			grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		)
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		stream, err := conn.NewStream(context.Background(), &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, "/test.Service/Method")
+		require.NoError(t, err)
+		require.NoError(t, stream.CloseSend())
+		_ = stream.RecvMsg(&struct{}{})
+		return <-userAgents
+	}
+
+	t.Run("Should send the configured user agent", func(t *testing.T) {
+		got := userAgent(t, &Client{InsecureConnection: true, Endpoint: "passthrough:///bufnet", UserAgent: "my-service/1.2.3"})
+		require.True(t, strings.HasPrefix(got, "my-service/1.2.3 grpc-go/"), got)
+	})
+
+	t.Run("Should default to the name and revision of the executable", func(t *testing.T) {
+		executable, err := os.Executable()
+		require.NoError(t, err)
+
+		got := userAgent(t, &Client{InsecureConnection: true, Endpoint: "passthrough:///bufnet"})
+		require.True(t, strings.HasPrefix(got, filepath.Base(executable)+"/"), got)
+		require.Equal(t, strings.SplitN(got, " ", 2)[0], defaultUserAgent())
+	})
+}
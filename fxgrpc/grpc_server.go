@@ -3,11 +3,12 @@ package fxgrpc
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	reloader "github.com/exoscale/stelling/fxcert-reloader"
 	fxhttp "github.com/exoscale/stelling/fxhttp"
-	zapgrpc "github.com/exoscale/stelling/fxlogging/grpc"
+	"github.com/exoscale/stelling/fxlogging/summary"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -30,14 +31,42 @@ type Server struct {
 	SocketName string
 	// Address is the address+port the server will bind to, as passed to net.Listen
 	Address string `default:"localhost:8080"`
+	// AdvertiseAddress is the address+port clients should use to reach the server, when it differs from the bind Address
+	// eg: when the server binds 0.0.0.0 in a container. It is meant for service discovery registration
+	AdvertiseAddress string
 	// TLS indicates whether the http server exposes with TLS
 	TLS bool
 	// CertFile is the path to the pem encoded TLS certificate
-	CertFile string `validate:"required_if=TLS true,omitempty,file"`
+	// It must be unset when TLS is disabled, so a misconfiguration does not silently serve plaintext
+	CertFile string `validate:"required_if=TLS true,excluded_without=TLS,omitempty,file"`
 	// KeyFile is the path to the pem encoded private key of the TLS certificate
-	KeyFile string `validate:"required_if=TLS true,omitempty,file"`
-	// ClientCAFile is the path to a pem encoded CA cert bundle used to validate clients
-	ClientCAFile string `validate:"excluded_without=TLS,omitempty,file"`
+	KeyFile string `validate:"required_if=TLS true,excluded_without=TLS,omitempty,file"`
+	// ClientCAFile is the path to a pem encoded CA cert bundle, or a directory of bundles, used to validate clients
+	// It is periodically reloaded, so new CAs take effect without a restart
+	ClientCAFile string `validate:"excluded_without=TLS,omitempty,file|dir"`
+	// RequireClientCert rejects requests without a verified client certificate with codes.Unauthenticated
+	// This protects against a client CA misconfiguration
+	RequireClientCert bool `validate:"excluded_without=TLS"`
+	// TLSMinVersion is the minimum TLS version accepted by the server (eg: 1.3)
+	TLSMinVersion string `validate:"excluded_without=TLS,omitempty,oneof=1.0 1.1 1.2 1.3"`
+	// TLSCipherSuites restricts the cipher suites accepted by the server (eg: TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256)
+	// The TLS 1.3 cipher suites are not configurable
+	TLSCipherSuites []string `validate:"excluded_without=TLS"`
+	// ALPNProtocols are the application protocols negotiated with the clients, in order of preference (eg: h2)
+	// grpc always adds h2, which it requires
+	ALPNProtocols []string `validate:"excluded_without=TLS"`
+	// MethodTimeouts bounds the duration of the given methods, by full method name (eg: /pkg.Service/Method)
+	// An earlier deadline set by the client is kept
+	MethodTimeouts map[string]time.Duration `validate:"dive,gt=0"`
+	// MethodMaxStreams caps the number of concurrent streams of the given methods, by full method name (eg: /pkg.Service/Method)
+	// Streams above the cap are rejected with codes.ResourceExhausted
+	MethodMaxStreams map[string]int `validate:"dive,gt=0"`
+	// MethodMaxRequestSizes bounds the size in bytes of the requests of the given methods, by full method name (eg: /pkg.Service/Method)
+	// Larger requests are rejected with codes.InvalidArgument, it is meant to be lower than the global max message size
+	MethodMaxRequestSizes map[string]int `validate:"dive,gt=0"`
+	// DisableGrpcLogger keeps the global grpc logger, rather than replacing it with the logger of the system
+	// It must be set on all the grpc modules of the system, as any of them replaces it
+	DisableGrpcLogger bool
 }
 
 func (s *Server) MarshalLogObject(enc zapcore.ObjectEncoder) error {
@@ -47,12 +76,51 @@ func (s *Server) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 
 	enc.AddString("socket-name", s.SocketName)
 	enc.AddString("address", s.Address)
-	enc.AddBool("tls", s.TLS)
+	if s.AdvertiseAddress != "" {
+		enc.AddString("advertise-address", s.AdvertiseAddress)
+	}
+	if err := s.ServerTLSConfig().MarshalLogObject(enc); err != nil {
+		return err
+	}
 
 	if s.TLS {
-		enc.AddString("cert-file", s.CertFile)
-		enc.AddString("key-file", s.KeyFile)
-		enc.AddString("client-ca-file", s.ClientCAFile)
+		enc.AddBool("require-client-cert", s.RequireClientCert)
+		if s.TLSMinVersion != "" {
+			enc.AddString("tls-min-version", s.TLSMinVersion)
+		}
+		if len(s.TLSCipherSuites) > 0 {
+			enc.AddString("tls-cipher-suites", strings.Join(s.TLSCipherSuites, ","))
+		}
+		if len(s.ALPNProtocols) > 0 {
+			enc.AddString("alpn-protocols", strings.Join(s.ALPNProtocols, ","))
+		}
+	}
+	if s.DisableGrpcLogger {
+		enc.AddBool("disable-grpc-logger", s.DisableGrpcLogger)
+	}
+	if len(s.MethodTimeouts) > 0 {
+		enc.AddObject("method-timeouts", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			for method, timeout := range s.MethodTimeouts {
+				enc.AddDuration(method, timeout)
+			}
+			return nil
+		}))
+	}
+	if len(s.MethodMaxStreams) > 0 {
+		enc.AddObject("method-max-streams", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			for method, limit := range s.MethodMaxStreams {
+				enc.AddInt(method, limit)
+			}
+			return nil
+		}))
+	}
+	if len(s.MethodMaxRequestSizes) > 0 {
+		enc.AddObject("method-max-request-sizes", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			for method, size := range s.MethodMaxRequestSizes {
+				enc.AddInt(method, size)
+			}
+			return nil
+		}))
 	}
 
 	return nil
@@ -62,10 +130,9 @@ func (s *Server) GrpcServerConfig() *Server {
 	return s
 }
 
-func (s *Server) AsHttpConfig() *fxhttp.Server {
-	return &fxhttp.Server{
-		SocketName:   s.SocketName,
-		Address:      s.Address,
+// ServerTLSConfig returns the TLS settings of the server
+func (s *Server) ServerTLSConfig() *reloader.ServerTLS {
+	return &reloader.ServerTLS{
 		TLS:          s.TLS,
 		CertFile:     s.CertFile,
 		KeyFile:      s.KeyFile,
@@ -73,6 +140,29 @@ func (s *Server) AsHttpConfig() *fxhttp.Server {
 	}
 }
 
+// AdvertisedAddress returns the address clients should use to reach the server
+// It is the AdvertiseAddress if set, and the bind Address otherwise
+func (s *Server) AdvertisedAddress() string {
+	if s.AdvertiseAddress != "" {
+		return s.AdvertiseAddress
+	}
+	return s.Address
+}
+
+func (s *Server) AsHttpConfig() *fxhttp.Server {
+	return &fxhttp.Server{
+		SocketName:      s.SocketName,
+		Address:         s.Address,
+		TLS:             s.TLS,
+		CertFile:        s.CertFile,
+		KeyFile:         s.KeyFile,
+		ClientCAFile:    s.ClientCAFile,
+		TLSMinVersion:   s.TLSMinVersion,
+		TLSCipherSuites: s.TLSCipherSuites,
+		ALPNProtocols:   s.ALPNProtocols,
+	}
+}
+
 type serverModuleOpts struct {
 	name string
 }
@@ -80,6 +170,11 @@ type serverModuleOpts struct {
 type serverModuleOption func(*serverModuleOpts)
 
 // WithServerModuleName will annotate the outputs with the given name
+// This allows several grpc servers with distinct configurations to coexist in the system,
+// eg: an admin server next to the public one
+// The named server must be started with:
+//
+//	fx.Annotate(StartGrpcServer, fx.ParamTags(``, ``, `name:"yourname"`))
 func WithServerModuleName(name string) serverModuleOption {
 	return func(o *serverModuleOpts) {
 		o.name = name
@@ -104,9 +199,26 @@ func NewServerModule(conf Config, sOpts ...serverModuleOption) fx.Option {
 		),
 		fx.Provide(
 			NewGrpcServer,
+			NewServerStats,
+			// Only the credentials of this server are passed to NewGrpcServer
+			fx.Annotate(
+				func(creds credentials.TransportCredentials) credentials.TransportCredentials { return creds },
+				fx.ParamTags(ServerCredentialsName(modOpts.name)+` optional:"true"`),
+				fx.ResultTags(serverModuleCredsTag),
+			),
 			fx.Private,
 		),
-		fx.Invoke(zapgrpc.SetGrpcLogger),
+		fx.Provide(
+			fx.Annotate(
+				func(s *ServerStats) *ServerStats { return s },
+				fx.ResultTags(ServerStatsGroup),
+			),
+		),
+		fx.Invoke(
+			setGrpcLogger(conf.GrpcServerConfig().DisableGrpcLogger),
+			LogServerInterceptorChain,
+		),
+		summary.ProvideFunc(serverSummary(modOpts.name, conf)),
 	)
 	if modOpts.name == "" {
 		opts = fx.Options(
@@ -126,7 +238,20 @@ func NewServerModule(conf Config, sOpts ...serverModuleOption) fx.Option {
 			opts,
 			fx.Provide(
 				fx.Annotate(
-					newServer,
+					func(unary []*UnaryServerInterceptor, stream []*StreamServerInterceptor) *ScopedServerInterceptors {
+						return &ScopedServerInterceptors{Server: modOpts.name, Unary: unary, Stream: stream}
+					},
+					fx.ParamTags(UnaryServerInterceptorGroup(modOpts.name), StreamServerInterceptorGroup(modOpts.name)),
+				),
+				fx.Private,
+			),
+			fx.Provide(
+				fx.Annotate(
+					func(s *grpc.Server, conf Config, stats *ServerStats) *server {
+						srv := newServer(s, conf, stats)
+						srv.name = modOpts.name
+						return srv
+					},
 					fx.ResultTags(nameTag),
 				),
 				fx.Annotate(
@@ -153,7 +278,8 @@ func NewServerModule(conf Config, sOpts ...serverModuleOption) fx.Option {
 			opts,
 			fx.Provide(
 				fx.Annotate(
-					GetCertReloaderConfig,
+					unlessServerCredentials(GetCertReloaderConfig),
+					fx.ParamTags(``, serverModuleCredsTag),
 					fx.ResultTags(`name:"grpc_server"`),
 				),
 				fx.Annotate(
@@ -164,6 +290,24 @@ func NewServerModule(conf Config, sOpts ...serverModuleOption) fx.Option {
 				fx.Private,
 			),
 		)
+		if conf.GrpcServerConfig().ClientCAFile != "" {
+			opts = fx.Options(
+				opts,
+				fx.Provide(
+					fx.Annotate(
+						unlessServerCredentials(GetCAReloaderConfig),
+						fx.ParamTags(``, serverModuleCredsTag),
+						fx.ResultTags(`name:"grpc_server"`),
+					),
+					fx.Annotate(
+						reloader.ProvideCAReloader,
+						fx.ParamTags(``, `name:"grpc_server"`, ``),
+						fx.ResultTags(`name:"grpc_server"`),
+					),
+					fx.Private,
+				),
+			)
+		}
 	}
 	return fx.Module(
 		"grpc-server",
@@ -171,6 +315,60 @@ func NewServerModule(conf Config, sOpts ...serverModuleOption) fx.Option {
 	)
 }
 
+// serverModuleCredsTag is the tag of the credentials of the server, inside its module
+const serverModuleCredsTag = `name:"grpc_server_module_creds"`
+
+// ServerCredentialsName returns the tag of the credentials of the grpc server with the given name (see WithServerModuleName)
+// The default server uses `name:"grpc_server_creds"`
+func ServerCredentialsName(server string) string {
+	if server == "" {
+		return `name:"grpc_server_creds"`
+	}
+	return fmt.Sprintf(`name:"grpc_server_creds_%s"`, server)
+}
+
+// WithServerCredentials makes the default grpc server use the given credentials, rather than the cert files of its configuration
+// It suits deployments which obtain their certificates at runtime, eg: from a secrets manager through a tls.Config GetCertificate callback
+// The cert files are not loaded, even when the TLS option of the server is set
+func WithServerCredentials(creds credentials.TransportCredentials) fx.Option {
+	return WithNamedServerCredentials("", creds)
+}
+
+// WithNamedServerCredentials makes the grpc server with the given name (see WithServerModuleName) use the given credentials,
+// like WithServerCredentials does for the default server
+func WithNamedServerCredentials(server string, creds credentials.TransportCredentials) fx.Option {
+	return fx.Provide(
+		fx.Annotate(
+			func() credentials.TransportCredentials { return creds },
+			fx.ResultTags(ServerCredentialsName(server)),
+		),
+	)
+}
+
+// unlessServerCredentials wraps a getter of the config of a reloader, so that it returns nil when credentials are provided to the server
+// The credentials take precedence over the files of the config, which are then not loaded
+func unlessServerCredentials[T any](get func(Config) *T) func(Config, credentials.TransportCredentials) *T {
+	return func(conf Config, creds credentials.TransportCredentials) *T {
+		if creds != nil {
+			return nil
+		}
+		return get(conf)
+	}
+}
+
+// WithServerOption adds the given options to the grpc servers of the system
+// They are applied after the options set by the server module, so they can override them
+func WithServerOption(opts ...grpc.ServerOption) fx.Option {
+	provides := make([]any, 0, len(opts))
+	for _, opt := range opts {
+		provides = append(provides, fx.Annotate(
+			func() grpc.ServerOption { return opt },
+			fx.ResultTags(`group:"grpc_server_options"`),
+		))
+	}
+	return fx.Provide(provides...)
+}
+
 func GetCertReloaderConfig(conf Config) *reloader.CertReloaderConfig {
 	if !conf.GrpcServerConfig().TLS {
 		return nil
@@ -178,29 +376,48 @@ func GetCertReloaderConfig(conf Config) *reloader.CertReloaderConfig {
 	return &reloader.CertReloaderConfig{
 		CertFile:       conf.GrpcServerConfig().CertFile,
 		KeyFile:        conf.GrpcServerConfig().KeyFile,
-		ReloadInterval: 1 * time.Hour,
+		ReloadInterval: reloader.DefaultReloadInterval,
+	}
+}
+
+func GetCAReloaderConfig(conf Config) *reloader.CAReloaderConfig {
+	if !conf.GrpcServerConfig().TLS || conf.GrpcServerConfig().ClientCAFile == "" {
+		return nil
+	}
+	return &reloader.CAReloaderConfig{
+		Path:           conf.GrpcServerConfig().ClientCAFile,
+		ReloadInterval: reloader.DefaultCAReloadInterval,
 	}
 }
 
 // server is a tuple of grpc.Server with its accompanying address or socket name
+// and the stats used to log the progress of its graceful stop
+// name is the name given by WithServerModuleName, if any
 type server struct {
-	server     *grpc.Server
-	addr       string
-	socketName string
+	name          string
+	server        *grpc.Server
+	addr          string
+	socketName    string
+	advertiseAddr string
+	stats         *ServerStats
 }
 
-func newServer(s *grpc.Server, conf Config) *server {
-	return &server{s, conf.AsHttpConfig().Address, conf.AsHttpConfig().SocketName}
+func newServer(s *grpc.Server, conf Config, stats *ServerStats) *server {
+	return &server{"", s, conf.AsHttpConfig().Address, conf.AsHttpConfig().SocketName, conf.GrpcServerConfig().AdvertisedAddress(), stats}
 }
 
 type GrpcServerParams struct {
 	fx.In
 
 	Conf               Config
-	UnaryInterceptors  []*UnaryServerInterceptor  `group:"unary_server_interceptor"`
-	StreamInterceptors []*StreamServerInterceptor `group:"stream_server_interceptor"`
-	Reloader           *reloader.CertReloader     `name:"grpc_server" optional:"true"`
-	ServerOpts         []grpc.ServerOption        `group:"grpc_server_options"`
+	UnaryInterceptors  []*UnaryServerInterceptor        `group:"unary_server_interceptor"`
+	StreamInterceptors []*StreamServerInterceptor       `group:"stream_server_interceptor"`
+	Reloader           *reloader.CertReloader           `name:"grpc_server" optional:"true"`
+	CAReloader         *reloader.CAReloader             `name:"grpc_server" optional:"true"`
+	ServerOpts         []grpc.ServerOption              `group:"grpc_server_options"`
+	Stats              *ServerStats                     `optional:"true"`
+	Scoped             *ScopedServerInterceptors        `optional:"true"`
+	Creds              credentials.TransportCredentials `name:"grpc_server_module_creds" optional:"true"`
 }
 
 func NewGrpcServer(p GrpcServerParams) (*grpc.Server, error) {
@@ -208,9 +425,24 @@ func NewGrpcServer(p GrpcServerParams) (*grpc.Server, error) {
 	serverConf := p.Conf.GrpcServerConfig()
 
 	// Handle server TLS
-	if serverConf.TLS {
-		// Due to GetCertReloaderConfig we know we have a reloader here
-		creds, err := reloader.MakeServerTLS(p.Reloader, serverConf.ClientCAFile)
+	// Credentials provided to the system take precedence over the cert files
+	if p.Creds != nil {
+		opts = append(opts, grpc.Creds(p.Creds))
+	} else if serverConf.TLS {
+		// Due to GetCertReloaderConfig we know we have a reloader here, as no credentials were provided
+		tlsOpts, err := reloader.ServerTLSOptions(serverConf.TLSMinVersion, serverConf.TLSCipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		if len(serverConf.ALPNProtocols) > 0 {
+			tlsOpts = append(tlsOpts, reloader.WithNextProtos(serverConf.ALPNProtocols))
+		}
+		clientCAFile := serverConf.ClientCAFile
+		if p.CAReloader != nil {
+			tlsOpts = append(tlsOpts, reloader.WithClientCAReloader(p.CAReloader))
+			clientCAFile = ""
+		}
+		creds, err := reloader.MakeServerTLS(p.Reloader, clientCAFile, tlsOpts...)
 		if err != nil {
 			return nil, err
 		}
@@ -218,11 +450,39 @@ func NewGrpcServer(p GrpcServerParams) (*grpc.Server, error) {
 	}
 
 	// Handle server middleware
+	unaryIx, streamIx := p.UnaryInterceptors, p.StreamInterceptors
+	if p.Scoped != nil {
+		unaryIx = append(append([]*UnaryServerInterceptor(nil), unaryIx...), p.Scoped.Unary...)
+		streamIx = append(append([]*StreamServerInterceptor(nil), streamIx...), p.Scoped.Stream...)
+	}
+	if serverConf.RequireClientCert {
+		// Installed directly, rather than through the group, so it only applies to this server
+		u, s := NewRequireClientCertInterceptors()
+		unaryIx = append(append([]*UnaryServerInterceptor(nil), unaryIx...), u)
+		streamIx = append(append([]*StreamServerInterceptor(nil), streamIx...), s)
+	}
+	if len(serverConf.MethodTimeouts) > 0 {
+		u, s := NewMethodTimeoutInterceptors(serverConf.MethodTimeouts)
+		unaryIx = append(append([]*UnaryServerInterceptor(nil), unaryIx...), u)
+		streamIx = append(append([]*StreamServerInterceptor(nil), streamIx...), s)
+	}
+	if len(serverConf.MethodMaxStreams) > 0 {
+		s := NewMethodMaxStreamsInterceptor(serverConf.MethodMaxStreams)
+		streamIx = append(append([]*StreamServerInterceptor(nil), streamIx...), s)
+	}
+	if len(serverConf.MethodMaxRequestSizes) > 0 {
+		u, s := NewMethodMaxRequestSizeInterceptors(serverConf.MethodMaxRequestSizes)
+		unaryIx = append(append([]*UnaryServerInterceptor(nil), unaryIx...), u)
+		streamIx = append(append([]*StreamServerInterceptor(nil), streamIx...), s)
+	}
 	opts = append(
 		opts,
-		UnaryServerInterceptors(p.UnaryInterceptors),
-		StreamServerInterceptors(p.StreamInterceptors),
+		UnaryServerInterceptors(unaryIx),
+		StreamServerInterceptors(streamIx),
 	)
+	if p.Stats != nil {
+		opts = append(opts, grpc.StatsHandler(p.Stats))
+	}
 
 	// Add the externally supplied options last: this allows the user to override any options we may have set already
 	opts = append(opts, p.ServerOpts...)
@@ -233,9 +493,12 @@ func NewGrpcServer(p GrpcServerParams) (*grpc.Server, error) {
 }
 
 func StartGrpcServer(lc fx.Lifecycle, logger *zap.Logger, s *server) {
+	if s.name != "" {
+		logger = logger.With(zap.String("server", s.name))
+	}
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
-			logger.Info("Starting gRPC server", zap.String("address", s.addr))
+			logger.Info("Starting gRPC server", zap.String("address", s.addr), zap.String("advertise_address", s.advertiseAddr))
 			lis, err := fxhttp.NewListener(ctx, s.socketName, s.addr)
 			if err != nil {
 				return err
@@ -253,8 +516,12 @@ func StartGrpcServer(lc fx.Lifecycle, logger *zap.Logger, s *server) {
 			return nil
 		},
 		OnStop: func(ctx context.Context) error {
-			logger.Info("Stopping gRPC server")
-			s.server.GracefulStop()
+			logger.Info(
+				"Stopping gRPC server",
+				zap.Int64("connections", s.stats.Connections()),
+				zap.Int64("in_flight_requests", s.stats.InFlightRequests()),
+			)
+			gracefulStop(s.server, s.stats, logger)
 			return nil
 		},
 	})
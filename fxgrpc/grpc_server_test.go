@@ -0,0 +1,217 @@
+package fxgrpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestWithServerOption(t *testing.T) {
+	called := make(chan string, 1)
+	unknownHandler := func(srv any, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		called <- method
+		return nil
+	}
+
+	var server *grpc.Server
+	app := fx.New(
+		fx.NopLogger,
+		fx.Supply(fx.Annotate(&Server{Address: "localhost:0"}, fx.As(new(Config)))),
+		fx.Provide(NewGrpcServer),
+		WithServerOption(grpc.UnknownServiceHandler(unknownHandler)),
+		fx.Populate(&server),
+	)
+	require.NoError(t, app.Err())
+
+	lis := bufconn.Listen(1024 * 1024)
+	go server.Serve(lis) //nolint:errcheck
+	defer server.Stop()
+
+	conn, err := NewGrpcClient(
+		&Client{InsecureConnection: true, Endpoint: "passthrough://bufnet"},
+		zap.NewNop(), nil, nil,
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+	)
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	stream, err := conn.NewStream(context.Background(), &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, "/unknown.Service/Method")
+	require.NoError(t, err)
+	require.NoError(t, stream.CloseSend())
+	_ = stream.RecvMsg(&struct{}{})
+
+	require.Equal(t, "/unknown.Service/Method", <-called)
+}
+
+func TestAdvertiseAddress(t *testing.T) {
+	// Reserve a free port for the server to bind
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	bindAddress := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	conf := &Server{Address: bindAddress, AdvertiseAddress: "grpc.example.com:443"}
+	require.Equal(t, "grpc.example.com:443", conf.AdvertisedAddress())
+	require.Equal(t, bindAddress, (&Server{Address: bindAddress}).AdvertisedAddress())
+
+	core, logs := observer.New(zap.InfoLevel)
+	app := fxtest.New(
+		t,
+		NewServerModule(conf),
+		fx.Supply(zap.New(core)),
+		fx.Invoke(StartGrpcServer),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	entries := logs.FilterMessage("Starting gRPC server").AllUntimed()
+	require.Len(t, entries, 1)
+	require.Equal(t, bindAddress, entries[0].ContextMap()["address"])
+	require.Equal(t, "grpc.example.com:443", entries[0].ContextMap()["advertise_address"])
+
+	// The listener binds the bind address, not the advertised one
+	c, err := net.Dial("tcp", bindAddress)
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+}
+
+type namedRouteGuideServer struct {
+	pb.UnimplementedRouteGuideServer
+}
+
+func (s *namedRouteGuideServer) GetFeature(context.Context, *pb.Point) (*pb.Feature, error) {
+	return &pb.Feature{Name: "public"}, nil
+}
+
+func TestNamedServerModule(t *testing.T) {
+	publicAddress, adminAddress := freeAddress(t), freeAddress(t)
+
+	core, logs := observer.New(zap.InfoLevel)
+	app := fxtest.New(
+		t,
+		NewServerModule(&Server{Address: publicAddress}),
+		NewServerModule(&Server{Address: adminAddress}, WithServerModuleName("admin")),
+		fx.Supply(zap.New(core)),
+		fx.Invoke(
+			func(s grpc.ServiceRegistrar) { pb.RegisterRouteGuideServer(s, &namedRouteGuideServer{}) },
+			fx.Annotate(
+				func(s grpc.ServiceRegistrar) { healthpb.RegisterHealthServer(s, health.NewServer()) },
+				fx.ParamTags(`name:"admin"`),
+			),
+			StartGrpcServer,
+			fx.Annotate(StartGrpcServer, fx.ParamTags(``, ``, `name:"admin"`)),
+		),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	dial := func(t *testing.T, address string) *grpc.ClientConn {
+		conn, err := NewGrpcClient(&Client{InsecureConnection: true, Endpoint: address}, zap.NewNop(), nil, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() }) //nolint:errcheck
+		return conn
+	}
+	public, admin := dial(t, publicAddress), dial(t, adminAddress)
+
+	t.Run("Should log the name of the named server", func(t *testing.T) {
+		entries := logs.FilterMessage("Starting gRPC server").AllUntimed()
+		require.Len(t, entries, 2)
+		require.NotContains(t, entries[0].ContextMap(), "server")
+		require.Equal(t, "admin", entries[1].ContextMap()["server"])
+		require.Equal(t, adminAddress, entries[1].ContextMap()["address"])
+	})
+
+	t.Run("Should serve the services registered on the default server", func(t *testing.T) {
+		feature, err := pb.NewRouteGuideClient(public).GetFeature(context.Background(), &pb.Point{})
+		require.NoError(t, err)
+		require.Equal(t, "public", feature.GetName())
+
+		_, err = healthpb.NewHealthClient(public).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		require.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+
+	t.Run("Should serve the services registered on the named server", func(t *testing.T) {
+		resp, err := healthpb.NewHealthClient(admin).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+
+		_, err = pb.NewRouteGuideClient(admin).GetFeature(context.Background(), &pb.Point{})
+		require.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+}
+
+func TestServerTLSValidation(t *testing.T) {
+	cases := []struct {
+		name  string
+		conf  *Server
+		valid bool
+	}{
+		{"Should accept a plaintext server without certificates", &Server{Address: "localhost:0"}, true},
+		{"Should reject a plaintext server with a CertFile", &Server{Address: "localhost:0", CertFile: "/etc/hosts"}, false},
+		{"Should reject a plaintext server with a KeyFile", &Server{Address: "localhost:0", KeyFile: "/etc/hosts"}, false},
+		{"Should accept a TLS server with certificates", &Server{Address: "localhost:0", TLS: true, CertFile: "/etc/hosts", KeyFile: "/etc/hosts"}, true},
+		{"Should reject a TLS server without certificates", &Server{Address: "localhost:0", TLS: true}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validator.New().Struct(tc.conf)
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestDisableGrpcLogger(t *testing.T) {
+	var buf bytes.Buffer
+	custom := grpclog.NewLoggerV2(&buf, io.Discard, io.Discard)
+	t.Cleanup(func() { grpclog.SetLoggerV2(grpclog.NewLoggerV2(io.Discard, io.Discard, io.Discard)) })
+
+	newApp := func(disabled bool) *fxtest.App {
+		return fxtest.New(
+			t,
+			NewServerModule(&Server{Address: "localhost:0", DisableGrpcLogger: disabled}),
+			NewClientModule(&Client{InsecureConnection: true, Endpoint: "localhost:0", DisableGrpcLogger: disabled}),
+			fx.Supply(zap.NewNop()),
+		)
+	}
+
+	t.Run("Should keep the global grpc logger when disabled", func(t *testing.T) {
+		grpclog.SetLoggerV2(custom)
+		buf.Reset()
+		newApp(true)
+
+		grpclog.Info("custom logger")
+		require.Contains(t, buf.String(), "custom logger")
+	})
+
+	t.Run("Should replace the global grpc logger by default", func(t *testing.T) {
+		grpclog.SetLoggerV2(custom)
+		buf.Reset()
+		newApp(false)
+
+		grpclog.Info("custom logger")
+		require.Empty(t, buf.String())
+	})
+}
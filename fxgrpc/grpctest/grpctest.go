@@ -18,6 +18,13 @@ var Module = fx.Module(
 		NewGrpc,
 		func(server *grpc.Server) grpc.ServiceRegistrar { return server },
 	),
+	fx.Provide(fxgrpc.NewServerStats, fx.Private),
+	fx.Provide(
+		fx.Annotate(
+			func(s *fxgrpc.ServerStats) *fxgrpc.ServerStats { return s },
+			fx.ResultTags(fxgrpc.ServerStatsGroup),
+		),
+	),
 )
 
 type GrpcParams struct {
@@ -28,6 +35,7 @@ type GrpcParams struct {
 	StreamServerInterceptors []*fxgrpc.StreamServerInterceptor `group:"stream_server_interceptor"`
 	UnaryClientInterceptors  []*fxgrpc.UnaryClientInterceptor  `group:"unary_client_interceptor"`
 	StreamClientInterceptors []*fxgrpc.StreamClientInterceptor `group:"stream_client_interceptor"`
+	Stats                    *fxgrpc.ServerStats               `optional:"true"`
 }
 
 func NewGrpc(p GrpcParams) (*grpc.Server, grpc.ClientConnInterface, error) {
@@ -48,10 +56,14 @@ func NewGrpc(p GrpcParams) (*grpc.Server, grpc.ClientConnInterface, error) {
 	}
 
 	// Handle server middleware
-	s := grpc.NewServer(
+	opts := []grpc.ServerOption{
 		fxgrpc.UnaryServerInterceptors(p.UnaryServerInterceptors),
 		fxgrpc.StreamServerInterceptors(p.StreamServerInterceptors),
-	)
+	}
+	if p.Stats != nil {
+		opts = append(opts, grpc.StatsHandler(p.Stats))
+	}
+	s := grpc.NewServer(opts...)
 
 	p.Lc.Append(fx.Hook{
 		OnStart: func(_ context.Context) error {
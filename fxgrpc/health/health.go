@@ -2,7 +2,12 @@
 package health
 
 import (
+	"context"
+	"sync"
+
+	"github.com/exoscale/stelling/fxgrpc"
 	"go.uber.org/fx"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
@@ -12,10 +17,76 @@ import (
 var Module = fx.Module(
 	"grpc-healthcheck",
 	fx.Provide(health.NewServer),
-	fx.Invoke(RegisterHealthService),
+	fx.Invoke(RegisterHealthService, GateHealthService),
 )
 
 func RegisterHealthService(healthServer *health.Server, grpcServer grpc.ServiceRegistrar) {
 	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
 	healthpb.RegisterHealthServer(grpcServer, healthServer)
 }
+
+type GateParams struct {
+	fx.In
+
+	Lc           fx.Lifecycle
+	Logger       *zap.Logger
+	HealthServer *health.Server
+	Gates        []*fxgrpc.ReadinessGate `group:"grpc_readiness_gates"`
+}
+
+// GateHealthService reports NOT_SERVING until the client connections of the readiness gates are ready
+// A gate which isn't ready within its timeout is logged, and holds the readiness until it is ready,
+// unless it is configured to report ready after the timeout
+func GateHealthService(p GateParams) {
+	if len(p.Gates) == 0 {
+		return
+	}
+	p.HealthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	p.Lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				waitForGates(ctx, p.Gates, p.Logger)
+				if ctx.Err() == nil {
+					p.HealthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+				}
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			wg.Wait()
+			return nil
+		},
+	})
+}
+
+// waitForGates waits for all the gates concurrently
+func waitForGates(ctx context.Context, gates []*fxgrpc.ReadinessGate, logger *zap.Logger) {
+	wg := &sync.WaitGroup{}
+	for _, gate := range gates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := gate.Wait(ctx); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if gate.ReadyAfterTimeout {
+					logger.Warn("gRPC client not ready, reporting ready anyway", zap.String("client", gate.Name), zap.Error(err))
+					return
+				}
+				logger.Warn("gRPC client not ready, reporting not ready until it is", zap.String("client", gate.Name), zap.Error(err))
+				if err := gate.WaitReady(ctx); err != nil {
+					return
+				}
+			}
+			logger.Info("gRPC client ready", zap.String("client", gate.Name), zap.String("endpoint", gate.Endpoint))
+		}()
+	}
+	wg.Wait()
+}
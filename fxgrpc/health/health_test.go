@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/exoscale/stelling/fxgrpc/grpctest"
+	"github.com/exoscale/stelling/stellingtest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func servingStatus(t *testing.T, ctx context.Context, s *health.Server) healthpb.HealthCheckResponse_ServingStatus {
+	res, err := s.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	return res.Status
+}
+
+func TestGateHealthService(t *testing.T) {
+	// upstreamModule adds a client to an upstream listening on lis, which gates the readiness
+	upstreamModule := func(lis *bufconn.Listener, timeout time.Duration, readyAfterTimeout bool) fx.Option {
+		return fx.Options(
+			fxgrpc.NewNamedClientModule("upstream", &fxgrpc.Client{
+				InsecureConnection:         true,
+				Endpoint:                   "passthrough://bufconn",
+				ReadinessTimeout:           timeout,
+				ReadyAfterReadinessTimeout: readyAfterTimeout,
+				// The global grpc logger would outlive the test logger
+				DisableGrpcLogger: true,
+			}),
+			fxgrpc.WithDialOption(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			})),
+		)
+	}
+	baseOpts := func(t *testing.T) fx.Option {
+		return fx.Options(
+			fx.Supply(zaptest.NewLogger(t)),
+			grpctest.Module,
+			Module,
+		)
+	}
+
+	t.Run("Should report serving without readiness gates", func(t *testing.T) {
+		stellingtest.Run(t, func(ctx context.Context, s *health.Server) error {
+			require.Equal(t, healthpb.HealthCheckResponse_SERVING, servingStatus(t, ctx, s))
+			return nil
+		}, baseOpts(t))
+	})
+
+	t.Run("Should delay the readiness until the upstream is available", func(t *testing.T) {
+		lis := bufconn.Listen(1024 * 1024)
+		upstream := grpc.NewServer()
+		defer upstream.Stop()
+
+		stellingtest.Run(t, func(ctx context.Context, s *health.Server) error {
+			require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, ctx, s))
+			// bufconn only completes the connections once the server accepts them
+			time.Sleep(100 * time.Millisecond)
+			require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, ctx, s))
+
+			go upstream.Serve(lis) //nolint:errcheck
+			require.Eventually(t, func() bool {
+				return servingStatus(t, ctx, s) == healthpb.HealthCheckResponse_SERVING
+			}, 5*time.Second, 10*time.Millisecond)
+			return nil
+		}, baseOpts(t), upstreamModule(lis, time.Minute, false))
+	})
+
+	t.Run("Should keep reporting not serving after the timeout until the upstream is available", func(t *testing.T) {
+		lis := bufconn.Listen(1024 * 1024)
+		upstream := grpc.NewServer()
+		defer upstream.Stop()
+
+		stellingtest.Run(t, func(ctx context.Context, s *health.Server) error {
+			time.Sleep(300 * time.Millisecond)
+			require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, ctx, s))
+
+			go upstream.Serve(lis) //nolint:errcheck
+			require.Eventually(t, func() bool {
+				return servingStatus(t, ctx, s) == healthpb.HealthCheckResponse_SERVING
+			}, 5*time.Second, 10*time.Millisecond)
+			return nil
+		}, baseOpts(t), upstreamModule(lis, 100*time.Millisecond, false))
+	})
+
+	t.Run("Should report serving once the timeout expires when configured to", func(t *testing.T) {
+		lis := bufconn.Listen(1024 * 1024)
+		defer lis.Close() //nolint:errcheck
+
+		stellingtest.Run(t, func(ctx context.Context, s *health.Server) error {
+			require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, ctx, s))
+			require.Eventually(t, func() bool {
+				return servingStatus(t, ctx, s) == healthpb.HealthCheckResponse_SERVING
+			}, 5*time.Second, 10*time.Millisecond)
+			return nil
+		}, baseOpts(t), upstreamModule(lis, 200*time.Millisecond, true))
+	})
+}
@@ -1,31 +1,44 @@
 package fxgrpc
 
 import (
+	"fmt"
 	"sort"
 
+	"github.com/exoscale/stelling/fxlogging/summary"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
 )
 
 // UnaryClientInterceptor wraps a grpc.UnaryClientInterceptor with a weight that determines its position in the interceptor chain
 type UnaryClientInterceptor struct {
+	// Name identifies the interceptor when the chain is logged
+	Name        string
 	Weight      uint
 	Interceptor grpc.UnaryClientInterceptor
 }
 
 // UnaryServerInterceptor wraps a grpc.UnaryServerInterceptor with a weight that determines its position in the interceptor chain
 type UnaryServerInterceptor struct {
+	// Name identifies the interceptor when the chain is logged
+	Name        string
 	Weight      uint
 	Interceptor grpc.UnaryServerInterceptor
 }
 
 // StreamClientInterceptor wraps a grpc.StreamClientInterceptor with a weight that determines its position in the interceptor chain
 type StreamClientInterceptor struct {
+	// Name identifies the interceptor when the chain is logged
+	Name        string
 	Weight      uint
 	Interceptor grpc.StreamClientInterceptor
 }
 
 // StreamServerInterceptor wraps a grpc.StreamServerInterceptor with a weight that determines its position in the interceptor chain
 type StreamServerInterceptor struct {
+	// Name identifies the interceptor when the chain is logged
+	Name        string
 	Weight      uint
 	Interceptor grpc.StreamServerInterceptor
 }
@@ -99,6 +112,28 @@ func (i *StreamServerInterceptor) GetWeight() uint {
 	return i.Weight
 }
 
+// NamedInterceptor is a WeightedInterceptor with a name to identify it in the logs
+type NamedInterceptor interface {
+	WeightedInterceptor
+	GetName() string
+}
+
+func (i *UnaryClientInterceptor) GetName() string {
+	return i.Name
+}
+
+func (i *UnaryServerInterceptor) GetName() string {
+	return i.Name
+}
+
+func (i *StreamClientInterceptor) GetName() string {
+	return i.Name
+}
+
+func (i *StreamServerInterceptor) GetName() string {
+	return i.Name
+}
+
 type WeightedInterceptors []WeightedInterceptor
 
 func (w WeightedInterceptors) Len() int           { return len(w) }
@@ -130,3 +165,184 @@ func SortInterceptors[T WeightedInterceptor](list []T) []T {
 	}
 	return list[:len(iList)]
 }
+
+type interceptorChain []NamedInterceptor
+
+func (c interceptorChain) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, ix := range c {
+		name := ix.GetName()
+		if name == "" {
+			name = "unnamed"
+		}
+		enc.AppendString(fmt.Sprintf("%s(%d)", name, ix.GetWeight()))
+	}
+	return nil
+}
+
+// InterceptorChain returns the interceptors in the order in which they are installed, as a loggable array
+// Each interceptor is represented as name(weight)
+func InterceptorChain[T NamedInterceptor](list []T) zapcore.ArrayMarshaler {
+	// SortInterceptors works in place, and the list may be shared with the server or client
+	sorted := SortInterceptors(append([]T(nil), list...))
+	chain := make(interceptorChain, 0, len(sorted))
+	for _, ix := range sorted {
+		chain = append(chain, ix)
+	}
+	return chain
+}
+
+// DuplicateInterceptorNames returns the names that are shared by more than one interceptor
+// Unnamed interceptors are ignored
+func DuplicateInterceptorNames[T NamedInterceptor](list []T) []string {
+	seen := map[string]int{}
+	duplicates := []string{}
+	for _, ix := range list {
+		if ix.IsNil() || ix.GetName() == "" {
+			continue
+		}
+		seen[ix.GetName()]++
+		if seen[ix.GetName()] == 2 {
+			duplicates = append(duplicates, ix.GetName())
+		}
+	}
+	return duplicates
+}
+
+// warnDuplicates logs a warning for every interceptor name that is registered multiple times
+// This typically means that two modules install the same interceptor
+func warnDuplicates[T NamedInterceptor](logger *zap.Logger, kind string, list []T) {
+	for _, name := range DuplicateInterceptorNames(list) {
+		logger.Warn("Interceptor is registered multiple times", zap.String("kind", kind), zap.String("name", name))
+	}
+}
+
+// UnaryServerInterceptorGroup returns the tag of the value group of the unary interceptors
+// that are only installed on the grpc server with the given name (see WithServerModuleName)
+// The interceptors of the `unary_server_interceptor` group are installed on every server
+func UnaryServerInterceptorGroup(server string) string {
+	if server == "" {
+		return `group:"unary_server_interceptor"`
+	}
+	return fmt.Sprintf(`group:"unary_server_interceptor_%s"`, server)
+}
+
+// StreamServerInterceptorGroup returns the tag of the value group of the stream interceptors
+// that are only installed on the grpc server with the given name (see WithServerModuleName)
+// The interceptors of the `stream_server_interceptor` group are installed on every server
+func StreamServerInterceptorGroup(server string) string {
+	if server == "" {
+		return `group:"stream_server_interceptor"`
+	}
+	return fmt.Sprintf(`group:"stream_server_interceptor_%s"`, server)
+}
+
+// ScopedServerInterceptors are the interceptors which are only installed on the named grpc server
+// It is privately provided by the server modules created with WithServerModuleName
+type ScopedServerInterceptors struct {
+	Server string
+	Unary  []*UnaryServerInterceptor
+	Stream []*StreamServerInterceptor
+}
+
+type ServerInterceptorChainParams struct {
+	fx.In
+
+	Logger             *zap.Logger
+	UnaryInterceptors  []*UnaryServerInterceptor  `group:"unary_server_interceptor"`
+	StreamInterceptors []*StreamServerInterceptor `group:"stream_server_interceptor"`
+	Scoped             *ScopedServerInterceptors  `optional:"true"`
+}
+
+// interceptors returns all the interceptors installed on the server, including the scoped ones
+func (p ServerInterceptorChainParams) interceptors() ([]*UnaryServerInterceptor, []*StreamServerInterceptor) {
+	if p.Scoped == nil {
+		return p.UnaryInterceptors, p.StreamInterceptors
+	}
+	unaryIx := append(append([]*UnaryServerInterceptor(nil), p.UnaryInterceptors...), p.Scoped.Unary...)
+	streamIx := append(append([]*StreamServerInterceptor(nil), p.StreamInterceptors...), p.Scoped.Stream...)
+	return unaryIx, streamIx
+}
+
+// LogServerInterceptorChain logs the order in which the server interceptors run
+// It warns about interceptors that are registered multiple times
+func LogServerInterceptorChain(p ServerInterceptorChainParams) {
+	logger := p.Logger
+	if p.Scoped != nil {
+		logger = logger.With(zap.String("server", p.Scoped.Server))
+	}
+	unaryIx, streamIx := p.interceptors()
+	warnDuplicates(logger, "unary_server", unaryIx)
+	warnDuplicates(logger, "stream_server", streamIx)
+	logger.Info(
+		"gRPC server interceptor chain",
+		zap.Array("unary", InterceptorChain(unaryIx)),
+		zap.Array("stream", InterceptorChain(streamIx)),
+	)
+}
+
+type ClientInterceptorChainParams struct {
+	fx.In
+
+	Logger             *zap.Logger
+	UnaryInterceptors  []*UnaryClientInterceptor  `group:"unary_client_interceptor"`
+	StreamInterceptors []*StreamClientInterceptor `group:"stream_client_interceptor"`
+}
+
+// LogClientInterceptorChain logs the order in which the client interceptors run
+// It warns about interceptors that are registered multiple times
+func LogClientInterceptorChain(p ClientInterceptorChainParams) {
+	warnDuplicates(p.Logger, "unary_client", p.UnaryInterceptors)
+	warnDuplicates(p.Logger, "stream_client", p.StreamInterceptors)
+	p.Logger.Info(
+		"gRPC client interceptor chain",
+		zap.Array("unary", InterceptorChain(p.UnaryInterceptors)),
+		zap.Array("stream", InterceptorChain(p.StreamInterceptors)),
+	)
+}
+
+// summaryName returns the name of a grpc module in the summary of the system, eg: grpc-server:admin
+func summaryName(kind, name string) string {
+	if name == "" {
+		return kind
+	}
+	return kind + ":" + name
+}
+
+// serverSummary returns the constructor of the entry of the server in the summary of the system
+// It adds the interceptor chain of the server to its configuration
+func serverSummary(name string, conf Config) func(p ServerInterceptorChainParams) summary.Module {
+	return func(p ServerInterceptorChainParams) summary.Module {
+		unaryIx, streamIx := p.interceptors()
+		return summary.Module{
+			Name: summaryName("grpc-server", name),
+			Config: zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+				if err := conf.GrpcServerConfig().MarshalLogObject(enc); err != nil {
+					return err
+				}
+				if err := enc.AddArray("unary-interceptors", InterceptorChain(unaryIx)); err != nil {
+					return err
+				}
+				return enc.AddArray("stream-interceptors", InterceptorChain(streamIx))
+			}),
+		}
+	}
+}
+
+// clientSummary returns the constructor of the entry of the client in the summary of the system
+// It adds the interceptor chain of the client to its configuration
+func clientSummary(name string, conf ClientConfig) func(p ClientInterceptorChainParams) summary.Module {
+	return func(p ClientInterceptorChainParams) summary.Module {
+		return summary.Module{
+			Name: summaryName("grpc-client", name),
+			Config: zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+				if err := conf.GrpcClientConfig().MarshalLogObject(enc); err != nil {
+					return err
+				}
+				if err := enc.AddArray("unary-interceptors", InterceptorChain(p.UnaryInterceptors)); err != nil {
+					return err
+				}
+				return enc.AddArray("stream-interceptors", InterceptorChain(p.StreamInterceptors))
+			}),
+		}
+	}
+}
@@ -1,9 +1,18 @@
 package fxgrpc
 
 import (
+	"context"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func TestSortInterceptors(t *testing.T) {
@@ -100,3 +109,203 @@ func TestSortInterceptors(t *testing.T) {
 		})
 	}
 }
+
+func TestLogInterceptorChain(t *testing.T) {
+	t.Run("Should log the server interceptors in the order in which they run", func(t *testing.T) {
+		core, logs := observer.New(zap.InfoLevel)
+		app := fx.New(
+			fx.NopLogger,
+			NewServerModule(&Server{Address: "localhost:0"}),
+			fx.Supply(zap.New(core)),
+			fx.Provide(
+				fx.Annotate(
+					func() *UnaryServerInterceptor { return &UnaryServerInterceptor{Name: "metrics", Weight: 60} },
+					fx.ResultTags(`group:"unary_server_interceptor"`),
+				),
+				fx.Annotate(
+					func() *UnaryServerInterceptor { return &UnaryServerInterceptor{Name: "tracing", Weight: 30} },
+					fx.ResultTags(`group:"unary_server_interceptor"`),
+				),
+				fx.Annotate(
+					func() *UnaryServerInterceptor { return &UnaryServerInterceptor{Weight: 40} },
+					fx.ResultTags(`group:"unary_server_interceptor"`),
+				),
+				fx.Annotate(
+					func() *StreamServerInterceptor { return &StreamServerInterceptor{Name: "logging", Weight: 50} },
+					fx.ResultTags(`group:"stream_server_interceptor"`),
+				),
+			),
+		)
+		require.NoError(t, app.Err())
+
+		entries := logs.FilterMessage("gRPC server interceptor chain").AllUntimed()
+		require.Len(t, entries, 1)
+		fields := entries[0].ContextMap()
+		require.Equal(t, []any{"tracing(30)", "unnamed(40)", "metrics(60)"}, fields["unary"])
+		require.Equal(t, []any{"logging(50)"}, fields["stream"])
+	})
+
+	t.Run("Should log the client interceptors in the order in which they run", func(t *testing.T) {
+		core, logs := observer.New(zap.InfoLevel)
+		app := fx.New(
+			fx.NopLogger,
+			NewClientModule(&Client{InsecureConnection: true, Endpoint: "localhost:1"}),
+			fx.Supply(zap.New(core)),
+			fx.Provide(
+				fx.Annotate(
+					func() *UnaryClientInterceptor { return &UnaryClientInterceptor{Name: "logging", Weight: 50} },
+					fx.ResultTags(`group:"unary_client_interceptor"`),
+				),
+				fx.Annotate(
+					func() *UnaryClientInterceptor { return &UnaryClientInterceptor{Name: "inject-peer", Weight: 49} },
+					fx.ResultTags(`group:"unary_client_interceptor"`),
+				),
+			),
+		)
+		require.NoError(t, app.Err())
+
+		entries := logs.FilterMessage("gRPC client interceptor chain").AllUntimed()
+		require.Len(t, entries, 1)
+		fields := entries[0].ContextMap()
+		require.Equal(t, []any{"inject-peer(49)", "logging(50)"}, fields["unary"])
+		require.Equal(t, []any{}, fields["stream"])
+	})
+}
+
+func TestDuplicateInterceptorNames(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    []*UnaryServerInterceptor
+		expected []string
+	}{
+		{
+			name:     "Should work with empty input",
+			input:    []*UnaryServerInterceptor{},
+			expected: []string{},
+		},
+		{
+			name: "Should return each duplicate name once",
+			input: []*UnaryServerInterceptor{
+				{Name: "tracing", Weight: 30},
+				{Name: "metrics", Weight: 60},
+				{Name: "tracing", Weight: 30},
+				{Name: "tracing", Weight: 80},
+			},
+			expected: []string{"tracing"},
+		},
+		{
+			name: "Should ignore unnamed and nil interceptors",
+			input: []*UnaryServerInterceptor{
+				{Weight: 30},
+				{Weight: 30},
+				nil,
+				nil,
+			},
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, DuplicateInterceptorNames(tc.input))
+		})
+	}
+}
+
+func TestWarnDuplicateInterceptors(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	app := fx.New(
+		fx.NopLogger,
+		NewServerModule(&Server{Address: "localhost:0"}),
+		fx.Supply(zap.New(core)),
+		fx.Provide(
+			fx.Annotate(
+				func() *UnaryServerInterceptor { return &UnaryServerInterceptor{Name: "tracing", Weight: 30} },
+				fx.ResultTags(`group:"unary_server_interceptor"`),
+			),
+			fx.Annotate(
+				func() *UnaryServerInterceptor { return &UnaryServerInterceptor{Name: "tracing", Weight: 65} },
+				fx.ResultTags(`group:"unary_server_interceptor"`),
+			),
+			fx.Annotate(
+				func() *StreamServerInterceptor { return &StreamServerInterceptor{Name: "tracing", Weight: 30} },
+				fx.ResultTags(`group:"stream_server_interceptor"`),
+			),
+		),
+	)
+	require.NoError(t, app.Err())
+
+	entries := logs.FilterMessage("Interceptor is registered multiple times").AllUntimed()
+	require.Len(t, entries, 1)
+	require.Equal(t, "unary_server", entries[0].ContextMap()["kind"])
+	require.Equal(t, "tracing", entries[0].ContextMap()["name"])
+}
+
+func TestScopedServerInterceptors(t *testing.T) {
+	publicAddress, adminAddress := freeAddress(t), freeAddress(t)
+	var calls []string
+	var mu sync.Mutex
+	recordingInterceptor := func(name string) *UnaryServerInterceptor {
+		return &UnaryServerInterceptor{
+			Name:   name,
+			Weight: 40,
+			Interceptor: func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				mu.Lock()
+				calls = append(calls, name)
+				mu.Unlock()
+				return handler(ctx, req)
+			},
+		}
+	}
+
+	app := fxtest.New(
+		t,
+		NewServerModule(&Server{Address: publicAddress}),
+		NewServerModule(&Server{Address: adminAddress}, WithServerModuleName("admin")),
+		fx.Supply(zap.NewNop()),
+		fx.Provide(
+			fx.Annotate(
+				func() *UnaryServerInterceptor { return recordingInterceptor("shared") },
+				fx.ResultTags(UnaryServerInterceptorGroup("")),
+			),
+			fx.Annotate(
+				func() *UnaryServerInterceptor { return recordingInterceptor("admin-only") },
+				fx.ResultTags(UnaryServerInterceptorGroup("admin")),
+			),
+		),
+		fx.Invoke(
+			func(s grpc.ServiceRegistrar) { healthpb.RegisterHealthServer(s, health.NewServer()) },
+			fx.Annotate(
+				func(s grpc.ServiceRegistrar) { healthpb.RegisterHealthServer(s, health.NewServer()) },
+				fx.ParamTags(`name:"admin"`),
+			),
+			StartGrpcServer,
+			fx.Annotate(StartGrpcServer, fx.ParamTags(``, ``, `name:"admin"`)),
+		),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	check := func(t *testing.T, address string) []string {
+		conn, err := NewGrpcClient(&Client{InsecureConnection: true, Endpoint: address}, zap.NewNop(), nil, nil)
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		mu.Lock()
+		calls = nil
+		mu.Unlock()
+		_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+
+	t.Run("Should only install the shared interceptors on the default server", func(t *testing.T) {
+		require.Equal(t, []string{"shared"}, check(t, publicAddress))
+	})
+
+	t.Run("Should install the scoped interceptors on the named server", func(t *testing.T) {
+		require.ElementsMatch(t, []string{"shared", "admin-only"}, check(t, adminAddress))
+	})
+}
@@ -0,0 +1,170 @@
+// Package maintenance provides grpc server interceptors that reject the business requests while the service is under maintenance.
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/exoscale/stelling/fxlogging/summary"
+	"go.uber.org/fx"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GrpcInterceptorWeight places the interceptors after the logging (50) and metrics (60) interceptors,
+// so the rejected requests are still logged and counted
+const GrpcInterceptorWeight uint = 62
+
+// DefaultExemptMethods are always served during maintenance, so the service still reports its health and version
+var DefaultExemptMethods = []string{
+	"/grpc.health.v1.Health/",
+	"/stelling.version.v1.Version/",
+	"/grpc.reflection.v1.ServerReflection/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+}
+
+type MaintenanceConfig interface {
+	MaintenanceConfig() *Maintenance
+}
+
+type Maintenance struct {
+	// Enabled starts the service in maintenance mode
+	Enabled bool
+	// Message is returned to the clients of the rejected requests
+	Message string `default:"the service is under maintenance"`
+	// ExemptMethods are served during maintenance, by full method name (eg: /pkg.Service/Method)
+	// A name ending with a / exempts all the methods of the service (eg: /pkg.Admin/)
+	// The health, version and reflection services are always exempt
+	ExemptMethods []string
+}
+
+func (m *Maintenance) MaintenanceConfig() *Maintenance {
+	return m
+}
+
+func (m *Maintenance) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if m == nil {
+		return nil
+	}
+
+	enc.AddBool("enabled", m.Enabled)
+	enc.AddString("message", m.Message)
+	if len(m.ExemptMethods) > 0 {
+		enc.AddString("exempt-methods", strings.Join(m.ExemptMethods, ","))
+	}
+
+	return nil
+}
+
+// Mode is the maintenance flag of the service, which can be toggled while it runs
+// It is an http.Handler, like zap.AtomicLevel: GET returns the flag, eg: {"enabled":true}, and PUT sets it from a body of the same shape
+type Mode struct {
+	enabled atomic.Bool
+}
+
+func NewMode(conf MaintenanceConfig) *Mode {
+	m := &Mode{}
+	m.enabled.Store(conf.MaintenanceConfig().Enabled)
+	return m
+}
+
+// Enabled reports whether the service is under maintenance
+func (m *Mode) Enabled() bool {
+	return m.enabled.Load()
+}
+
+// SetEnabled turns the maintenance mode on or off
+func (m *Mode) SetEnabled(enabled bool) {
+	m.enabled.Store(enabled)
+}
+
+type modePayload struct {
+	Enabled *bool `json:"enabled"`
+}
+
+func (m *Mode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var payload modePayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Enabled == nil {
+			http.Error(w, `expected a body like {"enabled":true}`, http.StatusBadRequest)
+			return
+		}
+		m.SetEnabled(*payload.Enabled)
+	default:
+		http.Error(w, "only GET and PUT are supported", http.StatusMethodNotAllowed)
+		return
+	}
+	enabled := m.Enabled()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(modePayload{Enabled: &enabled})
+}
+
+// isExempt reports whether the method matches one of the exempt methods or services
+func isExempt(exempt []string, method string) bool {
+	for _, e := range exempt {
+		if method == e || (strings.HasSuffix(e, "/") && strings.HasPrefix(method, e)) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewGrpcServerInterceptors returns server interceptors that reject the requests to the methods
+// which are not exempt with codes.Unavailable, while the mode is enabled
+func NewGrpcServerInterceptors(conf MaintenanceConfig, mode *Mode) (*fxgrpc.UnaryServerInterceptor, *fxgrpc.StreamServerInterceptor) {
+	c := conf.MaintenanceConfig()
+	exempt := append(append([]string(nil), DefaultExemptMethods...), c.ExemptMethods...)
+	reject := func(method string) error {
+		if !mode.Enabled() || isExempt(exempt, method) {
+			return nil
+		}
+		return status.Error(codes.Unavailable, c.Message)
+	}
+
+	unaryIx := &fxgrpc.UnaryServerInterceptor{
+		Name:   "maintenance",
+		Weight: GrpcInterceptorWeight,
+		Interceptor: func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := reject(info.FullMethod); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		},
+	}
+	streamIx := &fxgrpc.StreamServerInterceptor{
+		Name:   "maintenance",
+		Weight: GrpcInterceptorWeight,
+		Interceptor: func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := reject(info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		},
+	}
+	return unaryIx, streamIx
+}
+
+// NewModule provides the *Mode of the service, and installs its interceptors on the grpc servers of the system
+// The metrics module serves the mode on its http server when enabled, see fxmetrics.MaintenancePath
+func NewModule(conf MaintenanceConfig) fx.Option {
+	return fx.Module(
+		"grpc-maintenance",
+		fx.Supply(fx.Annotate(conf, fx.As(new(MaintenanceConfig))), fx.Private),
+		fx.Provide(
+			NewMode,
+			fx.Annotate(
+				NewGrpcServerInterceptors,
+				fx.ResultTags(`group:"unary_server_interceptor"`, `group:"stream_server_interceptor"`),
+			),
+		),
+		summary.Provide("grpc-maintenance", conf.MaintenanceConfig()),
+	)
+}
@@ -0,0 +1,130 @@
+package maintenance_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sconfig "github.com/exoscale/stelling/config"
+	"github.com/exoscale/stelling/fxgrpc/grpctest"
+	"github.com/exoscale/stelling/fxgrpc/maintenance"
+	"github.com/exoscale/stelling/stellingtest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+type routeGuideServer struct {
+	pb.UnimplementedRouteGuideServer
+}
+
+func (routeGuideServer) GetFeature(_ context.Context, p *pb.Point) (*pb.Feature, error) {
+	return &pb.Feature{Location: p}, nil
+}
+
+func (routeGuideServer) ListFeatures(_ *pb.Rectangle, stream pb.RouteGuide_ListFeaturesServer) error {
+	return stream.Send(&pb.Feature{})
+}
+
+type deps struct {
+	fx.In
+
+	Mode   *maintenance.Mode
+	Client pb.RouteGuideClient
+	Health healthpb.HealthClient
+}
+
+func TestMaintenance(t *testing.T) {
+	conf := &maintenance.Maintenance{}
+	require.NoError(t, sconfig.Load(conf, []string{"test"}))
+	conf.ExemptMethods = []string{"/routeguide.RouteGuide/ListFeatures"}
+
+	stellingtest.Run(t, func(ctx context.Context, d deps) error {
+		listFeatures := func() error {
+			stream, err := d.Client.ListFeatures(ctx, &pb.Rectangle{})
+			if err != nil {
+				return err
+			}
+			_, err = stream.Recv()
+			return err
+		}
+
+		t.Run("Should serve all the methods by default", func(t *testing.T) {
+			_, err := d.Client.GetFeature(ctx, &pb.Point{})
+			require.NoError(t, err)
+		})
+
+		t.Run("Should reject the business calls during maintenance", func(t *testing.T) {
+			d.Mode.SetEnabled(true)
+			defer d.Mode.SetEnabled(false)
+
+			_, err := d.Client.GetFeature(ctx, &pb.Point{})
+			require.Equal(t, codes.Unavailable, status.Code(err))
+			require.Equal(t, "the service is under maintenance", status.Convert(err).Message())
+		})
+
+		t.Run("Should serve the exempt methods during maintenance", func(t *testing.T) {
+			d.Mode.SetEnabled(true)
+			defer d.Mode.SetEnabled(false)
+
+			require.NoError(t, listFeatures())
+			_, err := d.Health.Check(ctx, &healthpb.HealthCheckRequest{})
+			require.NoError(t, err)
+		})
+
+		t.Run("Should toggle the mode over http", func(t *testing.T) {
+			server := httptest.NewServer(d.Mode)
+			defer server.Close()
+
+			req, err := http.NewRequest(http.MethodPut, server.URL, strings.NewReader(`{"enabled":true}`))
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.JSONEq(t, `{"enabled":true}`, string(body))
+
+			_, err = d.Client.GetFeature(ctx, &pb.Point{})
+			require.Equal(t, codes.Unavailable, status.Code(err))
+
+			req, err = http.NewRequest(http.MethodPut, server.URL, strings.NewReader(`{"enabled":false}`))
+			require.NoError(t, err)
+			resp, err = http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+
+			_, err = d.Client.GetFeature(ctx, &pb.Point{})
+			require.NoError(t, err)
+		})
+
+		t.Run("Should reject an invalid body", func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			d.Mode.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/maintenance", strings.NewReader(`{}`)))
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+		return nil
+	},
+		grpctest.Module,
+		maintenance.NewModule(conf),
+		fx.Provide(
+			func() pb.RouteGuideServer { return routeGuideServer{} },
+			pb.NewRouteGuideClient,
+			healthpb.NewHealthClient,
+			health.NewServer,
+		),
+		fx.Invoke(
+			pb.RegisterRouteGuideServer,
+			func(s *health.Server, r grpc.ServiceRegistrar) { healthpb.RegisterHealthServer(r, s) },
+		),
+	)
+}
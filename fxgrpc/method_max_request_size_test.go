@@ -0,0 +1,98 @@
+package fxgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// echoRouteGuideServer returns the location of GetFeature, and counts the points of RecordRoute
+type echoRouteGuideServer struct {
+	pb.UnimplementedRouteGuideServer
+}
+
+func (echoRouteGuideServer) GetFeature(_ context.Context, p *pb.Point) (*pb.Feature, error) {
+	return &pb.Feature{Location: p}, nil
+}
+
+func (echoRouteGuideServer) RecordRoute(stream pb.RouteGuide_RecordRouteServer) error {
+	var count int32
+	for {
+		_, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&pb.RouteSummary{PointCount: count})
+		}
+		if err != nil {
+			return err
+		}
+		count++
+	}
+}
+
+func TestMethodMaxRequestSizes(t *testing.T) {
+	// A point with small coordinates takes 4 bytes
+	small := &pb.Point{Latitude: 1, Longitude: 1}
+	large := &pb.Point{Latitude: 400_000_000, Longitude: 400_000_000}
+
+	server, err := NewGrpcServer(GrpcServerParams{
+		Conf: &Server{
+			MethodMaxRequestSizes: map[string]int{
+				"/routeguide.RouteGuide/GetFeature":  4,
+				"/routeguide.RouteGuide/RecordRoute": 4,
+			},
+		},
+	})
+	require.NoError(t, err)
+	pb.RegisterRouteGuideServer(server, echoRouteGuideServer{})
+
+	lis := bufconn.Listen(1024 * 1024)
+	go server.Serve(lis) //nolint:errcheck
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(
+		"passthrough://bufconn",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+	)
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+	client := pb.NewRouteGuideClient(conn)
+
+	t.Run("Should accept a request within the limit", func(t *testing.T) {
+		_, err := client.GetFeature(context.Background(), small)
+		require.NoError(t, err)
+	})
+
+	t.Run("Should reject an oversized request", func(t *testing.T) {
+		_, err := client.GetFeature(context.Background(), large)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("Should reject an oversized message of a stream", func(t *testing.T) {
+		stream, err := client.RecordRoute(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(small))
+		require.NoError(t, stream.Send(large))
+		_, err = stream.CloseAndRecv()
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("Should accept a stream within the limit", func(t *testing.T) {
+		stream, err := client.RecordRoute(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(small))
+		summary, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		require.Equal(t, int32(1), summary.PointCount)
+	})
+}
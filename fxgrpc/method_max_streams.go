@@ -0,0 +1,39 @@
+package fxgrpc
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MethodMaxStreamsInterceptorWeight places the interceptor after the logging (50) and metrics (60) interceptors,
+// so the rejected streams are still logged and counted
+const MethodMaxStreamsInterceptorWeight uint = 63
+
+// NewMethodMaxStreamsInterceptor returns a stream server interceptor that caps the number of concurrent streams of a method
+// The keys of limits are full method names, eg: /pkg.Service/Method
+// Streams above the limit are rejected with codes.ResourceExhausted, and a slot is released as soon as a stream ends
+func NewMethodMaxStreamsInterceptor(limits map[string]int) *StreamServerInterceptor {
+	// The map is only read after its creation, so it needs no locking
+	slots := make(map[string]chan struct{}, len(limits))
+	for method, limit := range limits {
+		slots[method] = make(chan struct{}, limit)
+	}
+	return &StreamServerInterceptor{
+		Name:   "method-max-streams",
+		Weight: MethodMaxStreamsInterceptorWeight,
+		Interceptor: func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			sem, ok := slots[info.FullMethod]
+			if !ok {
+				return handler(srv, ss)
+			}
+			select {
+			case sem <- struct{}{}:
+			default:
+				return status.Errorf(codes.ResourceExhausted, "too many concurrent streams for %s", info.FullMethod)
+			}
+			defer func() { <-sem }()
+			return handler(srv, ss)
+		},
+	}
+}
@@ -0,0 +1,91 @@
+package fxgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// streamingRouteGuideServer sends a single feature, and keeps its streams open until they are canceled
+type streamingRouteGuideServer struct {
+	pb.UnimplementedRouteGuideServer
+}
+
+func (streamingRouteGuideServer) ListFeatures(_ *pb.Rectangle, stream pb.RouteGuide_ListFeaturesServer) error {
+	if err := stream.Send(&pb.Feature{}); err != nil {
+		return err
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+func (streamingRouteGuideServer) RecordRoute(stream pb.RouteGuide_RecordRouteServer) error {
+	return stream.SendAndClose(&pb.RouteSummary{})
+}
+
+func TestMethodMaxStreams(t *testing.T) {
+	server, err := NewGrpcServer(GrpcServerParams{
+		Conf: &Server{
+			MethodMaxStreams: map[string]int{"/routeguide.RouteGuide/ListFeatures": 2},
+		},
+	})
+	require.NoError(t, err)
+	pb.RegisterRouteGuideServer(server, streamingRouteGuideServer{})
+
+	lis := bufconn.Listen(1024 * 1024)
+	go server.Serve(lis) //nolint:errcheck
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(
+		"passthrough://bufconn",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+	)
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+	client := pb.NewRouteGuideClient(conn)
+
+	// openStream returns once the handler of the stream runs
+	openStream := func(ctx context.Context) error {
+		stream, err := client.ListFeatures(ctx, &pb.Rectangle{})
+		if err != nil {
+			return err
+		}
+		_, err = stream.Recv()
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first, cancelFirst := context.WithCancel(ctx)
+	require.NoError(t, openStream(first))
+	require.NoError(t, openStream(ctx))
+
+	t.Run("Should reject the streams above the limit", func(t *testing.T) {
+		err := openStream(ctx)
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+
+	t.Run("Should not affect other methods", func(t *testing.T) {
+		stream, err := client.RecordRoute(ctx)
+		require.NoError(t, err)
+		_, err = stream.CloseAndRecv()
+		require.NoError(t, err)
+	})
+
+	t.Run("Should release the slot when a stream ends", func(t *testing.T) {
+		cancelFirst()
+		require.Eventually(t, func() bool {
+			return openStream(ctx) == nil
+		}, time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,55 @@
+package fxgrpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// MethodTimeoutInterceptorWeight places the interceptor before all the others
+// so the whole chain runs within the timeout of the method
+const MethodTimeoutInterceptorWeight uint = 20
+
+// timeoutServerStream overrides the context of a grpc.ServerStream
+type timeoutServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *timeoutServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// NewMethodTimeoutInterceptors returns server interceptors that apply the timeout configured for a method
+// The keys of timeouts are full method names, eg: /pkg.Service/Method
+// When the incoming request has an earlier deadline, it is kept
+func NewMethodTimeoutInterceptors(timeouts map[string]time.Duration) (*UnaryServerInterceptor, *StreamServerInterceptor) {
+	unaryIx := &UnaryServerInterceptor{
+		Name:   "method-timeout",
+		Weight: MethodTimeoutInterceptorWeight,
+		Interceptor: func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			timeout, ok := timeouts[info.FullMethod]
+			if !ok {
+				return handler(ctx, req)
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return handler(ctx, req)
+		},
+	}
+	streamIx := &StreamServerInterceptor{
+		Name:   "method-timeout",
+		Weight: MethodTimeoutInterceptorWeight,
+		Interceptor: func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			timeout, ok := timeouts[info.FullMethod]
+			if !ok {
+				return handler(srv, ss)
+			}
+			ctx, cancel := context.WithTimeout(ss.Context(), timeout)
+			defer cancel()
+			return handler(srv, &timeoutServerStream{ss, ctx})
+		},
+	}
+	return unaryIx, streamIx
+}
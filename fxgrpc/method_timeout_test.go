@@ -0,0 +1,116 @@
+package fxgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// slowRouteGuideServer waits for its context to be done, or for a second to elapse
+type slowRouteGuideServer struct {
+	pb.UnimplementedRouteGuideServer
+}
+
+func wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+func (slowRouteGuideServer) GetFeature(ctx context.Context, p *pb.Point) (*pb.Feature, error) {
+	if err := wait(ctx); err != nil {
+		return nil, err
+	}
+	return &pb.Feature{Location: p}, nil
+}
+
+func (slowRouteGuideServer) ListFeatures(_ *pb.Rectangle, stream pb.RouteGuide_ListFeaturesServer) error {
+	return wait(stream.Context())
+}
+
+func TestMethodTimeouts(t *testing.T) {
+	server, err := NewGrpcServer(GrpcServerParams{
+		Conf: &Server{
+			MethodTimeouts: map[string]time.Duration{
+				"/routeguide.RouteGuide/GetFeature":   50 * time.Millisecond,
+				"/routeguide.RouteGuide/ListFeatures": 50 * time.Millisecond,
+			},
+		},
+	})
+	require.NoError(t, err)
+	pb.RegisterRouteGuideServer(server, slowRouteGuideServer{})
+
+	lis := bufconn.Listen(1024 * 1024)
+	go server.Serve(lis) //nolint:errcheck
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(
+		"passthrough://bufconn",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+	)
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+	client := pb.NewRouteGuideClient(conn)
+
+	t.Run("Should cancel a unary method after its timeout", func(t *testing.T) {
+		start := time.Now()
+		_, err := client.GetFeature(context.Background(), &pb.Point{})
+		require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		require.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+
+	t.Run("Should cancel a streaming method after its timeout", func(t *testing.T) {
+		stream, err := client.ListFeatures(context.Background(), &pb.Rectangle{})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	})
+
+	t.Run("Should keep an earlier incoming deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := client.GetFeature(ctx, &pb.Point{})
+		require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		require.Less(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("Should not affect other methods", func(t *testing.T) {
+		other, err := NewGrpcServer(GrpcServerParams{
+			Conf: &Server{
+				MethodTimeouts: map[string]time.Duration{
+					"/routeguide.RouteGuide/ListFeatures": 50 * time.Millisecond,
+				},
+			},
+		})
+		require.NoError(t, err)
+		pb.RegisterRouteGuideServer(other, slowRouteGuideServer{})
+		lis := bufconn.Listen(1024 * 1024)
+		go other.Serve(lis) //nolint:errcheck
+		defer other.Stop()
+
+		conn, err := grpc.NewClient(
+			"passthrough://bufconn",
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		)
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		_, err = pb.NewRouteGuideClient(conn).GetFeature(context.Background(), &pb.Point{})
+		require.NoError(t, err)
+	})
+}
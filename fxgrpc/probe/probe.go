@@ -0,0 +1,201 @@
+// Package probe provides a small reflection based client to debug stelling grpc servers.
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Usage describes the subcommands understood by Run
+const Usage = `usage:
+  list                  lists the services exposed by the server
+  call <method> [json]  invokes a unary method (eg: pkg.Service/Method) with a json encoded request`
+
+// Probe inspects and calls a grpc server through its reflection service
+type Probe struct {
+	conn   grpc.ClientConnInterface
+	client rpb.ServerReflectionClient
+}
+
+// New returns a Probe that uses the given connection
+func New(conn grpc.ClientConnInterface) *Probe {
+	return &Probe{
+		conn:   conn,
+		client: rpb.NewServerReflectionClient(conn),
+	}
+}
+
+// reflect sends a single request to the reflection service and returns its response
+func (p *Probe) reflect(ctx context.Context, req *rpb.ServerReflectionRequest) (*rpb.ServerReflectionResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := p.client.ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(req); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if errResp := resp.GetErrorResponse(); errResp != nil {
+		return nil, fmt.Errorf("reflection error %d: %s", errResp.ErrorCode, errResp.ErrorMessage)
+	}
+	return resp, nil
+}
+
+// ListServices returns the sorted names of all services exposed by the server
+func (p *Probe) ListServices(ctx context.Context) ([]string, error) {
+	resp, err := p.reflect(ctx, &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]string, 0, len(resp.GetListServicesResponse().GetService()))
+	for _, s := range resp.GetListServicesResponse().GetService() {
+		services = append(services, s.Name)
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// findMethod resolves the descriptor of a fully qualified method through the reflection service
+// The method can be formatted as pkg.Service/Method or pkg.Service.Method
+func (p *Probe) findMethod(ctx context.Context, method string) (protoreflect.MethodDescriptor, error) {
+	method = strings.TrimPrefix(method, "/")
+	idx := strings.LastIndexAny(method, "/.")
+	if idx <= 0 || idx == len(method)-1 {
+		return nil, fmt.Errorf("invalid method name %q: expected pkg.Service/Method", method)
+	}
+	service, name := method[:idx], method[idx+1:]
+
+	resp, err := p.reflect(ctx, &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		fd := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(b, fd); err != nil {
+			return nil, err
+		}
+		set.File = append(set.File, fd)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, err
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(name))
+	if md == nil {
+		return nil, fmt.Errorf("service %s has no method %s", service, name)
+	}
+	return md, nil
+}
+
+// Invoke calls a unary method with a json encoded request and returns the json encoded response
+func (p *Probe) Invoke(ctx context.Context, method string, input []byte) ([]byte, error) {
+	md, err := p.findMethod(ctx, method)
+	if err != nil {
+		return nil, err
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, fmt.Errorf("%s is a streaming method: only unary methods are supported", md.FullName())
+	}
+
+	req := dynamicpb.NewMessage(md.Input())
+	if len(input) > 0 {
+		if err := protojson.Unmarshal(input, req); err != nil {
+			return nil, fmt.Errorf("failed to decode request: %w", err)
+		}
+	}
+	resp := dynamicpb.NewMessage(md.Output())
+
+	fullMethod := fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+	if err := p.conn.Invoke(ctx, fullMethod, req, resp); err != nil {
+		return nil, err
+	}
+	return protojson.MarshalOptions{Multiline: true}.Marshal(resp)
+}
+
+// Run connects to the server described by conf and executes the subcommand in args
+// Its output is written to out. See Usage for the supported subcommands.
+func Run(ctx context.Context, conf fxgrpc.ClientConfig, args []string, out io.Writer, dOpts ...grpc.DialOption) error {
+	if len(args) == 0 {
+		return errors.New(Usage)
+	}
+
+	conn, err := fxgrpc.NewGrpcClient(conf, zap.NewNop(), nil, nil, dOpts...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close() //nolint:errcheck
+	p := New(conn)
+
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return errors.New(Usage)
+		}
+		services, err := p.ListServices(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range services {
+			if _, err := fmt.Fprintln(out, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "call":
+		if len(args) < 2 || len(args) > 3 {
+			return errors.New(Usage)
+		}
+		input := []byte("{}")
+		if len(args) == 3 {
+			input = []byte(args[2])
+		}
+		resp, err := p.Invoke(ctx, args[1], input)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(resp))
+		return err
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], Usage)
+	}
+}
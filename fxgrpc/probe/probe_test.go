@@ -0,0 +1,74 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+type routeGuideServer struct {
+	pb.UnimplementedRouteGuideServer
+}
+
+func (routeGuideServer) GetFeature(_ context.Context, p *pb.Point) (*pb.Feature, error) {
+	return &pb.Feature{Name: "summit", Location: p}, nil
+}
+
+func startServer(t *testing.T) grpc.DialOption {
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	pb.RegisterRouteGuideServer(s, routeGuideServer{})
+	reflection.Register(s)
+	go s.Serve(lis) //nolint:errcheck
+	t.Cleanup(s.Stop)
+
+	return grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	})
+}
+
+func TestRun(t *testing.T) {
+	dialer := startServer(t)
+	conf := &fxgrpc.Client{InsecureConnection: true, Endpoint: "passthrough://bufnet"}
+
+	t.Run("Should list the registered services", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		require.NoError(t, Run(context.Background(), conf, []string{"list"}, out, dialer))
+
+		services := strings.Split(strings.TrimSpace(out.String()), "\n")
+		require.Contains(t, services, "routeguide.RouteGuide")
+		require.Contains(t, services, "grpc.reflection.v1.ServerReflection")
+	})
+
+	t.Run("Should invoke a unary method from json", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		args := []string{"call", "routeguide.RouteGuide/GetFeature", `{"latitude": 42}`}
+		require.NoError(t, Run(context.Background(), conf, args, out, dialer))
+
+		feature := &pb.Feature{}
+		require.NoError(t, protojson.Unmarshal(out.Bytes(), feature))
+		require.Equal(t, "summit", feature.Name)
+		require.Equal(t, int32(42), feature.Location.Latitude)
+	})
+
+	t.Run("Should reject streaming methods", func(t *testing.T) {
+		args := []string{"call", "routeguide.RouteGuide.ListFeatures"}
+		err := Run(context.Background(), conf, args, &bytes.Buffer{}, dialer)
+		require.ErrorContains(t, err, "streaming method")
+	})
+
+	t.Run("Should reject unknown commands", func(t *testing.T) {
+		err := Run(context.Background(), conf, []string{"describe"}, &bytes.Buffer{}, dialer)
+		require.ErrorContains(t, err, "unknown command")
+	})
+}
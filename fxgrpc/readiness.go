@@ -0,0 +1,75 @@
+package fxgrpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/fx"
+	"google.golang.org/grpc"
+)
+
+// ReadinessGateGroup is the value group of the client connections which gate the readiness of the system
+const ReadinessGateGroup = `group:"grpc_readiness_gates"`
+
+// ReadinessGate is a client connection the system waits for before reporting ready, see Client.ReadinessTimeout
+// The health module waits for the gates of the system before reporting SERVING
+type ReadinessGate struct {
+	// Name is the name of the client module, empty for the default client
+	Name string
+	// Endpoint is the endpoint of the client
+	Endpoint string
+	// Conn is the connection of the client
+	Conn *grpc.ClientConn
+	// Timeout bounds the wait for the connection
+	Timeout time.Duration
+	// ReadyAfterTimeout stops holding the readiness of the system when the Timeout expires
+	// Otherwise the system isn't ready until the connection is
+	ReadyAfterTimeout bool
+}
+
+// Wait connects the client and waits until the connection is ready
+// The wait is bounded by both ctx and the Timeout of the gate
+func (g *ReadinessGate) Wait(ctx context.Context) error {
+	waitCtx, cancel := context.WithTimeout(ctx, g.Timeout)
+	defer cancel()
+
+	if state, ok := connectAndWait(waitCtx, g.Conn); !ok {
+		return fmt.Errorf("%s not ready within %s (last state: %s): %w", g.Endpoint, g.Timeout, state, waitCtx.Err())
+	}
+	return nil
+}
+
+// WaitReady connects the client and waits until the connection is ready, without the Timeout of the gate
+func (g *ReadinessGate) WaitReady(ctx context.Context) error {
+	if state, ok := connectAndWait(ctx, g.Conn); !ok {
+		return fmt.Errorf("%s not ready (last state: %s): %w", g.Endpoint, state, ctx.Err())
+	}
+	return nil
+}
+
+// provideReadinessGate returns an option providing the client of the module as a ReadinessGate, when its ReadinessTimeout is set
+// nameTag is the tag of the client in the module, empty for the default client
+func provideReadinessGate(name, nameTag string, conf ClientConfig) fx.Option {
+	c := conf.GrpcClientConfig()
+	if c.ReadinessTimeout <= 0 {
+		return fx.Options()
+	}
+	return fx.Provide(fx.Annotate(
+		func(conn grpc.ClientConnInterface) (*ReadinessGate, error) {
+			cc, ok := conn.(*grpc.ClientConn)
+			if !ok {
+				return nil, fmt.Errorf("the grpc client %q is not a *grpc.ClientConn", name)
+			}
+			return &ReadinessGate{
+				Name:              name,
+				Endpoint:          c.Endpoint,
+				Conn:              cc,
+				Timeout:           c.ReadinessTimeout,
+				ReadyAfterTimeout: c.ReadyAfterReadinessTimeout,
+			}, nil
+		},
+		fx.ParamTags(nameTag),
+		fx.ResultTags(ReadinessGateGroup),
+	))
+}
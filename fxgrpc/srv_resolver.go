@@ -0,0 +1,153 @@
+package fxgrpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// SRVScheme is the scheme of the endpoints resolved from SRV records, eg: srv://_grpc._tcp.service.domain
+const SRVScheme = "srv"
+
+// minSRVResolveInterval is the minimum time between two lookups of the same name, like the dns resolver of grpc
+var minSRVResolveInterval = 30 * time.Second
+
+// srvLookupFunc has the signature of net.Resolver.LookupSRV
+type srvLookupFunc func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+
+// srvResolverBuilder builds the resolvers of the srv:// endpoints
+type srvResolverBuilder struct {
+	lookup srvLookupFunc
+}
+
+func newSRVResolverBuilder(lookup srvLookupFunc) resolver.Builder {
+	return &srvResolverBuilder{lookup: lookup}
+}
+
+func (b *srvResolverBuilder) Scheme() string {
+	return SRVScheme
+}
+
+// srvName returns the SRV name of the target, which is accepted as srv://name or srv:///name
+func srvName(target resolver.Target) string {
+	if target.URL.Host != "" {
+		return target.URL.Host
+	}
+	return target.Endpoint()
+}
+
+// OverrideAuthority uses the name without its service and protocol labels as the authority of the connection,
+// eg: service.domain for srv://_grpc._tcp.service.domain, which is also the server name checked against the TLS certificate
+func (b *srvResolverBuilder) OverrideAuthority(target resolver.Target) string {
+	labels := strings.Split(srvName(target), ".")
+	if len(labels) > 2 && strings.HasPrefix(labels[0], "_") && strings.HasPrefix(labels[1], "_") {
+		labels = labels[2:]
+	}
+	return strings.Join(labels, ".")
+}
+
+func (b *srvResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	name := srvName(target)
+	if name == "" {
+		return nil, fmt.Errorf("missing SRV name in target %q", target.URL.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &srvResolver{
+		name:   name,
+		lookup: b.lookup,
+		cc:     cc,
+		cancel: cancel,
+		rn:     make(chan struct{}, 1),
+	}
+	r.wg.Add(1)
+	go r.watch(ctx)
+	return r, nil
+}
+
+// srvResolver looks the SRV records up when it is built, and again whenever grpc asks for it
+type srvResolver struct {
+	name   string
+	lookup srvLookupFunc
+	cc     resolver.ClientConn
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	rn     chan struct{}
+}
+
+func (r *srvResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.rn <- struct{}{}:
+	default:
+	}
+}
+
+func (r *srvResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *srvResolver) watch(ctx context.Context) {
+	defer r.wg.Done()
+	for {
+		r.resolve(ctx)
+
+		// Rate limit the lookups, as ResolveNow is called on every connection failure
+		t := time.NewTimer(minSRVResolveInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.rn:
+		}
+	}
+}
+
+func (r *srvResolver) resolve(ctx context.Context) {
+	_, records, err := r.lookup(ctx, "", "", r.name)
+	if err != nil {
+		r.cc.ReportError(fmt.Errorf("failed to look up the SRV records of %s: %w", r.name, err))
+		return
+	}
+	addrs := srvAddresses(records)
+	if len(addrs) == 0 {
+		r.cc.ReportError(fmt.Errorf("no SRV records found for %s", r.name))
+		return
+	}
+	_ = r.cc.UpdateState(resolver.State{Addresses: addrs})
+}
+
+// srvAddresses returns the addresses of the records with the lowest priority value
+// The records of the other priorities are fallbacks, which are not used while these are published
+func srvAddresses(records []*net.SRV) []resolver.Address {
+	// A target of "." means the service is not available at this domain
+	var available []*net.SRV
+	for _, record := range records {
+		if record.Target != "." {
+			available = append(available, record)
+		}
+	}
+
+	var addrs []resolver.Address
+	for _, record := range available {
+		if record.Priority != available[0].Priority {
+			// net.LookupSRV sorts the records by priority
+			break
+		}
+		host := strings.TrimSuffix(record.Target, ".")
+		addrs = append(addrs, resolver.Address{Addr: net.JoinHostPort(host, strconv.Itoa(int(record.Port)))})
+	}
+	return addrs
+}
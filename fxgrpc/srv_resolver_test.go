@@ -0,0 +1,119 @@
+package fxgrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+)
+
+// authorityRouteGuideServer returns its name and the authority of the request in the feature
+type authorityRouteGuideServer struct {
+	pb.UnimplementedRouteGuideServer
+	name string
+}
+
+func (s *authorityRouteGuideServer) GetFeature(ctx context.Context, req *pb.Point) (*pb.Feature, error) {
+	authority := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(":authority")) > 0 {
+		authority = md.Get(":authority")[0]
+	}
+	return &pb.Feature{Name: s.name + "@" + authority}, nil
+}
+
+// startAuthorityServer starts a grpc server on a local port, and returns that port
+func startAuthorityServer(t *testing.T, name string) uint16 {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	pb.RegisterRouteGuideServer(server, &authorityRouteGuideServer{name: name})
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+	return uint16(lis.Addr().(*net.TCPAddr).Port)
+}
+
+func TestSRVResolver(t *testing.T) {
+	t.Run("Should resolve the endpoint to the targets of the SRV records", func(t *testing.T) {
+		portA := startAuthorityServer(t, "a")
+		portB := startAuthorityServer(t, "b")
+
+		var queried []string
+		lookup := func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+			queried = append(queried, service+proto+name)
+			return name, []*net.SRV{
+				{Target: "127.0.0.1.", Port: portA, Priority: 10},
+				{Target: "127.0.0.1.", Port: portB, Priority: 10},
+			}, nil
+		}
+
+		conf := &Client{InsecureConnection: true, Endpoint: "srv://_grpc._tcp.route-guide.example.com", LoadBalancingPolicy: "round_robin"}
+		opts := append([]grpc.DialOption{grpc.WithResolvers(newSRVResolverBuilder(lookup))}, clientDialOptions(conf, insecure.NewCredentials(), nil, nil, nil)...)
+		conn, err := grpc.NewClient(conf.Endpoint, opts...)
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		client := pb.NewRouteGuideClient(conn)
+		seen := map[string]bool{}
+		for i := 0; i < 10; i++ {
+			feature, err := client.GetFeature(context.Background(), &pb.Point{})
+			require.NoError(t, err)
+			seen[feature.Name] = true
+		}
+		require.Equal(t, map[string]bool{"a@route-guide.example.com": true, "b@route-guide.example.com": true}, seen)
+		require.Equal(t, []string{"_grpc._tcp.route-guide.example.com"}, queried)
+	})
+
+	t.Run("Should fail the requests when the lookup fails", func(t *testing.T) {
+		lookup := func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+			return "", nil, errors.New("no such host")
+		}
+
+		conn, err := grpc.NewClient(
+			"srv://_grpc._tcp.route-guide.example.com",
+			grpc.WithResolvers(newSRVResolverBuilder(lookup)),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		_, err = pb.NewRouteGuideClient(conn).GetFeature(context.Background(), &pb.Point{})
+		require.ErrorContains(t, err, "failed to look up the SRV records of _grpc._tcp.route-guide.example.com: no such host")
+	})
+}
+
+func TestSRVAddresses(t *testing.T) {
+	t.Run("Should only use the records of the lowest priority", func(t *testing.T) {
+		records := []*net.SRV{
+			{Target: "a.example.com.", Port: 443, Priority: 10},
+			{Target: "b.example.com.", Port: 8443, Priority: 10},
+			{Target: "fallback.example.com.", Port: 443, Priority: 20},
+		}
+		require.Equal(t, []resolver.Address{{Addr: "a.example.com:443"}, {Addr: "b.example.com:8443"}}, srvAddresses(records))
+	})
+
+	t.Run("Should skip the unavailable service records", func(t *testing.T) {
+		require.Empty(t, srvAddresses([]*net.SRV{{Target: ".", Port: 0}}))
+	})
+}
+
+func TestSRVAuthority(t *testing.T) {
+	cases := map[string]string{
+		"srv://_grpc._tcp.route-guide.example.com":  "route-guide.example.com",
+		"srv:///_grpc._tcp.route-guide.example.com": "route-guide.example.com",
+		"srv://route-guide.example.com":             "route-guide.example.com",
+	}
+	builder := &srvResolverBuilder{}
+	for target, expected := range cases {
+		u, err := url.Parse(target)
+		require.NoError(t, err)
+		require.Equal(t, expected, builder.OverrideAuthority(resolver.Target{URL: *u}), target)
+	}
+}
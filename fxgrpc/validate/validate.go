@@ -0,0 +1,166 @@
+// Package validate provides grpc server interceptors that validate the incoming requests, eg: with protovalidate.
+package validate
+
+import (
+	"context"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"go.uber.org/fx"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// GrpcInterceptorWeight places the interceptors after the authorizer,
+// so unauthorized clients do not learn about the constraints of the requests
+const GrpcInterceptorWeight uint = 75
+
+// Validator validates a request message
+// The returned error is reported to the client with codes.InvalidArgument, see NewViolation to add field violations
+type Validator interface {
+	Validate(msg proto.Message) error
+}
+
+// ValidatorFunc adapts a function to a Validator
+type ValidatorFunc func(msg proto.Message) error
+
+func (f ValidatorFunc) Validate(msg proto.Message) error {
+	return f(msg)
+}
+
+// violation is an error about a single field of a message
+type violation struct {
+	field       string
+	description string
+}
+
+func (v *violation) Error() string {
+	return v.field + ": " + v.description
+}
+
+// NewViolation returns an error about the given field, which is reported as a field violation in the details of the status
+// Several violations can be combined with errors.Join
+func NewViolation(field, description string) error {
+	return &violation{field, description}
+}
+
+// fieldViolations collects the violations of the error tree of err
+func fieldViolations(err error) []*errdetails.BadRequest_FieldViolation {
+	var result []*errdetails.BadRequest_FieldViolation
+	switch e := err.(type) {
+	case *violation:
+		result = append(result, &errdetails.BadRequest_FieldViolation{Field: e.field, Description: e.description})
+	case interface{ Unwrap() []error }:
+		for _, err := range e.Unwrap() {
+			result = append(result, fieldViolations(err)...)
+		}
+	case interface{ Unwrap() error }:
+		result = fieldViolations(e.Unwrap())
+	}
+	return result
+}
+
+// toStatus converts the error of a validator to a codes.InvalidArgument status, with its field violations as details
+// Errors which already carry a status are returned unchanged
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	st := status.New(codes.InvalidArgument, err.Error())
+	if violations := fieldViolations(err); len(violations) > 0 {
+		if detailed, dErr := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); dErr == nil {
+			st = detailed
+		}
+	}
+	return st.Err()
+}
+
+type options struct {
+	skip map[string]bool
+}
+
+type Option func(*options)
+
+// WithSkipMethods disables the validation of the given methods, by full method name (eg: /pkg.Service/Method)
+func WithSkipMethods(methods ...string) Option {
+	return func(o *options) {
+		for _, method := range methods {
+			o.skip[method] = true
+		}
+	}
+}
+
+// validate validates the request, when it is a proto message
+func validate(v Validator, req any) error {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil
+	}
+	if err := v.Validate(msg); err != nil {
+		return toStatus(err)
+	}
+	return nil
+}
+
+// validatingServerStream validates every message received on a grpc.ServerStream
+type validatingServerStream struct {
+	grpc.ServerStream
+	validator Validator
+}
+
+func (s *validatingServerStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return validate(s.validator, m)
+}
+
+// NewGrpcServerInterceptors returns server interceptors that reject the invalid requests with codes.InvalidArgument
+// For streams, every received message is validated
+func NewGrpcServerInterceptors(v Validator, opts ...Option) (*fxgrpc.UnaryServerInterceptor, *fxgrpc.StreamServerInterceptor) {
+	o := &options{skip: map[string]bool{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	unaryIx := &fxgrpc.UnaryServerInterceptor{
+		Name:   "validate",
+		Weight: GrpcInterceptorWeight,
+		Interceptor: func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if o.skip[info.FullMethod] {
+				return handler(ctx, req)
+			}
+			if err := validate(v, req); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		},
+	}
+	streamIx := &fxgrpc.StreamServerInterceptor{
+		Name:   "validate",
+		Weight: GrpcInterceptorWeight,
+		Interceptor: func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if o.skip[info.FullMethod] {
+				return handler(srv, ss)
+			}
+			return handler(srv, &validatingServerStream{ss, v})
+		},
+	}
+	return unaryIx, streamIx
+}
+
+// NewModule validates the requests of the grpc servers of the system with the given validator
+func NewModule(v Validator, opts ...Option) fx.Option {
+	return fx.Module(
+		"grpc-validate",
+		fx.Provide(
+			fx.Annotate(
+				func() (*fxgrpc.UnaryServerInterceptor, *fxgrpc.StreamServerInterceptor) {
+					return NewGrpcServerInterceptors(v, opts...)
+				},
+				fx.ResultTags(`group:"unary_server_interceptor"`, `group:"stream_server_interceptor"`),
+			),
+		),
+	)
+}
@@ -0,0 +1,110 @@
+package validate_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/exoscale/stelling/fxgrpc/grpctest"
+	"github.com/exoscale/stelling/fxgrpc/validate"
+	"github.com/exoscale/stelling/stellingtest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type routeGuideServer struct {
+	pb.UnimplementedRouteGuideServer
+}
+
+func (routeGuideServer) GetFeature(_ context.Context, p *pb.Point) (*pb.Feature, error) {
+	return &pb.Feature{Location: p}, nil
+}
+
+func (routeGuideServer) ListFeatures(_ *pb.Rectangle, stream pb.RouteGuide_ListFeaturesServer) error {
+	return stream.Send(&pb.Feature{})
+}
+
+// validateRequest requires the coordinates to be in the valid range, like a buf/validate constraint would
+func validateRequest(msg proto.Message) error {
+	switch m := msg.(type) {
+	case *pb.Point:
+		return validatePoint("", m)
+	case *pb.Rectangle:
+		return errors.Join(validatePoint("lo.", m.Lo), validatePoint("hi.", m.Hi))
+	}
+	return nil
+}
+
+func validatePoint(prefix string, p *pb.Point) error {
+	var errs []error
+	if p.Latitude < -900_000_000 || p.Latitude > 900_000_000 {
+		errs = append(errs, validate.NewViolation(prefix+"latitude", "must be between -90 and 90 degrees"))
+	}
+	if p.Longitude < -1_800_000_000 || p.Longitude > 1_800_000_000 {
+		errs = append(errs, validate.NewViolation(prefix+"longitude", "must be between -180 and 180 degrees"))
+	}
+	return errors.Join(errs...)
+}
+
+func TestValidate(t *testing.T) {
+	run := func(t *testing.T, fn func(ctx context.Context, client pb.RouteGuideClient) error, opts ...validate.Option) {
+		stellingtest.Run(t, fn,
+			grpctest.Module,
+			validate.NewModule(validate.ValidatorFunc(validateRequest), opts...),
+			fx.Provide(
+				func() pb.RouteGuideServer { return routeGuideServer{} },
+				pb.NewRouteGuideClient,
+			),
+			fx.Invoke(pb.RegisterRouteGuideServer),
+		)
+	}
+
+	t.Run("Should accept a valid request", func(t *testing.T) {
+		run(t, func(ctx context.Context, client pb.RouteGuideClient) error {
+			_, err := client.GetFeature(ctx, &pb.Point{Latitude: 1, Longitude: 1})
+			return err
+		})
+	})
+
+	t.Run("Should reject an invalid request with its field violations", func(t *testing.T) {
+		run(t, func(ctx context.Context, client pb.RouteGuideClient) error {
+			_, err := client.GetFeature(ctx, &pb.Point{Latitude: 1_000_000_000, Longitude: -2_000_000_000})
+			st := status.Convert(err)
+			require.Equal(t, codes.InvalidArgument, st.Code())
+			require.Len(t, st.Details(), 1)
+			badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+			require.True(t, ok)
+			require.Len(t, badRequest.FieldViolations, 2)
+			require.Equal(t, "latitude", badRequest.FieldViolations[0].Field)
+			require.Equal(t, "must be between -90 and 90 degrees", badRequest.FieldViolations[0].Description)
+			require.Equal(t, "longitude", badRequest.FieldViolations[1].Field)
+			return nil
+		})
+	})
+
+	t.Run("Should validate the messages of a stream", func(t *testing.T) {
+		run(t, func(ctx context.Context, client pb.RouteGuideClient) error {
+			stream, err := client.ListFeatures(ctx, &pb.Rectangle{Lo: &pb.Point{}, Hi: &pb.Point{Latitude: 1_000_000_000}})
+			if err != nil {
+				return err
+			}
+			_, err = stream.Recv()
+			st := status.Convert(err)
+			require.Equal(t, codes.InvalidArgument, st.Code())
+			require.Equal(t, "hi.latitude: must be between -90 and 90 degrees", st.Message())
+			return nil
+		})
+	})
+
+	t.Run("Should not validate the skipped methods", func(t *testing.T) {
+		run(t, func(ctx context.Context, client pb.RouteGuideClient) error {
+			_, err := client.GetFeature(ctx, &pb.Point{Latitude: 1_000_000_000})
+			return err
+		}, validate.WithSkipMethods("/routeguide.RouteGuide/GetFeature"))
+	})
+}
@@ -0,0 +1,173 @@
+// Package version provides a grpc service exposing the build information of the server.
+package version
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/exoscale/stelling/fxmetrics"
+	"go.uber.org/fx"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ServiceName is the name of the version service
+const ServiceName = "stelling.version.v1.Version"
+
+// GetVersionMethod is the full method name of the GetVersion RPC
+const GetVersionMethod = "/" + ServiceName + "/GetVersion"
+
+// Add a service that exposes the build information of the grpc server
+var Module = fx.Module(
+	"grpc-version",
+	fx.Provide(NewInfoFromBuild),
+	fx.Invoke(RegisterVersionService),
+)
+
+// Info is the build information of the binary
+type Info struct {
+	// Revision is the vcs revision the binary was built from
+	Revision string
+	// RevisionTimestamp is the time of the revision
+	RevisionTimestamp string
+	// Dirty reports whether the working tree had local modifications when the binary was built
+	Dirty bool
+	// GoVersion is the version of Go which built the binary
+	GoVersion string
+	// Version is the version of the main module, "(devel)" unless installed with go install
+	Version string
+}
+
+// NewInfo extracts the build information from info, as the build_info metric of [fxmetrics] does
+// The revision set at link time for fxmetrics takes precedence over the vcs settings of info
+// Values which can't be determined are set to "unknown"
+func NewInfo(info *debug.BuildInfo) *Info {
+	return newInfo(fxmetrics.NewBuildInfo(info))
+}
+
+// NewInfoFromBuild returns the build information of the running binary
+func NewInfoFromBuild() *Info {
+	return newInfo(fxmetrics.ReadBuildInfo())
+}
+
+func newInfo(b *fxmetrics.BuildInfo) *Info {
+	return &Info{
+		Revision:          b.Revision,
+		RevisionTimestamp: b.RevisionTimestamp,
+		Dirty:             b.Dirty == "true",
+		GoVersion:         b.GoVersion,
+		Version:           b.Version,
+	}
+}
+
+func (i *Info) toStruct() (*structpb.Struct, error) {
+	return structpb.NewStruct(map[string]any{
+		"revision":           i.Revision,
+		"revision_timestamp": i.RevisionTimestamp,
+		"dirty":              i.Dirty,
+		"go_version":         i.GoVersion,
+		"version":            i.Version,
+	})
+}
+
+func infoFromStruct(s *structpb.Struct) *Info {
+	fields := s.GetFields()
+	return &Info{
+		Revision:          fields["revision"].GetStringValue(),
+		RevisionTimestamp: fields["revision_timestamp"].GetStringValue(),
+		Dirty:             fields["dirty"].GetBoolValue(),
+		GoVersion:         fields["go_version"].GetStringValue(),
+		Version:           fields["version"].GetStringValue(),
+	}
+}
+
+// VersionServer is the server API of the version service
+// There is no proto file for the service: it is described by hand, and the well known types are used as messages
+type VersionServer interface {
+	GetVersion(context.Context, *emptypb.Empty) (*structpb.Struct, error)
+}
+
+type server struct {
+	info *Info
+}
+
+func (s *server) GetVersion(context.Context, *emptypb.Empty) (*structpb.Struct, error) {
+	return s.info.toStruct()
+}
+
+func getVersionHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VersionServer).GetVersion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GetVersionMethod,
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(VersionServer).GetVersion(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*VersionServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetVersion",
+			Handler:    getVersionHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: fileName,
+}
+
+// fileName is the name of the file descriptor registered for the service
+const fileName = "stelling/version/v1/version.proto"
+
+// The file descriptor of the service is registered so the reflection service can describe it
+func init() {
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String(fileName),
+		Package:    proto.String("stelling.version.v1"),
+		Dependency: []string{"google/protobuf/empty.proto", "google/protobuf/struct.proto"},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Version"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("GetVersion"),
+				InputType:  proto.String(".google.protobuf.Empty"),
+				OutputType: proto.String(".google.protobuf.Struct"),
+			}},
+		}},
+		Syntax: proto.String("proto3"),
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		panic(err)
+	}
+	if err := protoregistry.GlobalFiles.RegisterFile(file); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterVersionService registers the version service, serving info, on the grpc server
+func RegisterVersionService(info *Info, grpcServer grpc.ServiceRegistrar) {
+	grpcServer.RegisterService(&serviceDesc, &server{info})
+}
+
+// GetVersion calls the version service of the server behind conn
+func GetVersion(ctx context.Context, conn grpc.ClientConnInterface, opts ...grpc.CallOption) (*Info, error) {
+	out := new(structpb.Struct)
+	if err := conn.Invoke(ctx, GetVersionMethod, &emptypb.Empty{}, out, opts...); err != nil {
+		return nil, err
+	}
+	return infoFromStruct(out), nil
+}
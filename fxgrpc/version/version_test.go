@@ -0,0 +1,87 @@
+package version
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"runtime/debug"
+	"testing"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/exoscale/stelling/fxgrpc/grpctest"
+	"github.com/exoscale/stelling/fxgrpc/probe"
+	"github.com/exoscale/stelling/stellingtest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var buildInfo = &debug.BuildInfo{
+	GoVersion: "go1.24.2",
+	Main:      debug.Module{Path: "github.com/exoscale/my-service", Version: "v1.2.3"},
+	Settings: []debug.BuildSetting{
+		{Key: "vcs.revision", Value: "0123abcd"},
+		{Key: "vcs.time", Value: "2024-06-18T14:28:57Z"},
+		{Key: "vcs.modified", Value: "true"},
+	},
+}
+
+func TestNewInfo(t *testing.T) {
+	t.Run("Should read the vcs settings", func(t *testing.T) {
+		require.Equal(t, &Info{
+			Revision:          "0123abcd",
+			RevisionTimestamp: "2024-06-18T14:28:57Z",
+			Dirty:             true,
+			GoVersion:         "go1.24.2",
+			Version:           "v1.2.3",
+		}, NewInfo(buildInfo))
+	})
+
+	t.Run("Should default to unknown", func(t *testing.T) {
+		require.Equal(t, &Info{
+			Revision:          "unknown",
+			RevisionTimestamp: "unknown",
+			GoVersion:         "go1.24.2",
+			Version:           "unknown",
+		}, NewInfo(&debug.BuildInfo{GoVersion: "go1.24.2"}))
+	})
+}
+
+func TestVersionService(t *testing.T) {
+	stellingtest.Run(t, func(ctx context.Context, conn grpc.ClientConnInterface) error {
+		info, err := GetVersion(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, NewInfo(buildInfo), info)
+		return nil
+	},
+		grpctest.Module,
+		Module,
+		fx.Decorate(func() *Info { return NewInfo(buildInfo) }),
+	)
+}
+
+func TestVersionServiceReflection(t *testing.T) {
+	t.Run("Should be described by the reflection service", func(t *testing.T) {
+		lis := bufconn.Listen(1024 * 1024)
+		s := grpc.NewServer()
+		RegisterVersionService(NewInfo(buildInfo), s)
+		reflection.Register(s)
+		go s.Serve(lis) //nolint:errcheck
+		t.Cleanup(s.Stop)
+		dialer := grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		})
+		conf := &fxgrpc.Client{InsecureConnection: true, Endpoint: "passthrough://bufnet"}
+
+		out := &bytes.Buffer{}
+		require.NoError(t, probe.Run(context.Background(), conf, []string{"call", GetVersionMethod}, out, dialer))
+
+		got := &structpb.Struct{}
+		require.NoError(t, protojson.Unmarshal(out.Bytes(), got))
+		require.Equal(t, NewInfo(buildInfo), infoFromStruct(got))
+	})
+}
@@ -0,0 +1,153 @@
+package fxhttp
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// CORSMiddlewareWeight places the CORS middleware inside the logging and metrics middlewares, so preflight requests are observed,
+// but before any authorization middleware, which browsers don't satisfy in preflight requests
+const CORSMiddlewareWeight = 65
+
+// CORS contains the configuration of the Cross-Origin Resource Sharing headers
+type CORS struct {
+	// Enabled adds the CORS headers to the responses of the allowed origins, and answers their preflight requests
+	Enabled bool
+	// AllowedOrigins are the origins allowed to make cross-origin requests, eg: https://portal.example.com
+	// "*" allows all origins
+	AllowedOrigins []string `validate:"required_if=Enabled true"`
+	// AllowedMethods are the methods allowed in cross-origin requests
+	// GET, HEAD and POST are allowed when unset
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed in cross-origin requests, on top of the CORS-safelisted ones
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers which the browser exposes to the client, on top of the CORS-safelisted ones
+	ExposedHeaders []string
+	// AllowCredentials allows cross-origin requests to carry cookies and authorization headers
+	AllowCredentials bool
+	// MaxAge is how long the browser may cache the result of a preflight request
+	MaxAge time.Duration `validate:"min=0"`
+}
+
+func (c *CORS) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if c == nil {
+		return nil
+	}
+
+	enc.AddBool("enabled", c.Enabled)
+	enc.AddString("allowed-origins", strings.Join(c.AllowedOrigins, ","))
+	if len(c.AllowedMethods) > 0 {
+		enc.AddString("allowed-methods", strings.Join(c.AllowedMethods, ","))
+	}
+	if len(c.AllowedHeaders) > 0 {
+		enc.AddString("allowed-headers", strings.Join(c.AllowedHeaders, ","))
+	}
+	if len(c.ExposedHeaders) > 0 {
+		enc.AddString("exposed-headers", strings.Join(c.ExposedHeaders, ","))
+	}
+	if c.AllowCredentials {
+		enc.AddBool("allow-credentials", c.AllowCredentials)
+	}
+	if c.MaxAge > 0 {
+		enc.AddDuration("max-age", c.MaxAge)
+	}
+
+	return nil
+}
+
+var defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// NewCORSMiddleware adds the CORS headers to the responses of the origins allowed by conf
+// Preflight requests are answered directly, and don't reach the wrapped handler
+// The requests of other origins are handled normally, without CORS headers, so the browser blocks their response
+func NewCORSMiddleware(conf *CORS) *Middleware {
+	methods := conf.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	methods = normalizeTokens(methods, strings.ToUpper)
+	headers := normalizeTokens(conf.AllowedHeaders, http.CanonicalHeaderKey)
+	allowAll := slices.Contains(conf.AllowedOrigins, "*")
+
+	return &Middleware{
+		Name:   "cors",
+		Weight: CORSMiddlewareWeight,
+		Middleware: func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header := w.Header()
+				origin := r.Header.Get("Origin")
+				preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+				if preflight {
+					header.Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+				} else {
+					header.Add("Vary", "Origin")
+				}
+				if origin == "" || !allowAll && !slices.Contains(conf.AllowedOrigins, origin) {
+					h.ServeHTTP(w, r)
+					return
+				}
+
+				if preflight {
+					// A preflight which is not allowed gets no CORS headers, and the browser blocks the actual request
+					if allowedPreflight(r, methods, headers) {
+						setAllowOrigin(header, conf, origin, allowAll)
+						header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+						if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+							header.Set("Access-Control-Allow-Headers", requested)
+						}
+						if conf.MaxAge > 0 {
+							header.Set("Access-Control-Max-Age", strconv.Itoa(int(conf.MaxAge.Seconds())))
+						}
+					}
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+
+				setAllowOrigin(header, conf, origin, allowAll)
+				if len(conf.ExposedHeaders) > 0 {
+					header.Set("Access-Control-Expose-Headers", strings.Join(conf.ExposedHeaders, ", "))
+				}
+				h.ServeHTTP(w, r)
+			})
+		},
+	}
+}
+
+func setAllowOrigin(header http.Header, conf *CORS, origin string, allowAll bool) {
+	// Credentials are not allowed with a wildcard origin, so the origin is reflected instead
+	if allowAll && !conf.AllowCredentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if conf.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// allowedPreflight returns whether the method and headers requested by a preflight request are allowed
+func allowedPreflight(r *http.Request, methods []string, headers []string) bool {
+	if !slices.Contains(methods, strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))) {
+		return false
+	}
+	for _, requested := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		requested = strings.TrimSpace(requested)
+		if requested != "" && !slices.Contains(headers, http.CanonicalHeaderKey(requested)) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeTokens(tokens []string, normalize func(string) string) []string {
+	normalized := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		normalized = append(normalized, normalize(strings.TrimSpace(t)))
+	}
+	return normalized
+}
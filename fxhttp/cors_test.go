@@ -0,0 +1,107 @@
+package fxhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	conf := &CORS{
+		Enabled:          true,
+		AllowedOrigins:   []string{"https://portal.example.com"},
+		AllowedMethods:   []string{"GET", "put"},
+		AllowedHeaders:   []string{"authorization", "Content-Type"},
+		ExposedHeaders:   []string{"X-Trace-Id"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	handled := false
+	handler := NewCORSMiddleware(conf).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled = true
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	serve := func(method string, headers map[string]string) *httptest.ResponseRecorder {
+		handled = false
+		req := httptest.NewRequest(method, "/admin", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Should answer an allowed preflight request", func(t *testing.T) {
+		rec := serve(http.MethodOptions, map[string]string{
+			"Origin":                         "https://portal.example.com",
+			"Access-Control-Request-Method":  "PUT",
+			"Access-Control-Request-Headers": "Authorization, content-type",
+		})
+
+		require.False(t, handled)
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		require.Equal(t, "https://portal.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "GET, PUT", rec.Header().Get("Access-Control-Allow-Methods"))
+		require.Equal(t, "Authorization, content-type", rec.Header().Get("Access-Control-Allow-Headers"))
+		require.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+		require.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+	})
+
+	t.Run("Should not allow a preflight request for a method or header which is not configured", func(t *testing.T) {
+		for _, headers := range []map[string]string{
+			{"Origin": "https://portal.example.com", "Access-Control-Request-Method": "DELETE"},
+			{"Origin": "https://portal.example.com", "Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Custom"},
+		} {
+			rec := serve(http.MethodOptions, headers)
+
+			require.False(t, handled)
+			require.Equal(t, http.StatusNoContent, rec.Code)
+			require.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+		}
+	})
+
+	t.Run("Should add the CORS headers to an actual cross-origin request", func(t *testing.T) {
+		rec := serve(http.MethodGet, map[string]string{"Origin": "https://portal.example.com"})
+
+		require.True(t, handled)
+		require.Equal(t, http.StatusTeapot, rec.Code)
+		require.Equal(t, "https://portal.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+		require.Equal(t, "X-Trace-Id", rec.Header().Get("Access-Control-Expose-Headers"))
+		require.Equal(t, "Origin", rec.Header().Get("Vary"))
+	})
+
+	t.Run("Should not add the CORS headers for other origins", func(t *testing.T) {
+		for _, headers := range []map[string]string{
+			{"Origin": "https://evil.example.com"},
+			{"Origin": "https://evil.example.com", "Access-Control-Request-Method": "GET"},
+			{},
+		} {
+			method := http.MethodGet
+			if _, ok := headers["Access-Control-Request-Method"]; ok {
+				method = http.MethodOptions
+			}
+			rec := serve(method, headers)
+
+			require.True(t, handled)
+			require.Equal(t, http.StatusTeapot, rec.Code)
+			require.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+		}
+	})
+
+	t.Run("Should allow all origins with a wildcard", func(t *testing.T) {
+		handler := NewCORSMiddleware(&CORS{Enabled: true, AllowedOrigins: []string{"*"}}).Middleware(http.NotFoundHandler())
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", "https://any.example.com")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		require.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+		require.Empty(t, rec.Header().Get("Access-Control-Allow-Credentials"))
+	})
+}
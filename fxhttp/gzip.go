@@ -0,0 +1,215 @@
+package fxhttp
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// GzipMiddlewareWeight makes the gzip middleware one of the innermost, so the other middlewares see the compressed response
+const GzipMiddlewareWeight = 90
+
+// Gzip contains the configuration of the response compression
+type Gzip struct {
+	// Enabled compresses the responses of clients which accept the gzip encoding
+	Enabled bool
+	// MinSize is the size, in bytes, from which a response is compressed
+	MinSize int `default:"1024" validate:"min=0"`
+	// Level is the gzip compression level, from 1 (best speed) to 9 (best compression)
+	// -1 uses the default level of compress/gzip
+	Level int `default:"-1" validate:"min=-1,max=9"`
+}
+
+func (g *Gzip) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if g == nil {
+		return nil
+	}
+
+	enc.AddBool("enabled", g.Enabled)
+	enc.AddInt("min-size", g.MinSize)
+	enc.AddInt("level", g.Level)
+
+	return nil
+}
+
+// compressedContentTypes are not worth compressing again
+var compressedContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-bzip2",
+	"application/x-xz",
+}
+
+func isCompressedContentType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	// SVG is text, and compresses well
+	if strings.HasPrefix(contentType, "image/svg") {
+		return false
+	}
+	for _, prefix := range compressedContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip returns whether the Accept-Encoding header of the request allows a gzip encoded response
+func acceptsGzip(r *http.Request) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, encoding := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(encoding, ";")
+			name = strings.TrimSpace(name)
+			if name != "gzip" && name != "*" {
+				continue
+			}
+			q := 1.0
+			for _, param := range strings.Split(params, ";") {
+				if k, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && k == "q" {
+					q, _ = strconv.ParseFloat(v, 64)
+				}
+			}
+			return q > 0
+		}
+	}
+	return false
+}
+
+// NewGzipMiddleware compresses the responses larger than conf.MinSize when the client accepts it
+// Responses which already have a Content-Encoding or a compressed Content-Type are left untouched
+func NewGzipMiddleware(conf *Gzip) *Middleware {
+	return &Middleware{
+		Name:   "gzip",
+		Weight: GzipMiddlewareWeight,
+		Middleware: func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Vary", "Accept-Encoding")
+				if !acceptsGzip(r) || r.Method == http.MethodHead {
+					h.ServeHTTP(w, r)
+					return
+				}
+				gw := &gzipResponseWriter{ResponseWriter: w, conf: conf}
+				defer gw.close()
+				h.ServeHTTP(gw, r)
+			})
+		},
+	}
+}
+
+// gzipResponseWriter buffers the beginning of the response, until it knows whether it should be compressed
+type gzipResponseWriter struct {
+	http.ResponseWriter
+
+	conf   *Gzip
+	status int
+	buf    []byte
+	// out is the writer of the body, once the encoding is decided
+	out io.Writer
+	gz  *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	if w.out != nil || w.status != 0 {
+		// Like the http.ResponseWriter, only the first status matters
+		return
+	}
+	if statusCode >= 100 && statusCode < 200 {
+		// Informational responses don't have a body
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.status = statusCode
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if w.out == nil {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.conf.MinSize {
+			return len(b), nil
+		}
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	return w.out.Write(b)
+}
+
+// start writes the headers and the buffered body, compressed when possible
+func (w *gzipResponseWriter) start(compress bool) error {
+	header := w.Header()
+	if header.Get("Content-Type") == "" && len(w.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if header.Get("Content-Encoding") != "" || isCompressedContentType(header.Get("Content-Type")) {
+		compress = false
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	w.out = w.ResponseWriter
+	if compress {
+		gz, err := gzip.NewWriterLevel(w.ResponseWriter, w.conf.Level)
+		if err != nil {
+			return err
+		}
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.gz, w.out = gz, gz
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.out.Write(buf)
+	return err
+}
+
+// Flush sends the buffered response, compressing it regardless of its size
+func (w *gzipResponseWriter) Flush() {
+	if w.out == nil {
+		if err := w.start(true); err != nil {
+			return
+		}
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap allows http.ResponseController to reach the features of the wrapped writer
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *gzipResponseWriter) close() {
+	if w.out == nil {
+		if w.status == 0 && len(w.buf) == 0 {
+			// The handler did not write anything, let the server reply
+			return
+		}
+		// The response is below the threshold
+		_ = w.start(false)
+	}
+	if w.gz != nil {
+		_ = w.gz.Close()
+	}
+}
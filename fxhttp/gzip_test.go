@@ -0,0 +1,79 @@
+package fxhttp
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	payload, err := json.Marshal(map[string]string{"data": strings.Repeat("stelling", 512)})
+	require.NoError(t, err)
+	handler := NewGzipMiddleware(&Gzip{Enabled: true, MinSize: 1024, Level: -1}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.URL.Query().Get("content-type"); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		if r.URL.Path == "/small" {
+			_, _ = w.Write([]byte(`{"data":"small"}`))
+			return
+		}
+		// Writing in chunks ensures the response is buffered until the threshold is reached
+		for chunk := range slices.Chunk(payload, 100) {
+			_, _ = w.Write(chunk)
+		}
+	}))
+
+	serve := func(path string, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Should compress a large response when the client accepts gzip", func(t *testing.T) {
+		rec := serve("/large?content-type=application/json", "br, gzip")
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+		require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		require.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+		gz, err := gzip.NewReader(rec.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		require.Equal(t, payload, body)
+	})
+
+	t.Run("Should not compress when the client does not accept gzip", func(t *testing.T) {
+		for _, acceptEncoding := range []string{"", "br", "gzip;q=0"} {
+			rec := serve("/large?content-type=application/json", acceptEncoding)
+
+			require.Empty(t, rec.Header().Get("Content-Encoding"), acceptEncoding)
+			require.Equal(t, payload, rec.Body.Bytes(), acceptEncoding)
+		}
+	})
+
+	t.Run("Should not compress a response below the threshold", func(t *testing.T) {
+		rec := serve("/small", "gzip")
+
+		require.Empty(t, rec.Header().Get("Content-Encoding"))
+		require.Equal(t, `{"data":"small"}`, rec.Body.String())
+	})
+
+	t.Run("Should not compress already compressed content types", func(t *testing.T) {
+		rec := serve("/large?content-type=image/png", "gzip")
+
+		require.Empty(t, rec.Header().Get("Content-Encoding"))
+		require.Equal(t, payload, rec.Body.Bytes())
+	})
+}
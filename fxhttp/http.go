@@ -6,9 +6,10 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"time"
+	"strings"
 
 	reloader "github.com/exoscale/stelling/fxcert-reloader"
+	"github.com/exoscale/stelling/fxlogging/summary"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -28,14 +29,24 @@ func WithServerModuleName(name string) serverModuleOption {
 }
 
 // server is a tuple of http.Server with its accompanying address or socket name
+// and the middlewares wrapping its handler
 type server struct {
-	server     *http.Server
-	addr       string
-	socketName string
+	server      *http.Server
+	addr        string
+	socketName  string
+	middlewares []*Middleware
 }
 
-func newServer(s *http.Server, conf ServerConfig) *server {
-	return &server{s, conf.HttpServerConfig().Address, conf.HttpServerConfig().SocketName}
+// newServer adds the middlewares derived from the configuration to the given ones
+func newServer(s *http.Server, conf ServerConfig, mws ...*Middleware) *server {
+	c := conf.HttpServerConfig()
+	if c.CORS.Enabled {
+		mws = append(mws, NewCORSMiddleware(&c.CORS))
+	}
+	if c.Gzip.Enabled {
+		mws = append(mws, NewGzipMiddleware(&c.Gzip))
+	}
+	return &server{s, c.Address, c.SocketName, mws}
 }
 
 // NewModule provides a configured *http.Server to the system
@@ -46,18 +57,23 @@ func NewModule(conf ServerConfig, sOpts ...serverModuleOption) fx.Option {
 		o(modOpts)
 	}
 
+	summaryName := "http-server"
+	if modOpts.name != "" {
+		summaryName += ":" + modOpts.name
+	}
 	opts := fx.Options(
 		fx.Supply(
 			fx.Annotate(conf, fx.As(new(ServerConfig))),
 			fx.Private,
 		),
+		summary.Provide(summaryName, conf.HttpServerConfig()),
 	)
 	if modOpts.name == "" {
 		opts = fx.Options(
 			opts,
 			fx.Provide(
-				fx.Annotate(NewHTTPServer, fx.ParamTags(``, ``, `optional:"true"`)),
-				newServer,
+				fx.Annotate(NewHTTPServer, fx.ParamTags(``, ``, `optional:"true"`, `optional:"true"`)),
+				fx.Annotate(newServer, fx.ParamTags(``, ``, `group:"http_middleware"`)),
 			),
 		)
 	} else {
@@ -67,7 +83,7 @@ func NewModule(conf ServerConfig, sOpts ...serverModuleOption) fx.Option {
 			fx.Provide(
 				fx.Annotate(
 					NewHTTPServer,
-					fx.ParamTags(``, ``, `optional:"true"`),
+					fx.ParamTags(``, ``, `optional:"true"`, `optional:"true"`),
 					fx.ResultTags(nameTag),
 				),
 				fx.Annotate(
@@ -87,6 +103,16 @@ func NewModule(conf ServerConfig, sOpts ...serverModuleOption) fx.Option {
 				fx.Private,
 			),
 		)
+		if conf.HttpServerConfig().ClientCAFile != "" {
+			opts = fx.Options(
+				opts,
+				fx.Provide(
+					GetCAReloaderConfig,
+					reloader.ProvideCAReloader,
+					fx.Private,
+				),
+			)
+		}
 	}
 	return fx.Module("http", opts)
 }
@@ -122,17 +148,41 @@ type Server struct {
 	// TLS indicates whether the http server exposes with TLS
 	TLS bool
 	// CertFile is the path to the pem encoded TLS certificate
-	CertFile string `validate:"required_if=TLS true,omitempty,file"`
+	// It must be unset when TLS is disabled, so a misconfiguration does not silently serve plaintext
+	CertFile string `validate:"required_if=TLS true,excluded_without=TLS,omitempty,file"`
 	// KeyFile is the path to the pem encoded private key of the TLS certificate
-	KeyFile string `validate:"required_if=TLS true,omitempty,file"`
-	// ClientCAFile is the path to a pem encoded CA cert bundle used to validate clients
-	ClientCAFile string `validate:"excluded_without=TLS,omitempty,file"`
+	KeyFile string `validate:"required_if=TLS true,excluded_without=TLS,omitempty,file"`
+	// ClientCAFile is the path to a pem encoded CA cert bundle, or a directory of bundles, used to validate clients
+	// It is periodically reloaded, so new CAs take effect without a restart
+	ClientCAFile string `validate:"excluded_without=TLS,omitempty,file|dir"`
+	// TLSMinVersion is the minimum TLS version accepted by the server (eg: 1.3)
+	TLSMinVersion string `validate:"excluded_without=TLS,omitempty,oneof=1.0 1.1 1.2 1.3"`
+	// TLSCipherSuites restricts the cipher suites accepted by the server (eg: TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256)
+	// The TLS 1.3 cipher suites are not configurable
+	TLSCipherSuites []string `validate:"excluded_without=TLS"`
+	// ALPNProtocols are the application protocols negotiated with the clients, in order of preference (eg: h2)
+	// The http server adds http/1.1, and h2 when it is unset
+	ALPNProtocols []string `validate:"excluded_without=TLS"`
+	// Gzip configures the compression of the responses
+	Gzip Gzip
+	// CORS configures the Cross-Origin Resource Sharing headers of the responses
+	CORS CORS
 }
 
 func (s *Server) HttpServerConfig() *Server {
 	return s
 }
 
+// ServerTLSConfig returns the TLS settings of the server
+func (s *Server) ServerTLSConfig() *reloader.ServerTLS {
+	return &reloader.ServerTLS{
+		TLS:          s.TLS,
+		CertFile:     s.CertFile,
+		KeyFile:      s.KeyFile,
+		ClientCAFile: s.ClientCAFile,
+	}
+}
+
 func (s *Server) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	if s == nil {
 		return nil
@@ -140,12 +190,30 @@ func (s *Server) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 
 	enc.AddString("socket-name", s.SocketName)
 	enc.AddString("address", s.Address)
-	enc.AddBool("tls", s.TLS)
+	if err := s.ServerTLSConfig().MarshalLogObject(enc); err != nil {
+		return err
+	}
 
 	if s.TLS {
-		enc.AddString("cert-file", s.CertFile)
-		enc.AddString("key-file", s.KeyFile)
-		enc.AddString("client-ca-file", s.ClientCAFile)
+		if s.TLSMinVersion != "" {
+			enc.AddString("tls-min-version", s.TLSMinVersion)
+		}
+		if len(s.TLSCipherSuites) > 0 {
+			enc.AddString("tls-cipher-suites", strings.Join(s.TLSCipherSuites, ","))
+		}
+		if len(s.ALPNProtocols) > 0 {
+			enc.AddString("alpn-protocols", strings.Join(s.ALPNProtocols, ","))
+		}
+	}
+	if s.Gzip.Enabled {
+		if err := enc.AddObject("gzip", &s.Gzip); err != nil {
+			return err
+		}
+	}
+	if s.CORS.Enabled {
+		if err := enc.AddObject("cors", &s.CORS); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -155,7 +223,14 @@ func GetCertReloaderConfig(conf ServerConfig) *reloader.CertReloaderConfig {
 	return &reloader.CertReloaderConfig{
 		CertFile:       conf.HttpServerConfig().CertFile,
 		KeyFile:        conf.HttpServerConfig().KeyFile,
-		ReloadInterval: 1 * time.Hour,
+		ReloadInterval: reloader.DefaultReloadInterval,
+	}
+}
+
+func GetCAReloaderConfig(conf ServerConfig) *reloader.CAReloaderConfig {
+	return &reloader.CAReloaderConfig{
+		Path:           conf.HttpServerConfig().ClientCAFile,
+		ReloadInterval: reloader.DefaultCAReloadInterval,
 	}
 }
 
@@ -168,11 +243,25 @@ func NewListener(ctx context.Context, socketName string, addr string) (net.Liste
 	}
 }
 
-func NewHTTPServer(lc fx.Lifecycle, conf ServerConfig, r *reloader.CertReloader) (*http.Server, error) {
+// NewHTTPServer returns an *http.Server configured with TLS if required
+// The CAReloader is optional: when it is set, it takes precedence over the ClientCAFile
+func NewHTTPServer(lc fx.Lifecycle, conf ServerConfig, r *reloader.CertReloader, ca *reloader.CAReloader) (*http.Server, error) {
 	server := &http.Server{}
 
 	if conf.HttpServerConfig().TLS {
-		tlsConf, err := reloader.MakeServerTLS(r, conf.HttpServerConfig().ClientCAFile)
+		tlsOpts, err := reloader.ServerTLSOptions(conf.HttpServerConfig().TLSMinVersion, conf.HttpServerConfig().TLSCipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		if protos := conf.HttpServerConfig().ALPNProtocols; len(protos) > 0 {
+			tlsOpts = append(tlsOpts, reloader.WithNextProtos(protos))
+		}
+		clientCAFile := conf.HttpServerConfig().ClientCAFile
+		if ca != nil {
+			tlsOpts = append(tlsOpts, reloader.WithClientCAReloader(ca))
+			clientCAFile = ""
+		}
+		tlsConf, err := reloader.MakeServerTLS(r, clientCAFile, tlsOpts...)
 		if err != nil {
 			return nil, err
 		}
@@ -185,7 +274,13 @@ func NewHTTPServer(lc fx.Lifecycle, conf ServerConfig, r *reloader.CertReloader)
 func StartHttpServer(lc fx.Lifecycle, s *server, logger *zap.Logger) {
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
-			logger.Info("Starting http server", zap.String("address", s.addr))
+			if len(s.middlewares) > 0 {
+				// The handler is only wrapped now, because it is usually set after the server is provided
+				s.server.Handler = ChainMiddlewares(s.server.Handler, s.middlewares...)
+				logger.Info("Starting http server", zap.String("address", s.addr), zap.Strings("middlewares", middlewareNames(s.middlewares)))
+			} else {
+				logger.Info("Starting http server", zap.String("address", s.addr))
+			}
 			lis, err := NewListener(ctx, s.socketName, s.addr)
 			if err != nil {
 				return err
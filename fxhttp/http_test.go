@@ -0,0 +1,24 @@
+package fxhttp
+
+import (
+	"testing"
+
+	reloader "github.com/exoscale/stelling/fxcert-reloader"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+)
+
+func TestNewHTTPServer(t *testing.T) {
+	t.Run("Should keep the default ALPN protocols", func(t *testing.T) {
+		server, err := NewHTTPServer(fxtest.NewLifecycle(t), &Server{TLS: true}, &reloader.CertReloader{}, nil)
+		require.NoError(t, err)
+		require.Empty(t, server.TLSConfig.NextProtos)
+	})
+
+	t.Run("Should apply the configured ALPN protocols", func(t *testing.T) {
+		conf := &Server{TLS: true, ALPNProtocols: []string{"h2", "acme-tls/1"}}
+		server, err := NewHTTPServer(fxtest.NewLifecycle(t), conf, &reloader.CertReloader{}, nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"h2", "acme-tls/1"}, server.TLSConfig.NextProtos)
+	})
+}
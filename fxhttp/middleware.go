@@ -0,0 +1,67 @@
+package fxhttp
+
+import (
+	"net/http"
+	"slices"
+
+	"go.uber.org/fx"
+)
+
+// Middleware wraps an http.Handler with a weight that determines its position in the middleware chain
+// Middlewares are sorted in ascending weight: the lightest one is the outermost, and sees the request first
+type Middleware struct {
+	// Name identifies the middleware when the chain is logged
+	Name       string
+	Weight     uint
+	Middleware func(http.Handler) http.Handler
+}
+
+// WithMiddleware adds the given middlewares to the main http server of the system
+// Named servers, such as the ones of the metrics and pprof modules, are not affected
+func WithMiddleware(mws ...*Middleware) fx.Option {
+	opts := make([]fx.Option, 0, len(mws))
+	for _, mw := range mws {
+		opts = append(opts, fx.Provide(
+			fx.Annotate(
+				func() *Middleware { return mw },
+				fx.ResultTags(`group:"http_middleware"`),
+			),
+		))
+	}
+	return fx.Options(opts...)
+}
+
+// SortMiddlewares returns a copy of the given middlewares in ascending weight, without the nil items
+func SortMiddlewares(list []*Middleware) []*Middleware {
+	sorted := make([]*Middleware, 0, len(list))
+	for _, mw := range list {
+		if mw != nil && mw.Middleware != nil {
+			sorted = append(sorted, mw)
+		}
+	}
+	slices.SortStableFunc(sorted, func(a, b *Middleware) int {
+		return int(a.Weight) - int(b.Weight)
+	})
+	return sorted
+}
+
+// ChainMiddlewares wraps handler with the given middlewares, in the order of SortMiddlewares
+// A nil handler is replaced by http.DefaultServeMux, like http.Server does
+func ChainMiddlewares(handler http.Handler, mws ...*Middleware) http.Handler {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	sorted := SortMiddlewares(mws)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		handler = sorted[i].Middleware(handler)
+	}
+	return handler
+}
+
+func middlewareNames(mws []*Middleware) []string {
+	names := make([]string, 0, len(mws))
+	for _, mw := range SortMiddlewares(mws) {
+		names = append(names, mw.Name)
+	}
+	return names
+}
@@ -0,0 +1,65 @@
+package fxhttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/exoscale/stelling/fxhttp"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// tag returns a middleware which appends its name to the X-Chain header of the request
+func tag(name string, weight uint) *fxhttp.Middleware {
+	return &fxhttp.Middleware{
+		Name:   name,
+		Weight: weight,
+		Middleware: func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.Header.Add("X-Chain", name)
+				h.ServeHTTP(w, r)
+			})
+		},
+	}
+}
+
+func echoChain(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte(strings.Join(r.Header.Values("X-Chain"), ",")))
+}
+
+func TestChainMiddlewares(t *testing.T) {
+	t.Run("Should run the lightest middleware first", func(t *testing.T) {
+		handler := fxhttp.ChainMiddlewares(http.HandlerFunc(echoChain), tag("heavy", 90), nil, tag("light", 10), tag("medium", 50))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		require.Equal(t, "light,medium,heavy", rec.Body.String())
+	})
+}
+
+func TestWithMiddleware(t *testing.T) {
+	t.Run("Should wrap the handler of the main server", func(t *testing.T) {
+		var s *http.Server
+		app := fxtest.New(
+			t,
+			fxhttp.NewModule(&fxhttp.Server{Address: "localhost:0"}),
+			fxhttp.WithMiddleware(tag("second", 20), tag("first", 10)),
+			fx.Provide(zap.NewNop),
+			fx.Invoke(func(server *http.Server) {
+				server.Handler = http.HandlerFunc(echoChain)
+			}),
+			fx.Invoke(fxhttp.StartHttpServer),
+			fx.Populate(&s),
+		)
+		app.RequireStart()
+		defer app.RequireStop()
+
+		rec := httptest.NewRecorder()
+		s.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, "first,second", rec.Body.String())
+	})
+}
@@ -0,0 +1,126 @@
+// Package fxjob provides a convenient way to run a job to completion in an fx system.
+package fxjob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Job is a unit of work that runs once, after the system has started
+// The system shuts down once it returns
+type Job interface {
+	Run(ctx context.Context) error
+}
+
+// JobFunc allows a plain function to be used as a Job
+type JobFunc func(ctx context.Context) error
+
+func (f JobFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// ExitCoder can be implemented by errors that want to control the exit code of the process
+type ExitCoder interface {
+	ExitCode() int
+}
+
+type exitCodeError struct {
+	err  error
+	code int
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+func (e *exitCodeError) Unwrap() error { return e.err }
+func (e *exitCodeError) ExitCode() int { return e.code }
+
+// WithExitCode wraps err so that the job exits with the given code
+// It returns nil if err is nil
+func WithExitCode(err error, code int) error {
+	if err == nil {
+		return nil
+	}
+	return &exitCodeError{err: err, code: code}
+}
+
+// ExitCode returns the process exit code for the result of a job
+// It is 0 when err is nil, the code of the first ExitCoder in the chain if there is one, and 1 otherwise
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var ec ExitCoder
+	if errors.As(err, &ec) {
+		return ec.ExitCode()
+	}
+	return 1
+}
+
+// ErrTimeout is returned by jobs wrapped with WithTimeout that did not finish in time
+var ErrTimeout = errors.New("job timed out")
+
+// TimeoutExitCode is the exit code of jobs that did not finish in time
+// It is the same code as the one used by the coreutils timeout command
+const TimeoutExitCode = 124
+
+// WithTimeout returns a Job that cancels the work of job when it runs longer than timeout
+// The returned error then wraps ErrTimeout, and the process exits with TimeoutExitCode
+// A timeout of 0 disables the deadline
+func WithTimeout(job Job, timeout time.Duration) Job {
+	if timeout <= 0 {
+		return job
+	}
+	return JobFunc(func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		err := job.Run(ctx)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			if err == nil {
+				err = context.DeadlineExceeded
+			}
+			return WithExitCode(fmt.Errorf("%w after %s: %w", ErrTimeout, timeout, err), TimeoutExitCode)
+		}
+		return err
+	})
+}
+
+// StartJob runs the job in the background when the system starts
+// When the job returns, the system is shut down with an exit code derived from its error
+// Stopping the system before the job is done cancels its context and waits for it to return
+func StartJob(lc fx.Lifecycle, sd fx.Shutdowner, logger *zap.Logger, job Job) {
+	jobCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			go func() {
+				defer close(done)
+				err := job.Run(jobCtx)
+				code := ExitCode(err)
+				if err != nil {
+					logger.Error("Job failed", zap.Error(err), zap.Int("exit_code", code))
+				} else {
+					logger.Info("Job finished")
+				}
+				if err := sd.Shutdown(fx.ExitCode(code)); err != nil {
+					logger.Error("Failed to shut down the system", zap.Error(err))
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+}
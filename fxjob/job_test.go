@@ -0,0 +1,142 @@
+package fxjob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func TestExitCode(t *testing.T) {
+	failure := errors.New("failure")
+
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "Should return 0 without error", err: nil, expected: 0},
+		{name: "Should return 1 for a plain error", err: failure, expected: 1},
+		{name: "Should return the code of the error", err: WithExitCode(failure, 3), expected: 3},
+		{name: "Should return the code of a wrapped error", err: fmt.Errorf("wrapped: %w", WithExitCode(failure, 4)), expected: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, ExitCode(tt.err))
+		})
+	}
+
+	require.NoError(t, WithExitCode(nil, 3))
+}
+
+func TestStartJob(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "Should exit with 0 when the job succeeds", err: nil, expected: 0},
+		{name: "Should exit with 1 when the job fails", err: errors.New("failure"), expected: 1},
+		{name: "Should exit with the code of the error", err: WithExitCode(errors.New("failure"), 42), expected: 42},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fxtest.New(
+				t,
+				fx.Provide(zap.NewNop),
+				fx.Supply(fx.Annotate(JobFunc(func(context.Context) error { return tt.err }), fx.As(new(Job)))),
+				fx.Invoke(StartJob),
+			)
+			app.RequireStart()
+
+			select {
+			case sig := <-app.Wait():
+				require.Equal(t, tt.expected, sig.ExitCode)
+			case <-time.After(time.Second):
+				require.Fail(t, "the job should shut down the system")
+			}
+
+			app.RequireStop()
+		})
+	}
+
+	t.Run("Should cancel the job when the system stops", func(t *testing.T) {
+		canceled := make(chan struct{})
+		job := JobFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			close(canceled)
+			return ctx.Err()
+		})
+		app := fxtest.New(
+			t,
+			fx.Provide(zap.NewNop),
+			fx.Supply(fx.Annotate(job, fx.As(new(Job)))),
+			fx.Invoke(StartJob),
+		)
+		app.RequireStart().RequireStop()
+
+		select {
+		case <-canceled:
+		default:
+			require.Fail(t, "the job should have returned before the system stopped")
+		}
+	})
+}
+
+func TestWithTimeout(t *testing.T) {
+	t.Run("Should cancel a job that exceeds its deadline", func(t *testing.T) {
+		canceled := false
+		job := WithTimeout(JobFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			canceled = true
+			return ctx.Err()
+		}), 10*time.Millisecond)
+
+		err := job.Run(context.Background())
+		require.True(t, canceled)
+		require.ErrorIs(t, err, ErrTimeout)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, TimeoutExitCode, ExitCode(err))
+	})
+
+	t.Run("Should return the result of a job that finishes in time", func(t *testing.T) {
+		failure := errors.New("failure")
+		job := WithTimeout(JobFunc(func(ctx context.Context) error { return failure }), time.Second)
+
+		err := job.Run(context.Background())
+		require.ErrorIs(t, err, failure)
+		require.NotErrorIs(t, err, ErrTimeout)
+		require.Equal(t, 1, ExitCode(err))
+	})
+
+	t.Run("Should shut down the system with the timeout exit code", func(t *testing.T) {
+		job := WithTimeout(JobFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}), 10*time.Millisecond)
+		app := fxtest.New(
+			t,
+			fx.Provide(zap.NewNop),
+			fx.Supply(fx.Annotate(job, fx.As(new(Job)))),
+			fx.Invoke(StartJob),
+		)
+		app.RequireStart()
+
+		select {
+		case sig := <-app.Wait():
+			require.Equal(t, TimeoutExitCode, sig.ExitCode)
+		case <-time.After(time.Second):
+			require.Fail(t, "the job should shut down the system")
+		}
+
+		app.RequireStop()
+	})
+}
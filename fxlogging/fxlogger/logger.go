@@ -1,6 +1,7 @@
 package fxlogger
 
 import (
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxevent"
 	"go.uber.org/zap"
@@ -11,17 +12,29 @@ type FxLoggerParams struct {
 	fx.In
 	Logger *zap.Logger
 	Opts   []Option `group:"fxlogger_opts"`
+	// Registerer receives the metrics of the lifecycle hooks, when the system has one
+	Registerer prometheus.Registerer `optional:"true"`
 }
 
 // NewFxLogger emits an fxevent.Logger that uses the passed in zap logger
 // The fxevent.Logger is used to write out the log messages produces by the fx framework
+// When the system has a prometheus.Registerer, the OnStart and OnStop hooks are also measured, see HookMetrics
 func NewFxLogger(p FxLoggerParams) fxevent.Logger {
 	result := &fxevent.ZapLogger{Logger: p.Logger}
 	result.UseLogLevel(zapcore.DebugLevel)
 	for _, opt := range p.Opts {
 		opt(result)
 	}
-	return result
+	if p.Registerer == nil {
+		return result
+	}
+	metrics := NewHookMetrics()
+	if err := p.Registerer.Register(metrics); err != nil {
+		// Failing the logger would make fx fall back to its default one: the metrics are not worth it
+		p.Logger.Warn("Failed to register the metrics of the fx hooks", zap.Error(err))
+		return result
+	}
+	return WithMetrics(result, metrics)
 }
 
 // Option are constructor parameters that configure the fxevent.Logger
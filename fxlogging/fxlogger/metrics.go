@@ -0,0 +1,75 @@
+package fxlogger
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/fx/fxevent"
+)
+
+// The outcomes of a hook
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// HookMetrics measures the OnStart and OnStop hooks of the system
+// The caller label is the constructor which appended the hook, and the function label the hook itself
+type HookMetrics struct {
+	total    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func NewHookMetrics() *HookMetrics {
+	labels := []string{"hook", "caller", "function"}
+	return &HookMetrics{
+		total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "fx_hooks_total",
+			Help: "Total number of fx lifecycle hooks executed, by hook, caller, function and outcome.",
+		}, append(labels, "outcome")),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "fx_hook_duration_seconds",
+			Help: "Duration of the fx lifecycle hooks, by hook, caller and function.",
+			// Startup hooks, eg: migrations, can take much longer than a request
+			Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		}, labels),
+	}
+}
+
+func (m *HookMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.total.Describe(ch)
+	m.duration.Describe(ch)
+}
+
+func (m *HookMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.total.Collect(ch)
+	m.duration.Collect(ch)
+}
+
+func (m *HookMetrics) observe(hook, caller, function string, err error, seconds float64) {
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = OutcomeFailure
+	}
+	m.total.WithLabelValues(hook, caller, function, outcome).Inc()
+	m.duration.WithLabelValues(hook, caller, function).Observe(seconds)
+}
+
+// metricsLogger records the executed hooks in the metrics, before passing every event to the wrapped logger
+type metricsLogger struct {
+	fxevent.Logger
+	metrics *HookMetrics
+}
+
+func (l *metricsLogger) LogEvent(event fxevent.Event) {
+	switch e := event.(type) {
+	case *fxevent.OnStartExecuted:
+		l.metrics.observe("OnStart", e.CallerName, e.FunctionName, e.Err, e.Runtime.Seconds())
+	case *fxevent.OnStopExecuted:
+		l.metrics.observe("OnStop", e.CallerName, e.FunctionName, e.Err, e.Runtime.Seconds())
+	}
+	l.Logger.LogEvent(event)
+}
+
+// WithMetrics wraps logger, so it also records the executed hooks in metrics
+func WithMetrics(logger fxevent.Logger, metrics *HookMetrics) fxevent.Logger {
+	return &metricsLogger{logger, metrics}
+}
@@ -0,0 +1,81 @@
+package fxlogger
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// findMetric returns the metric of the family with the given labels
+func findMetric(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) *dto.Metric {
+	t.Helper()
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if want, ok := labels[label.GetName()]; ok && want != label.GetValue() {
+					continue metrics
+				}
+			}
+			return m
+		}
+	}
+	return nil
+}
+
+func slowHook(lc fx.Lifecycle) {
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			return errors.New("boom")
+		},
+	})
+}
+
+func TestHookMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	app := fxtest.New(
+		t,
+		fx.WithLogger(NewFxLogger),
+		fx.Supply(zap.NewNop()),
+		fx.Provide(func() prometheus.Registerer { return reg }),
+		fx.Invoke(slowHook),
+	)
+	app.RequireStart()
+	require.Error(t, app.Stop(context.Background()))
+
+	caller := "github.com/exoscale/stelling/fxlogging/fxlogger.slowHook"
+
+	t.Run("Should observe the duration of a slow hook", func(t *testing.T) {
+		m := findMetric(t, reg, "fx_hook_duration_seconds", map[string]string{"hook": "OnStart", "caller": caller})
+		require.NotNil(t, m)
+		require.Equal(t, uint64(1), m.GetHistogram().GetSampleCount())
+		require.GreaterOrEqual(t, m.GetHistogram().GetSampleSum(), 0.05)
+	})
+
+	t.Run("Should count the outcome of the hooks", func(t *testing.T) {
+		m := findMetric(t, reg, "fx_hooks_total", map[string]string{"hook": "OnStart", "caller": caller, "outcome": OutcomeSuccess})
+		require.NotNil(t, m)
+		require.Equal(t, 1.0, m.GetCounter().GetValue())
+
+		m = findMetric(t, reg, "fx_hooks_total", map[string]string{"hook": "OnStop", "caller": caller, "outcome": OutcomeFailure})
+		require.NotNil(t, m)
+		require.Equal(t, 1.0, m.GetCounter().GetValue())
+	})
+}
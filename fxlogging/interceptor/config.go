@@ -1,10 +1,13 @@
 package interceptor
 
 import (
+	"time"
+
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 )
 
 type interceptorConfig struct {
@@ -12,6 +15,9 @@ type interceptorConfig struct {
 	logFilter       otelgrpc.InterceptorFilter //nolint:staticcheck
 	payloadFilter   otelgrpc.InterceptorFilter //nolint:staticcheck
 	startLogFilter  otelgrpc.InterceptorFilter //nolint:staticcheck
+	metadataFilter  otelgrpc.InterceptorFilter //nolint:staticcheck
+	redacted        []string
+	slowThreshold   time.Duration
 	extraFieldsFunc func(logger *zap.Logger, info *otelgrpc.InterceptorInfo, payload any) *zap.Logger
 }
 
@@ -58,12 +64,39 @@ func WithStartLogFilter(f otelgrpc.InterceptorFilter) Option { //nolint:staticch
 	}
 }
 
+// WithMetadataFilter registers a predicate to determine whether the request metadata should be logged
+// The predicate function must return `true` to log the request metadata
+// The values of the redacted metadata keys are replaced by `***`, see WithRedactedMetadata
+func WithMetadataFilter(f otelgrpc.InterceptorFilter) Option { //nolint:staticcheck
+	return func(c *interceptorConfig) {
+		c.metadataFilter = f
+	}
+}
+
+// WithRedactedMetadata sets the metadata keys whose values are replaced by `***` before being logged
+// It replaces DefaultRedactedMetadata, so those keys must be repeated to keep redacting them
+func WithRedactedMetadata(keys ...string) Option {
+	return func(c *interceptorConfig) {
+		c.redacted = keys
+	}
+}
+
+// WithSlowThreshold logs the requests that take longer than d at Warn level at least, with a `slow` field
+// The start of the requests is not affected
+func WithSlowThreshold(d time.Duration) Option {
+	return func(c *interceptorConfig) {
+		c.slowThreshold = d
+	}
+}
+
 func newInterceptorConfig(opts []Option) *interceptorConfig {
 	conf := &interceptorConfig{
 		levelFunc:       DefaultServerCodeToLevel,
 		logFilter:       defaultFilter,
 		payloadFilter:   defaultPayloadFilter,
 		startLogFilter:  defaultStartLogFilter,
+		metadataFilter:  defaultMetadataFilter,
+		redacted:        DefaultRedactedMetadata,
 		extraFieldsFunc: defaultExtraFieldsFunc,
 	}
 
@@ -92,6 +125,32 @@ var defaultPayloadFilter = DenyAllFilter
 
 var defaultStartLogFilter = DenyAllFilter
 
+var defaultMetadataFilter = DenyAllFilter
+
+// DefaultRedactedMetadata are the metadata keys redacted by default, as they carry credentials
+var DefaultRedactedMetadata = []string{"authorization", "cookie", "proxy-authorization"}
+
+// RedactedValue replaces the values of the redacted metadata keys
+const RedactedValue = "***"
+
+// RedactMetadata returns a copy of md in which the values of the given keys are replaced by RedactedValue
+// The keys are matched case-insensitively
+func RedactMetadata(md metadata.MD, keys ...string) metadata.MD {
+	redacted := md.Copy()
+	for _, key := range keys {
+		values := redacted.Get(key)
+		if len(values) == 0 {
+			continue
+		}
+		masked := make([]string, len(values))
+		for i := range masked {
+			masked[i] = RedactedValue
+		}
+		redacted.Set(key, masked...)
+	}
+	return redacted
+}
+
 func DefaultServerCodeToLevel(info *otelgrpc.InterceptorInfo, code codes.Code) zapcore.Level {
 	service, _ := MethodFromInterceptorInfo(info)
 	if service == "grpc.health.v1.Health" && code == codes.OK {
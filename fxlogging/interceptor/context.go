@@ -2,7 +2,7 @@ package interceptor
 
 import (
 	"context"
-	"fmt"
+	"sync/atomic"
 
 	ulid "github.com/oklog/ulid/v2"
 	oteltrace "go.opentelemetry.io/otel/trace"
@@ -11,26 +11,71 @@ import (
 
 type loggerContextKey struct{}
 type traceIdContextKey struct{}
+type clientTraceIdContextKey struct{}
 
 var loggerCtxKey = &loggerContextKey{}
 var traceIdCtxKey = &traceIdContextKey{}
+var clientTraceIdCtxKey = &clientTraceIdContextKey{}
 var nopLogger = zap.NewNop()
 
+// LocalTraceIdGenerator generates the trace-id of a request which does not carry one, eg: when tracing is disabled
+// The trace-id is generated once per request, and stored on its context, so all the logs of the request share it
+type LocalTraceIdGenerator func() string
+
+// DefaultLocalTraceIdPrefix is the prefix of the local trace-ids generated by default
+// It distinguishes them from the trace-ids of an OTEL trace
+const DefaultLocalTraceIdPrefix = "local-"
+
+// NewULIDTraceIdGenerator generates local trace-ids made of the prefix and a ULID, which sorts by creation time
+func NewULIDTraceIdGenerator(prefix string) LocalTraceIdGenerator {
+	return func() string {
+		return prefix + ulid.Make().String()
+	}
+}
+
+var localTraceIdGenerator atomic.Pointer[LocalTraceIdGenerator]
+
+func init() {
+	SetLocalTraceIdGenerator(NewULIDTraceIdGenerator(DefaultLocalTraceIdPrefix))
+}
+
+// SetLocalTraceIdGenerator sets the generator of the local trace-ids of the interceptors and middlewares of this package
+// It applies to the whole process, and defaults to a ULID generator with the DefaultLocalTraceIdPrefix
+func SetLocalTraceIdGenerator(g LocalTraceIdGenerator) {
+	localTraceIdGenerator.Store(&g)
+}
+
 // contextWithTraceId returns a new trace-id that embeds the given trace-id
 // It can be extracted again using the traceIdFromContext function.
 func contextWithTraceId(ctx context.Context, traceid string) context.Context {
 	return context.WithValue(ctx, traceIdCtxKey, traceid)
 }
 
-// traceIdFromContext will extract a traceid from the context, if any
-// It will look for one in this order:
-// 1. A trace-id set using contextWithTraceId
-// 2. The OTEL trace-id from the context
-// 3. A new random trace-id
-// If a new trace-id was generated, the second return argument of this function
-// will return 'false'. It is recommended to save this id on the context
-// so that future calls produce the same trace-id
-func traceIdFromContext(ctx context.Context) (string, bool) {
+// contextWithClientTraceId stores the trace-id sent by the client, when it differs from the trace-id of the request
+func contextWithClientTraceId(ctx context.Context, traceid string) context.Context {
+	return context.WithValue(ctx, clientTraceIdCtxKey, traceid)
+}
+
+// clientTraceIdFromContext returns the trace-id sent by the client, when it differs from the trace-id of the request
+func clientTraceIdFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(clientTraceIdCtxKey).(string)
+	return id, ok && id != ""
+}
+
+// traceIdFields returns the fields of the request logs for the trace-id, and the trace-id sent by the client if it differs
+func traceIdFields(ctx context.Context, traceid string) []zap.Field {
+	fields := []zap.Field{zap.String("otlp.trace_id", traceid)}
+	if clientTraceId, ok := clientTraceIdFromContext(ctx); ok {
+		fields = append(fields, zap.String(clientTraceIdKey, clientTraceId))
+	}
+	return fields
+}
+
+// TraceIdFromContext returns the trace-id carried by the context, if any
+// It is, in this order:
+// 1. The trace-id set by the extract trace id or inject logger interceptors
+// 2. The OTEL trace-id of the active span
+func TraceIdFromContext(ctx context.Context) (string, bool) {
 	id := ctx.Value(traceIdCtxKey)
 	if id != nil {
 		idstr, ok := id.(string)
@@ -42,7 +87,22 @@ func traceIdFromContext(ctx context.Context) (string, bool) {
 	if spanCtx.HasTraceID() {
 		return spanCtx.TraceID().String(), true
 	}
-	return fmt.Sprintf("local-%s", ulid.Make()), false
+	return "", false
+}
+
+// traceIdFromContext will extract a traceid from the context, if any
+// It will look for one in this order:
+// 1. A trace-id set using contextWithTraceId
+// 2. The OTEL trace-id from the context
+// 3. A new local trace-id, see SetLocalTraceIdGenerator
+// If a new trace-id was generated, the second return argument of this function
+// will return 'false'. It is recommended to save this id on the context
+// so that future calls produce the same trace-id
+func traceIdFromContext(ctx context.Context) (string, bool) {
+	if id, ok := TraceIdFromContext(ctx); ok {
+		return id, true
+	}
+	return (*localTraceIdGenerator.Load())(), false
 }
 
 // ContextWithLogger returns a copy of the given context with a Logger embedded into it
@@ -13,6 +13,8 @@ type WrapResponseWriter struct {
 	http.ResponseWriter
 
 	StatusCode int
+	// BytesWritten is the size of the response body
+	BytesWritten int
 }
 
 var _ http.ResponseWriter = (*WrapResponseWriter)(nil)
@@ -22,17 +24,57 @@ func NewWrapResponseWriter(w http.ResponseWriter) *WrapResponseWriter {
 }
 
 func (w *WrapResponseWriter) WriteHeader(statusCode int) {
-	w.StatusCode = statusCode
+	if w.StatusCode == 0 {
+		w.StatusCode = statusCode
+	}
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
+func (w *WrapResponseWriter) Write(b []byte) (int, error) {
+	// Like the http.ResponseWriter, writing the body implies a 200 status
+	if w.StatusCode == 0 {
+		w.StatusCode = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.BytesWritten += n
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to reach the features of the wrapped writer, such as Flush
+func (w *WrapResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type requestLoggerConfig struct {
+	skipPaths map[string]bool
+}
+
+// RequestLoggerOption customizes the behavior of NewRequestLogger
+type RequestLoggerOption func(*requestLoggerConfig)
+
+// WithSkipPaths disables the logging of the requests to the given paths, eg: health checks
+// The trace id is still injected in the context of these requests
+func WithSkipPaths(paths ...string) RequestLoggerOption {
+	return func(c *requestLoggerConfig) {
+		for _, p := range paths {
+			c.skipPaths[p] = true
+		}
+	}
+}
+
 // NeverEnabler implements zapcore.LevelEnabler and always return false regardless of the level
 // This is used to disable features that are controlled by a zapcore.levelEnabler
 type NeverEnabler struct{}
 
 func (NeverEnabler) Enabled(zapcore.Level) bool { return false }
 
-func NewRequestLogger(logger *zap.Logger, wrapped http.Handler) http.Handler {
+// NewRequestLogger produces an http.Handler which logs each request handled by wrapped
+// Like the grpc interceptors, it injects a logger enriched with the trace id of the request in its context
+func NewRequestLogger(logger *zap.Logger, wrapped http.Handler, opts ...RequestLoggerOption) http.Handler {
+	conf := &requestLoggerConfig{skipPaths: map[string]bool{}}
+	for _, o := range opts {
+		o(conf)
+	}
 	logger = logger.WithOptions(zap.WithCaller(false), zap.AddStacktrace(NeverEnabler{}))
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -51,6 +93,7 @@ func NewRequestLogger(logger *zap.Logger, wrapped http.Handler) http.Handler {
 		fields := []zapcore.Field{
 			zap.String("http.method", r.Method),
 			zap.String("http.uri", r.RequestURI),
+			zap.String("http.path", r.URL.Path),
 			zap.String("otlp.trace_id", traceid),
 		}
 
@@ -66,28 +109,29 @@ func NewRequestLogger(logger *zap.Logger, wrapped http.Handler) http.Handler {
 
 		wrapped.ServeHTTP(ww, r)
 
+		if conf.skipPaths[r.URL.Path] {
+			return
+		}
+		if ww.StatusCode == 0 {
+			// The handler did not write anything: the server replies with an empty 200
+			ww.StatusCode = http.StatusOK
+		}
+		resultFields := []zapcore.Field{
+			zap.Int("http.status", ww.StatusCode),
+			zap.Duration("http.duration", time.Since(start)),
+			zap.Int("http.response_size", ww.BytesWritten),
+			zap.String("net.peer.address", r.RemoteAddr),
+		}
+
 		if r.Method == "GET" && ww.StatusCode == 200 && strings.HasSuffix(r.RequestURI, "/healthz") {
-			l.Debug(
-				"Handled request",
-				zap.Int("http.status", ww.StatusCode),
-				zap.Duration("http.duration", time.Since(start)),
-			)
+			l.Debug("Handled request", resultFields...)
 			return
 		}
 
 		if ww.StatusCode >= 500 {
-			l.Error(
-				"Handled request",
-				zap.Int("http.status", ww.StatusCode),
-				zap.Duration("http.duration", time.Since(start)),
-			)
+			l.Error("Handled request", resultFields...)
 		} else {
-			l.Info(
-				"Handled request",
-				zap.Int("http.status", ww.StatusCode),
-				zap.Duration("http.duration", time.Since(start)),
-			)
+			l.Info("Handled request", resultFields...)
 		}
-
 	})
 }
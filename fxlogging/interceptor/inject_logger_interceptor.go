@@ -16,7 +16,7 @@ func NewInjectLoggerUnaryServerInterceptor(logger *zap.Logger) grpc.UnaryServerI
 		if !ok {
 			ctx = contextWithTraceId(ctx, traceid)
 		}
-		newLogger := logger.With(zap.String("otlp.trace_id", traceid))
+		newLogger := logger.With(traceIdFields(ctx, traceid)...)
 		ctx = ContextWithLogger(ctx, newLogger)
 
 		return handler(ctx, req)
@@ -43,7 +43,7 @@ func NewInjectLoggerStreamServerInterceptor(logger *zap.Logger) grpc.StreamServe
 		if !ok {
 			ctx = contextWithTraceId(ctx, traceid)
 		}
-		newLogger := logger.With(zap.String("otlp.trace_id", traceid))
+		newLogger := logger.With(traceIdFields(ctx, traceid)...)
 		ctx = ContextWithLogger(ctx, newLogger)
 
 		wrappedStream := &wrappedServerStream{ctx: ctx, ServerStream: ss}
@@ -3,11 +3,13 @@ package interceptor
 import (
 	"context"
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/exoscale/stelling/fxgrpc"
 	"github.com/exoscale/stelling/fxgrpc/grpctest"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxtest"
 	"go.uber.org/zap"
@@ -148,3 +150,61 @@ func TestInjectLoggerInterceptor(t *testing.T) {
 		require.Len(t, traceIdFields, 1)
 	})
 }
+
+func TestLocalTraceId(t *testing.T) {
+	var client pb.RouteGuideClient
+
+	SetLocalTraceIdGenerator(NewULIDTraceIdGenerator("test-"))
+	t.Cleanup(func() { SetLocalTraceIdGenerator(NewULIDTraceIdGenerator(DefaultLocalTraceIdPrefix)) })
+
+	core, observer := observer.New(zapcore.DebugLevel)
+	logger := zaptest.NewLogger(t, zaptest.WrapOptions(zap.WrapCore(func(_ zapcore.Core) zapcore.Core { return core })))
+
+	app := fxtest.New(t, fx.Options(
+		grpctest.Module,
+		fx.Supply(logger),
+		fx.Provide(
+			newInjectLoggerRouteGuideServer,
+			pb.NewRouteGuideClient,
+			fx.Annotate(
+				func(logger *zap.Logger) *fxgrpc.UnaryServerInterceptor {
+					return &fxgrpc.UnaryServerInterceptor{Weight: 49, Interceptor: NewInjectLoggerUnaryServerInterceptor(logger)}
+				},
+				fx.ResultTags(`group:"unary_server_interceptor"`),
+			),
+			fx.Annotate(
+				func(logger *zap.Logger) *fxgrpc.UnaryServerInterceptor {
+					return &fxgrpc.UnaryServerInterceptor{
+						Weight: 50,
+						Interceptor: NewLoggingUnaryServerInterceptor(logger,
+							WithStartLogFilter(func(*otelgrpc.InterceptorInfo) bool { return true }),
+						),
+					}
+				},
+				fx.ResultTags(`group:"unary_server_interceptor"`),
+			),
+		),
+		fx.Invoke(
+			pb.RegisterRouteGuideServer,
+		),
+		fx.Populate(&client),
+	))
+	defer app.RequireStart().RequireStop()
+
+	t.Run("Should use the same local trace-id on the request and handler logs", func(t *testing.T) {
+		_, err := client.GetFeature(context.Background(), &pb.Point{})
+		require.NoError(t, err)
+
+		logs := observer.TakeAll()
+		require.Len(t, logs, 3)
+		require.Equal(t, "GetFeature", logs[1].Message)
+		require.Equal(t, "finished call", logs[2].Message)
+
+		traceId, ok := logs[1].ContextMap()["otlp.trace_id"].(string)
+		require.True(t, ok)
+		require.True(t, strings.HasPrefix(traceId, "test-"))
+		for _, log := range logs {
+			require.Equal(t, traceId, log.ContextMap()["otlp.trace_id"])
+		}
+	})
+}
@@ -8,15 +8,26 @@ import (
 )
 
 const (
+	// peerServiceMDKey matches fxgrpc.PeerServiceMDKey, which can't be imported without a cycle
 	peerServiceMDKey = "peer.service"
 )
 
+// withPeerService sets the peer.service on the metadata of the outgoing context,
+// unless it was already set, eg: by the ServiceName of the fxgrpc client config
+func withPeerService(ctx context.Context) context.Context {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(peerServiceMDKey)) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, peerServiceMDKey, serviceName())
+}
+
 // NewInjectPeerUnaryClientInterceptor produces a UnaryClientInterceptor that sets the
 // peer.service on the metadata of the outgoing context
 // It can then be logged by the server to identify the service making the request
+// The name is taken from OTEL_SERVICE_NAME or the name of the executable
 func NewInjectPeerUnaryClientInterceptor() grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callopts ...grpc.CallOption) error {
-		ctx = metadata.AppendToOutgoingContext(ctx, peerServiceMDKey, serviceName())
+		ctx = withPeerService(ctx)
 		return invoker(ctx, method, req, reply, cc, callopts...)
 	}
 }
@@ -24,9 +35,10 @@ func NewInjectPeerUnaryClientInterceptor() grpc.UnaryClientInterceptor {
 // NewInjectPeerStreamClientInterceptor produces a StreamClientInterceptor that sets the
 // peer.service on the metadata of the outgoing context
 // It can then be logged by the server to identify the service making the request
+// The name is taken from OTEL_SERVICE_NAME or the name of the executable
 func NewInjectPeerStreamClientInterceptor() grpc.StreamClientInterceptor {
 	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
-		ctx = metadata.AppendToOutgoingContext(ctx, peerServiceMDKey, serviceName())
+		ctx = withPeerService(ctx)
 		return streamer(ctx, desc, cc, method, callOpts...)
 	}
 }
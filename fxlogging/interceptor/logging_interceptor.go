@@ -69,6 +69,15 @@ func MethodFromInterceptorInfo(info *otelgrpc.InterceptorInfo) (string, string)
 	return "unknown", "unknown"
 }
 
+// withStableTraceId stores a local trace-id on the context when it does not carry one,
+// so that the start and end logs of the request, and the handler, share it
+func withStableTraceId(ctx context.Context) context.Context {
+	if traceid, ok := traceIdFromContext(ctx); !ok {
+		return contextWithTraceId(ctx, traceid)
+	}
+	return ctx
+}
+
 type reporter struct {
 	svcName string
 	conf    *interceptorConfig
@@ -83,28 +92,20 @@ const (
 	logEventMessage
 )
 
-func (r *reporter) Log(ctx context.Context, info *otelgrpc.InterceptorInfo, startTime time.Time, event logEvent, payload any, handleErr error) {
-	code := status.Code(handleErr)
-	level := r.conf.levelFunc(info, code)
+// requestLogger returns a logger with the fields that describe the request
+func (r *reporter) requestLogger(ctx context.Context, info *otelgrpc.InterceptorInfo, startTime time.Time) *zap.Logger {
 	traceid, _ := traceIdFromContext(ctx)
 
 	// TODO: refactor this using otel.semconv
 	service, method := MethodFromInterceptorInfo(info)
-	logger := r.logger.With(
+	fields := []zap.Field{
 		zap.String("rpc.system", "grpc"),
 		zap.String("service.name", r.svcName),
 		zap.String("rpc.method", method),
 		zap.String("rpc.service", service),
 		zap.Time("rpc.request.start_time", startTime),
-		zap.String("otlp.trace_id", traceid),
-	)
-	if event == logEventEnd {
-		duration := time.Since(startTime)
-		logger = logger.With(
-			zap.Duration("rpc.request.duration", duration),
-			zap.String("rpc.grpc.status_code", code.String()),
-		)
 	}
+	logger := r.logger.With(append(fields, traceIdFields(ctx, traceid)...)...)
 	if deadline, ok := ctx.Deadline(); ok {
 		logger = logger.With(zap.Time("rpc.request.deadline", deadline))
 	}
@@ -122,6 +123,27 @@ func (r *reporter) Log(ctx context.Context, info *otelgrpc.InterceptorInfo, star
 	if peerService, ok := peerService(ctx); ok {
 		logger = logger.With(zap.String("peer.service", peerService))
 	}
+	if r.conf.metadataFilter(info) {
+		if md, ok := requestMetadata(ctx, info); ok {
+			logger = logger.With(zap.Any("rpc.request.metadata", RedactMetadata(md, r.conf.redacted...)))
+		}
+	}
+	return logger
+}
+
+// requestMetadata returns the metadata sent with the request: the incoming metadata on the server
+// and the outgoing metadata on the client
+func requestMetadata(ctx context.Context, info *otelgrpc.InterceptorInfo) (metadata.MD, bool) {
+	switch info.Type {
+	case otelgrpc.UnaryClient, otelgrpc.StreamClient:
+		return metadata.FromOutgoingContext(ctx)
+	default:
+		return metadata.FromIncomingContext(ctx)
+	}
+}
+
+// withPayload applies the extra fields and adds the payload, when allowed by the payload filter
+func (r *reporter) withPayload(logger *zap.Logger, info *otelgrpc.InterceptorInfo, payload any) *zap.Logger {
 	logger = r.conf.extraFieldsFunc(logger, info, payload)
 	if payload != nil && r.conf.payloadFilter(info) {
 		p, ok := payload.(proto.Message)
@@ -131,6 +153,26 @@ func (r *reporter) Log(ctx context.Context, info *otelgrpc.InterceptorInfo, star
 			logger = logger.With(zap.Any("rpc.request.content", p))
 		}
 	}
+	return logger
+}
+
+func (r *reporter) Log(ctx context.Context, info *otelgrpc.InterceptorInfo, startTime time.Time, event logEvent, payload any, handleErr error) {
+	code := status.Code(handleErr)
+	level := r.conf.levelFunc(info, code)
+
+	logger := r.requestLogger(ctx, info, startTime)
+	if event == logEventEnd {
+		duration := time.Since(startTime)
+		logger = logger.With(
+			zap.Duration("rpc.request.duration", duration),
+			zap.String("rpc.grpc.status_code", code.String()),
+		)
+		if r.conf.slowThreshold > 0 && duration > r.conf.slowThreshold {
+			level = max(level, zap.WarnLevel)
+			logger = logger.With(zap.Bool("slow", true))
+		}
+	}
+	logger = r.withPayload(logger, info, payload)
 	if handleErr != nil {
 		logger = logger.With(zap.Error(handleErr))
 	}
@@ -153,6 +195,7 @@ func NewLoggingUnaryServerInterceptor(logger *zap.Logger, opts ...Option) grpc.U
 	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
 		startTime := time.Now()
 		interceptorInfo := &otelgrpc.InterceptorInfo{UnaryServerInfo: info, Type: otelgrpc.UnaryServer}
+		ctx = withStableTraceId(ctx)
 
 		if conf.logFilter(interceptorInfo) && conf.startLogFilter(interceptorInfo) {
 			r.Log(ctx, interceptorInfo, startTime, logEventStart, req, nil)
@@ -205,7 +248,7 @@ func NewLoggingStreamServerInterceptor(logger *zap.Logger, opts ...Option) grpc.
 	}
 	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 		startTime := time.Now()
-		ctx := ss.Context()
+		ctx := withStableTraceId(ss.Context())
 		interceptorInfo := &otelgrpc.InterceptorInfo{StreamServerInfo: info, Type: otelgrpc.StreamServer}
 
 		mStream := &monitoredServerStream{ctx: ctx, ServerStream: ss}
@@ -6,6 +6,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/exoscale/stelling/fxgrpc"
 	"github.com/exoscale/stelling/fxgrpc/grpctest"
@@ -17,8 +18,10 @@ import (
 	"go.uber.org/zap/zapcore"
 	"go.uber.org/zap/zaptest"
 	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -307,6 +310,95 @@ func TestLoggingServerInterceptor(t *testing.T) {
 		withTestSystem(t, run, extraOpts)
 	})
 
+	t.Run("Should log the request metadata with redacted credentials", func(t *testing.T) {
+		run := func(client pb.RouteGuideClient, logs *observer.ObservedLogs) {
+			ctx := metadata.AppendToOutgoingContext(context.Background(),
+				"authorization", "Bearer secret",
+				"cookie", "session=secret",
+				"x-tenant-id", "acme",
+			)
+			_, err := client.GetFeature(ctx, &pb.Point{})
+			require.Error(t, err)
+
+			require.Equal(t, 1, logs.Len())
+			md, ok := logs.AllUntimed()[0].ContextMap()["rpc.request.metadata"].(metadata.MD)
+			require.True(t, ok)
+			require.Equal(t, []string{"***"}, md.Get("authorization"))
+			require.Equal(t, []string{"***"}, md.Get("cookie"))
+			require.Equal(t, []string{"acme"}, md.Get("x-tenant-id"))
+		}
+		extraOpts := fx.Provide(
+			func() []Option {
+				return []Option{WithMetadataFilter(AllowAllFilter)}
+			},
+			fx.Annotate(
+				func(logger *zap.Logger, opts ...Option) *fxgrpc.UnaryServerInterceptor {
+					return &fxgrpc.UnaryServerInterceptor{Weight: 42, Interceptor: NewLoggingUnaryServerInterceptor(logger, opts...)}
+				},
+				fx.ResultTags(`group:"unary_server_interceptor"`),
+			),
+		)
+		withTestSystem(t, run, extraOpts)
+	})
+
+	t.Run("Should redact the configured metadata keys", func(t *testing.T) {
+		md := metadata.Pairs("Authorization", "Bearer secret", "x-api-key", "secret", "x-api-key", "other")
+		redacted := RedactMetadata(md, "X-Api-Key")
+
+		require.Equal(t, []string{"Bearer secret"}, redacted.Get("authorization"))
+		require.Equal(t, []string{"***", "***"}, redacted.Get("x-api-key"))
+		require.Equal(t, []string{"secret", "other"}, md.Get("x-api-key"))
+	})
+
+	t.Run("Should log slow requests at warn level", func(t *testing.T) {
+		for _, tc := range []struct {
+			name      string
+			threshold time.Duration
+			level     zapcore.Level
+			slow      bool
+		}{
+			{"above the threshold", 10 * time.Millisecond, zapcore.WarnLevel, true},
+			{"below the threshold", time.Minute, zapcore.InfoLevel, false},
+		} {
+			run := func(client pb.RouteGuideClient, logs *observer.ObservedLogs) {
+				_, err := client.GetFeature(context.Background(), &pb.Point{})
+				require.Error(t, err)
+
+				require.Equal(t, 1, logs.Len(), tc.name)
+				log := logs.AllUntimed()[0]
+				require.Equal(t, tc.level, log.Level, tc.name)
+				if tc.slow {
+					require.Equal(t, true, log.ContextMap()["slow"], tc.name)
+				} else {
+					require.NotContains(t, log.ContextMap(), "slow", tc.name)
+				}
+			}
+			extraOpts := fx.Provide(
+				func() []Option {
+					infoLevel := func(*otelgrpc.InterceptorInfo, codes.Code) zapcore.Level { return zapcore.InfoLevel }
+					return []Option{WithLevelFunc(infoLevel), WithSlowThreshold(tc.threshold)}
+				},
+				fx.Annotate(
+					func(logger *zap.Logger, opts ...Option) *fxgrpc.UnaryServerInterceptor {
+						return &fxgrpc.UnaryServerInterceptor{Weight: 42, Interceptor: NewLoggingUnaryServerInterceptor(logger, opts...)}
+					},
+					fx.ResultTags(`group:"unary_server_interceptor"`),
+				),
+				// An artificially slow handler
+				fx.Annotate(
+					func() *fxgrpc.UnaryServerInterceptor {
+						return &fxgrpc.UnaryServerInterceptor{Weight: 43, Interceptor: func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+							time.Sleep(20 * time.Millisecond)
+							return handler(ctx, req)
+						}}
+					},
+					fx.ResultTags(`group:"unary_server_interceptor"`),
+				),
+			)
+			withTestSystem(t, run, extraOpts)
+		}
+	})
+
 	t.Run("Should log correct payload with serverside stream", func(t *testing.T) {
 		run := func(client pb.RouteGuideClient, logs *observer.ObservedLogs) {
 			stream, err := client.ListFeatures(context.Background(), &pb.Rectangle{
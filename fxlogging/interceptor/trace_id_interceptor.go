@@ -0,0 +1,96 @@
+package interceptor
+
+import (
+	"context"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	traceIdMDKey = "x-trace-id"
+	// clientTraceIdKey is the field of the request logs for the x-trace-id sent by the client,
+	// when the request belongs to a trace of the server
+	clientTraceIdKey = "client.trace_id"
+)
+
+// traceIdFromMetadata will extract the x-trace-id metadata from the context, if any
+// If more than 1 value is set on the request metadata, the last value will be returned
+func traceIdFromMetadata(ctx context.Context) (string, bool) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(traceIdMDKey); len(ids) > 0 && ids[len(ids)-1] != "" {
+			return ids[len(ids)-1], true
+		}
+	}
+	return "", false
+}
+
+// withOutgoingTraceId sets the x-trace-id metadata on the outgoing context
+// It only does so when the context already carries a trace-id: we never generate a new one here
+func withOutgoingTraceId(ctx context.Context) context.Context {
+	if traceid, ok := traceIdFromContext(ctx); ok {
+		return metadata.AppendToOutgoingContext(ctx, traceIdMDKey, traceid)
+	}
+	return ctx
+}
+
+// NewInjectTraceIdUnaryClientInterceptor produces a UnaryClientInterceptor that sets the
+// x-trace-id on the metadata of the outgoing context when a trace-id is present
+// This allows servers that don't understand W3C tracecontext to log the same trace-id
+func NewInjectTraceIdUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callopts ...grpc.CallOption) error {
+		return invoker(withOutgoingTraceId(ctx), method, req, reply, cc, callopts...)
+	}
+}
+
+// NewInjectTraceIdStreamClientInterceptor produces a StreamClientInterceptor that sets the
+// x-trace-id on the metadata of the outgoing context when a trace-id is present
+// This allows servers that don't understand W3C tracecontext to log the same trace-id
+func NewInjectTraceIdStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(withOutgoingTraceId(ctx), desc, cc, method, callOpts...)
+	}
+}
+
+// withIncomingTraceId stores the x-trace-id sent by the client on the request context
+// The trace-id of the active span of the server takes precedence: the x-trace-id is then stored as the client trace-id,
+// which is logged under its own field, so a client can't override the trace-id of the server
+func withIncomingTraceId(ctx context.Context) (context.Context, bool) {
+	traceid, ok := traceIdFromMetadata(ctx)
+	if !ok {
+		return ctx, false
+	}
+	if spanCtx := oteltrace.SpanContextFromContext(ctx); spanCtx.HasTraceID() {
+		if traceid == spanCtx.TraceID().String() {
+			return ctx, false
+		}
+		return contextWithClientTraceId(ctx, traceid), true
+	}
+	return contextWithTraceId(ctx, traceid), true
+}
+
+// NewExtractTraceIdUnaryServerInterceptor returns a UnaryServerInterceptor that stores the
+// x-trace-id sent by the client in the request context
+// It is only used as the trace-id of the request when the server has no active span
+// It must run after the tracing interceptor and before the inject logger interceptor, so the injected logger picks up the trace-id
+func NewExtractTraceIdUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, _ = withIncomingTraceId(ctx)
+		return handler(ctx, req)
+	}
+}
+
+// NewExtractTraceIdStreamServerInterceptor returns a StreamServerInterceptor that stores the
+// x-trace-id sent by the client in the request context
+// It is only used as the trace-id of the request when the server has no active span
+// It must run after the tracing interceptor and before the inject logger interceptor, so the injected logger picks up the trace-id
+func NewExtractTraceIdStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, ok := withIncomingTraceId(ss.Context())
+		if !ok {
+			return handler(srv, ss)
+		}
+		return handler(srv, &wrappedServerStream{ctx: ctx, ServerStream: ss})
+	}
+}
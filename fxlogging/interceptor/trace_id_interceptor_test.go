@@ -0,0 +1,206 @@
+package interceptor
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/exoscale/stelling/fxgrpc/grpctest"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/metadata"
+)
+
+type traceIdRouteGuideServer struct {
+	pb.UnimplementedRouteGuideServer
+}
+
+func newTraceIdRouteGuideServer() pb.RouteGuideServer {
+	return &traceIdRouteGuideServer{}
+}
+
+func (s *traceIdRouteGuideServer) GetFeature(ctx context.Context, req *pb.Point) (*pb.Feature, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	LoggerFromContext(ctx).Info("GetFeature", zap.Strings("header", md.Get("x-trace-id")))
+	return &pb.Feature{}, nil
+}
+
+func (s *traceIdRouteGuideServer) ListFeatures(req *pb.Rectangle, stream pb.RouteGuide_ListFeaturesServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	LoggerFromContext(stream.Context()).Info("ListFeatures", zap.Strings("header", md.Get("x-trace-id")))
+	return stream.Send(&pb.Feature{})
+}
+
+func TestTraceIdInterceptors(t *testing.T) {
+	var client pb.RouteGuideClient
+
+	core, observer := observer.New(zapcore.DebugLevel)
+	logger := zaptest.NewLogger(t, zaptest.WrapOptions(zap.WrapCore(func(_ zapcore.Core) zapcore.Core { return core })))
+
+	app := fxtest.New(t, fx.Options(
+		grpctest.Module,
+		fx.Supply(logger),
+		fx.Provide(
+			newTraceIdRouteGuideServer,
+			pb.NewRouteGuideClient,
+			fx.Annotate(
+				func() *fxgrpc.UnaryClientInterceptor {
+					return &fxgrpc.UnaryClientInterceptor{Weight: 42, Interceptor: NewInjectTraceIdUnaryClientInterceptor()}
+				},
+				fx.ResultTags(`group:"unary_client_interceptor"`),
+			),
+			fx.Annotate(
+				func() *fxgrpc.StreamClientInterceptor {
+					return &fxgrpc.StreamClientInterceptor{Weight: 42, Interceptor: NewInjectTraceIdStreamClientInterceptor()}
+				},
+				fx.ResultTags(`group:"stream_client_interceptor"`),
+			),
+			fx.Annotate(
+				func() *fxgrpc.UnaryServerInterceptor {
+					return &fxgrpc.UnaryServerInterceptor{Weight: 41, Interceptor: NewExtractTraceIdUnaryServerInterceptor()}
+				},
+				fx.ResultTags(`group:"unary_server_interceptor"`),
+			),
+			fx.Annotate(
+				func() *fxgrpc.StreamServerInterceptor {
+					return &fxgrpc.StreamServerInterceptor{Weight: 41, Interceptor: NewExtractTraceIdStreamServerInterceptor()}
+				},
+				fx.ResultTags(`group:"stream_server_interceptor"`),
+			),
+			fx.Annotate(
+				func(logger *zap.Logger) *fxgrpc.UnaryServerInterceptor {
+					return &fxgrpc.UnaryServerInterceptor{Weight: 42, Interceptor: NewInjectLoggerUnaryServerInterceptor(logger)}
+				},
+				fx.ResultTags(`group:"unary_server_interceptor"`),
+			),
+			fx.Annotate(
+				func(logger *zap.Logger) *fxgrpc.StreamServerInterceptor {
+					return &fxgrpc.StreamServerInterceptor{Weight: 42, Interceptor: NewInjectLoggerStreamServerInterceptor(logger)}
+				},
+				fx.ResultTags(`group:"stream_server_interceptor"`),
+			),
+		),
+		fx.Invoke(
+			pb.RegisterRouteGuideServer,
+		),
+		fx.Populate(&client),
+	))
+	defer app.RequireStart().RequireStop()
+
+	// The NoopTracerProvider doesn't supply TraceIDs, so we can't use it
+	// in this test
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(io.Discard))
+	require.NoError(t, err)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	t.Run("UnaryInterceptors should propagate the trace-id of the active span", func(t *testing.T) {
+		ctx, span := tp.Tracer("my-test").Start(context.Background(), "test")
+		defer span.End()
+		expected := span.SpanContext().TraceID().String()
+
+		_, err := client.GetFeature(ctx, &pb.Point{})
+		require.NoError(t, err)
+
+		logs := observer.TakeAll()
+		require.Len(t, logs, 1)
+		fields := logs[0].ContextMap()
+		require.Equal(t, []any{expected}, fields["header"])
+		require.Equal(t, expected, fields["otlp.trace_id"])
+	})
+
+	t.Run("StreamInterceptors should propagate the trace-id of the active span", func(t *testing.T) {
+		ctx, span := tp.Tracer("my-test").Start(context.Background(), "test")
+		defer span.End()
+		expected := span.SpanContext().TraceID().String()
+
+		stream, err := client.ListFeatures(ctx, &pb.Rectangle{})
+		require.NoError(t, err)
+		for {
+			_, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+		}
+
+		logs := observer.TakeAll()
+		require.Len(t, logs, 1)
+		fields := logs[0].ContextMap()
+		require.Equal(t, []any{expected}, fields["header"])
+		require.Equal(t, expected, fields["otlp.trace_id"])
+	})
+
+	t.Run("Should not set the header when there is no trace-id", func(t *testing.T) {
+		_, err := client.GetFeature(context.Background(), &pb.Point{})
+		require.NoError(t, err)
+
+		logs := observer.TakeAll()
+		require.Len(t, logs, 1)
+		fields := logs[0].ContextMap()
+		require.Empty(t, fields["header"])
+		require.NotEmpty(t, fields["otlp.trace_id"])
+	})
+}
+
+func TestExtractTraceIdPrecedence(t *testing.T) {
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(io.Discard))
+	require.NoError(t, err)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	core, observer := observer.New(zapcore.DebugLevel)
+	extract := NewExtractTraceIdUnaryServerInterceptor()
+	inject := NewInjectLoggerUnaryServerInterceptor(zap.New(core))
+
+	// call runs the extract and inject logger interceptors, and returns the fields of the handler log
+	call := func(t *testing.T, ctx context.Context, clientTraceId string) map[string]any {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(traceIdMDKey, clientTraceId))
+		_, err := extract(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req any) (any, error) {
+			return inject(ctx, req, &grpc.UnaryServerInfo{}, func(ctx context.Context, req any) (any, error) {
+				LoggerFromContext(ctx).Info("handler")
+				return nil, nil
+			})
+		})
+		require.NoError(t, err)
+
+		logs := observer.TakeAll()
+		require.Len(t, logs, 1)
+		return logs[0].ContextMap()
+	}
+
+	t.Run("Should prefer the trace-id of the active span of the server", func(t *testing.T) {
+		ctx, span := tp.Tracer("my-test").Start(context.Background(), "test")
+		defer span.End()
+
+		fields := call(t, ctx, "client-trace-id")
+		require.Equal(t, span.SpanContext().TraceID().String(), fields["otlp.trace_id"])
+		require.Equal(t, "client-trace-id", fields[clientTraceIdKey])
+	})
+
+	t.Run("Should not log the client trace-id when it is the trace-id of the server", func(t *testing.T) {
+		ctx, span := tp.Tracer("my-test").Start(context.Background(), "test")
+		defer span.End()
+		expected := span.SpanContext().TraceID().String()
+
+		fields := call(t, ctx, expected)
+		require.Equal(t, expected, fields["otlp.trace_id"])
+		require.NotContains(t, fields, clientTraceIdKey)
+	})
+
+	t.Run("Should use the client trace-id without an active span", func(t *testing.T) {
+		fields := call(t, context.Background(), "client-trace-id")
+		require.Equal(t, "client-trace-id", fields["otlp.trace_id"])
+		require.NotContains(t, fields, clientTraceIdKey)
+	})
+}
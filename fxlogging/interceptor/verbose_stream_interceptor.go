@@ -0,0 +1,90 @@
+package interceptor
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+)
+
+const (
+	messageTypeReceived = "RECEIVED"
+	messageTypeSent     = "SENT"
+)
+
+// LogMessage logs a single message sent or received on a stream at Debug level
+// The payload is only added when allowed by the payload filter
+// The logger of the message is not built unless the Debug level is enabled
+func (r *reporter) LogMessage(ctx context.Context, info *otelgrpc.InterceptorInfo, startTime time.Time, messageType string, seq uint64, payload any) {
+	if !r.logger.Core().Enabled(zapcore.DebugLevel) {
+		return
+	}
+	logger := r.requestLogger(ctx, info, startTime).With(
+		zap.String("rpc.message.type", messageType),
+		zap.Uint64("rpc.message.id", seq),
+	)
+	r.withPayload(logger, info, payload).Debug("stream message")
+}
+
+type verboseServerStream struct {
+	grpc.ServerStream
+	// ctx is the context of the stream with a stable trace-id, so all its messages are logged with the same one
+	ctx       context.Context
+	reporter  *reporter
+	info      *otelgrpc.InterceptorInfo
+	startTime time.Time
+	// Both counters are only touched by a single goroutine:
+	// grpc does not allow concurrent calls to SendMsg or RecvMsg
+	recvSeq uint64
+	sendSeq uint64
+}
+
+func (s *verboseServerStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.recvSeq++
+		s.reporter.LogMessage(s.ctx, s.info, s.startTime, messageTypeReceived, s.recvSeq, m)
+	}
+	return err
+}
+
+func (s *verboseServerStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sendSeq++
+		s.reporter.LogMessage(s.ctx, s.info, s.startTime, messageTypeSent, s.sendSeq, m)
+	}
+	return err
+}
+
+// NewVerboseStreamServerInterceptor returns a StreamServerInterceptor that logs every message sent and received
+// on a stream, at Debug level, with its sequence number
+// It is meant to debug misbehaving streams and is not part of the default logging interceptors:
+// NewLoggingStreamServerInterceptor only logs the first message of a stream
+// The LogFilter determines which streams are logged, the PayloadFilter whether the message content is logged
+func NewVerboseStreamServerInterceptor(logger *zap.Logger, opts ...Option) grpc.StreamServerInterceptor {
+	svcName := serviceName()
+	conf := newInterceptorConfig(opts)
+	r := &reporter{
+		svcName: svcName,
+		conf:    conf,
+		logger:  logger,
+	}
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		interceptorInfo := &otelgrpc.InterceptorInfo{StreamServerInfo: info, Type: otelgrpc.StreamServer}
+		if !conf.logFilter(interceptorInfo) {
+			return handler(srv, ss)
+		}
+
+		return handler(srv, &verboseServerStream{
+			ServerStream: ss,
+			ctx:          withStableTraceId(ss.Context()),
+			reporter:     r,
+			info:         interceptorInfo,
+			startTime:    time.Now(),
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+)
+
+func TestVerboseStreamServerInterceptor(t *testing.T) {
+	withVerboseInterceptor := func(opts ...Option) fx.Option {
+		return fx.Provide(
+			fx.Annotate(
+				func(logger *zap.Logger) *fxgrpc.StreamServerInterceptor {
+					return &fxgrpc.StreamServerInterceptor{Weight: 42, Interceptor: NewVerboseStreamServerInterceptor(logger, opts...)}
+				},
+				fx.ResultTags(`group:"stream_server_interceptor"`),
+			),
+		)
+	}
+
+	recordRoute := func(t *testing.T, client pb.RouteGuideClient, points int) {
+		stream, err := client.RecordRoute(context.Background())
+		require.NoError(t, err)
+		for i := 0; i < points; i++ {
+			require.NoError(t, stream.Send(&pb.Point{Latitude: int32(i)}))
+		}
+		_, err = stream.CloseAndRecv()
+		require.NoError(t, err)
+	}
+
+	t.Run("Should log every message of a stream", func(t *testing.T) {
+		run := func(client pb.RouteGuideClient, logs *observer.ObservedLogs) {
+			recordRoute(t, client, 3)
+
+			received := logs.FilterField(zap.String("rpc.message.type", messageTypeReceived)).AllUntimed()
+			sent := logs.FilterField(zap.String("rpc.message.type", messageTypeSent)).AllUntimed()
+			require.Len(t, received, 3)
+			require.Len(t, sent, 1)
+			require.Equal(t, 4, logs.Len())
+
+			for i, log := range received {
+				require.Equal(t, zapcore.DebugLevel, log.Level)
+				fields := log.ContextMap()
+				require.Equal(t, uint64(i+1), fields["rpc.message.id"])
+				require.Equal(t, "RecordRoute", fields["rpc.method"])
+				require.NotContains(t, fields, "rpc.request.content")
+			}
+			require.Equal(t, uint64(1), sent[0].ContextMap()["rpc.message.id"])
+
+			// The stream carries no trace-id, so a local one is generated once for all its messages
+			traceid := received[0].ContextMap()["otlp.trace_id"]
+			require.NotEmpty(t, traceid)
+			for _, log := range logs.AllUntimed() {
+				require.Equal(t, traceid, log.ContextMap()["otlp.trace_id"])
+			}
+		}
+		withTestSystem(t, run, withVerboseInterceptor())
+	})
+
+	t.Run("Should log the message content when allowed by the payload filter", func(t *testing.T) {
+		run := func(client pb.RouteGuideClient, logs *observer.ObservedLogs) {
+			recordRoute(t, client, 2)
+
+			require.Equal(t, 3, logs.Len())
+			for _, log := range logs.AllUntimed() {
+				require.Contains(t, log.ContextMap(), "rpc.request.content")
+			}
+		}
+		withTestSystem(t, run, withVerboseInterceptor(WithPayloadFilter(AllowAllFilter)))
+	})
+
+	t.Run("Should not log the messages when the Debug level is disabled", func(t *testing.T) {
+		run := func(client pb.RouteGuideClient, logs *observer.ObservedLogs) {
+			recordRoute(t, client, 2)
+
+			require.Equal(t, 0, logs.Len())
+		}
+		withInfoLogger := fx.Decorate(func(logger *zap.Logger) *zap.Logger {
+			return logger.WithOptions(zap.IncreaseLevel(zapcore.InfoLevel))
+		})
+		withTestSystem(t, run, withVerboseInterceptor(), withInfoLogger)
+	})
+
+	t.Run("Should not log streams rejected by the log filter", func(t *testing.T) {
+		run := func(client pb.RouteGuideClient, logs *observer.ObservedLogs) {
+			recordRoute(t, client, 2)
+
+			require.Equal(t, 0, logs.Len())
+		}
+		withTestSystem(t, run, withVerboseInterceptor(WithLogFilter(DenyAllFilter)))
+	})
+}
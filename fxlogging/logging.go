@@ -3,11 +3,15 @@ package fxlogging
 
 import (
 	"context"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/exoscale/stelling/fxhttp"
 	"github.com/exoscale/stelling/fxlogging/fxlogger"
 	"github.com/exoscale/stelling/fxlogging/interceptor"
+	"github.com/exoscale/stelling/fxlogging/summary"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -15,34 +19,34 @@ import (
 
 // NewModule provides a *zap.Logger to the system
 // It also provides the following related items:
-// * Grpc middleware
+// * Grpc middleware, unless DisableInterceptors is set
+// * An http access log middleware, if HttpAccessLog is enabled
 // * An adapter to log fx system events
+// * A summary of the stelling modules of the system, logged at startup
 func NewModule(conf LoggingConfig) fx.Option {
+	interceptors := fx.Options()
+	if !conf.LoggingConfig().DisableInterceptors {
+		interceptors = grpcInterceptors
+	}
+	if conf.LoggingConfig().HttpAccessLog.Enabled {
+		interceptors = fx.Options(
+			interceptors,
+			fx.Provide(
+				fx.Annotate(NewHttpAccessLogMiddleware, fx.ResultTags(`group:"http_middleware"`)),
+			),
+		)
+	}
 	return fx.Options(
 		fx.WithLogger(fxlogger.NewFxLogger),
 		fx.Module(
 			"logging",
-			fx.Provide(
-				fx.Annotate(NewLogger, fx.ParamTags(``, ``, `group:"zap_opts"`)),
-				fx.Annotate(
-					NewGrpcLoggingServerInterceptors,
-					fx.ParamTags(``, `group:"logging_server_interceptor_options"`),
-					fx.ResultTags(`group:"unary_server_interceptor"`, `group:"stream_server_interceptor"`),
-				),
-				fx.Annotate(
-					NewGrpcLoggingClientInterceptors,
-					fx.ParamTags(``, `group:"logging_client_interceptor_options"`),
-					fx.ResultTags(`group:"unary_client_interceptor"`, `group:"stream_client_interceptor"`),
-				),
-				fx.Annotate(
-					NewGrpcInjectLoggerInterceptors,
-					fx.ResultTags(`group:"unary_server_interceptor"`, `group:"stream_server_interceptor"`),
-				),
-				fx.Annotate(
-					NewGrpcInjectPeerInterceptors,
-					fx.ResultTags(`group:"unary_client_interceptor"`, `group:"stream_client_interceptor"`),
-				),
+			fx.Provide(provideLogger),
+			fx.Invoke(
+				setLocalTraceIdGenerator,
+				fx.Annotate(summary.LogSummary, fx.ParamTags(``, summary.Group)),
 			),
+			summary.Provide("logging", conf.LoggingConfig()),
+			interceptors,
 			fx.Supply(
 				fx.Annotate(conf, fx.As(new(LoggingConfig))),
 				fx.Private,
@@ -51,6 +55,54 @@ func NewModule(conf LoggingConfig) fx.Option {
 	)
 }
 
+// grpcInterceptors provides the grpc middleware of the module
+var grpcInterceptors = fx.Provide(
+	fx.Annotate(
+		NewGrpcLoggingServerInterceptors,
+		fx.ParamTags(``, `group:"logging_server_interceptor_options"`),
+		fx.ResultTags(`group:"unary_server_interceptor"`, `group:"stream_server_interceptor"`),
+	),
+	fx.Annotate(
+		NewGrpcLoggingClientInterceptors,
+		fx.ParamTags(``, `group:"logging_client_interceptor_options"`),
+		fx.ResultTags(`group:"unary_client_interceptor"`, `group:"stream_client_interceptor"`),
+	),
+	fx.Annotate(
+		NewGrpcInjectLoggerInterceptors,
+		fx.ResultTags(`group:"unary_server_interceptor"`, `group:"stream_server_interceptor"`),
+	),
+	fx.Annotate(
+		NewGrpcInjectPeerInterceptors,
+		fx.ResultTags(`group:"unary_client_interceptor"`, `group:"stream_client_interceptor"`),
+	),
+	fx.Annotate(
+		NewGrpcInjectTraceIdInterceptors,
+		fx.ResultTags(`group:"unary_client_interceptor"`, `group:"stream_client_interceptor"`),
+	),
+	fx.Annotate(
+		NewGrpcExtractTraceIdInterceptors,
+		fx.ResultTags(`group:"unary_server_interceptor"`, `group:"stream_server_interceptor"`),
+	),
+)
+
+type localTraceIdParams struct {
+	fx.In
+
+	Conf      LoggingConfig
+	Generator interceptor.LocalTraceIdGenerator `optional:"true"`
+}
+
+// setLocalTraceIdGenerator sets the generator of the trace-id of the requests which do not carry one
+// A LocalTraceIdGenerator provided to the system takes precedence over the configured LocalTraceIdPrefix
+func setLocalTraceIdGenerator(p localTraceIdParams) {
+	switch {
+	case p.Generator != nil:
+		interceptor.SetLocalTraceIdGenerator(p.Generator)
+	case p.Conf.LoggingConfig().LocalTraceIdPrefix != "":
+		interceptor.SetLocalTraceIdGenerator(interceptor.NewULIDTraceIdGenerator(p.Conf.LoggingConfig().LocalTraceIdPrefix))
+	}
+}
+
 type LoggingConfig interface {
 	LoggingConfig() *Logging
 }
@@ -59,6 +111,36 @@ type LoggingConfig interface {
 type Logging struct {
 	// LogMode is the preset logging configuration
 	Mode string `default:"development" validate:"oneof=production development preproduction"`
+	// Otlp configures the export of logs to an OTLP collector, in addition to stdout
+	Otlp OtlpLogs
+	// DisableInterceptors keeps the logger but does not add the grpc logging middleware to the system
+	DisableInterceptors bool
+	// HttpAccessLog configures the logging of the requests handled by the main http server
+	HttpAccessLog HttpAccessLog
+	// LocalTraceIdPrefix is the prefix of the trace-id generated for the requests which do not carry one
+	// It defaults to interceptor.DefaultLocalTraceIdPrefix
+	LocalTraceIdPrefix string
+}
+
+// HttpAccessLog contains the configuration options of the http access log
+type HttpAccessLog struct {
+	// Enabled adds a middleware logging each request to the main http server
+	Enabled bool
+	// SkipPaths are the paths of requests which are not logged, eg: /healthz
+	SkipPaths []string
+}
+
+func (h *HttpAccessLog) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if h == nil {
+		return nil
+	}
+
+	enc.AddBool("enabled", h.Enabled)
+	if len(h.SkipPaths) > 0 {
+		enc.AddString("skip-paths", strings.Join(h.SkipPaths, ","))
+	}
+
+	return nil
 }
 
 func (l *Logging) MarshalLogObject(enc zapcore.ObjectEncoder) error {
@@ -67,6 +149,22 @@ func (l *Logging) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	}
 
 	enc.AddString("mode", l.Mode)
+	if l.DisableInterceptors {
+		enc.AddBool("disable-interceptors", l.DisableInterceptors)
+	}
+	if l.LocalTraceIdPrefix != "" {
+		enc.AddString("local-trace-id-prefix", l.LocalTraceIdPrefix)
+	}
+	if l.Otlp.Enabled {
+		if err := enc.AddObject("otlp", &l.Otlp); err != nil {
+			return err
+		}
+	}
+	if l.HttpAccessLog.Enabled {
+		if err := enc.AddObject("http-access-log", &l.HttpAccessLog); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -75,7 +173,45 @@ func (l *Logging) LoggingConfig() *Logging {
 	return l
 }
 
+// WithLoggerFields adds the given fields to every entry of the logger provided by the module
+// As the fields are set on the logger itself, they are inherited by all its consumers, including the stelling interceptors
+func WithLoggerFields(fields ...zap.Field) fx.Option {
+	return fx.Provide(
+		fx.Annotate(
+			func() []zap.Field { return fields },
+			fx.ResultTags(`group:"zap_fields,flatten"`),
+		),
+	)
+}
+
+type loggerParams struct {
+	fx.In
+
+	Conf   LoggingConfig
+	Lc     fx.Lifecycle
+	Opts   []zap.Option `group:"zap_opts"`
+	Fields []zap.Field  `group:"zap_fields"`
+}
+
+type loggerResult struct {
+	fx.Out
+
+	Logger *zap.Logger
+	// Level is the level of the logger, which can be changed while the system runs
+	Level zap.AtomicLevel
+}
+
+func provideLogger(p loggerParams) (loggerResult, error) {
+	logger, level, err := newLogger(p.Conf, p.Lc, p.Fields, p.Opts...)
+	return loggerResult{Logger: logger, Level: level}, err
+}
+
 func NewLogger(conf LoggingConfig, lc fx.Lifecycle, opts ...zap.Option) (*zap.Logger, error) {
+	logger, _, err := newLogger(conf, lc, nil, opts...)
+	return logger, err
+}
+
+func newLogger(conf LoggingConfig, lc fx.Lifecycle, fields []zap.Field, opts ...zap.Option) (*zap.Logger, zap.AtomicLevel, error) {
 	var config zap.Config
 	switch conf.LoggingConfig().Mode {
 	case "production":
@@ -93,8 +229,22 @@ func NewLogger(conf LoggingConfig, lc fx.Lifecycle, opts ...zap.Option) (*zap.Lo
 	config.ErrorOutputPaths = []string{"stdout"}
 	logger, err := config.Build(opts...)
 	if err != nil {
-		return nil, err
+		return nil, config.Level, err
+	}
+	if otlpConf := &conf.LoggingConfig().Otlp; otlpConf.Enabled {
+		otlpCore, err := newOtlpCore(otlpConf, config.Level, lc, logger)
+		if err != nil {
+			return nil, config.Level, err
+		}
+		if s := config.Sampling; s != nil {
+			otlpCore = zapcore.NewSamplerWithOptions(otlpCore, time.Second, s.Initial, s.Thereafter)
+		}
+		logger = logger.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(c, otlpCore)
+		}))
 	}
+	// The fields are added last, so they are also exported to the OTLP collector
+	logger = logger.With(fields...)
 	logger.Info("Using configuration", zap.Any("conf", conf))
 
 	lc.Append(fx.Hook{
@@ -110,7 +260,18 @@ func NewLogger(conf LoggingConfig, lc fx.Lifecycle, opts ...zap.Option) (*zap.Lo
 		},
 	})
 
-	return logger, nil
+	return logger, config.Level, nil
+}
+
+// WithTraceContext returns the logger with the `otlp.trace_id` field of the trace carried by ctx,
+// like the loggers of the stelling interceptors
+// It lets code outside of a request, eg: a background worker creating its own spans, correlate its logs with the traces
+// The logger is returned as is when ctx carries no trace
+func WithTraceContext(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if traceid, ok := interceptor.TraceIdFromContext(ctx); ok {
+		return logger.With(zap.String("otlp.trace_id", traceid))
+	}
+	return logger
 }
 
 // ISO8601UTCTimeEncoder is like zapcore.ISO8601TimeEncoder but sets
@@ -122,31 +283,62 @@ func ISO8601UTCTimeEncoder(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 
 const GrpcInterceptorWeight uint = 50
 
+const HttpMiddlewareWeight uint = 50
+
+// NewHttpAccessLogMiddleware logs each request handled by the http server
+// Like the grpc interceptors, it injects a logger enriched with the trace id of the request in its context
+func NewHttpAccessLogMiddleware(logger *zap.Logger, conf LoggingConfig) *fxhttp.Middleware {
+	skipPaths := conf.LoggingConfig().HttpAccessLog.SkipPaths
+	return &fxhttp.Middleware{
+		Name:   "access-log",
+		Weight: HttpMiddlewareWeight,
+		Middleware: func(h http.Handler) http.Handler {
+			return interceptor.NewRequestLogger(logger, h, interceptor.WithSkipPaths(skipPaths...))
+		},
+	}
+}
+
 func NewGrpcLoggingServerInterceptors(logger *zap.Logger, opts ...interceptor.Option) (*fxgrpc.UnaryServerInterceptor, *fxgrpc.StreamServerInterceptor) {
 	logger = logger.WithOptions(zap.WithCaller(false), zap.AddStacktrace(interceptor.NeverEnabler{}))
-	unaryIx := &fxgrpc.UnaryServerInterceptor{Weight: GrpcInterceptorWeight, Interceptor: interceptor.NewLoggingUnaryServerInterceptor(logger, opts...)}
-	streamIx := &fxgrpc.StreamServerInterceptor{Weight: GrpcInterceptorWeight, Interceptor: interceptor.NewLoggingStreamServerInterceptor(logger, opts...)}
+	unaryIx := &fxgrpc.UnaryServerInterceptor{Name: "logging", Weight: GrpcInterceptorWeight, Interceptor: interceptor.NewLoggingUnaryServerInterceptor(logger, opts...)}
+	streamIx := &fxgrpc.StreamServerInterceptor{Name: "logging", Weight: GrpcInterceptorWeight, Interceptor: interceptor.NewLoggingStreamServerInterceptor(logger, opts...)}
 	return unaryIx, streamIx
 }
 
 func NewGrpcLoggingClientInterceptors(logger *zap.Logger, opts ...interceptor.Option) (*fxgrpc.UnaryClientInterceptor, *fxgrpc.StreamClientInterceptor) {
 	logger = logger.WithOptions(zap.WithCaller(false), zap.AddStacktrace(interceptor.NeverEnabler{}))
 
-	unaryIx := &fxgrpc.UnaryClientInterceptor{Weight: GrpcInterceptorWeight, Interceptor: interceptor.NewLoggingUnaryClientInterceptor(logger, opts...)}
-	streamIx := &fxgrpc.StreamClientInterceptor{Weight: GrpcInterceptorWeight, Interceptor: interceptor.NewLoggingStreamClientInterceptor(logger, opts...)}
+	unaryIx := &fxgrpc.UnaryClientInterceptor{Name: "logging", Weight: GrpcInterceptorWeight, Interceptor: interceptor.NewLoggingUnaryClientInterceptor(logger, opts...)}
+	streamIx := &fxgrpc.StreamClientInterceptor{Name: "logging", Weight: GrpcInterceptorWeight, Interceptor: interceptor.NewLoggingStreamClientInterceptor(logger, opts...)}
 	return unaryIx, streamIx
 }
 
 func NewGrpcInjectLoggerInterceptors(logger *zap.Logger) (*fxgrpc.UnaryServerInterceptor, *fxgrpc.StreamServerInterceptor) {
 	weight := GrpcInterceptorWeight - 1
-	unaryIx := &fxgrpc.UnaryServerInterceptor{Weight: weight, Interceptor: interceptor.NewInjectLoggerUnaryServerInterceptor(logger)}
-	streamIx := &fxgrpc.StreamServerInterceptor{Weight: weight, Interceptor: interceptor.NewInjectLoggerStreamServerInterceptor(logger)}
+	unaryIx := &fxgrpc.UnaryServerInterceptor{Name: "inject-logger", Weight: weight, Interceptor: interceptor.NewInjectLoggerUnaryServerInterceptor(logger)}
+	streamIx := &fxgrpc.StreamServerInterceptor{Name: "inject-logger", Weight: weight, Interceptor: interceptor.NewInjectLoggerStreamServerInterceptor(logger)}
 	return unaryIx, streamIx
 }
 
 func NewGrpcInjectPeerInterceptors() (*fxgrpc.UnaryClientInterceptor, *fxgrpc.StreamClientInterceptor) {
 	weight := GrpcInterceptorWeight - 1
-	unaryIx := &fxgrpc.UnaryClientInterceptor{Weight: weight, Interceptor: interceptor.NewInjectPeerUnaryClientInterceptor()}
-	streamIx := &fxgrpc.StreamClientInterceptor{Weight: weight, Interceptor: interceptor.NewInjectPeerStreamClientInterceptor()}
+	unaryIx := &fxgrpc.UnaryClientInterceptor{Name: "inject-peer", Weight: weight, Interceptor: interceptor.NewInjectPeerUnaryClientInterceptor()}
+	streamIx := &fxgrpc.StreamClientInterceptor{Name: "inject-peer", Weight: weight, Interceptor: interceptor.NewInjectPeerStreamClientInterceptor()}
+	return unaryIx, streamIx
+}
+
+func NewGrpcInjectTraceIdInterceptors() (*fxgrpc.UnaryClientInterceptor, *fxgrpc.StreamClientInterceptor) {
+	weight := GrpcInterceptorWeight - 1
+	unaryIx := &fxgrpc.UnaryClientInterceptor{Name: "inject-trace-id", Weight: weight, Interceptor: interceptor.NewInjectTraceIdUnaryClientInterceptor()}
+	streamIx := &fxgrpc.StreamClientInterceptor{Name: "inject-trace-id", Weight: weight, Interceptor: interceptor.NewInjectTraceIdStreamClientInterceptor()}
+	return unaryIx, streamIx
+}
+
+// NewGrpcExtractTraceIdInterceptors must run before the inject logger interceptors
+// so the logger stored in the context is seeded with the trace-id sent by the client
+func NewGrpcExtractTraceIdInterceptors() (*fxgrpc.UnaryServerInterceptor, *fxgrpc.StreamServerInterceptor) {
+	weight := GrpcInterceptorWeight - 2
+	unaryIx := &fxgrpc.UnaryServerInterceptor{Name: "extract-trace-id", Weight: weight, Interceptor: interceptor.NewExtractTraceIdUnaryServerInterceptor()}
+	streamIx := &fxgrpc.StreamServerInterceptor{Name: "extract-trace-id", Weight: weight, Interceptor: interceptor.NewExtractTraceIdStreamServerInterceptor()}
 	return unaryIx, streamIx
 }
@@ -32,6 +32,7 @@ func Example() {
 
 	// Output:
 	// {"level":"info","ts":"2009-11-10T23:00:00.000Z","msg":"Using configuration","conf":{"mode":"production"}}
+	// {"level":"info","ts":"2009-11-10T23:00:00.000Z","msg":"Stelling modules","modules":["logging"],"config":{"logging":{"mode":"production"}}}
 	// {"level":"info","ts":"2009-11-10T23:00:00.000Z","msg":"Example log"}
 	// {"level":"info","ts":"2009-11-10T23:00:00.000Z","msg":"Final configuration","conf":{"mode":"production"}}
 }
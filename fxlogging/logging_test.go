@@ -0,0 +1,305 @@
+package fxlogging
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/exoscale/stelling/fxhttp"
+	"github.com/exoscale/stelling/fxlogging/interceptor"
+	"github.com/exoscale/stelling/fxsentry"
+	"github.com/stretchr/testify/require"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type interceptors struct {
+	fx.In
+
+	Logger       *zap.Logger
+	UnaryServer  []*fxgrpc.UnaryServerInterceptor  `group:"unary_server_interceptor"`
+	StreamServer []*fxgrpc.StreamServerInterceptor `group:"stream_server_interceptor"`
+	UnaryClient  []*fxgrpc.UnaryClientInterceptor  `group:"unary_client_interceptor"`
+	StreamClient []*fxgrpc.StreamClientInterceptor `group:"stream_client_interceptor"`
+}
+
+func names[T fxgrpc.NamedInterceptor](list []T) []string {
+	result := make([]string, 0, len(list))
+	for _, ix := range list {
+		result = append(result, ix.GetName())
+	}
+	return result
+}
+
+func TestDisableInterceptors(t *testing.T) {
+	t.Run("Should provide the grpc middleware by default", func(t *testing.T) {
+		var got interceptors
+		app := fxtest.New(t, NewModule(&Logging{}), fx.Populate(&got))
+		app.RequireStart().RequireStop()
+
+		require.NotNil(t, got.Logger)
+		require.Contains(t, names(got.UnaryServer), "logging")
+		require.Contains(t, names(got.StreamServer), "logging")
+		require.Contains(t, names(got.UnaryClient), "logging")
+		require.Contains(t, names(got.StreamClient), "logging")
+	})
+
+	t.Run("Should only provide the logger when the interceptors are disabled", func(t *testing.T) {
+		var got interceptors
+		app := fxtest.New(t, NewModule(&Logging{DisableInterceptors: true}), fx.Populate(&got))
+		app.RequireStart().RequireStop()
+
+		require.NotNil(t, got.Logger)
+		require.Empty(t, got.UnaryServer)
+		require.Empty(t, got.StreamServer)
+		require.Empty(t, got.UnaryClient)
+		require.Empty(t, got.StreamClient)
+	})
+}
+
+func TestPeerService(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	unaryServer, streamServer := NewGrpcLoggingServerInterceptors(zap.New(core))
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		fxgrpc.UnaryServerInterceptors([]*fxgrpc.UnaryServerInterceptor{unaryServer}),
+		fxgrpc.StreamServerInterceptors([]*fxgrpc.StreamServerInterceptor{streamServer}),
+	)
+	pb.RegisterRouteGuideServer(server, pb.UnimplementedRouteGuideServer{})
+	go server.Serve(lis) //nolint:errcheck
+	defer server.Stop()
+
+	// peerService returns the peer.service logged by the server for a request of a client configured with conf
+	peerService := func(t *testing.T, conf *fxgrpc.Client) any {
+		t.Helper()
+		logs.TakeAll()
+		unaryClient, streamClient := NewGrpcInjectPeerInterceptors()
+		conn, err := fxgrpc.NewGrpcClient(conf, zap.NewNop(),
+			[]*fxgrpc.UnaryClientInterceptor{unaryClient},
+			[]*fxgrpc.StreamClientInterceptor{streamClient},
+			grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		)
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		_, err = pb.NewRouteGuideClient(conn).GetFeature(context.Background(), &pb.Point{})
+		require.Error(t, err)
+
+		entries := logs.FilterMessage("finished call").All()
+		require.Len(t, entries, 1)
+		return entries[0].ContextMap()["peer.service"]
+	}
+
+	t.Run("Should log the service name of the client config", func(t *testing.T) {
+		t.Setenv("OTEL_SERVICE_NAME", "from-env")
+		got := peerService(t, &fxgrpc.Client{InsecureConnection: true, Endpoint: "passthrough:///bufnet", ServiceName: "billing"})
+		require.Equal(t, "billing", got)
+	})
+
+	t.Run("Should fall back to OTEL_SERVICE_NAME", func(t *testing.T) {
+		t.Setenv("OTEL_SERVICE_NAME", "from-env")
+		got := peerService(t, &fxgrpc.Client{InsecureConnection: true, Endpoint: "passthrough:///bufnet"})
+		require.Equal(t, "from-env", got)
+	})
+}
+
+func TestHttpAccessLog(t *testing.T) {
+	type middlewares struct {
+		fx.In
+
+		Middlewares []*fxhttp.Middleware `group:"http_middleware"`
+	}
+
+	t.Run("Should not provide the access log by default", func(t *testing.T) {
+		var got middlewares
+		app := fxtest.New(t, NewModule(&Logging{}), fx.Populate(&got))
+		app.RequireStart().RequireStop()
+
+		require.Empty(t, got.Middlewares)
+	})
+
+	core, logs := observer.New(zap.DebugLevel)
+	var got middlewares
+	app := fxtest.New(
+		t,
+		NewModule(&Logging{HttpAccessLog: HttpAccessLog{Enabled: true, SkipPaths: []string{"/healthz"}}}),
+		fx.Decorate(func() *zap.Logger { return zap.New(core) }),
+		fx.Populate(&got),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+	require.Len(t, got.Middlewares, 1)
+
+	var handlerLogger *zap.Logger
+	handler := fxhttp.ChainMiddlewares(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerLogger = interceptor.LoggerFromContext(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("Hello Stelling"))
+	}), got.Middlewares...)
+
+	t.Run("Should log one entry per request", func(t *testing.T) {
+		logs.TakeAll()
+		req := httptest.NewRequest(http.MethodGet, "/foo?bar=baz", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		entries := logs.FilterMessage("Handled request").All()
+		require.Len(t, entries, 1)
+		fields := entries[0].ContextMap()
+		require.Equal(t, "GET", fields["http.method"])
+		require.Equal(t, "/foo", fields["http.path"])
+		require.Equal(t, int64(http.StatusTeapot), fields["http.status"])
+		require.Contains(t, fields, "http.duration")
+		require.Equal(t, int64(len("Hello Stelling")), fields["http.response_size"])
+		require.Equal(t, "192.0.2.1:1234", fields["net.peer.address"])
+		require.NotEmpty(t, fields["otlp.trace_id"])
+		require.Equal(t, fields["otlp.trace_id"], rec.Header().Get("X-Trace-Id"))
+		require.NotNil(t, handlerLogger)
+	})
+
+	t.Run("Should not log the skipped paths", func(t *testing.T) {
+		logs.TakeAll()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+		require.Zero(t, logs.FilterMessage("Handled request").Len())
+	})
+}
+
+func TestWithLoggerFields(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	var got interceptors
+	app := fxtest.New(
+		t,
+		NewModule(&Logging{}),
+		WithLoggerFields(zap.String("service", "foo")),
+		WithLoggerFields(zap.String("region", "ch-gva-2")),
+		// Redirect the output of the logger to the observer
+		fx.Supply(fx.Annotate(
+			[]zap.Option{zap.WrapCore(func(zapcore.Core) zapcore.Core { return core })},
+			fx.ResultTags(`group:"zap_opts,flatten"`),
+		)),
+		fx.Populate(&got),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	requireFields := func(t *testing.T, entry observer.LoggedEntry) {
+		t.Helper()
+		require.Equal(t, "foo", entry.ContextMap()["service"])
+		require.Equal(t, "ch-gva-2", entry.ContextMap()["region"])
+	}
+
+	t.Run("Should add the fields to the logs of the application", func(t *testing.T) {
+		got.Logger.Info("Application log")
+
+		entries := logs.FilterMessage("Application log").All()
+		require.Len(t, entries, 1)
+		requireFields(t, entries[0])
+	})
+
+	t.Run("Should add the fields to the logs of the interceptors", func(t *testing.T) {
+		lis := bufconn.Listen(1024 * 1024)
+		server := grpc.NewServer(
+			fxgrpc.UnaryServerInterceptors(got.UnaryServer),
+			fxgrpc.StreamServerInterceptors(got.StreamServer),
+		)
+		pb.RegisterRouteGuideServer(server, pb.UnimplementedRouteGuideServer{})
+		go server.Serve(lis) //nolint:errcheck
+		defer server.Stop()
+
+		conn, err := fxgrpc.NewGrpcClient(
+			&fxgrpc.Client{InsecureConnection: true, Endpoint: "passthrough:///bufnet"},
+			zap.NewNop(), nil, nil,
+			grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		)
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		_, err = pb.NewRouteGuideClient(conn).GetFeature(context.Background(), &pb.Point{})
+		require.Error(t, err)
+
+		entries := logs.FilterMessage("finished call").All()
+		require.Len(t, entries, 1)
+		requireFields(t, entries[0])
+	})
+}
+
+func TestWithTraceContext(t *testing.T) {
+	t.Run("Should add the trace id of the active span", func(t *testing.T) {
+		traceID := oteltrace.TraceID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+		spanCtx := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     oteltrace.SpanID{0x01},
+			TraceFlags: oteltrace.FlagsSampled,
+		})
+		ctx := oteltrace.ContextWithSpanContext(context.Background(), spanCtx)
+		core, logs := observer.New(zapcore.InfoLevel)
+
+		WithTraceContext(ctx, zap.New(core)).Info("background work")
+
+		require.Equal(t, 1, logs.Len())
+		require.Equal(t, traceID.String(), logs.AllUntimed()[0].ContextMap()["otlp.trace_id"])
+	})
+
+	t.Run("Should not add a trace id without a trace", func(t *testing.T) {
+		core, logs := observer.New(zapcore.InfoLevel)
+
+		WithTraceContext(context.Background(), zap.New(core)).Info("background work")
+
+		require.Equal(t, 1, logs.Len())
+		require.NotContains(t, logs.AllUntimed()[0].ContextMap(), "otlp.trace_id")
+	})
+}
+
+func TestSummary(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	app := fxtest.New(
+		t,
+		NewModule(&Logging{}),
+		fxgrpc.NewServerModule(&fxgrpc.Server{Address: "localhost:0"}),
+		fxsentry.NewModule(&fxsentry.Sentry{Dsn: "https://secret@sentry.example.com/1"}),
+		// Redirect the output of the logger to the observer
+		fx.Supply(fx.Annotate(
+			[]zap.Option{zap.WrapCore(func(zapcore.Core) zapcore.Core { return core })},
+			fx.ResultTags(`group:"zap_opts,flatten"`),
+		)),
+	)
+	app.RequireStart().RequireStop()
+
+	entries := logs.FilterMessage("Stelling modules").All()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	conf, ok := fields["config"].(map[string]any)
+	require.True(t, ok)
+
+	t.Run("Should list the modules of the system", func(t *testing.T) {
+		require.Equal(t, []any{"grpc-server", "logging", "sentry"}, fields["modules"])
+		require.Contains(t, conf, "logging")
+	})
+
+	t.Run("Should add the interceptors to the grpc server", func(t *testing.T) {
+		server, ok := conf["grpc-server"].(map[string]any)
+		require.True(t, ok)
+		require.Equal(t, "localhost:0", server["address"])
+		chain := []any{"extract-trace-id(48)", "inject-logger(49)", "logging(50)"}
+		require.Equal(t, chain, server["unary-interceptors"])
+		require.Equal(t, chain, server["stream-interceptors"])
+	})
+
+	t.Run("Should redact the secrets", func(t *testing.T) {
+		sentry, ok := conf["sentry"].(map[string]any)
+		require.True(t, ok)
+		require.Equal(t, "https://xxxxx@sentry.example.com/1", sentry["dsn"])
+	})
+}
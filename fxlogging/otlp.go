@@ -0,0 +1,440 @@
+package fxlogging
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// OtlpLogs contains the configuration options to export logs to an OTLP collector
+// The shape of the configuration is the same as the one used by the tracing module
+type OtlpLogs struct {
+	// Enabled allows otlp log export to be toggled on and off
+	Enabled bool
+	// InsecureConnection indicates whether TLS needs to be disabled when connecting to the grpc server
+	InsecureConnection bool
+	// CertFile is the path to the pem encoded TLS certificate
+	CertFile string `validate:"required_with=KeyFile,omitempty,file"`
+	// KeyFile is the path to the pem encoded private key of the TLS certificate
+	KeyFile string `validate:"required_with=CertFile,omitempty,file"`
+	// RootCAFile is the  path to a pem encoded CA bundle used to validate server connections
+	RootCAFile string `validate:"omitempty,file"`
+	// Endpoint is the address + port where the collector can be reached
+	Endpoint string `validate:"required_if=Enabled true,omitempty,hostname_port"`
+}
+
+func (o *OtlpLogs) GrpcClientConfig() *fxgrpc.Client {
+	return &fxgrpc.Client{
+		InsecureConnection: o.InsecureConnection,
+		CertFile:           o.CertFile,
+		KeyFile:            o.KeyFile,
+		RootCAFile:         o.RootCAFile,
+		Endpoint:           o.Endpoint,
+	}
+}
+
+func (o *OtlpLogs) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if o == nil {
+		return nil
+	}
+
+	enc.AddBool("enabled", o.Enabled)
+	if o.Enabled {
+		enc.AddString("endpoint", o.Endpoint)
+		if err := o.GrpcClientConfig().ClientTLSConfig().MarshalLogObject(enc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const (
+	otlpLogsExportMethod  = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+	otlpLogsScopeName     = "github.com/exoscale/stelling/fxlogging"
+	otlpLogsQueueSize     = 2048
+	otlpLogsBatchSize     = 512
+	otlpLogsFlushInterval = 1 * time.Second
+	otlpLogsExportTimeout = 10 * time.Second
+)
+
+// newOtlpCore creates a zapcore.Core that exports all entries to the configured OTLP collector
+// The logger is used to report on export failures: it must not be teed to the returned core
+func newOtlpCore(conf *OtlpLogs, enab zapcore.LevelEnabler, lc fx.Lifecycle, logger *zap.Logger) (zapcore.Core, error) {
+	creds, r, err := fxgrpc.MakeClientTLS(conf, logger)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		lc.Append(fx.Hook{OnStart: r.Start, OnStop: r.Stop})
+	}
+
+	conn, err := grpc.NewClient(conf.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+
+	exporter := newOtlpLogExporter(conn, logger)
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			exporter.Start()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			// Closing the connection also cancels the export which outlived ctx
+			return errors.Join(exporter.Stop(ctx), conn.Close())
+		},
+	})
+
+	return &otlpCore{LevelEnabler: enab, exporter: exporter}, nil
+}
+
+// otlpCore is a zapcore.Core which converts log entries into OTLP log records
+type otlpCore struct {
+	zapcore.LevelEnabler
+
+	fields   []zapcore.Field
+	exporter *otlpLogExporter
+}
+
+func (c *otlpCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	clone.fields = append(clone.fields, c.fields...)
+	clone.fields = append(clone.fields, fields...)
+	return &clone
+}
+
+func (c *otlpCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *otlpCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	c.exporter.Enqueue(encodeLogRecord(ent, enc.Fields))
+	return nil
+}
+
+// Sync is a noop: records are flushed at regular intervals and when the system stops
+func (c *otlpCore) Sync() error {
+	return nil
+}
+
+// otlpLogExporter batches encoded log records and pushes them to the collector
+type otlpLogExporter struct {
+	conn     grpc.ClientConnInterface
+	logger   *zap.Logger
+	resource []byte
+
+	records chan []byte
+	// stop passes the context of Stop, which bounds the last flush
+	stop chan context.Context
+	wg   sync.WaitGroup
+}
+
+func newOtlpLogExporter(conn grpc.ClientConnInterface, logger *zap.Logger) *otlpLogExporter {
+	return &otlpLogExporter{
+		conn:     conn,
+		logger:   logger,
+		resource: encodeResource(resource.Default()),
+		records:  make(chan []byte, otlpLogsQueueSize),
+		stop:     make(chan context.Context, 1),
+	}
+}
+
+// Enqueue adds the record to the next batch
+// Records are dropped when the queue is full, logging must never block the caller
+func (e *otlpLogExporter) Enqueue(record []byte) {
+	select {
+	case e.records <- record:
+	default:
+	}
+}
+
+func (e *otlpLogExporter) Start() {
+	e.wg.Add(1)
+	go e.run()
+}
+
+// Stop flushes all queued records
+// The flush is bounded by ctx: the records which are not exported by then are dropped
+func (e *otlpLogExporter) Stop(ctx context.Context) error {
+	e.stop <- ctx
+
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *otlpLogExporter) run() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(otlpLogsFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([][]byte, 0, otlpLogsBatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(ctx, batch); err != nil {
+			e.logger.Warn("Failed to export logs", zap.Int("records", len(batch)), zap.Error(err))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case record := <-e.records:
+			batch = append(batch, record)
+			if len(batch) >= otlpLogsBatchSize {
+				flush(context.Background())
+			}
+		case <-ticker.C:
+			flush(context.Background())
+		case ctx := <-e.stop:
+			for ctx.Err() == nil {
+				select {
+				case record := <-e.records:
+					batch = append(batch, record)
+					if len(batch) >= otlpLogsBatchSize {
+						flush(ctx)
+					}
+				default:
+					flush(ctx)
+					return
+				}
+			}
+			e.logger.Warn("Failed to export logs before shutdown", zap.Int("records", len(batch)+len(e.records)), zap.Error(ctx.Err()))
+			return
+		}
+	}
+}
+
+func (e *otlpLogExporter) export(ctx context.Context, records [][]byte) error {
+	ctx, cancel := context.WithTimeout(ctx, otlpLogsExportTimeout)
+	defer cancel()
+
+	req := otlpLogsMessage(encodeExportLogsRequest(e.resource, records))
+	return e.conn.Invoke(ctx, otlpLogsExportMethod, &req, &otlpLogsMessage{})
+}
+
+// otlpLogsMessage holds a protobuf encoded OTLP message
+// It implements the vtproto interface so the codec registered by fxgrpc sends it as-is
+type otlpLogsMessage []byte
+
+func (m *otlpLogsMessage) SizeVT() int {
+	return len(*m)
+}
+
+func (m *otlpLogsMessage) MarshalToSizedBufferVT(data []byte) (int, error) {
+	return copy(data, *m), nil
+}
+
+func (m *otlpLogsMessage) UnmarshalVT(data []byte) error {
+	*m = append((*m)[:0], data...)
+	return nil
+}
+
+// The OTLP logs protos aren't part of our dependencies, so the messages are encoded by hand
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/logs/v1/logs.proto
+
+func encodeExportLogsRequest(resource []byte, records [][]byte) []byte {
+	scope, _ := proto.Marshal(&commonpb.InstrumentationScope{Name: otlpLogsScopeName})
+
+	var scopeLogs []byte
+	scopeLogs = protowire.AppendTag(scopeLogs, 1, protowire.BytesType)
+	scopeLogs = protowire.AppendBytes(scopeLogs, scope)
+	for _, record := range records {
+		scopeLogs = protowire.AppendTag(scopeLogs, 2, protowire.BytesType)
+		scopeLogs = protowire.AppendBytes(scopeLogs, record)
+	}
+
+	var resourceLogs []byte
+	resourceLogs = protowire.AppendTag(resourceLogs, 1, protowire.BytesType)
+	resourceLogs = protowire.AppendBytes(resourceLogs, resource)
+	resourceLogs = protowire.AppendTag(resourceLogs, 2, protowire.BytesType)
+	resourceLogs = protowire.AppendBytes(resourceLogs, scopeLogs)
+
+	var req []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	req = protowire.AppendBytes(req, resourceLogs)
+	return req
+}
+
+func encodeResource(r *resource.Resource) []byte {
+	res := &resourcepb.Resource{}
+	for _, kv := range r.Attributes() {
+		res.Attributes = append(res.Attributes, &commonpb.KeyValue{
+			Key:   string(kv.Key),
+			Value: anyValue(attributeValue(kv.Value)),
+		})
+	}
+	b, _ := proto.Marshal(res)
+	return b
+}
+
+func attributeValue(v attribute.Value) any {
+	switch v.Type() {
+	case attribute.BOOL:
+		return v.AsBool()
+	case attribute.INT64:
+		return v.AsInt64()
+	case attribute.FLOAT64:
+		return v.AsFloat64()
+	default:
+		return v.Emit()
+	}
+}
+
+func encodeLogRecord(ent zapcore.Entry, fields map[string]any) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(ent.Time.UnixNano()))
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, severityNumber(ent.Level))
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendString(b, ent.Level.CapitalString())
+
+	body, _ := proto.Marshal(anyValue(ent.Message))
+	b = protowire.AppendTag(b, 5, protowire.BytesType)
+	b = protowire.AppendBytes(b, body)
+
+	if ent.LoggerName != "" {
+		fields["logger.name"] = ent.LoggerName
+	}
+	if ent.Caller.Defined {
+		fields["code.filepath"] = ent.Caller.File
+		fields["code.lineno"] = ent.Caller.Line
+	}
+	if ent.Stack != "" {
+		fields["exception.stacktrace"] = ent.Stack
+	}
+	for k, v := range fields {
+		attr, _ := proto.Marshal(&commonpb.KeyValue{Key: k, Value: anyValue(v)})
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, attr)
+	}
+
+	// Correlate the record with the trace set by the logging interceptors
+	if traceid, ok := fields["otlp.trace_id"].(string); ok {
+		if id, err := hex.DecodeString(traceid); err == nil && len(id) == 16 {
+			b = protowire.AppendTag(b, 9, protowire.BytesType)
+			b = protowire.AppendBytes(b, id)
+		}
+	}
+
+	b = protowire.AppendTag(b, 11, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(time.Now().UnixNano()))
+	return b
+}
+
+// severityNumber maps zap levels onto the OTLP SeverityNumber enum
+func severityNumber(lvl zapcore.Level) uint64 {
+	switch lvl {
+	case zapcore.DebugLevel:
+		return 5
+	case zapcore.InfoLevel:
+		return 9
+	case zapcore.WarnLevel:
+		return 13
+	case zapcore.ErrorLevel:
+		return 17
+	case zapcore.DPanicLevel:
+		return 18
+	case zapcore.PanicLevel:
+		return 19
+	case zapcore.FatalLevel:
+		return 21
+	default:
+		return 0
+	}
+}
+
+// anyValue converts the values produced by a zapcore.MapObjectEncoder into an OTLP AnyValue
+func anyValue(v any) *commonpb.AnyValue {
+	switch v := v.(type) {
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v}}
+	case int:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case int8:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case int16:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case int32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case int64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v}}
+	case uint8:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case uint16:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case uint32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case uint64:
+		if v > math.MaxInt64 {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprint(v)}}
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case float32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: float64(v)}}
+	case float64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v}}
+	case []byte:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: v}}
+	case time.Time:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.UTC().Format(time.RFC3339Nano)}}
+	case time.Duration:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.String()}}
+	case []any:
+		values := make([]*commonpb.AnyValue, 0, len(v))
+		for _, item := range v {
+			values = append(values, anyValue(item))
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+	case map[string]any:
+		kvs := make([]*commonpb.KeyValue, 0, len(v))
+		for key, item := range v {
+			kvs = append(kvs, &commonpb.KeyValue{Key: key, Value: anyValue(item)})
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: kvs}}}
+	default:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprint(v)}}
+	}
+}
@@ -0,0 +1,175 @@
+package fxlogging
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeLogSink is an OTLP collector which records all exported requests
+type fakeLogSink struct {
+	lock     sync.Mutex
+	methods  []string
+	requests [][]byte
+}
+
+func (s *fakeLogSink) handler(srv any, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	var req otlpLogsMessage
+	if err := stream.RecvMsg(&req); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.methods = append(s.methods, method)
+	s.requests = append(s.requests, req)
+	s.lock.Unlock()
+
+	return stream.SendMsg(&otlpLogsMessage{})
+}
+
+// bytesFields returns the values of all length delimited fields with the given number
+func bytesFields(t *testing.T, b []byte, num protowire.Number) [][]byte {
+	var out [][]byte
+	for len(b) > 0 {
+		n, typ, l := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, l, 0)
+		b = b[l:]
+		if n == num && typ == protowire.BytesType {
+			v, l := protowire.ConsumeBytes(b)
+			require.GreaterOrEqual(t, l, 0)
+			out = append(out, v)
+		}
+		l = protowire.ConsumeFieldValue(n, typ, b)
+		require.GreaterOrEqual(t, l, 0)
+		b = b[l:]
+	}
+	return out
+}
+
+type logRecord struct {
+	body       string
+	attributes map[string]*commonpb.AnyValue
+	traceId    []byte
+}
+
+func (s *fakeLogSink) records(t *testing.T) []logRecord {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var records []logRecord
+	for _, req := range s.requests {
+		for _, resourceLogs := range bytesFields(t, req, 1) {
+			for _, scopeLogs := range bytesFields(t, resourceLogs, 2) {
+				for _, record := range bytesFields(t, scopeLogs, 2) {
+					r := logRecord{attributes: map[string]*commonpb.AnyValue{}}
+
+					body := &commonpb.AnyValue{}
+					require.NoError(t, proto.Unmarshal(bytesFields(t, record, 5)[0], body))
+					r.body = body.GetStringValue()
+
+					for _, attr := range bytesFields(t, record, 6) {
+						kv := &commonpb.KeyValue{}
+						require.NoError(t, proto.Unmarshal(attr, kv))
+						r.attributes[kv.Key] = kv.Value
+					}
+
+					if ids := bytesFields(t, record, 9); len(ids) > 0 {
+						r.traceId = ids[0]
+					}
+					records = append(records, r)
+				}
+			}
+		}
+	}
+	return records
+}
+
+func TestOtlpLogs(t *testing.T) {
+	sink := &fakeLogSink{}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(sink.handler))
+	go srv.Serve(lis) //nolint:errcheck
+	defer srv.Stop()
+
+	conf := &Logging{
+		Mode: "production",
+		Otlp: OtlpLogs{
+			Enabled:            true,
+			InsecureConnection: true,
+			Endpoint:           lis.Addr().String(),
+		},
+	}
+	lc := fxtest.NewLifecycle(t)
+	logger, err := NewLogger(conf, lc)
+	require.NoError(t, err)
+	lc.RequireStart()
+
+	traceId := "0102030405060708090a0b0c0d0e0f10"
+	logger.Info("Hello otlp", zap.String("otlp.trace_id", traceId), zap.Int("answer", 42))
+	logger.Debug("Not enabled in production mode")
+
+	// Stopping the system flushes all pending records
+	lc.RequireStop()
+
+	sink.lock.Lock()
+	require.NotEmpty(t, sink.methods)
+	for _, method := range sink.methods {
+		require.Equal(t, otlpLogsExportMethod, method)
+	}
+	sink.lock.Unlock()
+
+	var found *logRecord
+	for _, r := range sink.records(t) {
+		require.NotEqual(t, "Not enabled in production mode", r.body)
+		if r.body == "Hello otlp" {
+			found = &r
+		}
+	}
+	require.NotNil(t, found, "the log entry should reach the collector")
+	require.Equal(t, int64(42), found.attributes["answer"].GetIntValue())
+	require.Equal(t, traceId, found.attributes["otlp.trace_id"].GetStringValue())
+	require.Equal(t, traceId, hex.EncodeToString(found.traceId))
+}
+
+func TestOtlpLogExporterStop(t *testing.T) {
+	// The collector never answers, so the exports only return when their context is done
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(srv any, stream grpc.ServerStream) error {
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	}))
+	go srv.Serve(lis) //nolint:errcheck
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	exporter := newOtlpLogExporter(conn, zap.NewNop())
+	exporter.Start()
+	exporter.Enqueue([]byte{})
+
+	t.Run("Should bound the flush with the context of Stop", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_ = exporter.Stop(ctx)
+		require.Less(t, time.Since(start), otlpLogsExportTimeout/2)
+	})
+}
@@ -0,0 +1,85 @@
+// Package summary logs a single line listing the stelling modules of the system and their configuration.
+// It only depends on fx and zap, so every module can register itself without depending on the logging module.
+package summary
+
+import (
+	"net/url"
+	"sort"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Group is the tag of the value group of the modules in the summary
+const Group = `group:"stelling_modules"`
+
+// Redacted replaces the secrets in the summary
+const Redacted = "xxxxx"
+
+// Module describes a stelling module in the summary
+type Module struct {
+	// Name identifies the module, eg: grpc-server or http-server:metrics
+	Name string
+	// Config holds the key configuration values of the module, it may be nil
+	// It must not log secrets: see RedactURL
+	Config zapcore.ObjectMarshaler
+}
+
+// Provide adds the module with the given name and configuration to the summary
+func Provide(name string, conf zapcore.ObjectMarshaler) fx.Option {
+	return ProvideFunc(func() Module { return Module{Name: name, Config: conf} })
+}
+
+// ProvideFunc adds the module returned by the constructor to the summary
+// This allows the entry to depend on other values of the system, eg: the interceptors of a grpc server
+func ProvideFunc(constructor any) fx.Option {
+	return fx.Provide(fx.Annotate(constructor, fx.ResultTags(Group)))
+}
+
+// modules marshals the configuration of each module under its name
+type modules []Module
+
+func (m modules) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, mod := range m {
+		if mod.Config == nil {
+			continue
+		}
+		if err := enc.AddObject(mod.Name, mod.Config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LogSummary logs the modules of the system, sorted by name, in a single line
+func LogSummary(logger *zap.Logger, mods []Module) {
+	sorted := append(modules(nil), mods...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	names := make([]string, 0, len(sorted))
+	for _, mod := range sorted {
+		names = append(names, mod.Name)
+	}
+	logger.Info(
+		"Stelling modules",
+		zap.Strings("modules", names),
+		zap.Object("config", sorted),
+	)
+}
+
+// RedactURL hides the credentials of the given url, eg: the key of a sentry dsn
+// Strings which can not be parsed are fully redacted, as they may still contain secrets
+func RedactURL(raw string) string {
+	if raw == "" {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Redacted
+	}
+	if u.User == nil {
+		return raw
+	}
+	u.User = url.User(Redacted)
+	return u.String()
+}
@@ -0,0 +1,30 @@
+package fxmetrics
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.uber.org/fx"
+)
+
+// AdminAuth authenticates the requests to the admin endpoints of the metrics server, eg: /loglevel
+// It must reject the unauthorized requests itself
+type AdminAuth func(http.Handler) http.Handler
+
+// WithAdminAuth protects the admin endpoints of the metrics server with the given middleware
+func WithAdminAuth(auth func(http.Handler) http.Handler) fx.Option {
+	return fx.Supply(AdminAuth(auth))
+}
+
+// adminHandler returns h protected for the admin endpoint at path
+// The endpoint can change the behavior of the system, so it is only served when the clients are authenticated:
+// either by the AdminAuth middleware, or by their certificate when the server verifies them
+func adminHandler(conf *Metrics, auth AdminAuth, path string, h http.Handler) (http.Handler, error) {
+	if auth != nil {
+		return auth(h), nil
+	}
+	if conf.Server.TLS && conf.Server.ClientCAFile != "" {
+		return h, nil
+	}
+	return nil, fmt.Errorf("refusing to serve %s without authentication: set the TLS and ClientCAFile options of the metrics server, or use fxmetrics.WithAdminAuth", path)
+}
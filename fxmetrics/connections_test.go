@@ -0,0 +1,79 @@
+package fxmetrics
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func connectionsValue(t *testing.T, reg *prometheus.Registry) float64 {
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == "grpc_server_connections" {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestGrpcConnections(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	stats := fxgrpc.NewServerStats()
+	// The connections of all the servers are summed
+	require.NoError(t, RegisterGrpcServerStats(GrpcServerStatsParams{Reg: reg, Stats: []*fxgrpc.ServerStats{stats, fxgrpc.NewServerStats()}}))
+
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.StatsHandler(stats))
+	go server.Serve(lis) //nolint:errcheck
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(
+		"passthrough://bufconn",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 0.0, connectionsValue(t, reg))
+
+	conn.Connect()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+		require.True(t, conn.WaitForStateChange(ctx, state))
+	}
+	require.Eventually(t, func() bool { return connectionsValue(t, reg) == 1.0 }, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, conn.Close())
+	require.Eventually(t, func() bool { return connectionsValue(t, reg) == 0.0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestGrpcServerStatsOfTheServerModules(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	var stats []*fxgrpc.ServerStats
+	app := fxtest.New(
+		t,
+		fxgrpc.NewServerModule(&fxgrpc.Server{Address: "127.0.0.1:0"}),
+		fxgrpc.NewServerModule(&fxgrpc.Server{Address: "127.0.0.1:0"}, fxgrpc.WithServerModuleName("admin")),
+		fx.Supply(reg, zap.NewNop()),
+		fx.Provide(func(reg *prometheus.Registry) prometheus.Registerer { return reg }),
+		fx.Invoke(RegisterGrpcServerStats),
+		fx.Populate(fx.Annotate(&stats, fx.ParamTags(fxgrpc.ServerStatsGroup))),
+	)
+	defer app.RequireStart().RequireStop()
+
+	require.Len(t, stats, 2)
+	require.Equal(t, 0.0, connectionsValue(t, reg))
+}
@@ -0,0 +1,68 @@
+package fxmetrics
+
+import (
+	"context"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/fx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+type GrpcExpiredInterceptorsResult struct {
+	fx.Out
+
+	*fxgrpc.UnaryServerInterceptor  `group:"unary_server_interceptor"`
+	*fxgrpc.StreamServerInterceptor `group:"stream_server_interceptor"`
+}
+
+// NewGrpcExpiredInterceptors provides server interceptors that count the requests whose context is
+// already done (expired or cancelled) before reaching the handler
+// When RejectExpiredRequests is set, those requests are rejected without invoking the handler
+func NewGrpcExpiredInterceptors(conf MetricsConfig, reg prometheus.Registerer) (GrpcExpiredInterceptorsResult, error) {
+	expired := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_expired_requests_total",
+		Help: "Total number of gRPC requests whose context was done before reaching the handler.",
+	}, []string{"grpc_service", "grpc_method"})
+	if err := Register(reg, expired); err != nil {
+		return GrpcExpiredInterceptorsResult{}, err
+	}
+	reject := conf.MetricsConfig().RejectExpiredRequests
+
+	// checkExpired returns an error if the request must be rejected
+	checkExpired := func(ctx context.Context, fullMethod string) error {
+		err := ctx.Err()
+		if err == nil {
+			return nil
+		}
+		expired.WithLabelValues(splitMethodName(fullMethod)).Inc()
+		if !reject {
+			return nil
+		}
+		return status.FromContextError(err).Err()
+	}
+
+	return GrpcExpiredInterceptorsResult{
+		UnaryServerInterceptor: &fxgrpc.UnaryServerInterceptor{
+			Name:   "metrics-expired",
+			Weight: GrpcInterceptorWeight,
+			Interceptor: func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				if err := checkExpired(ctx, info.FullMethod); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			},
+		},
+		StreamServerInterceptor: &fxgrpc.StreamServerInterceptor{
+			Name:   "metrics-expired",
+			Weight: GrpcInterceptorWeight,
+			Interceptor: func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := checkExpired(ss.Context(), info.FullMethod); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			},
+		},
+	}, nil
+}
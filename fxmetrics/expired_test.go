@@ -0,0 +1,94 @@
+package fxmetrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func expiredValue(t *testing.T, reg *prometheus.Registry) float64 {
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == "grpc_server_expired_requests_total" {
+			require.Len(t, family.GetMetric(), 1)
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestGrpcExpiredInterceptors(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/routeguide.RouteGuide/GetFeature"}
+
+	expiredCtx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := []struct {
+		name           string
+		ctx            context.Context
+		reject         bool
+		expectedCalled bool
+		expectedCode   codes.Code
+		expectedCount  float64
+	}{
+		{
+			name:           "Should invoke the handler for live requests",
+			ctx:            context.Background(),
+			reject:         true,
+			expectedCalled: true,
+			expectedCode:   codes.OK,
+			expectedCount:  0,
+		},
+		{
+			name:           "Should reject requests past their deadline",
+			ctx:            expiredCtx,
+			reject:         true,
+			expectedCalled: false,
+			expectedCode:   codes.DeadlineExceeded,
+			expectedCount:  1,
+		},
+		{
+			name:           "Should reject cancelled requests",
+			ctx:            cancelledCtx,
+			reject:         true,
+			expectedCalled: false,
+			expectedCode:   codes.Canceled,
+			expectedCount:  1,
+		},
+		{
+			name:           "Should only count expired requests when rejection is disabled",
+			ctx:            expiredCtx,
+			reject:         false,
+			expectedCalled: true,
+			expectedCode:   codes.OK,
+			expectedCount:  1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			res, err := NewGrpcExpiredInterceptors(&Metrics{RejectExpiredRequests: tc.reject}, reg)
+			require.NoError(t, err)
+
+			called := false
+			handler := func(ctx context.Context, req any) (any, error) {
+				called = true
+				return nil, nil
+			}
+			_, err = res.UnaryServerInterceptor.Interceptor(tc.ctx, nil, info, handler)
+			require.Equal(t, tc.expectedCode, status.Code(err))
+			require.Equal(t, tc.expectedCalled, called)
+			require.Equal(t, tc.expectedCount, expiredValue(t, reg))
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package fxmetrics
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/exoscale/stelling/fxhttp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/fx"
+)
+
+// HttpPathNormalizer returns the value of the path label of a request
+// It is called after the request is handled, and must collapse high cardinality paths, eg: /users/{id}
+type HttpPathNormalizer func(r *http.Request) string
+
+// DefaultHttpPathNormalizer uses the pattern of the http.ServeMux route that handled the request
+// Requests which were not routed by a ServeMux are labeled "other"
+func DefaultHttpPathNormalizer(r *http.Request) string {
+	if r.Pattern == "" {
+		return "other"
+	}
+	// A pattern has the form [METHOD ][HOST]/[PATH]
+	pattern := r.Pattern
+	if i := strings.Index(pattern, " "); i >= 0 {
+		pattern = strings.TrimLeft(pattern[i:], " ")
+	}
+	if i := strings.Index(pattern, "/"); i >= 0 {
+		pattern = pattern[i:]
+	}
+	return pattern
+}
+
+const HttpMiddlewareWeight = 60
+
+type HttpMiddlewareParams struct {
+	fx.In
+
+	Conf       MetricsConfig
+	Reg        prometheus.Registerer
+	Normalizer HttpPathNormalizer `optional:"true"`
+}
+
+type requestCtxKey struct{}
+
+// requestRef gives the path label access to the request seen by the inner handlers
+type requestRef struct {
+	r *http.Request
+}
+
+// NewHttpMiddleware provides a middleware that counts and times the requests handled by the main http server,
+// by method, path and status code
+func NewHttpMiddleware(p HttpMiddlewareParams) (*fxhttp.Middleware, error) {
+	labels := []string{"code", "method", "path"}
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Total number of HTTP requests handled by the server.",
+	}, labels)
+	buckets := prometheus.DefBuckets
+	if conf := p.Conf.MetricsConfig(); len(conf.HistogramBuckets) > 0 {
+		buckets = conf.HistogramBuckets
+	}
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Histogram of the response latency (seconds) of HTTP requests handled by the server.",
+		Buckets: buckets,
+	}, labels)
+	for _, c := range []prometheus.Collector{requests, duration} {
+		if err := Register(p.Reg, c); err != nil {
+			return nil, err
+		}
+	}
+
+	normalizer := p.Normalizer
+	if normalizer == nil {
+		normalizer = DefaultHttpPathNormalizer
+	}
+	opts := []promhttp.Option{
+		// The label is resolved after the request is handled, so the route of the mux is known
+		promhttp.WithLabelFromCtx("path", func(ctx context.Context) string {
+			return normalizer(ctx.Value(requestCtxKey{}).(*requestRef).r)
+		}),
+	}
+	if p.Conf.MetricsConfig().Exemplars {
+		opts = append(opts, promhttp.WithExemplarFromContext(traceExemplar))
+	}
+
+	return &fxhttp.Middleware{
+		Name:   "metrics",
+		Weight: HttpMiddlewareWeight,
+		Middleware: func(h http.Handler) http.Handler {
+			instrumented := promhttp.InstrumentHandlerDuration(duration, promhttp.InstrumentHandlerCounter(requests, h, opts...), opts...)
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// The mux sets the Pattern on the request it is given, which is only reachable through its context
+				ref := &requestRef{}
+				r = r.WithContext(context.WithValue(r.Context(), requestCtxKey{}, ref))
+				ref.r = r
+				instrumented.ServeHTTP(w, r)
+			})
+		},
+	}, nil
+}
@@ -0,0 +1,72 @@
+package fxmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// requestCounts returns the value of the http_requests_total series, keyed by code,method,path
+func requestCounts(t *testing.T, reg *prometheus.Registry) map[string]float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	counts := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "http_requests_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			counts[strings.Join([]string{labels["code"], labels["method"], labels["path"]}, ",")] = m.GetCounter().GetValue()
+		}
+	}
+	return counts
+}
+
+func TestNewHttpMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	t.Run("Should count the requests by code, method and route pattern", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		mw, err := NewHttpMiddleware(HttpMiddlewareParams{Conf: &Metrics{}, Reg: reg})
+		require.NoError(t, err)
+		handler := mw.Middleware(mux)
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/2", nil))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+		require.Equal(t, map[string]float64{
+			"202,get,/users/{id}": 2,
+			"404,get,other":       1,
+		}, requestCounts(t, reg))
+	})
+
+	t.Run("Should use the path normalizer", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		mw, err := NewHttpMiddleware(HttpMiddlewareParams{
+			Conf: &Metrics{},
+			Reg:  reg,
+			Normalizer: func(r *http.Request) string {
+				return strings.Join(strings.SplitN(r.URL.Path, "/", 3)[:2], "/")
+			},
+		})
+		require.NoError(t, err)
+		handler := mw.Middleware(mux)
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users/1", nil))
+
+		require.Equal(t, map[string]float64{"405,post,/users": 1}, requestCounts(t, reg))
+	})
+}
@@ -0,0 +1,74 @@
+package fxmetrics
+
+import (
+	"strings"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/fx"
+)
+
+type GrpcServerStatsParams struct {
+	fx.In
+
+	Reg   prometheus.Registerer
+	Stats []*fxgrpc.ServerStats `group:"grpc_server_stats"`
+}
+
+// RegisterGrpcServerStats registers gauges that track the number of requests currently being handled,
+// by service and method, and the number of transport connections currently open on the gRPC servers
+// They are read from the fxgrpc.ServerStats of the servers, which also log the progress of their graceful stop
+func RegisterGrpcServerStats(p GrpcServerStatsParams) error {
+	return Register(p.Reg, &grpcServerStatsCollector{
+		stats: p.Stats,
+		inFlight: prometheus.NewDesc(
+			"grpc_server_in_flight_requests",
+			"Number of gRPC requests currently being handled by the server.",
+			[]string{"grpc_service", "grpc_method"}, nil,
+		),
+		connections: prometheus.NewDesc(
+			"grpc_server_connections",
+			"Number of gRPC connections currently open on the server.",
+			nil, nil,
+		),
+	})
+}
+
+// grpcServerStatsCollector sums the counts of the ServerStats of all the servers
+type grpcServerStatsCollector struct {
+	stats       []*fxgrpc.ServerStats
+	inFlight    *prometheus.Desc
+	connections *prometheus.Desc
+}
+
+func (c *grpcServerStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.inFlight
+	ch <- c.connections
+}
+
+func (c *grpcServerStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	connections := int64(0)
+	inFlight := map[string]int64{}
+	for _, s := range c.stats {
+		connections += s.Connections()
+		for method, count := range s.InFlightRequestsByMethod() {
+			inFlight[method] += count
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, float64(connections))
+	for method, count := range inFlight {
+		service, name := splitMethodName(method)
+		ch <- prometheus.MustNewConstMetric(c.inFlight, prometheus.GaugeValue, float64(count), service, name)
+	}
+}
+
+// splitMethodName splits a full method name of the form /package.Service/Method
+// into its service and method parts
+func splitMethodName(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", "unknown"
+}
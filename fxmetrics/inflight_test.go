@@ -0,0 +1,161 @@
+package fxmetrics
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/exoscale/stelling/fxgrpc/grpctest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type blockingRouteGuideServer struct {
+	pb.UnimplementedRouteGuideServer
+
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingRouteGuideServer) GetFeature(ctx context.Context, req *pb.Point) (*pb.Feature, error) {
+	s.started <- struct{}{}
+	<-s.release
+	return &pb.Feature{}, nil
+}
+
+func inFlightValue(t *testing.T, reg *prometheus.Registry, service, method string) float64 {
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "grpc_server_in_flight_requests" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["grpc_service"] == service && labels["grpc_method"] == method {
+				return m.GetGauge().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestGrpcInFlightRequests(t *testing.T) {
+	var client pb.RouteGuideClient
+	reg := prometheus.NewRegistry()
+	server := &blockingRouteGuideServer{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+
+	app := fxtest.New(t, fx.Options(
+		grpctest.Module,
+		fx.Supply(reg, zaptest.NewLogger(t)),
+		fx.Supply(fx.Annotate(&Metrics{}, fx.As(new(MetricsConfig)))),
+		fx.Provide(
+			NewPrometheusRegisterer,
+			func() pb.RouteGuideServer { return server },
+			pb.NewRouteGuideClient,
+		),
+		fx.Invoke(pb.RegisterRouteGuideServer, RegisterGrpcServerStats),
+		fx.Populate(&client),
+	))
+	defer app.RequireStart().RequireStop()
+
+	errs := make(chan error)
+	go func() {
+		_, err := client.GetFeature(context.Background(), &pb.Point{})
+		errs <- err
+	}()
+
+	<-server.started
+	require.Equal(t, 1.0, inFlightValue(t, reg, "routeguide.RouteGuide", "GetFeature"))
+
+	close(server.release)
+	require.NoError(t, <-errs)
+	require.Equal(t, 0.0, inFlightValue(t, reg, "routeguide.RouteGuide", "GetFeature"))
+}
+
+func TestGrpcInFlightRequestsDuringGracefulStop(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	stats := fxgrpc.NewServerStats()
+	require.NoError(t, RegisterGrpcServerStats(GrpcServerStatsParams{Reg: reg, Stats: []*fxgrpc.ServerStats{stats}}))
+	server := &blockingRouteGuideServer{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	s := grpc.NewServer(grpc.StatsHandler(stats))
+	pb.RegisterRouteGuideServer(s, server)
+	lis := bufconn.Listen(1024 * 1024)
+	go s.Serve(lis) //nolint:errcheck
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	errs := make(chan error)
+	go func() {
+		_, err := pb.NewRouteGuideClient(conn).GetFeature(context.Background(), &pb.Point{})
+		errs <- err
+	}()
+	<-server.started
+
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	// The request is still being handled while the server drains
+	require.Never(t, func() bool {
+		select {
+		case <-stopped:
+			return true
+		default:
+			return false
+		}
+	}, 50*time.Millisecond, 5*time.Millisecond)
+	require.Equal(t, 1.0, inFlightValue(t, reg, "routeguide.RouteGuide", "GetFeature"))
+
+	close(server.release)
+	require.NoError(t, <-errs)
+	<-stopped
+	require.Equal(t, 0.0, inFlightValue(t, reg, "routeguide.RouteGuide", "GetFeature"))
+}
+
+func TestSplitMethodName(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		service string
+		method  string
+	}{
+		{"Should split a full method name", "/routeguide.RouteGuide/GetFeature", "routeguide.RouteGuide", "GetFeature"},
+		{"Should handle a missing leading slash", "routeguide.RouteGuide/GetFeature", "routeguide.RouteGuide", "GetFeature"},
+		{"Should return unknown for malformed names", "GetFeature", "unknown", "unknown"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			service, method := splitMethodName(tc.input)
+			require.Equal(t, tc.service, service)
+			require.Equal(t, tc.method, method)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package fxmetrics
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/fx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataLabel labels the requests of the metadata metrics with the value of a metadata key of the request
+type MetadataLabel struct {
+	// Name is the name of the label, eg: tenant
+	Name string
+	// Key is the metadata key from which the value is read, eg: x-tenant-id
+	Key string
+	// Allowed are the values used as label, which bounds the cardinality of the metrics
+	// Other values are labeled "other", and a missing metadata key is labeled ""
+	Allowed []string
+}
+
+// MetadataLabelOther is the value of a MetadataLabel when the metadata value is not allowed
+const MetadataLabelOther = "other"
+
+// WithMetadataLabels labels the metadata metrics of the grpc servers with the given metadata keys
+// The metadata metrics are only registered when at least one label is provided
+func WithMetadataLabels(labels ...MetadataLabel) fx.Option {
+	return fx.Provide(
+		fx.Annotate(
+			func() []MetadataLabel { return labels },
+			fx.ResultTags(`group:"metrics_metadata_labels,flatten"`),
+		),
+	)
+}
+
+type GrpcMetadataInterceptorsParams struct {
+	fx.In
+
+	Conf   MetricsConfig
+	Reg    prometheus.Registerer
+	Labels []MetadataLabel `group:"metrics_metadata_labels"`
+}
+
+type GrpcMetadataInterceptorsResult struct {
+	fx.Out
+
+	*fxgrpc.UnaryServerInterceptor  `group:"unary_server_interceptor"`
+	*fxgrpc.StreamServerInterceptor `group:"stream_server_interceptor"`
+}
+
+// NewGrpcMetadataInterceptors provides server interceptors that count and time the requests
+// by method, code and the configured metadata labels
+// No interceptors are provided when no labels are configured
+func NewGrpcMetadataInterceptors(p GrpcMetadataInterceptorsParams) (GrpcMetadataInterceptorsResult, error) {
+	if len(p.Labels) == 0 {
+		return GrpcMetadataInterceptorsResult{}, nil
+	}
+
+	labelNames := []string{"grpc_service", "grpc_method", "grpc_code"}
+	for _, l := range p.Labels {
+		if l.Name == "" || l.Key == "" {
+			return GrpcMetadataInterceptorsResult{}, fmt.Errorf("metadata label %q: the name and key are required", l.Name)
+		}
+		if len(l.Allowed) == 0 {
+			return GrpcMetadataInterceptorsResult{}, fmt.Errorf("metadata label %q: at least one allowed value is required", l.Name)
+		}
+		if slices.Contains(labelNames, l.Name) {
+			return GrpcMetadataInterceptorsResult{}, fmt.Errorf("metadata label %q: the label is already used", l.Name)
+		}
+		labelNames = append(labelNames, l.Name)
+	}
+
+	handled := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_metadata_handled_total",
+		Help: "Total number of RPCs completed on the server, labeled by request metadata.",
+	}, labelNames)
+	buckets := prometheus.DefBuckets
+	if conf := p.Conf.MetricsConfig(); len(conf.HistogramBuckets) > 0 {
+		buckets = conf.HistogramBuckets
+	}
+	handling := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_metadata_handling_seconds",
+		Help:    "Histogram of response latency (seconds) of RPCs handled by the server, labeled by request metadata.",
+		Buckets: buckets,
+	}, labelNames)
+	for _, c := range []prometheus.Collector{handled, handling} {
+		if err := Register(p.Reg, c); err != nil {
+			return GrpcMetadataInterceptorsResult{}, err
+		}
+	}
+
+	labels := p.Labels
+	observe := func(ctx context.Context, fullMethod string, start time.Time, err error) {
+		service, method := splitMethodName(fullMethod)
+		values := []string{service, method, status.Code(err).String()}
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, l := range labels {
+			values = append(values, metadataLabelValue(md, l))
+		}
+		handled.WithLabelValues(values...).Inc()
+		handling.WithLabelValues(values...).Observe(time.Since(start).Seconds())
+	}
+
+	return GrpcMetadataInterceptorsResult{
+		UnaryServerInterceptor: &fxgrpc.UnaryServerInterceptor{
+			Name:   "metrics-metadata",
+			Weight: GrpcInterceptorWeight,
+			Interceptor: func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				start := time.Now()
+				resp, err := handler(ctx, req)
+				observe(ctx, info.FullMethod, start, err)
+				return resp, err
+			},
+		},
+		StreamServerInterceptor: &fxgrpc.StreamServerInterceptor{
+			Name:   "metrics-metadata",
+			Weight: GrpcInterceptorWeight,
+			Interceptor: func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				start := time.Now()
+				err := handler(srv, ss)
+				observe(ss.Context(), info.FullMethod, start, err)
+				return err
+			},
+		},
+	}, nil
+}
+
+// metadataLabelValue returns the value of the label l for a request with the metadata md
+func metadataLabelValue(md metadata.MD, l MetadataLabel) string {
+	values := md.Get(strings.ToLower(l.Key))
+	if len(values) == 0 {
+		return ""
+	}
+	if slices.Contains(l.Allowed, values[0]) {
+		return values[0]
+	}
+	return MetadataLabelOther
+}
@@ -0,0 +1,95 @@
+package fxmetrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/exoscale/stelling/fxgrpc/grpctest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap/zaptest"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/metadata"
+)
+
+// metadataHandled returns the value of the grpc_server_metadata_handled_total series, keyed by tenant label
+func metadataHandled(t *testing.T, reg *prometheus.Registry) map[string]float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	counts := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "grpc_server_metadata_handled_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "tenant" {
+					counts[l.GetValue()] += m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return counts
+}
+
+func TestGrpcMetadataInterceptors(t *testing.T) {
+	t.Run("Should label the requests with the allowed metadata values", func(t *testing.T) {
+		var client pb.RouteGuideClient
+		reg := prometheus.NewRegistry()
+		app := fxtest.New(t, fx.Options(
+			grpctest.Module,
+			fx.Supply(reg, zaptest.NewLogger(t)),
+			fx.Supply(fx.Annotate(&Metrics{}, fx.As(new(MetricsConfig)))),
+			WithMetadataLabels(MetadataLabel{Name: "tenant", Key: "X-Tenant-Id", Allowed: []string{"acme", "globex"}}),
+			fx.Provide(
+				NewPrometheusRegisterer,
+				NewGrpcMetadataInterceptors,
+				func() pb.RouteGuideServer { return pb.UnimplementedRouteGuideServer{} },
+				pb.NewRouteGuideClient,
+			),
+			fx.Invoke(pb.RegisterRouteGuideServer),
+			fx.Populate(&client),
+		))
+		defer app.RequireStart().RequireStop()
+
+		for _, tenant := range []string{"acme", "acme", "globex", "initech", ""} {
+			ctx := context.Background()
+			if tenant != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "x-tenant-id", tenant)
+			}
+			_, err := client.GetFeature(ctx, &pb.Point{})
+			require.Error(t, err)
+		}
+
+		require.Equal(t, map[string]float64{
+			"acme":             2,
+			"globex":           1,
+			MetadataLabelOther: 1,
+			"":                 1,
+		}, metadataHandled(t, reg))
+	})
+
+	t.Run("Should not provide interceptors without labels", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		res, err := NewGrpcMetadataInterceptors(GrpcMetadataInterceptorsParams{Conf: &Metrics{}, Reg: reg})
+		require.NoError(t, err)
+
+		require.Nil(t, res.UnaryServerInterceptor)
+		require.Nil(t, res.StreamServerInterceptor)
+		families, err := reg.Gather()
+		require.NoError(t, err)
+		require.Empty(t, families)
+	})
+
+	t.Run("Should reject a label without allowed values", func(t *testing.T) {
+		_, err := NewGrpcMetadataInterceptors(GrpcMetadataInterceptorsParams{
+			Conf:   &Metrics{},
+			Reg:    prometheus.NewRegistry(),
+			Labels: []MetadataLabel{{Name: "tenant", Key: "x-tenant-id"}},
+		})
+		require.EqualError(t, err, `metadata label "tenant": at least one allowed value is required`)
+	})
+}
@@ -2,15 +2,24 @@
 package fxmetrics
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/exoscale/stelling/fxgrpc/maintenance"
 	"github.com/exoscale/stelling/fxhttp"
+	"github.com/exoscale/stelling/fxlogging/summary"
+	"github.com/exoscale/stelling/fxmetrics/reloads"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-middleware/providers/prometheus"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/fx"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc/reflection"
 )
@@ -23,13 +32,19 @@ func NewModule(conf MetricsConfig) fx.Option {
 		fxhttp.NewModule(&conf.MetricsConfig().Server, fxhttp.WithServerModuleName("metrics")),
 		fx.Provide(
 			NewPrometheusRegistry,
+			NewPrometheusRegisterer,
 			NewGrpcServerInterceptors,
+			NewGrpcExpiredInterceptors,
 			NewGrpcClientInterceptors,
+			NewGrpcMetadataInterceptors,
+			fx.Annotate(NewHttpMiddleware, fx.ResultTags(`group:"http_middleware"`)),
 		),
 		fx.Invoke(
 			RegisterMetricsHandlers,
+			RegisterGrpcServerStats,
 			fx.Annotate(fxhttp.StartHttpServer, fx.ParamTags("", `name:"metrics"`, "")),
 		),
+		summary.Provide("metrics", conf.MetricsConfig()),
 	)
 }
 
@@ -42,8 +57,33 @@ type Metrics struct {
 
 	// indicates whether Prometheus grpc middleware exports Histograms or not
 	Histograms bool `default:"false"`
+	// HistogramBuckets overrides the default buckets of the handling time histogram
+	HistogramBuckets []float64
 	// ProcessName is used as a prefix for certain metrics that can clash
 	ProcessName string
+	// Namespace is used as a prefix for the metrics registered by the module
+	Namespace string
+	// Subsystem is used as a prefix for the metrics registered by the module, after the Namespace
+	Subsystem string
+	// ConstLabels are added to all metrics registered by the module
+	// A service label is derived from the ProcessName, unless it is explicitly set
+	ConstLabels map[string]string
+	// RejectExpiredRequests fails requests whose context is already done before reaching the handler,
+	// rather than only counting them
+	RejectExpiredRequests bool
+	// Exemplars attaches the trace id of the active span to the request counters and histograms of the server
+	// Exemplars are only exposed when the scraper negotiates the OpenMetrics format
+	Exemplars bool
+	// Path is the path on which the metrics are served
+	Path string `default:"/metrics" validate:"omitempty,startswith=/"`
+	// LegacyPaths are additional paths serving the metrics, eg: while scrapers migrate to a new Path
+	LegacyPaths []string `validate:"dive,startswith=/"`
+	// EnableLogLevel serves the log level of the system on /loglevel
+	// The clients must be authenticated, see WithAdminAuth
+	EnableLogLevel bool
+	// EnableMaintenance serves the maintenance mode of the system on /maintenance
+	// The clients must be authenticated, see WithAdminAuth
+	EnableMaintenance bool
 }
 
 func (m *Metrics) ApplyDefaults() {
@@ -64,30 +104,158 @@ func (m *Metrics) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	}
 
 	enc.AddBool("histograms", m.Histograms)
+	if len(m.HistogramBuckets) > 0 {
+		enc.AddString("histogrambuckets", formatBuckets(m.HistogramBuckets))
+	}
 	if m.ProcessName != "" {
 		enc.AddString("processname", m.ProcessName)
 	}
+	if m.Namespace != "" {
+		enc.AddString("namespace", m.Namespace)
+	}
+	if m.Subsystem != "" {
+		enc.AddString("subsystem", m.Subsystem)
+	}
+	if len(m.ConstLabels) > 0 {
+		enc.AddString("constlabels", formatLabels(m.ConstLabels))
+	}
+	enc.AddBool("rejectexpiredrequests", m.RejectExpiredRequests)
+	if m.Exemplars {
+		enc.AddBool("exemplars", m.Exemplars)
+	}
+	if m.Path != "" {
+		enc.AddString("path", m.Path)
+	}
+	if len(m.LegacyPaths) > 0 {
+		enc.AddString("legacypaths", strings.Join(m.LegacyPaths, ","))
+	}
+	if m.EnableLogLevel {
+		enc.AddBool("enableloglevel", m.EnableLogLevel)
+	}
+	if m.EnableMaintenance {
+		enc.AddBool("enablemaintenance", m.EnableMaintenance)
+	}
 	return nil
 }
 
+// metricsPrefix joins the Namespace and Subsystem the same way prometheus.BuildFQName does
+func (m *Metrics) metricsPrefix() string {
+	prefix := ""
+	for _, part := range []string{m.Namespace, m.Subsystem} {
+		if part != "" {
+			prefix += part + "_"
+		}
+	}
+	return prefix
+}
+
+// constLabels returns the ConstLabels, with a service label derived from the ProcessName
+// when it isn't explicitly configured
+func (m *Metrics) constLabels() prometheus.Labels {
+	labels := prometheus.Labels{}
+	for k, v := range m.ConstLabels {
+		labels[k] = v
+	}
+	if _, ok := labels["service"]; !ok && m.ProcessName != "" {
+		labels["service"] = m.ProcessName
+	}
+	return labels
+}
+
+// NewPrometheusRegisterer wraps the registry so all metrics registered through it carry the configured
+// prefix and constant labels
+// Components should register their metrics through it, while the registry remains available to gather them
+func NewPrometheusRegisterer(conf MetricsConfig, reg *prometheus.Registry) prometheus.Registerer {
+	var registerer prometheus.Registerer = reg
+	if labels := conf.MetricsConfig().constLabels(); len(labels) > 0 {
+		registerer = prometheus.WrapRegistererWith(labels, registerer)
+	}
+	if prefix := conf.MetricsConfig().metricsPrefix(); prefix != "" {
+		registerer = prometheus.WrapRegistererWithPrefix(prefix, registerer)
+	}
+	return registerer
+}
+
+func formatLabels(labels map[string]string) string {
+	kvs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		kvs = append(kvs, fmt.Sprintf("%s=%s", k, v))
+	}
+	return strings.Join(kvs, ",")
+}
+
+func formatBuckets(buckets []float64) string {
+	bs := make([]string, 0, len(buckets))
+	for _, b := range buckets {
+		bs = append(bs, strconv.FormatFloat(b, 'g', -1, 64))
+	}
+	return strings.Join(bs, ",")
+}
+
 type RegisterParams struct {
 	fx.In
 
+	Conf   MetricsConfig
 	Reg    *prometheus.Registry
 	Server *http.Server `name:"metrics"`
+	// LogLevel is provided by the logging module
+	LogLevel zap.AtomicLevel `optional:"true"`
+	// Maintenance is provided by the grpc maintenance module
+	Maintenance *maintenance.Mode `optional:"true"`
+	// AdminAuth protects the admin endpoints, see WithAdminAuth
+	AdminAuth AdminAuth `optional:"true"`
 }
 
-func RegisterMetricsHandlers(p RegisterParams) {
+// LogLevelPath is the path on which the log level is served
+const LogLevelPath = "/loglevel"
+
+// MaintenancePath is the path on which the maintenance mode is served
+const MaintenancePath = "/maintenance"
+
+func RegisterMetricsHandlers(p RegisterParams) error {
+	conf := p.Conf.MetricsConfig()
+	handler := promhttp.HandlerFor(p.Reg, promhttp.HandlerOpts{
+		// Exemplars can only be exposed in the OpenMetrics format
+		EnableOpenMetrics: conf.Exemplars,
+	})
+
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.HandlerFor(p.Reg, promhttp.HandlerOpts{}))
+	path := conf.Path
+	if path == "" {
+		path = "/metrics"
+	}
+	registered := map[string]bool{}
+	for _, p := range append([]string{path}, conf.LegacyPaths...) {
+		// The mux panics when a pattern is registered twice
+		if !registered[p] {
+			mux.Handle(p, handler)
+			registered[p] = true
+		}
+	}
+	// The zero value means the log level isn't provided
+	if conf.EnableLogLevel && p.LogLevel != (zap.AtomicLevel{}) && !registered[LogLevelPath] {
+		h, err := adminHandler(conf, p.AdminAuth, LogLevelPath, p.LogLevel)
+		if err != nil {
+			return err
+		}
+		mux.Handle(LogLevelPath, h)
+	}
+	if conf.EnableMaintenance && p.Maintenance != nil && !registered[MaintenancePath] {
+		h, err := adminHandler(conf, p.AdminAuth, MaintenancePath, p.Maintenance)
+		if err != nil {
+			return err
+		}
+		mux.Handle(MaintenancePath, h)
+	}
 	p.Server.Handler = mux
+	return nil
 }
 
 type GrpcServerInterceptorParams struct {
 	fx.In
 
 	Conf         MetricsConfig
-	Reg          *prometheus.Registry
+	Reg          prometheus.Registerer
 	HistogramOps []grpc_prometheus.HistogramOption `optional:"true"`
 }
 
@@ -103,27 +271,46 @@ const GrpcInterceptorWeight = 60
 
 func NewGrpcServerInterceptors(p GrpcServerInterceptorParams) (GrpcServerInterceptorsResult, error) {
 	opts := []grpc_prometheus.ServerMetricsOption{}
-	if p.Conf.MetricsConfig().Histograms {
-		opts = append(opts, grpc_prometheus.WithServerHandlingTimeHistogram(p.HistogramOps...))
+	if conf := p.Conf.MetricsConfig(); conf.Histograms {
+		histogramOps := p.HistogramOps
+		if len(conf.HistogramBuckets) > 0 {
+			histogramOps = append(histogramOps, grpc_prometheus.WithHistogramBuckets(conf.HistogramBuckets))
+		}
+		opts = append(opts, grpc_prometheus.WithServerHandlingTimeHistogram(histogramOps...))
 	}
 	serverMetrics := grpc_prometheus.NewServerMetrics(opts...)
-	if err := p.Reg.Register(serverMetrics); err != nil {
+	if err := Register(p.Reg, serverMetrics); err != nil {
 		return GrpcServerInterceptorsResult{}, err
 	}
+	ixOpts := []grpc_prometheus.Option{}
+	if p.Conf.MetricsConfig().Exemplars {
+		ixOpts = append(ixOpts, grpc_prometheus.WithExemplarFromContext(traceExemplar))
+	}
 
 	return GrpcServerInterceptorsResult{
 		UnaryServerInterceptor: &fxgrpc.UnaryServerInterceptor{
+			Name:        "metrics",
 			Weight:      GrpcInterceptorWeight,
-			Interceptor: serverMetrics.UnaryServerInterceptor(),
+			Interceptor: serverMetrics.UnaryServerInterceptor(ixOpts...),
 		},
 		StreamServerInterceptor: &fxgrpc.StreamServerInterceptor{
+			Name:        "metrics",
 			Weight:      GrpcInterceptorWeight,
-			Interceptor: serverMetrics.StreamServerInterceptor(),
+			Interceptor: serverMetrics.StreamServerInterceptor(ixOpts...),
 		},
 		ServerMetrics: serverMetrics,
 	}, nil
 }
 
+// traceExemplar returns the trace id of the sampled span in ctx as exemplar labels
+func traceExemplar(ctx context.Context) prometheus.Labels {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() || !sc.IsSampled() {
+		return nil
+	}
+	return prometheus.Labels{"trace_id": sc.TraceID().String()}
+}
+
 func InitializeGrpcServerMetrics(metrics *grpc_prometheus.ServerMetrics, server reflection.ServiceInfoProvider) {
 	metrics.InitializeMetrics(server)
 }
@@ -135,17 +322,19 @@ type GrpcClientInterceptorsResult struct {
 	*fxgrpc.StreamClientInterceptor `group:"stream_client_interceptor"`
 }
 
-func NewGrpcClientInterceptors(reg *prometheus.Registry) (GrpcClientInterceptorsResult, error) {
+func NewGrpcClientInterceptors(reg prometheus.Registerer) (GrpcClientInterceptorsResult, error) {
 	clientMetrics := grpc_prometheus.NewClientMetrics()
-	if err := reg.Register(clientMetrics); err != nil {
+	if err := Register(reg, clientMetrics); err != nil {
 		return GrpcClientInterceptorsResult{}, err
 	}
 	return GrpcClientInterceptorsResult{
 		UnaryClientInterceptor: &fxgrpc.UnaryClientInterceptor{
+			Name:        "metrics",
 			Weight:      GrpcInterceptorWeight,
 			Interceptor: clientMetrics.UnaryClientInterceptor(),
 		},
 		StreamClientInterceptor: &fxgrpc.StreamClientInterceptor{
+			Name:        "metrics",
 			Weight:      GrpcInterceptorWeight,
 			Interceptor: clientMetrics.StreamClientInterceptor(),
 		},
@@ -155,7 +344,8 @@ func NewGrpcClientInterceptors(reg *prometheus.Registry) (GrpcClientInterceptors
 func NewPrometheusRegistry(conf MetricsConfig) (*prometheus.Registry, error) {
 	reg := prometheus.NewRegistry()
 
-	err := reg.Register(
+	err := Register(
+		reg,
 		collectors.NewGoCollector(
 			collectors.WithGoCollectorRuntimeMetrics(
 				collectors.MetricsAll,
@@ -168,13 +358,19 @@ func NewPrometheusRegistry(conf MetricsConfig) (*prometheus.Registry, error) {
 	opts := collectors.ProcessCollectorOpts{
 		Namespace: conf.MetricsConfig().ProcessName,
 	}
-	if err := reg.Register(collectors.NewProcessCollector(opts)); err != nil {
+	if err := Register(reg, collectors.NewProcessCollector(opts)); err != nil {
 		return nil, err
 	}
 
 	// TODO: I expect prometheus to add this to the BuildInfo collector, we can swap
 	// over to that one once it happens
-	if err := reg.Register(NewVersionCollector()); err != nil {
+	if err := Register(reg, NewVersionCollector()); err != nil {
+		return nil, err
+	}
+	if err := Register(reg, reloads.Total); err != nil {
+		return nil, err
+	}
+	if err := Register(reg, NewBuildInfoCollector()); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,510 @@
+package fxmetrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/exoscale/stelling/fxgrpc/maintenance"
+	"github.com/exoscale/stelling/fxhttp"
+	"github.com/go-playground/validator/v10"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewGrpcServerInterceptors(t *testing.T) {
+	t.Run("Should apply the configured histogram buckets", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		buckets := []float64{0.001, 0.01, 0.1, 1}
+		res, err := NewGrpcServerInterceptors(GrpcServerInterceptorParams{
+			Conf: &Metrics{Histograms: true, HistogramBuckets: buckets},
+			Reg:  reg,
+		})
+		require.NoError(t, err)
+
+		// Histograms are provisioned lazily, so we need to handle one request first
+		info := &grpc.UnaryServerInfo{FullMethod: "/routeguide.RouteGuide/GetFeature"}
+		_, err = res.UnaryServerInterceptor.Interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+			return nil, nil
+		})
+		require.NoError(t, err)
+
+		families, err := reg.Gather()
+		require.NoError(t, err)
+		var bounds []float64
+		for _, family := range families {
+			if family.GetName() != "grpc_server_handling_seconds" {
+				continue
+			}
+			require.Len(t, family.GetMetric(), 1)
+			for _, b := range family.GetMetric()[0].GetHistogram().GetBucket() {
+				bounds = append(bounds, b.GetUpperBound())
+			}
+		}
+		require.Equal(t, buckets, bounds)
+	})
+
+	handledExemplar := func(t *testing.T, exemplars bool, ctx context.Context) *dto.Exemplar {
+		reg := prometheus.NewRegistry()
+		res, err := NewGrpcServerInterceptors(GrpcServerInterceptorParams{
+			Conf: &Metrics{Exemplars: exemplars},
+			Reg:  reg,
+		})
+		require.NoError(t, err)
+
+		info := &grpc.UnaryServerInfo{FullMethod: "/routeguide.RouteGuide/GetFeature"}
+		_, err = res.UnaryServerInterceptor.Interceptor(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+			return nil, nil
+		})
+		require.NoError(t, err)
+
+		families, err := reg.Gather()
+		require.NoError(t, err)
+		for _, family := range families {
+			if family.GetName() == "grpc_server_handled_total" {
+				require.Len(t, family.GetMetric(), 1)
+				return family.GetMetric()[0].GetCounter().GetExemplar()
+			}
+		}
+		t.Fatal("grpc_server_handled_total was not found")
+		return nil
+	}
+	traceID := trace.TraceID{0x01, 0x02, 0x03}
+	spanCtx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     trace.SpanID{0x01},
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	t.Run("Should attach the trace id as exemplar when a span is active", func(t *testing.T) {
+		exemplar := handledExemplar(t, true, spanCtx)
+		require.NotNil(t, exemplar)
+		require.Len(t, exemplar.GetLabel(), 1)
+		require.Equal(t, "trace_id", exemplar.GetLabel()[0].GetName())
+		require.Equal(t, traceID.String(), exemplar.GetLabel()[0].GetValue())
+	})
+
+	t.Run("Should not attach an exemplar without an active span", func(t *testing.T) {
+		require.Nil(t, handledExemplar(t, true, context.Background()))
+	})
+
+	t.Run("Should not attach an exemplar when exemplars are disabled", func(t *testing.T) {
+		require.Nil(t, handledExemplar(t, false, spanCtx))
+	})
+}
+
+func TestMetricsPrefix(t *testing.T) {
+	cases := []struct {
+		name     string
+		conf     *Metrics
+		expected []string
+	}{
+		{
+			name:     "Should not prefix metrics by default",
+			conf:     &Metrics{},
+			expected: []string{"grpc_client_started_total", "grpc_server_connections", "grpc_server_started_total"},
+		},
+		{
+			name:     "Should prefix metrics with the namespace",
+			conf:     &Metrics{Namespace: "app"},
+			expected: []string{"app_grpc_client_started_total", "app_grpc_server_connections", "app_grpc_server_started_total"},
+		},
+		{
+			name:     "Should prefix metrics with the namespace and subsystem",
+			conf:     &Metrics{Namespace: "app", Subsystem: "component"},
+			expected: []string{"app_component_grpc_client_started_total", "app_component_grpc_server_connections", "app_component_grpc_server_started_total"},
+		},
+		{
+			name:     "Should prefix metrics with only the subsystem",
+			conf:     &Metrics{Subsystem: "component"},
+			expected: []string{"component_grpc_client_started_total", "component_grpc_server_connections", "component_grpc_server_started_total"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			registerer := NewPrometheusRegisterer(tc.conf, reg)
+			server, err := NewGrpcServerInterceptors(GrpcServerInterceptorParams{Conf: tc.conf, Reg: registerer})
+			require.NoError(t, err)
+			require.NoError(t, RegisterGrpcServerStats(GrpcServerStatsParams{Reg: registerer}))
+			client, err := NewGrpcClientInterceptors(registerer)
+			require.NoError(t, err)
+
+			// Metrics are provisioned lazily, so we need to handle one request first
+			handler := func(ctx context.Context, req any) (any, error) { return nil, nil }
+			info := &grpc.UnaryServerInfo{FullMethod: "/routeguide.RouteGuide/GetFeature"}
+			_, err = server.UnaryServerInterceptor.Interceptor(context.Background(), nil, info, handler)
+			require.NoError(t, err)
+			invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				return nil
+			}
+			err = client.UnaryClientInterceptor.Interceptor(context.Background(), info.FullMethod, nil, nil, nil, invoker)
+			require.NoError(t, err)
+
+			families, err := reg.Gather()
+			require.NoError(t, err)
+			names := map[string]bool{}
+			for _, family := range families {
+				names[family.GetName()] = true
+			}
+			for _, name := range tc.expected {
+				require.True(t, names[name], "missing metric %s", name)
+			}
+		})
+	}
+}
+
+func TestNewPrometheusRegisterer(t *testing.T) {
+	cases := []struct {
+		name           string
+		conf           *Metrics
+		expectedName   string
+		expectedLabels map[string]string
+	}{
+		{
+			name:           "Should not modify metrics by default",
+			conf:           &Metrics{},
+			expectedName:   "example_total",
+			expectedLabels: map[string]string{},
+		},
+		{
+			name:           "Should prefix metrics with the namespace and subsystem",
+			conf:           &Metrics{Namespace: "app", Subsystem: "component"},
+			expectedName:   "app_component_example_total",
+			expectedLabels: map[string]string{},
+		},
+		{
+			name:           "Should add the constant labels",
+			conf:           &Metrics{ConstLabels: map[string]string{"instance": "a", "service": "b"}},
+			expectedName:   "example_total",
+			expectedLabels: map[string]string{"instance": "a", "service": "b"},
+		},
+		{
+			name:           "Should derive the service label from the ProcessName",
+			conf:           &Metrics{ProcessName: "app", ConstLabels: map[string]string{"instance": "a"}},
+			expectedName:   "example_total",
+			expectedLabels: map[string]string{"instance": "a", "service": "app"},
+		},
+		{
+			name:           "Should not override an explicit service label",
+			conf:           &Metrics{ProcessName: "app", ConstLabels: map[string]string{"service": "b"}},
+			expectedName:   "example_total",
+			expectedLabels: map[string]string{"service": "b"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var reg *prometheus.Registry
+			var registerer prometheus.Registerer
+
+			app := fxtest.New(t,
+				fx.Supply(fx.Annotate(tc.conf, fx.As(new(MetricsConfig)))),
+				fx.Provide(
+					NewPrometheusRegistry,
+					NewPrometheusRegisterer,
+				),
+				fx.Populate(&reg, &registerer),
+			)
+			defer app.RequireStart().RequireStop()
+
+			counter := prometheus.NewCounter(prometheus.CounterOpts{
+				Name: "example_total",
+				Help: "Total number of examples",
+			})
+			require.NoError(t, registerer.Register(counter))
+			counter.Inc()
+
+			families, err := reg.Gather()
+			require.NoError(t, err)
+			var labels map[string]string
+			for _, family := range families {
+				if family.GetName() != tc.expectedName {
+					continue
+				}
+				require.Len(t, family.GetMetric(), 1)
+				labels = map[string]string{}
+				for _, l := range family.GetMetric()[0].GetLabel() {
+					labels[l.GetName()] = l.GetValue()
+				}
+			}
+			require.Equal(t, tc.expectedLabels, labels)
+		})
+	}
+}
+
+func TestRegisterMetricsHandlers(t *testing.T) {
+	cases := []struct {
+		name   string
+		conf   *Metrics
+		served []string
+		absent []string
+	}{
+		{"Should serve /metrics by default", &Metrics{}, []string{"/metrics"}, []string{"/prometheus"}},
+		{"Should serve the configured path", &Metrics{Path: "/prometheus"}, []string{"/prometheus"}, []string{"/metrics"}},
+		{
+			"Should serve the legacy paths along with the path",
+			&Metrics{Path: "/prometheus", LegacyPaths: []string{"/metrics", "/old/metrics", "/prometheus"}},
+			[]string{"/prometheus", "/metrics", "/old/metrics"},
+			[]string{"/other"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "A test counter."})
+			reg.MustRegister(counter)
+			server := &http.Server{}
+			require.NoError(t, RegisterMetricsHandlers(RegisterParams{Conf: tc.conf, Reg: reg, Server: server}))
+
+			for _, path := range tc.served {
+				rec := httptest.NewRecorder()
+				server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				require.Equal(t, http.StatusOK, rec.Code, path)
+				require.Contains(t, rec.Body.String(), "test_total 0", path)
+			}
+			for _, path := range tc.absent {
+				rec := httptest.NewRecorder()
+				server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				require.Equal(t, http.StatusNotFound, rec.Code, path)
+			}
+		})
+	}
+
+	t.Run("Should reject paths that are not absolute", func(t *testing.T) {
+		require.Error(t, validator.New().Struct(&Metrics{LegacyPaths: []string{"metrics"}}))
+		require.Error(t, validator.New().Struct(&Metrics{Path: "metrics"}))
+	})
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	// allowAdmin only lets the requests with the admin header through
+	allowAdmin := AdminAuth(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Admin") != "true" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	t.Run("Should change what the logger emits when a new level is put", func(t *testing.T) {
+		level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+		core, logs := observer.New(level)
+		logger := zap.New(core)
+		server := &http.Server{}
+		require.NoError(t, RegisterMetricsHandlers(RegisterParams{
+			Conf: &Metrics{EnableLogLevel: true}, Reg: prometheus.NewRegistry(), Server: server, LogLevel: level, AdminAuth: allowAdmin,
+		}))
+
+		logger.Debug("hidden")
+		require.Zero(t, logs.Len())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, LogLevelPath, strings.NewReader(`{"level":"debug"}`))
+		server.Handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+
+		rec = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodPut, LogLevelPath, strings.NewReader(`{"level":"debug"}`))
+		req.Header.Set("X-Admin", "true")
+		server.Handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		rec = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, LogLevelPath, nil)
+		req.Header.Set("X-Admin", "true")
+		server.Handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.JSONEq(t, `{"level":"debug"}`, rec.Body.String())
+
+		logger.Debug("shown")
+		require.Equal(t, 1, logs.FilterMessage("shown").Len())
+	})
+
+	t.Run("Should serve the log level when the server verifies the client certificates", func(t *testing.T) {
+		conf := &Metrics{EnableLogLevel: true}
+		conf.Server.TLS = true
+		conf.Server.ClientCAFile = "ca.pem"
+		server := &http.Server{}
+		require.NoError(t, RegisterMetricsHandlers(RegisterParams{Conf: conf, Reg: prometheus.NewRegistry(), Server: server, LogLevel: zap.NewAtomicLevel()}))
+
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, LogLevelPath, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("Should refuse to serve the log level without authentication", func(t *testing.T) {
+		for _, conf := range []*Metrics{{EnableLogLevel: true}, {EnableLogLevel: true, Server: fxhttp.Server{TLS: true}}} {
+			err := RegisterMetricsHandlers(RegisterParams{Conf: conf, Reg: prometheus.NewRegistry(), Server: &http.Server{}, LogLevel: zap.NewAtomicLevel()})
+			require.ErrorContains(t, err, "refusing to serve /loglevel without authentication")
+		}
+	})
+
+	t.Run("Should not serve the log level on a default config", func(t *testing.T) {
+		conf := &Metrics{}
+		conf.ApplyDefaults()
+		for _, p := range []RegisterParams{
+			{Conf: conf, LogLevel: zap.NewAtomicLevel()},
+			{Conf: conf, LogLevel: zap.NewAtomicLevel(), AdminAuth: allowAdmin},
+			{Conf: &Metrics{EnableLogLevel: true}},
+		} {
+			p.Reg, p.Server = prometheus.NewRegistry(), &http.Server{}
+			require.NoError(t, RegisterMetricsHandlers(p))
+
+			rec := httptest.NewRecorder()
+			p.Server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, LogLevelPath, nil))
+			require.Equal(t, http.StatusNotFound, rec.Code)
+		}
+	})
+}
+
+func TestMaintenanceHandler(t *testing.T) {
+	mtlsConf := func() *Metrics {
+		conf := &Metrics{EnableMaintenance: true}
+		conf.Server.TLS = true
+		conf.Server.ClientCAFile = "ca.pem"
+		return conf
+	}
+
+	t.Run("Should toggle the maintenance mode when it is enabled", func(t *testing.T) {
+		mode := maintenance.NewMode(&maintenance.Maintenance{})
+		server := &http.Server{}
+		require.NoError(t, RegisterMetricsHandlers(RegisterParams{Conf: mtlsConf(), Reg: prometheus.NewRegistry(), Server: server, Maintenance: mode}))
+
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, MaintenancePath, strings.NewReader(`{"enabled":true}`)))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.True(t, mode.Enabled())
+	})
+
+	t.Run("Should refuse to serve the maintenance mode without authentication", func(t *testing.T) {
+		err := RegisterMetricsHandlers(RegisterParams{
+			Conf: &Metrics{EnableMaintenance: true}, Reg: prometheus.NewRegistry(), Server: &http.Server{}, Maintenance: maintenance.NewMode(&maintenance.Maintenance{}),
+		})
+		require.ErrorContains(t, err, "refusing to serve /maintenance without authentication")
+	})
+
+	t.Run("Should not serve the maintenance mode when it is not enabled or not provided", func(t *testing.T) {
+		conf := &Metrics{}
+		conf.ApplyDefaults()
+		for _, p := range []RegisterParams{
+			{Conf: conf, Maintenance: maintenance.NewMode(&maintenance.Maintenance{})},
+			{Conf: mtlsConf()},
+		} {
+			p.Reg, p.Server = prometheus.NewRegistry(), &http.Server{}
+			require.NoError(t, RegisterMetricsHandlers(p))
+
+			rec := httptest.NewRecorder()
+			p.Server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, MaintenancePath, strings.NewReader(`{"enabled":true}`)))
+			require.Equal(t, http.StatusNotFound, rec.Code)
+		}
+	})
+}
+
+// handledCodes returns the grpc_server_handled_total counters of reg by grpc code
+func handledCodes(t *testing.T, reg *prometheus.Registry) map[string]float64 {
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	counts := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "grpc_server_handled_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "grpc_code" {
+					counts[l.GetValue()] += m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return counts
+}
+
+// chainUnary sorts the interceptors like the grpc servers do, and chains them in front of handler
+func chainUnary(ixs []*fxgrpc.UnaryServerInterceptor, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) grpc.UnaryHandler {
+	sorted := fxgrpc.SortInterceptors(ixs)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		ix, next := sorted[i].Interceptor, handler
+		handler = func(ctx context.Context, req any) (any, error) { return ix(ctx, req, info, next) }
+	}
+	return handler
+}
+
+// contextServerStream is a grpc.ServerStream which only has a context
+type contextServerStream struct {
+	grpc.ServerStream
+}
+
+func (contextServerStream) Context() context.Context { return context.Background() }
+
+// chainStream sorts the interceptors like the grpc servers do, and chains them in front of handler
+func chainStream(ixs []*fxgrpc.StreamServerInterceptor, info *grpc.StreamServerInfo, handler grpc.StreamHandler) grpc.StreamHandler {
+	sorted := fxgrpc.SortInterceptors(ixs)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		ix, next := sorted[i].Interceptor, handler
+		handler = func(srv any, ss grpc.ServerStream) error { return ix(srv, ss, info, next) }
+	}
+	return handler
+}
+
+func TestRejectedRequestsAreCounted(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/routeguide.RouteGuide/GetFeature"}
+	handler := func(ctx context.Context, req any) (any, error) { return nil, nil }
+	newMetrics := func(t *testing.T) (*prometheus.Registry, GrpcServerInterceptorsResult) {
+		reg := prometheus.NewRegistry()
+		res, err := NewGrpcServerInterceptors(GrpcServerInterceptorParams{Conf: &Metrics{}, Reg: reg})
+		require.NoError(t, err)
+		return reg, res
+	}
+
+	t.Run("Should count the requests rejected during maintenance", func(t *testing.T) {
+		reg, metricsIx := newMetrics(t)
+		mode := maintenance.NewMode(&maintenance.Maintenance{})
+		mode.SetEnabled(true)
+		maintenanceIx, _ := maintenance.NewGrpcServerInterceptors(&maintenance.Maintenance{}, mode)
+
+		_, err := chainUnary([]*fxgrpc.UnaryServerInterceptor{maintenanceIx, metricsIx.UnaryServerInterceptor}, info, handler)(context.Background(), nil)
+		require.Equal(t, codes.Unavailable, status.Code(err))
+		require.Equal(t, map[string]float64{codes.Unavailable.String(): 1}, handledCodes(t, reg))
+	})
+
+	t.Run("Should count the requests rejected above the size limit of their method", func(t *testing.T) {
+		reg, metricsIx := newMetrics(t)
+		maxSizeIx, _ := fxgrpc.NewMethodMaxRequestSizeInterceptors(map[string]int{info.FullMethod: 1})
+
+		_, err := chainUnary([]*fxgrpc.UnaryServerInterceptor{maxSizeIx, metricsIx.UnaryServerInterceptor}, info, handler)(context.Background(), &pb.Point{Latitude: 1000})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+		require.Equal(t, map[string]float64{codes.InvalidArgument.String(): 1}, handledCodes(t, reg))
+	})
+
+	t.Run("Should count the streams rejected above the limit of their method", func(t *testing.T) {
+		reg, metricsIx := newMetrics(t)
+		streamInfo := &grpc.StreamServerInfo{FullMethod: "/routeguide.RouteGuide/RouteChat", IsClientStream: true, IsServerStream: true}
+		maxStreamsIx := fxgrpc.NewMethodMaxStreamsInterceptor(map[string]int{streamInfo.FullMethod: 0})
+
+		err := chainStream([]*fxgrpc.StreamServerInterceptor{maxStreamsIx, metricsIx.StreamServerInterceptor}, streamInfo, func(any, grpc.ServerStream) error {
+			return nil
+		})(nil, contextServerStream{})
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		require.Equal(t, map[string]float64{codes.ResourceExhausted.String(): 1}, handledCodes(t, reg))
+	})
+}
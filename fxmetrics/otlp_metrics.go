@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/exoscale/stelling/fxlogging/summary"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
@@ -23,11 +24,15 @@ func NewOtlpModule(conf OtlpMetricsConfig) fx.Option {
 		fx.Supply(fx.Annotate(conf, fx.As(new(MetricsConfig))), fx.Private),
 		fx.Provide(
 			NewPrometheusRegistry,
+			NewPrometheusRegisterer,
 			NewOtlpMeterProvider,
 			NewGrpcServerInterceptors,
+			NewGrpcExpiredInterceptors,
+			NewGrpcMetadataInterceptors,
 			NewGrpcClientInterceptors,
 		),
-		fx.Invoke(InvokeOtlpMeterProvider),
+		fx.Invoke(InvokeOtlpMeterProvider, RegisterGrpcServerStats),
+		summary.Provide("otlp-metrics", conf.OtlpMetricsConfig()),
 	)
 }
 
@@ -43,8 +48,20 @@ type OtlpMetrics struct {
 	PushInterval time.Duration `default:"15s"`
 	// indicates whether Prometheus grpc middleware exports Histograms or not
 	Histograms bool `default:"false"`
+	// HistogramBuckets overrides the default buckets of the handling time histogram
+	HistogramBuckets []float64
 	// ProcessName is used as a prefix for certain metrics that can clash
 	ProcessName string
+	// Namespace is used as a prefix for the metrics registered by the module
+	Namespace string
+	// Subsystem is used as a prefix for the metrics registered by the module, after the Namespace
+	Subsystem string
+	// ConstLabels are added to all metrics registered by the module
+	// A service label is derived from the ProcessName, unless it is explicitly set
+	ConstLabels map[string]string
+	// RejectExpiredRequests fails requests whose context is already done before reaching the handler,
+	// rather than only counting them
+	RejectExpiredRequests bool
 
 	// GrpcClient is the client used to talk to the collector
 	GrpcClient fxgrpc.Client `validate:"required_with=Enabled,omitempty"`
@@ -56,8 +73,13 @@ func (om *OtlpMetrics) OtlpMetricsConfig() *OtlpMetrics {
 
 func (om *OtlpMetrics) MetricsConfig() *Metrics {
 	return &Metrics{
-		Histograms:  om.Histograms,
-		ProcessName: om.ProcessName,
+		Histograms:            om.Histograms,
+		HistogramBuckets:      om.HistogramBuckets,
+		ProcessName:           om.ProcessName,
+		Namespace:             om.Namespace,
+		Subsystem:             om.Subsystem,
+		ConstLabels:           om.ConstLabels,
+		RejectExpiredRequests: om.RejectExpiredRequests,
 	}
 }
 
@@ -72,9 +94,22 @@ func (m *OtlpMetrics) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	}
 	enc.AddDuration("pushinterval", m.PushInterval)
 	enc.AddBool("histograms", m.Histograms)
+	if len(m.HistogramBuckets) > 0 {
+		enc.AddString("histogrambuckets", formatBuckets(m.HistogramBuckets))
+	}
 	if m.ProcessName != "" {
 		enc.AddString("processname", m.ProcessName)
 	}
+	if m.Namespace != "" {
+		enc.AddString("namespace", m.Namespace)
+	}
+	if m.Subsystem != "" {
+		enc.AddString("subsystem", m.Subsystem)
+	}
+	if len(m.ConstLabels) > 0 {
+		enc.AddString("constlabels", formatLabels(m.ConstLabels))
+	}
+	enc.AddBool("rejectexpiredrequests", m.RejectExpiredRequests)
 	return nil
 }
 
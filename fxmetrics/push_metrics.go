@@ -2,15 +2,12 @@ package fxmetrics
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"fmt"
-	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	reloader "github.com/exoscale/stelling/fxcert-reloader"
+	"github.com/exoscale/stelling/fxlogging/summary"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/push"
 	"go.uber.org/fx"
@@ -25,13 +22,18 @@ func NewPushModule(conf PushMetricsConfig) fx.Option {
 		fx.Supply(fx.Annotate(conf, fx.As(new(PushMetricsConfig))), fx.Private),
 		fx.Provide(
 			NewPrometheusRegistry,
+			NewPrometheusRegisterer,
 			NewGrpcServerInterceptors,
+			NewGrpcExpiredInterceptors,
+			NewGrpcMetadataInterceptors,
 			NewGrpcClientInterceptors,
 		),
 		fx.Provide(
 			func(m PushMetricsConfig) MetricsConfig { return m },
 			fx.Private,
 		),
+		fx.Invoke(RegisterGrpcServerStats),
+		summary.Provide("push-metrics", conf.PushMetricsConfig()),
 	)
 	if conf.PushMetricsConfig().Endpoint != "" {
 		opts = fx.Options(
@@ -74,15 +76,27 @@ type PushMetrics struct {
 	// InsecureConnection indicates whether TLS needs to be disabled when connecting to PushGateway
 	InsecureConnection bool
 	// CertFile is the path to the pem encoded TLS certificate
-	CertFile string `validate:"omitempty,file"`
+	CertFile string `validate:"required_with=KeyFile,omitempty,file"`
 	// KeyFile is the path to the pem encoded private key of the TLS certificate
 	KeyFile string `validate:"required_with=CertFile,omitempty,file"`
 	// RootCAFile is the path to a pem encoded CA cert bundle used to validate server connections
 	RootCAFile string `validate:"omitempty,file"`
 	// indicates whether Prometheus grpc middleware exports Histograms or not
 	Histograms bool `default:"false"`
+	// HistogramBuckets overrides the default buckets of the handling time histogram
+	HistogramBuckets []float64
 	// ProcessName is used as a prefix for certain metrics that can clash
 	ProcessName string
+	// Namespace is used as a prefix for the metrics registered by the module
+	Namespace string
+	// Subsystem is used as a prefix for the metrics registered by the module, after the Namespace
+	Subsystem string
+	// ConstLabels are added to all metrics registered by the module
+	// A service label is derived from the ProcessName, unless it is explicitly set
+	ConstLabels map[string]string
+	// RejectExpiredRequests fails requests whose context is already done before reaching the handler,
+	// rather than only counting them
+	RejectExpiredRequests bool
 	// Endpoint is the URL on which the prometheus pushgateway can be reached
 	Endpoint string `validate:"omitempty,url"`
 	// JobName is the name of the job in PushGateway
@@ -109,10 +123,24 @@ func (m *PushMetrics) PushMetricsConfig() *PushMetrics {
 	return m
 }
 
+func (m *PushMetrics) ClientTLSConfig() *reloader.ClientTLS {
+	return &reloader.ClientTLS{
+		InsecureConnection: m.InsecureConnection,
+		CertFile:           m.CertFile,
+		KeyFile:            m.KeyFile,
+		RootCAFile:         m.RootCAFile,
+	}
+}
+
 func (m *PushMetrics) MetricsConfig() *Metrics {
 	return &Metrics{
-		Histograms:  m.Histograms,
-		ProcessName: m.ProcessName,
+		Histograms:            m.Histograms,
+		HistogramBuckets:      m.HistogramBuckets,
+		ProcessName:           m.ProcessName,
+		Namespace:             m.Namespace,
+		Subsystem:             m.Subsystem,
+		ConstLabels:           m.ConstLabels,
+		RejectExpiredRequests: m.RejectExpiredRequests,
 	}
 }
 
@@ -121,7 +149,7 @@ func (m *PushMetrics) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 		return nil
 	}
 
-	enc.AddString("endpoint", m.Endpoint)
+	enc.AddString("endpoint", summary.RedactURL(m.Endpoint))
 	enc.AddDuration("pushinterval", m.PushInterval)
 	enc.AddBool("insecureconnection", m.InsecureConnection)
 	if !m.InsecureConnection {
@@ -131,9 +159,22 @@ func (m *PushMetrics) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	}
 
 	enc.AddBool("histograms", m.Histograms)
+	if len(m.HistogramBuckets) > 0 {
+		enc.AddString("histogrambuckets", formatBuckets(m.HistogramBuckets))
+	}
 	if m.ProcessName != "" {
 		enc.AddString("processname", m.ProcessName)
 	}
+	if m.Namespace != "" {
+		enc.AddString("namespace", m.Namespace)
+	}
+	if m.Subsystem != "" {
+		enc.AddString("subsystem", m.Subsystem)
+	}
+	if len(m.ConstLabels) > 0 {
+		enc.AddString("constlabels", formatLabels(m.ConstLabels))
+	}
+	enc.AddBool("rejectexpiredrequests", m.RejectExpiredRequests)
 	enc.AddString("jobname", m.JobName)
 	if m.GroupingLabelKey != "" {
 		enc.AddString("groupinglabel", m.GroupingLabelKey)
@@ -152,39 +193,15 @@ func GetCertReloaderConfig(conf PushMetricsConfig) *reloader.CertReloaderConfig
 	return &reloader.CertReloaderConfig{
 		CertFile:       conf.PushMetricsConfig().CertFile,
 		KeyFile:        conf.PushMetricsConfig().KeyFile,
-		ReloadInterval: 1 * time.Hour,
-	}
-}
-
-func httpClient(conf *PushMetrics, reloader *reloader.CertReloader) (*http.Client, error) {
-	tlsConf := &tls.Config{
-		InsecureSkipVerify: conf.InsecureConnection,
-	}
-	if reloader != nil {
-		tlsConf.GetClientCertificate = reloader.GetClientCertificate
-	}
-	if conf.RootCAFile != "" {
-		certPool, err := x509.SystemCertPool()
-		if err != nil {
-			return nil, err
-		}
-		ca, err := os.ReadFile(conf.RootCAFile)
-		if err != nil {
-			return nil, err
-		}
-		if ok := certPool.AppendCertsFromPEM(ca); !ok {
-			return nil, fmt.Errorf("failed to parse RootCAFile: %s", conf.RootCAFile)
-		}
-		tlsConf.RootCAs = certPool
+		ReloadInterval: reloader.DefaultReloadInterval,
 	}
-	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConf}}, nil
 }
 
-func ProvideMetricsPusher(lc fx.Lifecycle, conf PushMetricsConfig, reloader *reloader.CertReloader, logger *zap.Logger) (*push.Pusher, error) {
+func ProvideMetricsPusher(lc fx.Lifecycle, conf PushMetricsConfig, r *reloader.CertReloader, logger *zap.Logger) (*push.Pusher, error) {
 	pConf := conf.PushMetricsConfig()
 	logger = logger.Named("metrics-pusher")
 
-	client, err := httpClient(pConf, reloader)
+	client, err := reloader.MakeHTTPClient(pConf, r)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,50 @@
+package fxmetrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// processStart approximates the start of the process: package variables are initialized before main runs
+var processStart = time.Now()
+
+type ServiceReadyParams struct {
+	fx.In
+
+	Lc     fx.Lifecycle
+	Reg    prometheus.Registerer
+	Logger *zap.Logger
+}
+
+// RegisterServiceReady records when the system is done starting, to measure the cold start time
+// Once its OnStart hook runs, it sets the process_start_timestamp_seconds gauge and logs the startup duration
+// Hooks run in the order they are appended: it must be passed as the last fx.Invoke of the system
+// so its hook runs after all other OnStart hooks
+func RegisterServiceReady(p ServiceReadyParams) error {
+	ready := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "process_start_timestamp_seconds",
+		Help: "Time at which the service finished starting, in seconds since the epoch.",
+	})
+	if err := Register(p.Reg, ready); err != nil {
+		return err
+	}
+
+	info := ReadBuildInfo()
+	p.Lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			now := time.Now()
+			ready.Set(float64(now.UnixNano()) / 1e9)
+			p.Logger.Info(
+				"Service ready",
+				zap.Duration("startup_duration", now.Sub(processStart)),
+				zap.String("revision", info.Revision),
+			)
+			return nil
+		},
+	})
+	return nil
+}
@@ -0,0 +1,56 @@
+package fxmetrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func readyValue(t *testing.T, reg *prometheus.Registry) float64 {
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == "process_start_timestamp_seconds" {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestRegisterServiceReady(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	core, logs := observer.New(zap.InfoLevel)
+
+	var slowHookDone time.Time
+	app := fxtest.New(
+		t,
+		fx.Supply(fx.Annotate(reg, fx.As(new(prometheus.Registerer))), zap.New(core)),
+		fx.Invoke(func(lc fx.Lifecycle) {
+			lc.Append(fx.Hook{OnStart: func(context.Context) error {
+				time.Sleep(20 * time.Millisecond)
+				slowHookDone = time.Now()
+				return nil
+			}})
+		}),
+		fx.Invoke(RegisterServiceReady),
+	)
+	require.Zero(t, readyValue(t, reg))
+	require.Empty(t, logs.FilterMessage("Service ready").AllUntimed())
+
+	app.RequireStart()
+	defer app.RequireStop()
+
+	require.GreaterOrEqual(t, readyValue(t, reg), float64(slowHookDone.UnixNano())/1e9)
+
+	entries := logs.FilterMessage("Service ready").AllUntimed()
+	require.Len(t, entries, 1)
+	require.GreaterOrEqual(t, entries[0].ContextMap()["startup_duration"], 20*time.Millisecond)
+	require.Contains(t, entries[0].ContextMap(), "revision")
+}
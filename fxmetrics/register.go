@@ -0,0 +1,50 @@
+package fxmetrics
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Register registers the collector with reg, like reg.Register
+// The returned error names the metrics of the collector, so a collision can be traced back to its origin,
+// and it should be preferred to MustRegister, which panics far from the root cause
+func Register(reg prometheus.Registerer, c prometheus.Collector) error {
+	err := reg.Register(c)
+	if err == nil {
+		return nil
+	}
+	names := strings.Join(collectorNames(c), ",")
+	if are := (prometheus.AlreadyRegisteredError{}); errors.As(err, &are) {
+		return fmt.Errorf("failed to register metrics %s: a collector with the same metrics is already registered: %w", names, err)
+	}
+	return fmt.Errorf("failed to register metrics %s: %w", names, err)
+}
+
+// descNameRegexp extracts the fully-qualified name from the string of a *prometheus.Desc, which has no accessor for it
+var descNameRegexp = regexp.MustCompile(`^Desc\{fqName: ("(?:[^"\\]|\\.)*")`)
+
+// collectorNames returns the names of the metrics described by c
+func collectorNames(c prometheus.Collector) []string {
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(descs)
+		close(descs)
+	}()
+
+	names := []string{}
+	for desc := range descs {
+		m := descNameRegexp.FindStringSubmatch(desc.String())
+		if m == nil {
+			continue
+		}
+		if name, err := strconv.Unquote(m[1]); err == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
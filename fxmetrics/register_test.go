@@ -0,0 +1,36 @@
+package fxmetrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+	newCounter := func(help string) prometheus.Collector {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Name: "jobs_processed_total", Help: help}, []string{"queue"})
+	}
+
+	t.Run("Should register the collector", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		require.NoError(t, Register(reg, newCounter("Number of processed jobs.")))
+	})
+
+	t.Run("Should name the metric of a collector which is already registered", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		require.NoError(t, Register(reg, newCounter("Number of processed jobs.")))
+
+		err := Register(reg, newCounter("Number of processed jobs."))
+		require.ErrorContains(t, err, "failed to register metrics jobs_processed_total: a collector with the same metrics is already registered")
+		require.ErrorAs(t, err, &prometheus.AlreadyRegisteredError{})
+	})
+
+	t.Run("Should name the metric of a collector colliding with a different help", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		require.NoError(t, Register(reg, newCounter("Number of processed jobs.")))
+
+		err := Register(reg, newCounter("Jobs processed."))
+		require.ErrorContains(t, err, "failed to register metrics jobs_processed_total: ")
+	})
+}
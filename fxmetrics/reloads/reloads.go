@@ -0,0 +1,29 @@
+// Package reloads counts the reloads of the hot reloadable components of the process, eg: certificates or configuration.
+// It only depends on prometheus, so the reloaders can report to it without depending on the metrics module.
+package reloads
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The outcomes of a reload
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Total counts the reloads of the process, by component and outcome
+// It is shared by all the reloaders: the metrics module registers it in the registry of the system
+var Total = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "config_reloads_total",
+	Help: "Total number of reloads of the hot reloadable components, by component and outcome.",
+}, []string{"component", "outcome"})
+
+// Observe counts a reload of the component, which failed when err is not nil
+func Observe(component string, err error) {
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = OutcomeFailure
+	}
+	Total.WithLabelValues(component, outcome).Inc()
+}
@@ -1,13 +1,73 @@
 package fxmetrics
 
 import (
+	"runtime"
 	"runtime/debug"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// revision and revisionTimestamp can be set at link time, see NewVersionCollector
 var revision, revisionTimestamp = "unknown", "unknown"
 
+// BuildInfo is the build information of the binary
+// Values which can't be determined are set to "unknown"
+type BuildInfo struct {
+	// Revision is the vcs revision the binary was built from
+	Revision string
+	// RevisionTimestamp is the time of the revision
+	RevisionTimestamp string
+	// Dirty is "true" when the working tree had local modifications when the binary was built
+	Dirty string
+	// GoVersion is the version of Go which built the binary
+	GoVersion string
+	// Version is the version of the main module, "(devel)" unless installed with go install
+	Version string
+}
+
+// NewBuildInfo extracts the build information from info
+// The revision and revision timestamp set at link time take precedence over the vcs settings of info
+func NewBuildInfo(info *debug.BuildInfo) *BuildInfo {
+	b := &BuildInfo{
+		Revision:          revision,
+		RevisionTimestamp: revisionTimestamp,
+		Dirty:             "unknown",
+		GoVersion:         info.GoVersion,
+		Version:           info.Main.Version,
+	}
+	if b.GoVersion == "" {
+		b.GoVersion = runtime.Version()
+	}
+	if b.Version == "" {
+		b.Version = "unknown"
+	}
+	linked := revision != "unknown"
+	for _, item := range info.Settings {
+		switch item.Key {
+		case "vcs.revision":
+			if !linked {
+				b.Revision = item.Value
+			}
+		case "vcs.time":
+			if !linked {
+				b.RevisionTimestamp = item.Value
+			}
+		case "vcs.modified":
+			b.Dirty = item.Value
+		}
+	}
+	return b
+}
+
+// ReadBuildInfo returns the build information of the running binary, see NewBuildInfo
+func ReadBuildInfo() *BuildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		info = &debug.BuildInfo{}
+	}
+	return NewBuildInfo(info)
+}
+
 // NewVersionCollector returns a collector collecting a single metric "go_version_info" with the
 // constant value of 1 and 2 labels "revision" and "revision_timestamp".
 // Their values can be set at link time.
@@ -17,24 +77,40 @@ var revision, revisionTimestamp = "unknown", "unknown"
 // the BuildInfo.Settings map.
 // If neither way returns an output, the value will be set to "unknown".
 func NewVersionCollector() prometheus.GaugeFunc {
-	if info, ok := debug.ReadBuildInfo(); ok && revision == "unknown" {
-		for _, item := range info.Settings {
-			switch item.Key {
-			case "vcs.revision":
-				revision = item.Value
-			case "vcs.time":
-				revisionTimestamp = item.Value
-			}
-		}
-	}
+	info := ReadBuildInfo()
 
 	return prometheus.NewGaugeFunc(
 		prometheus.GaugeOpts{
 			Name: "go_version_info",
 			Help: "Version information about the main Go module.",
 			ConstLabels: prometheus.Labels{
-				"revision":           revision,
-				"revision_timestamp": revisionTimestamp,
+				"revision":           info.Revision,
+				"revision_timestamp": info.RevisionTimestamp,
+			},
+		},
+		func() float64 { return 1 },
+	)
+}
+
+// NewBuildInfoCollector returns a collector collecting a single metric "build_info" with the
+// constant value of 1, following the prometheus convention, and the labels:
+// * "revision": the revision, as for NewVersionCollector
+// * "dirty": whether the working tree had local modifications, from "vcs.modified" in the BuildInfo.Settings map
+// * "goversion": the version of Go which built the binary
+// * "version": the version of the main module, "(devel)" unless installed with go install
+// Values which can't be determined are set to "unknown"
+func NewBuildInfoCollector() prometheus.GaugeFunc {
+	info := ReadBuildInfo()
+
+	return prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "build_info",
+			Help: "Build information about the main Go module.",
+			ConstLabels: prometheus.Labels{
+				"revision":  info.Revision,
+				"dirty":     info.Dirty,
+				"goversion": info.GoVersion,
+				"version":   info.Version,
 			},
 		},
 		func() float64 { return 1 },
@@ -0,0 +1,80 @@
+package fxmetrics
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBuildInfoCollector(t *testing.T) {
+	t.Run("Should expose the build information as labels of build_info", func(t *testing.T) {
+		reg, err := NewPrometheusRegistry(&Metrics{})
+		require.NoError(t, err)
+
+		families, err := reg.Gather()
+		require.NoError(t, err)
+		labels := map[string]string{}
+		found := false
+		for _, family := range families {
+			if family.GetName() != "build_info" {
+				continue
+			}
+			require.Len(t, family.GetMetric(), 1)
+			require.Equal(t, 1.0, family.GetMetric()[0].GetGauge().GetValue())
+			for _, l := range family.GetMetric()[0].GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			found = true
+		}
+
+		require.True(t, found)
+		require.NotEmpty(t, labels["revision"])
+		require.NotEmpty(t, labels["dirty"])
+		require.NotEmpty(t, labels["version"])
+		require.Equal(t, runtime.Version(), labels["goversion"])
+	})
+}
+
+func TestNewBuildInfo(t *testing.T) {
+	info := &debug.BuildInfo{
+		GoVersion: "go1.24.2",
+		Main:      debug.Module{Version: "v1.2.3"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "0123abcd"},
+			{Key: "vcs.time", Value: "2024-06-18T14:28:57Z"},
+			{Key: "vcs.modified", Value: "false"},
+		},
+	}
+
+	t.Run("Should read the vcs settings", func(t *testing.T) {
+		require.Equal(t, &BuildInfo{
+			Revision:          "0123abcd",
+			RevisionTimestamp: "2024-06-18T14:28:57Z",
+			Dirty:             "false",
+			GoVersion:         "go1.24.2",
+			Version:           "v1.2.3",
+		}, NewBuildInfo(info))
+	})
+
+	t.Run("Should prefer the revision set at link time", func(t *testing.T) {
+		revision, revisionTimestamp = "v1.0.0", "2024-01-01T00:00:00Z"
+		t.Cleanup(func() { revision, revisionTimestamp = "unknown", "unknown" })
+
+		got := NewBuildInfo(info)
+		require.Equal(t, "v1.0.0", got.Revision)
+		require.Equal(t, "2024-01-01T00:00:00Z", got.RevisionTimestamp)
+		require.Equal(t, "false", got.Dirty)
+	})
+
+	t.Run("Should default to unknown", func(t *testing.T) {
+		require.Equal(t, &BuildInfo{
+			Revision:          "unknown",
+			RevisionTimestamp: "unknown",
+			Dirty:             "unknown",
+			GoVersion:         runtime.Version(),
+			Version:           "unknown",
+		}, NewBuildInfo(&debug.BuildInfo{}))
+	})
+}
@@ -11,6 +11,7 @@ import (
 	runtimepprof "runtime/pprof"
 
 	"github.com/exoscale/stelling/fxhttp"
+	"github.com/exoscale/stelling/fxlogging/summary"
 	"go.uber.org/fx"
 	"go.uber.org/zap/zapcore"
 )
@@ -24,6 +25,7 @@ func NewModule(conf PprofConfig) fx.Option {
 			"pprof",
 			fx.Supply(fx.Annotate(conf, fx.As(new(PprofConfig))), fx.Private),
 			fx.Invoke(InvokeRuntimePprof),
+			summary.Provide("pprof", conf.PprofConfig()),
 		)
 	}
 
@@ -42,6 +44,7 @@ func NewModule(conf PprofConfig) fx.Option {
 					fx.ParamTags("", `name:"pprof"`, ""),
 				),
 			),
+			summary.Provide("pprof", conf.PprofConfig()),
 		)
 	}
 
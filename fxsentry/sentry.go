@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/TheZeroSlave/zapsentry"
+	"github.com/exoscale/stelling/fxlogging/summary"
 	sentry "github.com/getsentry/sentry-go"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
@@ -19,6 +20,7 @@ func NewModule(conf SentryConfig) fx.Option {
 		fx.Supply(fx.Annotate(conf, fx.As(new(SentryConfig))), fx.Private),
 		fx.Provide(ProvideSentryClient),
 		fx.Decorate(ProvideSentryLogger),
+		summary.Provide("sentry", conf.SentryConfig()),
 	)
 }
 
@@ -29,7 +31,8 @@ type SentryConfig interface {
 type Sentry struct {
 	// Dsn contains the sentry Dsn
 	// Sentry integration is disabled if this is empty
-	Dsn string
+	// It can be read from a file, eg: file:///run/secrets/sentry_dsn
+	Dsn string `fromFile:"true"`
 	// Environment is reported as the 'environment' tag in any sentry events
 	Environment string `default:"prod"`
 	// Debug controls whether sentry emits debugs logs about its own actions
@@ -48,7 +51,7 @@ func (s *Sentry) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 		return nil
 	}
 
-	enc.AddString("dsn", s.Dsn)
+	enc.AddString("dsn", summary.RedactURL(s.Dsn))
 	enc.AddString("environment", s.Environment)
 	enc.AddBool("debug", s.Debug)
 	enc.AddString("process", s.Process)
@@ -111,9 +114,11 @@ func ProvideSentryClient(lc fx.Lifecycle, conf SentryConfig) (*sentry.Client, er
 	}
 
 	if client != nil {
+		// Bind the client to the global hub, so it is reachable from goroutines without a hub in their context
+		sentry.CurrentHub().BindClient(client)
 		lc.Append(fx.Hook{
 			OnStop: func(ctx context.Context) error {
-				client.Flush(2 * time.Second)
+				client.Flush(flushTimeout)
 				return nil
 			},
 		})
@@ -121,6 +126,35 @@ func ProvideSentryClient(lc fx.Lifecycle, conf SentryConfig) (*sentry.Client, er
 	return client, nil
 }
 
+// flushTimeout bounds the time spent sending the pending events, when stopping or crashing
+const flushTimeout = 2 * time.Second
+
+// RecoverAndReport reports a panic of the current goroutine to sentry, then panics again
+// It must be deferred at the top of goroutines which are not started by a grpc or http server:
+//
+//	go func() {
+//		defer fxsentry.RecoverAndReport(ctx)
+//		...
+//	}()
+//
+// The hub of ctx is used if present, and the global hub, bound to the client of the module, otherwise
+func RecoverAndReport(ctx context.Context) {
+	err := recover()
+	if err == nil {
+		return
+	}
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+	hub.RecoverWithContext(ctx, err)
+	hub.Flush(flushTimeout)
+	panic(err)
+}
+
+// ProvideSentryLogger tees a sentry core next to the core of the given logger
+// The sentry core is not wrapped by the sampler of the logger, so every DPanic produces a sentry event,
+// even when the log lines themselves are sampled
 func ProvideSentryLogger(logger *zap.Logger, client *sentry.Client) *zap.Logger {
 	cfg := zapsentry.Configuration{
 		Level:             zapcore.DPanicLevel,
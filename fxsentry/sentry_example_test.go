@@ -37,9 +37,10 @@ func Example() {
 	app.Run()
 
 	// Output:
-	// {"level":"info","ts":"2009-11-10T23:00:00.000Z","msg":"Using configuration","conf":{"Mode":"production","Dsn":"","Environment":"prod","Debug":false,"Process":""}}
+	// {"level":"info","ts":"2009-11-10T23:00:00.000Z","msg":"Using configuration","conf":{"Mode":"production","Otlp":{"Enabled":false,"InsecureConnection":false,"CertFile":"","KeyFile":"","RootCAFile":"","Endpoint":""},"DisableInterceptors":false,"HttpAccessLog":{"Enabled":false,"SkipPaths":null},"LocalTraceIdPrefix":"","Dsn":"","Environment":"prod","Debug":false,"Process":""}}
+	// {"level":"info","ts":"2009-11-10T23:00:00.000Z","msg":"Stelling modules","modules":["logging","sentry"],"config":{"logging":{"mode":"production"},"sentry":{"dsn":"","environment":"prod","debug":false,"process":""}}}
 	// {"level":"dpanic","ts":"2009-11-10T23:00:00.000Z","msg":"Example sentry","error":"test error","extra-data":"some-value"}
-	// {"level":"info","ts":"2009-11-10T23:00:00.000Z","msg":"Final configuration","conf":{"Mode":"production","Dsn":"","Environment":"prod","Debug":false,"Process":""}}
+	// {"level":"info","ts":"2009-11-10T23:00:00.000Z","msg":"Final configuration","conf":{"Mode":"production","Otlp":{"Enabled":false,"InsecureConnection":false,"CertFile":"","KeyFile":"","RootCAFile":"","Endpoint":""},"DisableInterceptors":false,"HttpAccessLog":{"Enabled":false,"SkipPaths":null},"LocalTraceIdPrefix":"","Dsn":"","Environment":"prod","Debug":false,"Process":""}}
 }
 
 func testDPanic(logger *zap.Logger) {
@@ -0,0 +1,110 @@
+package fxsentry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	sentry "github.com/getsentry/sentry-go"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// recordingTransport is a sentry.Transport which keeps the events instead of sending them
+type recordingTransport struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+func (t *recordingTransport) Flush(time.Duration) bool { return true }
+
+func (t *recordingTransport) Configure(sentry.ClientOptions) {}
+
+func (t *recordingTransport) SendEvent(event *sentry.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+}
+
+func (t *recordingTransport) Close() {}
+
+func (t *recordingTransport) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.events)
+}
+
+func TestProvideSentryLogger(t *testing.T) {
+	t.Run("Should send every DPanic to sentry regardless of the sampling of the logger", func(t *testing.T) {
+		transport := &recordingTransport{}
+		client, err := sentry.NewClient(sentry.ClientOptions{
+			Dsn:       "https://public@sentry.example.com/1",
+			Transport: transport,
+		})
+		require.NoError(t, err)
+
+		// Only the first entry of each message is logged every minute
+		core, logs := observer.New(zap.InfoLevel)
+		logger := zap.New(zapcore.NewSamplerWithOptions(core, time.Minute, 1, 0))
+
+		logger = ProvideSentryLogger(logger, client)
+		for range 10 {
+			logger.DPanic("Something went wrong")
+		}
+
+		require.Equal(t, 1, logs.Len())
+		require.Equal(t, 10, transport.Len())
+	})
+}
+
+func TestRecoverAndReport(t *testing.T) {
+	newHub := func(t *testing.T) (*sentry.Hub, *recordingTransport) {
+		transport := &recordingTransport{}
+		client, err := sentry.NewClient(sentry.ClientOptions{
+			Dsn:              "https://public@sentry.example.com/1",
+			Transport:        transport,
+			AttachStacktrace: true,
+		})
+		require.NoError(t, err)
+		return sentry.NewHub(client, sentry.NewScope()), transport
+	}
+
+	t.Run("Should report the panic before panicking again", func(t *testing.T) {
+		hub, transport := newHub(t)
+		ctx := sentry.SetHubOnContext(context.Background(), hub)
+
+		var reported int
+		var repanicked any
+		func() {
+			defer func() {
+				reported = transport.Len()
+				repanicked = recover()
+			}()
+			defer RecoverAndReport(ctx)
+			panic(errors.New("worker failed"))
+		}()
+
+		require.EqualError(t, repanicked.(error), "worker failed")
+		require.Equal(t, 1, reported)
+		event := transport.events[0]
+		require.Len(t, event.Exception, 1)
+		require.Equal(t, "worker failed", event.Exception[0].Value)
+		require.NotNil(t, event.Exception[0].Stacktrace)
+		require.NotEmpty(t, event.Exception[0].Stacktrace.Frames)
+	})
+
+	t.Run("Should do nothing without a panic", func(t *testing.T) {
+		hub, transport := newHub(t)
+		ctx := sentry.SetHubOnContext(context.Background(), hub)
+
+		func() {
+			defer RecoverAndReport(ctx)
+		}()
+
+		require.Zero(t, transport.Len())
+	})
+}
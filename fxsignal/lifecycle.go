@@ -0,0 +1,48 @@
+package fxsignal
+
+import (
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap/zapcore"
+)
+
+type LifecycleConfig interface {
+	LifecycleConfig() *Lifecycle
+}
+
+type Lifecycle struct {
+	// StartTimeout is the maximum time the OnStart hooks of the system get to run, eg: to migrate a database
+	StartTimeout time.Duration `default:"15s" validate:"gte=0"`
+	// StopTimeout is the maximum time the OnStop hooks of the system get to run
+	// It is also the grace period of Run, when that one is unset
+	StopTimeout time.Duration `default:"15s" validate:"gte=0"`
+}
+
+func (l *Lifecycle) LifecycleConfig() *Lifecycle {
+	return l
+}
+
+func (l *Lifecycle) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if l == nil {
+		return nil
+	}
+
+	enc.AddDuration("start-timeout", l.StartTimeout)
+	enc.AddDuration("stop-timeout", l.StopTimeout)
+
+	return nil
+}
+
+// NewApp creates an fx.App with the configured start and stop timeouts
+// A zero timeout keeps the default of fx, fx.DefaultTimeout
+func NewApp(conf LifecycleConfig, opts ...fx.Option) *fx.App {
+	lc := conf.LifecycleConfig()
+	if lc.StartTimeout > 0 {
+		opts = append(opts, fx.StartTimeout(lc.StartTimeout))
+	}
+	if lc.StopTimeout > 0 {
+		opts = append(opts, fx.StopTimeout(lc.StopTimeout))
+	}
+	return fx.New(opts...)
+}
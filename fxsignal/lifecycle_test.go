@@ -0,0 +1,34 @@
+package fxsignal
+
+import (
+	"testing"
+	"time"
+
+	sconfig "github.com/exoscale/stelling/config"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+)
+
+func TestNewApp(t *testing.T) {
+	t.Run("Should apply the configured timeouts", func(t *testing.T) {
+		app := NewApp(&Lifecycle{StartTimeout: time.Minute, StopTimeout: 2 * time.Minute}, fx.NopLogger)
+		require.NoError(t, app.Err())
+		require.Equal(t, time.Minute, app.StartTimeout())
+		require.Equal(t, 2*time.Minute, app.StopTimeout())
+	})
+
+	t.Run("Should keep the fx defaults when the timeouts are unset", func(t *testing.T) {
+		app := NewApp(&Lifecycle{}, fx.NopLogger)
+		require.NoError(t, app.Err())
+		require.Equal(t, fx.DefaultTimeout, app.StartTimeout())
+		require.Equal(t, fx.DefaultTimeout, app.StopTimeout())
+	})
+
+	t.Run("Should load the timeouts from the configuration", func(t *testing.T) {
+		conf := &struct{ Lifecycle }{}
+		require.NoError(t, sconfig.Load(conf, []string{"test", "--lifecycle.start-timeout", "5m"}))
+		app := NewApp(conf, fx.NopLogger)
+		require.Equal(t, 5*time.Minute, app.StartTimeout())
+		require.Equal(t, fx.DefaultTimeout, app.StopTimeout())
+	})
+}
@@ -0,0 +1,79 @@
+package fxsignal
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/exoscale/stelling/fxlogging/summary"
+	"github.com/exoscale/stelling/fxmetrics/reloads"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// ReloadFunc reloads a part of the configuration of the running system, eg: the log level
+type ReloadFunc func(ctx context.Context) error
+
+// AsReloadFunc annotates a constructor of a ReloadFunc, so it is run by the ReloadModule on SIGHUP
+//
+//	fx.Provide(fxsignal.AsReloadFunc(func(level zap.AtomicLevel) fxsignal.ReloadFunc { ... }))
+func AsReloadFunc(constructor any) any {
+	return fx.Annotate(constructor, fx.ResultTags(`group:"reload_funcs"`))
+}
+
+// ReloadModule runs the functions of the `reload_funcs` group every time the process receives SIGHUP
+var ReloadModule = fx.Module(
+	"reload",
+	fx.Invoke(fx.Annotate(StartReloadHandler, fx.ParamTags(``, ``, `group:"reload_funcs"`))),
+	summary.Provide("reload", nil),
+)
+
+// StartReloadHandler runs funcs, in order, every time the process receives SIGHUP while the system is running
+// A failing function is logged and does not prevent the next ones from running
+func StartReloadHandler(lc fx.Lifecycle, logger *zap.Logger, funcs []ReloadFunc) {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			signal.Notify(sigs, syscall.SIGHUP)
+			go func() {
+				defer close(stopped)
+				for {
+					select {
+					case <-sigs:
+						reload(logger, funcs)
+					case <-done:
+						return
+					}
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			signal.Stop(sigs)
+			close(done)
+			select {
+			case <-stopped:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+}
+
+func reload(logger *zap.Logger, funcs []ReloadFunc) {
+	logger.Info("Received SIGHUP, reloading", zap.Int("reload_funcs", len(funcs)))
+	failed := 0
+	for _, f := range funcs {
+		err := f(context.Background())
+		reloads.Observe("sighup", err)
+		if err != nil {
+			logger.Error("Reload failed", zap.Error(err))
+			failed++
+		}
+	}
+	logger.Info("Reloaded", zap.Int("failed", failed))
+}
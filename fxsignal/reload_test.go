@@ -0,0 +1,80 @@
+package fxsignal
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/exoscale/stelling/fxlogging"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestReloadModule(t *testing.T) {
+	t.Run("Should change the log level on SIGHUP", func(t *testing.T) {
+		var logger *zap.Logger
+		app := fxtest.New(
+			t,
+			fx.NopLogger,
+			fxlogging.NewModule(&fxlogging.Logging{Mode: "production", DisableInterceptors: true}),
+			ReloadModule,
+			fx.Provide(
+				AsReloadFunc(func(level zap.AtomicLevel) ReloadFunc {
+					return func(context.Context) error {
+						// A real reload function would read the level from the configuration
+						level.SetLevel(zapcore.DebugLevel)
+						return nil
+					}
+				}),
+			),
+			fx.Populate(&logger),
+		)
+		app.RequireStart()
+		defer app.RequireStop()
+
+		require.False(t, logger.Core().Enabled(zapcore.DebugLevel))
+		require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+		require.Eventually(t, func() bool {
+			return logger.Core().Enabled(zapcore.DebugLevel)
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Should run the next reload functions when one fails", func(t *testing.T) {
+		core, logs := observer.New(zapcore.InfoLevel)
+		reloaded := make(chan struct{})
+		app := fxtest.New(
+			t,
+			fx.NopLogger,
+			fx.Supply(zap.New(core)),
+			ReloadModule,
+			fx.Provide(
+				AsReloadFunc(func() ReloadFunc {
+					return func(context.Context) error { return errors.New("bad config") }
+				}),
+				AsReloadFunc(func() ReloadFunc {
+					return func(context.Context) error { close(reloaded); return nil }
+				}),
+			),
+		)
+		app.RequireStart()
+		defer app.RequireStop()
+
+		require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+		select {
+		case <-reloaded:
+		case <-time.After(time.Second):
+			t.Fatal("the reload functions did not run")
+		}
+		require.Eventually(t, func() bool {
+			return logs.FilterMessage("Reloaded").Len() == 1
+		}, time.Second, 10*time.Millisecond)
+		require.Equal(t, "bad config", logs.FilterMessage("Reload failed").AllUntimed()[0].ContextMap()["error"])
+		require.Equal(t, int64(1), logs.FilterMessage("Reloaded").AllUntimed()[0].ContextMap()["failed"])
+	})
+}
@@ -0,0 +1,111 @@
+// Package fxsignal provides a replacement for fx.App.Run with a bounded shutdown.
+package fxsignal
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ForcedExitCode is the exit code of a process that did not shut down cleanly in time
+const ForcedExitCode = 1
+
+type ShutdownConfig interface {
+	ShutdownConfig() *Shutdown
+}
+
+type Shutdown struct {
+	// GracePeriod is the maximum time the system gets to stop once shutdown was requested
+	// The process is forcefully terminated when it expires
+	// The StopTimeout of the app is used when it is unset
+	GracePeriod time.Duration
+}
+
+func (s *Shutdown) ShutdownConfig() *Shutdown {
+	return s
+}
+
+func (s *Shutdown) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if s == nil {
+		return nil
+	}
+
+	enc.AddDuration("grace-period", s.GracePeriod)
+
+	return nil
+}
+
+// Run starts the app and blocks until it receives SIGINT or SIGTERM, or is shut down through an fx.Shutdowner
+// The received signal is logged, and the app is then stopped within the configured grace period.
+// The process exits immediately with ForcedExitCode when the grace period expires or when a second signal arrives.
+// Like fx.App.Run, it only returns when the app stopped cleanly with a 0 exit code, and exits the process otherwise.
+func Run(app *fx.App, conf ShutdownConfig, logger *zap.Logger) {
+	if code := run(app, conf.ShutdownConfig(), logger); code != 0 {
+		os.Exit(code)
+	}
+}
+
+func run(app *fx.App, conf *Shutdown, logger *zap.Logger) int {
+	gracePeriod := conf.GracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = app.StopTimeout()
+	}
+
+	// We register before starting the app, so that we see every signal fx sees
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	startCtx, cancel := context.WithTimeout(context.Background(), app.StartTimeout())
+	defer cancel()
+	if err := app.Start(startCtx); err != nil {
+		logger.Error("Failed to start the system", zap.Error(err))
+		return 1
+	}
+
+	exitCode := 0
+	select {
+	case sig := <-sigs:
+		logger.Info("Received signal, shutting down", zap.Stringer("signal", sig), zap.Duration("grace_period", gracePeriod))
+	case sd := <-app.Wait():
+		// The os delivers signals to all channels at once, so a signal received by fx is already in ours
+		select {
+		case sig := <-sigs:
+			logger.Info("Received signal, shutting down", zap.Stringer("signal", sig), zap.Duration("grace_period", gracePeriod))
+		default:
+			logger.Info("Shutdown requested", zap.Int("exit_code", sd.ExitCode), zap.Duration("grace_period", gracePeriod))
+			exitCode = sd.ExitCode
+		}
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- app.Stop(stopCtx)
+	}()
+
+	// OnStop hooks are not required to respect the context, so we can't rely on app.Stop returning in time
+	timer := time.NewTimer(gracePeriod)
+	defer timer.Stop()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			logger.Error("Failed to stop the system", zap.Error(err))
+			return 1
+		}
+		return exitCode
+	case sig := <-sigs:
+		logger.Error("Received second signal, forcing exit", zap.Stringer("signal", sig))
+	case <-timer.C:
+		logger.Error("System did not stop within the grace period, forcing exit", zap.Duration("grace_period", gracePeriod))
+	}
+	_ = logger.Sync()
+	return ForcedExitCode
+}
@@ -0,0 +1,147 @@
+package fxsignal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const helperEnv = "FXSIGNAL_TEST_HELPER"
+
+// TestHelperProcess is not a real test: it is the process the other tests send signals to
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv(helperEnv)
+	if mode == "" {
+		t.Skip("only runs as a subprocess")
+	}
+	gracePeriod, err := time.ParseDuration(os.Getenv("FXSIGNAL_TEST_GRACE_PERIOD"))
+	require.NoError(t, err)
+	stopTimeout := fx.DefaultTimeout
+	if s := os.Getenv("FXSIGNAL_TEST_STOP_TIMEOUT"); s != "" {
+		stopTimeout, err = time.ParseDuration(s)
+		require.NoError(t, err)
+	}
+
+	app := fx.New(
+		fx.NopLogger,
+		fx.StopTimeout(stopTimeout),
+		fx.Invoke(func(lc fx.Lifecycle) {
+			lc.Append(fx.Hook{
+				OnStart: func(context.Context) error {
+					fmt.Println("ready")
+					return nil
+				},
+				OnStop: func(context.Context) error {
+					if mode == "stuck" {
+						select {}
+					}
+					return nil
+				},
+			})
+		}),
+	)
+	Run(app, &Shutdown{GracePeriod: gracePeriod}, zap.NewExample())
+	os.Exit(0)
+}
+
+type helper struct {
+	cmd   *exec.Cmd
+	lines chan string
+}
+
+func startHelper(t *testing.T, mode string, gracePeriod time.Duration, env ...string) *helper {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), helperEnv+"="+mode, "FXSIGNAL_TEST_GRACE_PERIOD="+gracePeriod.String())
+	cmd.Env = append(cmd.Env, env...)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() { _ = cmd.Process.Kill() })
+
+	h := &helper{cmd: cmd, lines: make(chan string, 100)}
+	go func() {
+		defer close(h.lines)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			h.lines <- scanner.Text()
+		}
+	}()
+	h.waitFor(t, "ready")
+	return h
+}
+
+// waitFor consumes the output of the helper until a line contains s
+func (h *helper) waitFor(t *testing.T, s string) {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-h.lines:
+			require.True(t, ok, "helper exited before printing %q", s)
+			if strings.Contains(line, s) {
+				return
+			}
+		case <-timeout:
+			require.Fail(t, "helper did not print", s)
+		}
+	}
+}
+
+func (h *helper) signal(t *testing.T, sig os.Signal) {
+	require.NoError(t, h.cmd.Process.Signal(sig))
+}
+
+// exitCode waits for the helper to exit and returns its exit code
+func (h *helper) exitCode(t *testing.T) int {
+	done := make(chan error, 1)
+	go func() { done <- h.cmd.Wait() }()
+	select {
+	case <-done:
+		return h.cmd.ProcessState.ExitCode()
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "helper did not exit")
+		return -1
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Run("Should log the signal and stop cleanly", func(t *testing.T) {
+		h := startHelper(t, "clean", time.Minute)
+		h.signal(t, syscall.SIGINT)
+		h.waitFor(t, `"signal":"interrupt"`)
+		require.Equal(t, 0, h.exitCode(t))
+	})
+
+	t.Run("Should force exit on a second signal", func(t *testing.T) {
+		h := startHelper(t, "stuck", time.Minute)
+		h.signal(t, syscall.SIGTERM)
+		h.waitFor(t, "Received signal, shutting down")
+		h.signal(t, syscall.SIGTERM)
+		h.waitFor(t, "Received second signal, forcing exit")
+		require.Equal(t, ForcedExitCode, h.exitCode(t))
+	})
+
+	t.Run("Should force exit when the grace period expires", func(t *testing.T) {
+		h := startHelper(t, "stuck", 100*time.Millisecond)
+		h.signal(t, syscall.SIGTERM)
+		h.waitFor(t, "System did not stop within the grace period, forcing exit")
+		require.Equal(t, ForcedExitCode, h.exitCode(t))
+	})
+
+	t.Run("Should use the stop timeout of the app when the grace period is unset", func(t *testing.T) {
+		h := startHelper(t, "stuck", 0, "FXSIGNAL_TEST_STOP_TIMEOUT=100ms")
+		h.signal(t, syscall.SIGTERM)
+		h.waitFor(t, `"grace_period":"100ms"`)
+		h.waitFor(t, "System did not stop within the grace period, forcing exit")
+		require.Equal(t, ForcedExitCode, h.exitCode(t))
+	})
+}
@@ -0,0 +1,136 @@
+// Package fxsqlite provides a configured sqlite *sql.DB, backed by modernc.org/sqlite
+package fxsqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/exoscale/stelling/fxlogging/summary"
+	"github.com/exoscale/stelling/sqlite/migration"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	_ "modernc.org/sqlite"
+)
+
+// NewModule provides a *sql.DB configured by conf, which is closed when the system stops
+// When Migrate is set, the module requires a *migration.Migrations and applies it to the database on start
+func NewModule(conf SqliteConfig) fx.Option {
+	opts := fx.Options(
+		fx.Supply(fx.Annotate(conf, fx.As(new(SqliteConfig))), fx.Private),
+		fx.Provide(ProvideDB),
+		summary.Provide("sqlite", conf.SqliteConfig()),
+	)
+	if conf.SqliteConfig().Migrate {
+		opts = fx.Options(opts, fx.Invoke(InvokeMigrations))
+	}
+
+	return fx.Module("sqlite", opts)
+}
+
+type SqliteConfig interface {
+	SqliteConfig() *Sqlite
+}
+
+type Sqlite struct {
+	// DSN is the data source name of the database, typically the path to the database file
+	// It can hold additional parameters of the modernc.org/sqlite driver
+	DSN string `validate:"required"`
+	// BusyTimeout is the time a connection waits for a lock held by another one before failing with SQLITE_BUSY
+	BusyTimeout time.Duration `default:"5s" validate:"gte=0"`
+	// JournalMode is the journal mode of the database
+	JournalMode string `default:"WAL" validate:"omitempty,oneof=DELETE TRUNCATE PERSIST MEMORY WAL OFF"`
+	// MaxOpenConns is the maximum number of open connections to the database
+	// sqlite only allows a single writer at a time: more connections mostly benefit read heavy workloads
+	// 0 means there is no limit
+	MaxOpenConns int `default:"1" validate:"gte=0"`
+	// Migrate applies the provided *migration.Migrations to the database when the system starts
+	Migrate bool
+}
+
+func (s *Sqlite) SqliteConfig() *Sqlite {
+	return s
+}
+
+func (s *Sqlite) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if s == nil {
+		return nil
+	}
+
+	enc.AddString("dsn", s.DSN)
+	enc.AddDuration("busy-timeout", s.BusyTimeout)
+	if s.JournalMode != "" {
+		enc.AddString("journal-mode", s.JournalMode)
+	}
+	enc.AddInt("max-open-conns", s.MaxOpenConns)
+	enc.AddBool("migrate", s.Migrate)
+
+	return nil
+}
+
+// dsn appends the PRAGMAs of the config to the DSN, so the driver applies them to every connection
+func dsn(conf *Sqlite) string {
+	params := url.Values{}
+	// busy_timeout must be set first, so it applies to the other PRAGMAs
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", conf.BusyTimeout.Milliseconds()))
+	if conf.JournalMode != "" {
+		params.Add("_pragma", fmt.Sprintf("journal_mode(%s)", conf.JournalMode))
+	}
+
+	sep := "?"
+	if strings.Contains(conf.DSN, "?") {
+		sep = "&"
+	}
+	return conf.DSN + sep + params.Encode()
+}
+
+// NewDB opens the database described by conf
+// The caller is responsible for closing it
+func NewDB(conf SqliteConfig) (*sql.DB, error) {
+	c := conf.SqliteConfig()
+	db, err := sql.Open("sqlite", dsn(c))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(c.MaxOpenConns)
+
+	return db, nil
+}
+
+// ProvideDB opens the database described by conf and closes it when the system stops
+func ProvideDB(lc fx.Lifecycle, conf SqliteConfig) (*sql.DB, error) {
+	db, err := NewDB(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			// sql.Open does not connect: this surfaces errors in the configuration on start
+			return db.PingContext(ctx)
+		},
+		OnStop: func(ctx context.Context) error {
+			return db.Close()
+		},
+	})
+
+	return db, nil
+}
+
+// InvokeMigrations applies the migrations to the database when the system starts
+func InvokeMigrations(lc fx.Lifecycle, db *sql.DB, m *migration.Migrations, logger *zap.Logger) {
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			version, latest, err := m.Status(ctx, db)
+			if err != nil {
+				return err
+			}
+			logger.Info("Migrating database", zap.Uint64("from", version), zap.Uint64("to", latest))
+			return m.Up(ctx, db)
+		},
+	})
+}
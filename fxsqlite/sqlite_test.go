@@ -0,0 +1,95 @@
+package fxsqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/exoscale/stelling/sqlite/migration"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func testMigrations(t *testing.T) *migration.Migrations {
+	t.Helper()
+	m, err := migration.NewMigrations(
+		[]string{
+			"CREATE TABLE test1 (name text, value int);",
+			"CREATE TABLE test2 (name text, value int);",
+		},
+		[]string{
+			"DROP TABLE test1;",
+			"DROP TABLE test2;",
+		},
+	)
+	require.NoError(t, err)
+	return m
+}
+
+func TestNewModule(t *testing.T) {
+	t.Run("Should migrate the provided database on start", func(t *testing.T) {
+		m := testMigrations(t)
+		conf := &Sqlite{
+			DSN:          filepath.Join(t.TempDir(), "testdb"),
+			BusyTimeout:  5 * time.Second,
+			JournalMode:  "WAL",
+			MaxOpenConns: 1,
+			Migrate:      true,
+		}
+		var db *sql.DB
+		app := fxtest.New(t, NewModule(conf), fx.Supply(m, zap.NewNop()), fx.Populate(&db))
+
+		app.RequireStart()
+		version, latest, err := m.Status(context.Background(), db)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), version)
+		require.Equal(t, uint64(2), latest)
+
+		var journalMode string
+		var busyTimeout int
+		require.NoError(t, db.QueryRow("PRAGMA journal_mode").Scan(&journalMode))
+		require.NoError(t, db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout))
+		require.Equal(t, "wal", journalMode)
+		require.Equal(t, 5000, busyTimeout)
+		require.Equal(t, 1, db.Stats().MaxOpenConnections)
+
+		app.RequireStop()
+		require.ErrorContains(t, db.Ping(), "database is closed")
+	})
+
+	t.Run("Should not migrate the database unless configured", func(t *testing.T) {
+		conf := &Sqlite{DSN: filepath.Join(t.TempDir(), "testdb")}
+		var db *sql.DB
+		// The migrations are not required either
+		app := fxtest.New(t, NewModule(conf), fx.Supply(zap.NewNop()), fx.Populate(&db))
+
+		app.RequireStart()
+		version, _, err := testMigrations(t).Status(context.Background(), db)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), version)
+		app.RequireStop()
+	})
+
+	t.Run("Should keep the parameters of the DSN", func(t *testing.T) {
+		conf := &Sqlite{DSN: "file:params?mode=memory&cache=shared", JournalMode: "MEMORY"}
+		require.Equal(t, "file:params?mode=memory&cache=shared&_pragma=busy_timeout%280%29&_pragma=journal_mode%28MEMORY%29", dsn(conf))
+
+		db, err := NewDB(conf)
+		require.NoError(t, err)
+		defer func() { _ = db.Close() }()
+		var journalMode string
+		require.NoError(t, db.QueryRow("PRAGMA journal_mode").Scan(&journalMode))
+		require.Equal(t, "memory", journalMode)
+	})
+
+	t.Run("Should fail to start if the database can't be opened", func(t *testing.T) {
+		conf := &Sqlite{DSN: filepath.Join(t.TempDir(), "missing", "testdb")}
+		app := fx.New(NewModule(conf), fx.Supply(zap.NewNop()), fx.Invoke(func(*sql.DB) {}), fx.NopLogger)
+
+		require.Error(t, app.Start(context.Background()))
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/exoscale/stelling/fxlogging/summary"
 	"github.com/go-logr/zapr"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.opentelemetry.io/otel"
@@ -16,18 +17,27 @@ import (
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
 )
 
 // NewModule provides an opentelemetry TracingProvider to the system
 func NewModule(conf TracingConfig) fx.Option {
+	instrumentation := fx.Provide(
+		NewGrpcServerInterceptors,
+		NewGrpcClientInterceptors,
+	)
+	if conf.TracingConfig().UseStatsHandler {
+		instrumentation = fx.Provide(
+			NewGrpcServerStatsHandler,
+			NewGrpcClientStatsHandler,
+		)
+	}
 	return fx.Module(
 		"tracing",
 		fx.Supply(fx.Annotate(conf, fx.As(new(TracingConfig))), fx.Private),
-		fx.Provide(
-			NewTracerProvider,
-			NewGrpcServerInterceptors,
-			NewGrpcClientInterceptors,
-		),
+		fx.Provide(NewTracerProvider),
+		instrumentation,
+		summary.Provide("tracing", conf.TracingConfig()),
 	)
 }
 
@@ -41,13 +51,16 @@ type Tracing struct {
 	// InsecureConnection indicates whether TLS needs to be disabled when connecting to the grpc server
 	InsecureConnection bool
 	// CertFile is the path to the pem encoded TLS certificate
-	CertFile string `validate:"required_if=Enabled true InsecureConnection false,omitempty,file"`
+	CertFile string `validate:"required_with=KeyFile,omitempty,file"`
 	// KeyFile is the path to the pem encoded private key of the TLS certificate
-	KeyFile string `validate:"required_if=Enabled true InsecureConnection false,omitempty,file"`
+	KeyFile string `validate:"required_with=CertFile,omitempty,file"`
 	// RootCAFile is the  path to a pem encoded CA bundle used to validate server connections
-	RootCAFile string `validate:"required_if=Enabled true InsecureConnection false,omitempty,file"`
+	RootCAFile string `validate:"omitempty,file"`
 	// Endpoint is the address + port where the collector can be reached
 	Endpoint string `validate:"required_if=Enabled true InsecureConnection false,omitempty,hostname_port"`
+	// UseStatsHandler instruments grpc servers and clients with a stats.Handler rather than interceptors
+	// The stats.Handler is incompatible with receive buffer reuse
+	UseStatsHandler bool
 }
 
 func (t *Tracing) TracingConfig() *Tracing {
@@ -72,12 +85,10 @@ func (t *Tracing) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	enc.AddBool("enabled", t.Enabled)
 	if t.Enabled {
 		enc.AddString("endpoint", t.Endpoint)
-		enc.AddBool("insecure-connection", t.InsecureConnection)
-		if !t.InsecureConnection {
-			enc.AddString("cert-file", t.CertFile)
-			enc.AddString("key-file", t.KeyFile)
-			enc.AddString("root-ca-file", t.RootCAFile)
+		if err := t.GrpcClientConfig().ClientTLSConfig().MarshalLogObject(enc); err != nil {
+			return err
 		}
+		enc.AddBool("use-stats-handler", t.UseStatsHandler)
 	}
 
 	return nil
@@ -149,6 +160,13 @@ func NewTracerProvider(lc fx.Lifecycle, conf TracingConfig, logger *zap.Logger)
 	return tracerProvider, nil
 }
 
+func newPropagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(
+		propagation.Baggage{},
+		propagation.TraceContext{},
+	)
+}
+
 type GrpcServerInterceptorsResult struct {
 	fx.Out
 
@@ -160,19 +178,17 @@ const GrpcInterceptorWeight = 30
 
 // NewGrpcClientInterceptors returns OpenTelemetry tracing interceptors that can be used as middleware in a gRPC server
 func NewGrpcServerInterceptors(tracerProvider trace.TracerProvider) (GrpcServerInterceptorsResult, error) {
+	propagator := newPropagator()
 
-	propagator := propagation.NewCompositeTextMapPropagator(
-		propagation.Baggage{},
-		propagation.TraceContext{},
-	)
-
-	// We explicitly rely on the deprecated interceptor implementation
+	// We rely on the deprecated interceptor implementation by default
 	// The new implementation relies on a stats.Handler which is incompatible
 	// with receive buffer reuse: https://github.com/grpc/grpc-go/blob/master/experimental/experimental.go#L40-L42
 	// The receive buffer reuse is important for our performance sensitive use cases
+	// The stats.Handler can be opted into with UseStatsHandler
 
 	return GrpcServerInterceptorsResult{
 		UnaryServerInterceptor: &fxgrpc.UnaryServerInterceptor{
+			Name:   "tracing",
 			Weight: GrpcInterceptorWeight,
 			Interceptor: otelgrpc.UnaryServerInterceptor( //nolint:staticcheck
 				otelgrpc.WithTracerProvider(tracerProvider),
@@ -180,6 +196,7 @@ func NewGrpcServerInterceptors(tracerProvider trace.TracerProvider) (GrpcServerI
 			),
 		},
 		StreamServerInterceptor: &fxgrpc.StreamServerInterceptor{
+			Name:   "tracing",
 			Weight: GrpcInterceptorWeight,
 			Interceptor: otelgrpc.StreamServerInterceptor( //nolint:staticcheck
 				otelgrpc.WithTracerProvider(tracerProvider),
@@ -198,18 +215,17 @@ type GrpcClientInterceptorsResult struct {
 
 // NewGrpcClientInterceptors returns OpenTelemetry tracing interceptors that can be used as middleware in a gRPC client
 func NewGrpcClientInterceptors(tracerProvider trace.TracerProvider) (GrpcClientInterceptorsResult, error) {
-	propagator := propagation.NewCompositeTextMapPropagator(
-		propagation.Baggage{},
-		propagation.TraceContext{},
-	)
+	propagator := newPropagator()
 
-	// We explicitly rely on the deprecated interceptor implementation
+	// We rely on the deprecated interceptor implementation by default
 	// The new implementation relies on a stats.Handler which is incompatible
 	// with receive buffer reuse: https://github.com/grpc/grpc-go/blob/master/experimental/experimental.go#L40-L42
 	// The receive buffer reuse is important for our performance sensitive use cases
+	// The stats.Handler can be opted into with UseStatsHandler
 
 	return GrpcClientInterceptorsResult{
 		UnaryClientInterceptor: &fxgrpc.UnaryClientInterceptor{
+			Name:   "tracing",
 			Weight: GrpcInterceptorWeight,
 			Interceptor: otelgrpc.UnaryClientInterceptor( //nolint:staticcheck
 				otelgrpc.WithTracerProvider(tracerProvider),
@@ -217,6 +233,7 @@ func NewGrpcClientInterceptors(tracerProvider trace.TracerProvider) (GrpcClientI
 			),
 		},
 		StreamClientInterceptor: &fxgrpc.StreamClientInterceptor{
+			Name:   "tracing",
 			Weight: GrpcInterceptorWeight,
 			Interceptor: otelgrpc.StreamClientInterceptor( //nolint:staticcheck
 				otelgrpc.WithTracerProvider(tracerProvider),
@@ -225,3 +242,37 @@ func NewGrpcClientInterceptors(tracerProvider trace.TracerProvider) (GrpcClientI
 		},
 	}, nil
 }
+
+type GrpcServerStatsHandlerResult struct {
+	fx.Out
+
+	grpc.ServerOption `group:"grpc_server_options"`
+}
+
+// NewGrpcServerStatsHandler returns an OpenTelemetry tracing stats.Handler that traces all incoming requests of a gRPC server
+// It replaces NewGrpcServerInterceptors when UseStatsHandler is set
+func NewGrpcServerStatsHandler(tracerProvider trace.TracerProvider) GrpcServerStatsHandlerResult {
+	return GrpcServerStatsHandlerResult{
+		ServerOption: grpc.StatsHandler(otelgrpc.NewServerHandler(
+			otelgrpc.WithTracerProvider(tracerProvider),
+			otelgrpc.WithPropagators(newPropagator()),
+		)),
+	}
+}
+
+type GrpcClientStatsHandlerResult struct {
+	fx.Out
+
+	grpc.DialOption `group:"grpc_client_options"`
+}
+
+// NewGrpcClientStatsHandler returns an OpenTelemetry tracing stats.Handler that traces all requests made with a gRPC client
+// It replaces NewGrpcClientInterceptors when UseStatsHandler is set
+func NewGrpcClientStatsHandler(tracerProvider trace.TracerProvider) GrpcClientStatsHandlerResult {
+	return GrpcClientStatsHandlerResult{
+		DialOption: grpc.WithStatsHandler(otelgrpc.NewClientHandler(
+			otelgrpc.WithTracerProvider(tracerProvider),
+			otelgrpc.WithPropagators(newPropagator()),
+		)),
+	}
+}
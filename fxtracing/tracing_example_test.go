@@ -38,8 +38,9 @@ func Example() {
 	// But then I also need to figure out why the example test isn't currently checking the output anyway
 
 	// Output:
-	// {"level":"info","ts":"2009-11-10T23:00:00.000Z","msg":"Using configuration","conf":{"Mode":"production","Enabled":true,"InsecureConnection":true,"CertFile":"","KeyFile":"","RootCAFile":"","Endpoint":""}}
-	// {"level":"info","ts":"2009-11-10T23:00:00.000Z","msg":"Final configuration","conf":{"Mode":"production","Enabled":true,"InsecureConnection":true,"CertFile":"","KeyFile":"","RootCAFile":"","Endpoint":""}}
+	// {"level":"info","ts":"2009-11-10T23:00:00.000Z","msg":"Using configuration","conf":{"Mode":"production","Otlp":{"Enabled":false,"InsecureConnection":false,"CertFile":"","KeyFile":"","RootCAFile":"","Endpoint":""},"DisableInterceptors":false,"HttpAccessLog":{"Enabled":false,"SkipPaths":null},"LocalTraceIdPrefix":"","Enabled":true,"InsecureConnection":true,"CertFile":"","KeyFile":"","RootCAFile":"","Endpoint":"","UseStatsHandler":false}}
+	// {"level":"info","ts":"2009-11-10T23:00:00.000Z","msg":"Stelling modules","modules":["logging","tracing"],"config":{"logging":{"mode":"production"},"tracing":{"enabled":true,"endpoint":"","insecure-connection":true,"use-stats-handler":false}}}
+	// {"level":"info","ts":"2009-11-10T23:00:00.000Z","msg":"Final configuration","conf":{"Mode":"production","Otlp":{"Enabled":false,"InsecureConnection":false,"CertFile":"","KeyFile":"","RootCAFile":"","Endpoint":""},"DisableInterceptors":false,"HttpAccessLog":{"Enabled":false,"SkipPaths":null},"LocalTraceIdPrefix":"","Enabled":true,"InsecureConnection":true,"CertFile":"","KeyFile":"","RootCAFile":"","Endpoint":"","UseStatsHandler":false}}
 }
 
 func run(lc fx.Lifecycle, sd fx.Shutdowner, tp trace.TracerProvider) {
@@ -0,0 +1,89 @@
+package fxtracing
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/exoscale/stelling/fxgrpc"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type instrumentation struct {
+	fx.In
+
+	UnaryServer  []*fxgrpc.UnaryServerInterceptor  `group:"unary_server_interceptor"`
+	StreamServer []*fxgrpc.StreamServerInterceptor `group:"stream_server_interceptor"`
+	UnaryClient  []*fxgrpc.UnaryClientInterceptor  `group:"unary_client_interceptor"`
+	StreamClient []*fxgrpc.StreamClientInterceptor `group:"stream_client_interceptor"`
+	ServerOpts   []grpc.ServerOption               `group:"grpc_server_options"`
+	ClientOpts   []grpc.DialOption                 `group:"grpc_client_options"`
+}
+
+func TestUseStatsHandler(t *testing.T) {
+	t.Run("Should provide interceptors by default", func(t *testing.T) {
+		var got instrumentation
+		app := fxtest.New(t, NewModule(&Tracing{}), fx.Supply(zap.NewNop()), fx.Populate(&got))
+		app.RequireStart().RequireStop()
+
+		require.Len(t, got.UnaryServer, 1)
+		require.Len(t, got.StreamServer, 1)
+		require.Len(t, got.UnaryClient, 1)
+		require.Len(t, got.StreamClient, 1)
+		require.Empty(t, got.ServerOpts)
+		require.Empty(t, got.ClientOpts)
+	})
+
+	t.Run("Should provide stats handlers rather than interceptors under the flag", func(t *testing.T) {
+		var got instrumentation
+		app := fxtest.New(t, NewModule(&Tracing{UseStatsHandler: true}), fx.Supply(zap.NewNop()), fx.Populate(&got))
+		app.RequireStart().RequireStop()
+
+		require.Empty(t, got.UnaryServer)
+		require.Empty(t, got.StreamServer)
+		require.Empty(t, got.UnaryClient)
+		require.Empty(t, got.StreamClient)
+		require.Len(t, got.ServerOpts, 1)
+		require.Len(t, got.ClientOpts, 1)
+	})
+
+	t.Run("Should trace requests through the stats handlers", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+		lis := bufconn.Listen(1024 * 1024)
+		server := grpc.NewServer(NewGrpcServerStatsHandler(tp).ServerOption)
+		pb.RegisterRouteGuideServer(server, pb.UnimplementedRouteGuideServer{})
+		go server.Serve(lis) //nolint:errcheck
+		defer server.Stop()
+
+		conn, err := grpc.NewClient(
+			"passthrough://bufconn",
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+			NewGrpcClientStatsHandler(tp).DialOption,
+		)
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		_, err = pb.NewRouteGuideClient(conn).GetFeature(context.Background(), &pb.Point{})
+		require.Error(t, err)
+
+		// The server span ends asynchronously
+		require.Eventually(t, func() bool { return len(recorder.Ended()) == 2 }, time.Second, 10*time.Millisecond)
+		spans := recorder.Ended()
+		require.Equal(t, "routeguide.RouteGuide/GetFeature", spans[0].Name())
+		require.Equal(t, "routeguide.RouteGuide/GetFeature", spans[1].Name())
+		require.Equal(t, spans[0].SpanContext().TraceID(), spans[1].SpanContext().TraceID())
+	})
+}
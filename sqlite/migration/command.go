@@ -0,0 +1,139 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DatabaseConfig describes the database on which RunCommand operates
+type DatabaseConfig interface {
+	DatabaseConfig() *Database
+}
+
+type Database struct {
+	// DSN is the data source name of the sqlite database
+	// The "sqlite" driver must be registered, for instance by importing modernc.org/sqlite
+	DSN string `validate:"required"`
+}
+
+func (d *Database) DatabaseConfig() *Database {
+	return d
+}
+
+func (d *Database) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if d == nil {
+		return nil
+	}
+
+	enc.AddString("dsn", d.DSN)
+
+	return nil
+}
+
+const commandUsage = "usage: migrate up|down|to <version>|status"
+
+// Status returns the current version of the database and the latest version of the migrations
+// Unlike Migrate, it does not create the version table when it does not exist
+func (m *Migrations) Status(ctx context.Context, db *sql.DB) (uint64, uint64, error) {
+	latest := uint64(len(m.UpScripts))
+
+	var tables int
+	row := db.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_schema WHERE type = 'table' AND name = 'schema_migrations'")
+	if err := row.Scan(&tables); err != nil {
+		return 0, latest, fmt.Errorf("status failed: %w", err)
+	}
+	if tables == 0 {
+		return 0, latest, nil
+	}
+
+	version, err := dbVersion(ctx, db)
+	if err != nil {
+		return 0, latest, fmt.Errorf("status failed: %w", err)
+	}
+	return version, latest, nil
+}
+
+// EnsureLatest returns an error if the database is not at the latest version of the migrations
+// Unlike Up, it does not modify the database: it is meant for readiness checks
+func (m *Migrations) EnsureLatest(ctx context.Context, db *sql.DB) error {
+	version, latest, err := m.Status(ctx, db)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version < latest:
+		return fmt.Errorf("database version %d is behind the latest migration version %d: %d pending migrations", version, latest, latest-version)
+	case version > latest:
+		return fmt.Errorf("database version %d is higher than max migration version %d", version, latest)
+	}
+	return nil
+}
+
+// RunCommand runs the migration subcommand described by args on the database of conf:
+// * up: applies all migrations
+// * down: reverts all migrations
+// * to <version>: migrates up or down to the given version
+// * status: logs the current version of the database and the latest version of the migrations
+func RunCommand(ctx context.Context, m *Migrations, conf DatabaseConfig, args []string, logger *zap.Logger) error {
+	if len(args) == 0 {
+		return errors.New(commandUsage)
+	}
+
+	var target uint64
+	switch args[0] {
+	case "up":
+		target = uint64(len(m.UpScripts))
+	case "down":
+		target = 0
+	case "to":
+		if len(args) != 2 {
+			return errors.New(commandUsage)
+		}
+		v, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q: %w", args[1], err)
+		}
+		target = v
+	case "status":
+	default:
+		return fmt.Errorf("unknown command %q, %s", args[0], commandUsage)
+	}
+	if len(args) > 1 && args[0] != "to" {
+		return errors.New(commandUsage)
+	}
+
+	c := conf.DatabaseConfig()
+	logger = logger.With(zap.Object("database", c))
+	db, err := sql.Open("sqlite", c.DSN)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+	// A single connection is enough, and keeps all operations on the same in-memory database
+	db.SetMaxOpenConns(1)
+
+	version, latest, err := m.Status(ctx, db)
+	if err != nil {
+		return err
+	}
+	if args[0] == "status" {
+		logger.Info("Migration status", zap.Uint64("version", version), zap.Uint64("latest", latest))
+		return nil
+	}
+
+	logger.Info("Migrating database", zap.String("command", args[0]), zap.Uint64("from", version), zap.Uint64("to", target))
+	start := time.Now()
+	if err := m.Migrate(ctx, db, target); err != nil {
+		logger.Error("Failed to migrate database", zap.Error(err))
+		return err
+	}
+	logger.Info("Migrated database", zap.Uint64("version", target), zap.Duration("duration", time.Since(start)))
+	return nil
+}
@@ -0,0 +1,159 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRunCommand(t *testing.T) {
+	up := []string{
+		"CREATE TABLE test1 (name text, value int);",
+		"CREATE TABLE test2 (name text, value int);",
+		"CREATE TABLE test3 (name text, value int);",
+	}
+	down := []string{
+		"DROP TABLE test1;",
+		"DROP TABLE test2;",
+		"DROP TABLE test3;",
+	}
+	migrations, err := NewMigrations(up, down)
+	require.NoError(t, err)
+
+	// sharedDb returns the config of a named in-memory database, which lives as long as the returned handle
+	sharedDb := func(t *testing.T, name string) (*Database, *sql.DB) {
+		t.Helper()
+		conf := &Database{DSN: "file:" + name + "?mode=memory&cache=shared"}
+		db, err := sql.Open("sqlite", conf.DSN)
+		require.NoError(t, err)
+		require.NoError(t, db.Ping())
+		t.Cleanup(func() { _ = db.Close() })
+		return conf, db
+	}
+
+	statusOf := func(t *testing.T, conf *Database) map[string]any {
+		t.Helper()
+		core, logs := observer.New(zap.InfoLevel)
+		require.NoError(t, RunCommand(context.Background(), migrations, conf, []string{"status"}, zap.New(core)))
+		entries := logs.FilterMessage("Migration status").All()
+		require.Len(t, entries, 1)
+		return entries[0].ContextMap()
+	}
+
+	t.Run("Should report the status of a new database without modifying it", func(t *testing.T) {
+		conf, db := sharedDb(t, "status")
+
+		status := statusOf(t, conf)
+		require.Equal(t, map[string]any{"version": uint64(0), "latest": uint64(3), "database": map[string]any{"dsn": conf.DSN}}, status)
+		require.Empty(t, dbSchema(t, db))
+	})
+
+	t.Run("Should migrate to the given version", func(t *testing.T) {
+		conf, db := sharedDb(t, "to")
+		core, logs := observer.New(zap.InfoLevel)
+
+		require.NoError(t, RunCommand(context.Background(), migrations, conf, []string{"to", "2"}, zap.New(core)))
+		version, err := dbVersion(context.Background(), db)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), version)
+		require.Equal(t, 1, logs.FilterMessage("Migrating database").Len())
+		require.Equal(t, 1, logs.FilterMessage("Migrated database").Len())
+
+		status := statusOf(t, conf)
+		require.Equal(t, uint64(2), status["version"])
+
+		require.NoError(t, RunCommand(context.Background(), migrations, conf, []string{"to", "1"}, zap.NewNop()))
+		status = statusOf(t, conf)
+		require.Equal(t, uint64(1), status["version"])
+	})
+
+	t.Run("Should migrate up and down", func(t *testing.T) {
+		conf, db := sharedDb(t, "updown")
+
+		require.NoError(t, RunCommand(context.Background(), migrations, conf, []string{"up"}, zap.NewNop()))
+		version, err := dbVersion(context.Background(), db)
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), version)
+
+		require.NoError(t, RunCommand(context.Background(), migrations, conf, []string{"down"}, zap.NewNop()))
+		version, err = dbVersion(context.Background(), db)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), version)
+	})
+
+	t.Run("Should return an error for invalid commands", func(t *testing.T) {
+		conf, _ := sharedDb(t, "invalid")
+
+		testCases := []struct {
+			args     []string
+			expected string
+		}{
+			{args: nil, expected: "usage: migrate up|down|to <version>|status"},
+			{args: []string{"sideways"}, expected: `unknown command "sideways", usage: migrate up|down|to <version>|status`},
+			{args: []string{"to"}, expected: "usage: migrate up|down|to <version>|status"},
+			{args: []string{"to", "two"}, expected: `invalid version "two": strconv.ParseUint: parsing "two": invalid syntax`},
+			{args: []string{"up", "3"}, expected: "usage: migrate up|down|to <version>|status"},
+			{args: []string{"to", "4"}, expected: "migrate failed: target version 4 is higher than max migration version 3"},
+		}
+		for _, tc := range testCases {
+			err := RunCommand(context.Background(), migrations, conf, tc.args, zap.NewNop())
+			require.EqualError(t, err, tc.expected, tc.args)
+		}
+	})
+}
+
+func TestMigrationsEnsureLatest(t *testing.T) {
+	up := []string{
+		"CREATE TABLE test1 (name text, value int);",
+		"CREATE TABLE test2 (name text, value int);",
+	}
+	down := []string{
+		"DROP TABLE test1;",
+		"DROP TABLE test2;",
+	}
+	migrations, err := NewMigrations(up, down)
+	require.NoError(t, err)
+
+	t.Run("Should succeed when the database is at the latest version", func(t *testing.T) {
+		db := testDb(t)
+		db.SetMaxOpenConns(1)
+		require.NoError(t, migrations.Up(context.Background(), db))
+
+		require.NoError(t, migrations.EnsureLatest(context.Background(), db))
+	})
+
+	t.Run("Should fail without migrating when the database is behind", func(t *testing.T) {
+		db := testDb(t)
+		db.SetMaxOpenConns(1)
+		require.NoError(t, migrations.Migrate(context.Background(), db, 1))
+
+		err := migrations.EnsureLatest(context.Background(), db)
+		require.EqualError(t, err, "database version 1 is behind the latest migration version 2: 1 pending migrations")
+		version, err := dbVersion(context.Background(), db)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), version)
+	})
+
+	t.Run("Should fail without creating the version table on a new database", func(t *testing.T) {
+		db := testDb(t)
+		db.SetMaxOpenConns(1)
+
+		err := migrations.EnsureLatest(context.Background(), db)
+		require.EqualError(t, err, "database version 0 is behind the latest migration version 2: 2 pending migrations")
+		require.Empty(t, dbSchema(t, db))
+	})
+
+	t.Run("Should fail when the database is ahead of the migrations", func(t *testing.T) {
+		db := testDb(t)
+		db.SetMaxOpenConns(1)
+		require.NoError(t, migrations.Up(context.Background(), db))
+
+		older, err := NewMigrations(up[:1], down[:1])
+		require.NoError(t, err)
+		require.EqualError(t, older.EnsureLatest(context.Background(), db), "database version 2 is higher than max migration version 1")
+	})
+}
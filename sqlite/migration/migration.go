@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"regexp"
+	"time"
 
 	"github.com/exoscale/stelling/sqlite/migrationx"
 )
@@ -22,6 +24,24 @@ func ensureVersionSchema(ctx context.Context, tx sqlExecutor) error {
 	return err
 }
 
+func ensureHistorySchema(ctx context.Context, tx sqlExecutor) error {
+	_, err := tx.ExecContext(ctx, migrationx.HistorySchema)
+	return err
+}
+
+func addHistory(ctx context.Context, tx sqlExecutor, version uint64, direction string, appliedAt time.Time, duration time.Duration, script string) error {
+	_, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO schema_migration_history (version, direction, applied_at, duration_ms, checksum) VALUES (?, ?, ?, ?, ?)",
+		version,
+		direction,
+		appliedAt.UTC().Format(time.RFC3339Nano),
+		duration.Milliseconds(),
+		migrationx.Checksum(script),
+	)
+	return err
+}
+
 func dbVersion(ctx context.Context, tx sqlExecutor) (uint64, error) {
 	var version uint64
 	row := tx.QueryRowContext(
@@ -48,8 +68,61 @@ func setDbVersion(ctx context.Context, tx sqlExecutor, version uint64) error {
 	return err
 }
 
+// Pragma is a SQLite PRAGMA statement applied with ApplyPragmas
+type Pragma struct {
+	Name  string
+	Value string
+}
+
+var (
+	pragmaNameRegex  = regexp.MustCompile(`^[A-Za-z_]+$`)
+	pragmaValueRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// ApplyPragmas runs the given PRAGMAs in order
+// PRAGMAs can't be bound as query arguments, so names and values are restricted to plain identifiers and numbers
+// Most PRAGMAs are scoped to a connection: use a *sql.Conn, rather than a *sql.DB, to control which one they apply to
+func ApplyPragmas(ctx context.Context, db sqlExecutor, pragmas []Pragma) error {
+	for _, p := range pragmas {
+		if !pragmaNameRegex.MatchString(p.Name) || !pragmaValueRegex.MatchString(p.Value) {
+			return fmt.Errorf("invalid pragma: %s=%s", p.Name, p.Value)
+		}
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("PRAGMA %s = %s", p.Name, p.Value)); err != nil {
+			return fmt.Errorf("pragma %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
 type Migrations struct {
 	*migrationx.Migrations
+	// Pragmas are applied on the connection running the migrations, before the migration transaction starts
+	// The following are safe to use with concurrent migrations:
+	// * busy_timeout: recommended, so concurrent migrations wait for each other rather than fail
+	//   It should be listed first, so it applies to the PRAGMAs that follow
+	// * journal_mode=WAL: the transaction still serializes the migrations
+	// * foreign_keys, synchronous, and other PRAGMAs that don't affect locking
+	// PRAGMAs that give up atomicity (journal_mode=OFF or MEMORY) or hold locks beyond the
+	// transaction (locking_mode=EXCLUSIVE) break the concurrency guarantee
+	Pragmas []Pragma
+	// Retries is the number of times a migration failing with SQLITE_BUSY is retried
+	// It complements the busy_timeout PRAGMA, which does not prevent all busy errors under contention
+	Retries int
+	// RetryBackoff is the time waited before the first retry, doubled on each following retry
+	// Defaults to DefaultRetryBackoff when unset
+	RetryBackoff time.Duration
+}
+
+// DefaultRetryBackoff is the time waited before the first retry of a busy migration, when Migrations.RetryBackoff is unset
+const DefaultRetryBackoff = 50 * time.Millisecond
+
+// sqliteBusy is the primary result code of SQLITE_BUSY: extended codes share its low byte
+const sqliteBusy = 5
+
+// isBusy returns true if err is a SQLITE_BUSY error of the driver
+func isBusy(err error) bool {
+	var coded interface{ Code() int }
+	return errors.As(err, &coded) && coded.Code()&0xff == sqliteBusy
 }
 
 func NewMigrations(up []string, down []string) (*Migrations, error) {
@@ -68,6 +141,14 @@ func NewMigrationsFromFS(fsys fs.FS, subpath string) (*Migrations, error) {
 	return &Migrations{Migrations: m}, nil
 }
 
+func NewMigrationsFromMultipleFS(fsys []fs.FS, subpaths []string) (*Migrations, error) {
+	m, err := migrationx.NewMigrationsFromMultipleFS(fsys, subpaths)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrations{Migrations: m}, nil
+}
+
 func (m *Migrations) Up(ctx context.Context, db *sql.DB) error {
 	targetVersion := uint64(len(m.UpScripts))
 	return m.Migrate(ctx, db, targetVersion)
@@ -82,71 +163,134 @@ func (m *Migrations) Migrate(ctx context.Context, db *sql.DB, targetVersion uint
 		return fmt.Errorf("migrate failed: target version %d is higher than max migration version %d", targetVersion, len(m.UpScripts))
 	}
 
-	tx, err := db.BeginTx(ctx, nil)
+	backoff := m.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		err := m.migrate(ctx, db, targetVersion)
+		if err == nil || attempt >= m.Retries || !isBusy(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w, retry aborted: %w", err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// migrate runs a single attempt of Migrate
+func (m *Migrations) migrate(ctx context.Context, db *sql.DB, targetVersion uint64) error {
+	// The PRAGMAs must apply to the connection of the transaction, and some can't be changed inside of it
+	conn, err := db.Conn(ctx)
 	if err != nil {
 		return fmt.Errorf("migrate failed: %w", err)
 	}
+	defer func() { _ = conn.Close() }()
 
-	if err := ensureVersionSchema(ctx, tx); err != nil {
-		if err2 := tx.Rollback(); err2 != nil {
-			return fmt.Errorf("migrate failed: %w, rollback failed: %w", err, err2)
-		}
+	if err := ApplyPragmas(ctx, conn, m.Pragmas); err != nil {
 		return fmt.Errorf("migrate failed: %w", err)
 	}
 
-	version, err := dbVersion(ctx, tx)
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
+		return fmt.Errorf("migrate failed: %w", err)
+	}
+
+	if err := m.migrateTx(ctx, tx, targetVersion); err != nil {
 		if err2 := tx.Rollback(); err2 != nil {
 			return fmt.Errorf("migrate failed: %w, rollback failed: %w", err, err2)
 		}
 		return fmt.Errorf("migrate failed: %w", err)
 	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migrate failed: %w", err)
+	}
+	return nil
+}
 
-	if version == targetVersion {
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("migrate failed: %w", err)
+// MigrateTx migrates the database up or down to targetVersion within a transaction of the caller,
+// eg: to run the migrations as part of a larger bootstrap transaction
+// The caller is responsible for committing or rolling back tx, including when an error is returned
+// Neither the Pragmas nor the Retries apply, and the concurrency guarantees of Migrate are weakened:
+// the migrations are serialized by the transaction of the caller, whose statements and duration are
+// out of the control of Migrations, so concurrent migrations are more likely to fail with SQLITE_BUSY
+func (m *Migrations) MigrateTx(ctx context.Context, tx *sql.Tx, targetVersion uint64) error {
+	if uint64(len(m.UpScripts)) < targetVersion {
+		return fmt.Errorf("migrate failed: target version %d is higher than max migration version %d", targetVersion, len(m.UpScripts))
+	}
+	if err := m.migrateTx(ctx, tx, targetVersion); err != nil {
+		return fmt.Errorf("migrate failed: %w", err)
+	}
+	return nil
+}
+
+// migrateTx applies the migrations to targetVersion in tx, without committing or rolling it back
+func (m *Migrations) migrateTx(ctx context.Context, tx sqlExecutor, targetVersion uint64) error {
+	if err := ensureVersionSchema(ctx, tx); err != nil {
+		return err
+	}
+
+	if m.History {
+		if err := ensureHistorySchema(ctx, tx); err != nil {
+			return err
 		}
+	}
+
+	version, err := dbVersion(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if version == targetVersion {
 		return nil
 	}
 
 	if uint64(len(m.UpScripts)) < version {
-		err := fmt.Errorf("database version %d is higher than max migration version %d", version, len(m.UpScripts))
-		if err2 := tx.Rollback(); err2 != nil {
-			return fmt.Errorf("migrate failed: %w, rollback failed: %w", err, err2)
-		}
-		return fmt.Errorf("migrate failed: %w", err)
+		return fmt.Errorf("database version %d is higher than max migration version %d", version, len(m.UpScripts))
+	}
+
+	if err := m.CheckDirection(version, targetVersion); err != nil {
+		return err
 	}
 
 	if targetVersion < version {
 		for i := int(version - 1); i >= int(targetVersion); i-- {
-			_, err := tx.ExecContext(ctx, m.DownScripts[i])
-			if err != nil {
-				if err2 := tx.Rollback(); err2 != nil {
-					return fmt.Errorf("migrate failed: %w, rollback failed: %w", err, err2)
-				}
-				return fmt.Errorf("migrate failed: %w", err)
+			if err := m.applyStep(ctx, tx, uint64(i+1), migrationx.DirectionDown, m.DownScripts[i]); err != nil {
+				return err
 			}
 		}
 	} else {
-		for _, migration := range m.UpScripts[version:targetVersion] {
-			_, err := tx.ExecContext(ctx, migration)
-			if err != nil {
-				if err2 := tx.Rollback(); err2 != nil {
-					return fmt.Errorf("migrate failed: %w, rollback failed: %w", err, err2)
-				}
-				return fmt.Errorf("migrate failed: %w", err)
+		for i := version; i < targetVersion; i++ {
+			if err := m.applyStep(ctx, tx, i+1, migrationx.DirectionUp, m.UpScripts[i]); err != nil {
+				return err
 			}
 		}
 	}
 
-	if err := setDbVersion(ctx, tx, targetVersion); err != nil {
-		if err2 := tx.Rollback(); err2 != nil {
-			return fmt.Errorf("migrate failed: %w, rollback failed: %w", err, err2)
-		}
-		return fmt.Errorf("migrate failed: %w", err)
+	return setDbVersion(ctx, tx, targetVersion)
+}
+
+func (m *Migrations) applyStep(ctx context.Context, tx sqlExecutor, version uint64, direction string, script string) error {
+	start := time.Now()
+	if err := m.execScript(ctx, tx, version, script); err != nil {
+		return err
 	}
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("migrate failed: %w", err)
+	if !m.History {
+		return nil
 	}
-	return nil
+	return addHistory(ctx, tx, version, direction, start, time.Since(start), script)
+}
+
+func (m *Migrations) execScript(ctx context.Context, tx sqlExecutor, version uint64, script string) error {
+	if !m.PerStatement {
+		_, err := tx.ExecContext(ctx, script)
+		return err
+	}
+	return migrationx.ExecStatements(version, script, func(sql string) error {
+		_, err := tx.ExecContext(ctx, sql)
+		return err
+	})
 }
@@ -3,11 +3,14 @@ package migration
 import (
 	"context"
 	"database/sql"
+	"io/fs"
 	"path/filepath"
 	"sync"
 	"testing"
 	"testing/fstest"
+	"time"
 
+	"github.com/exoscale/stelling/sqlite/migrationx"
 	"github.com/stretchr/testify/require"
 	_ "modernc.org/sqlite"
 )
@@ -109,6 +112,77 @@ func TestNewMigrationsFromFS(t *testing.T) {
 	})
 }
 
+func TestNewMigrationsFromMultipleFS(t *testing.T) {
+	base := fstest.MapFS{
+		"migrations/01_initial.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE test1 (name text, value int);")},
+		"migrations/01_initial.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE test1;")},
+		"migrations/02_second.up.sql":    &fstest.MapFile{Data: []byte("CREATE TABLE test2 (name text, value int);")},
+		"migrations/02_second.down.sql":  &fstest.MapFile{Data: []byte("DROP TABLE test2;")},
+	}
+	plugin := fstest.MapFS{
+		"01_plugin.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE test3 (name text, value int);")},
+		"01_plugin.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE test3;")},
+	}
+
+	t.Run("Should return an error if the number of subpaths does not match", func(t *testing.T) {
+		_, err := NewMigrationsFromMultipleFS([]fs.FS{base, plugin}, []string{"migrations"})
+		require.EqualError(t, err, "must have a subpath for each filesystem")
+	})
+
+	t.Run("Should return an error if a filesystem does not pair its migrations", func(t *testing.T) {
+		broken := fstest.MapFS{
+			"01_plugin.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE test3 (name text, value int);")},
+			"02_plugin.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE test3;")},
+		}
+
+		_, err := NewMigrationsFromMultipleFS([]fs.FS{base, broken}, []string{"migrations", "."})
+		require.EqualError(t, err, "filesystem 1: down migration for migration 1 is missing")
+	})
+
+	t.Run("Should renumber the migrations in the order of the filesystems", func(t *testing.T) {
+		migrations, err := NewMigrationsFromMultipleFS([]fs.FS{base, plugin}, []string{"migrations", "."})
+		require.NoError(t, err)
+
+		require.Equal(t, []string{
+			"CREATE TABLE test1 (name text, value int);",
+			"CREATE TABLE test2 (name text, value int);",
+			"CREATE TABLE test3 (name text, value int);",
+		}, migrations.UpScripts)
+		require.Equal(t, []string{
+			"DROP TABLE test1;",
+			"DROP TABLE test2;",
+			"DROP TABLE test3;",
+		}, migrations.DownScripts)
+	})
+
+	t.Run("Should apply the merged migrations", func(t *testing.T) {
+		migrations, err := NewMigrationsFromMultipleFS([]fs.FS{base, plugin}, []string{"migrations", "."})
+		require.NoError(t, err)
+
+		expected := []string{
+			"CREATE TABLE schema_migrations (version uint64, dirty bool)",
+			"CREATE UNIQUE INDEX version_unique ON schema_migrations (version)",
+			"CREATE TABLE test1 (name text, value int)",
+			"CREATE TABLE test2 (name text, value int)",
+			"CREATE TABLE test3 (name text, value int)",
+		}
+		db := testDb(t)
+		ctx := context.Background()
+
+		require.NoError(t, migrations.Up(ctx, db))
+
+		statements := dbSchema(t, db)
+		version, err := dbVersion(ctx, db)
+		require.NoError(t, err)
+
+		require.Equal(t, expected, statements)
+		require.Equal(t, uint64(3), version)
+
+		require.NoError(t, migrations.Migrate(ctx, db, 2))
+		require.Equal(t, expected[:4], dbSchema(t, db))
+	})
+}
+
 func testDb(t *testing.T) *sql.DB {
 	t.Helper()
 	db, err := sql.Open("sqlite", ":memory:")
@@ -120,20 +194,8 @@ func testDb(t *testing.T) *sql.DB {
 func dbSchema(t *testing.T, db sqlExecutor) []string {
 	t.Helper()
 
-	statements := []string{}
-	rows, err := db.QueryContext(
-		context.Background(),
-		"SELECT sql FROM sqlite_schema",
-	)
+	statements, err := Schema(context.Background(), db)
 	require.NoError(t, err)
-	defer func() { _ = rows.Close() }()
-
-	for rows.Next() {
-		var stmt string
-		require.NoError(t, rows.Scan(&stmt))
-		statements = append(statements, stmt)
-	}
-	require.NoError(t, rows.Err())
 
 	return statements
 }
@@ -562,6 +624,357 @@ func TestMigrationsMigrate(t *testing.T) {
 	})
 }
 
+func TestApplyPragmas(t *testing.T) {
+	t.Run("Should apply the pragmas in order", func(t *testing.T) {
+		db := testDb(t)
+		ctx := context.Background()
+		conn, err := db.Conn(ctx)
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+
+		require.NoError(t, ApplyPragmas(ctx, conn, []Pragma{
+			{Name: "foreign_keys", Value: "ON"},
+			{Name: "busy_timeout", Value: "1234"},
+		}))
+
+		var foreignKeys, busyTimeout int
+		require.NoError(t, conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys))
+		require.NoError(t, conn.QueryRowContext(ctx, "PRAGMA busy_timeout").Scan(&busyTimeout))
+		require.Equal(t, 1, foreignKeys)
+		require.Equal(t, 1234, busyTimeout)
+	})
+
+	t.Run("Should reject pragmas that are not plain identifiers", func(t *testing.T) {
+		db := testDb(t)
+
+		err := ApplyPragmas(context.Background(), db, []Pragma{{Name: "foreign_keys", Value: "ON; DROP TABLE test"}})
+		require.EqualError(t, err, "invalid pragma: foreign_keys=ON; DROP TABLE test")
+	})
+}
+
+func TestMigrationsPragmas(t *testing.T) {
+	up := []string{
+		"CREATE TABLE test1 (id integer PRIMARY KEY);",
+		"CREATE TABLE test2 (parent integer REFERENCES test1 (id));",
+	}
+	down := []string{
+		"DROP TABLE test1;",
+		"DROP TABLE test2;",
+	}
+	pragmas := []Pragma{
+		{Name: "busy_timeout", Value: "5000"},
+		{Name: "journal_mode", Value: "WAL"},
+		{Name: "foreign_keys", Value: "ON"},
+	}
+
+	t.Run("Should apply the pragmas on the connection running the migrations", func(t *testing.T) {
+		migrations, err := NewMigrations(up, down)
+		require.NoError(t, err)
+		migrations.Pragmas = pragmas
+
+		db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "testdb"))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+		// Ensures the assertions run on the connection used by the migration
+		db.SetMaxOpenConns(1)
+		ctx := context.Background()
+
+		require.NoError(t, migrations.Up(ctx, db))
+
+		var journalMode string
+		var foreignKeys int
+		require.NoError(t, db.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&journalMode))
+		require.NoError(t, db.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys))
+		require.Equal(t, "wal", journalMode)
+		require.Equal(t, 1, foreignKeys)
+
+		_, err = db.ExecContext(ctx, "INSERT INTO test2 (parent) VALUES (42)")
+		require.Error(t, err)
+	})
+
+	t.Run("Should return an error if a pragma is invalid", func(t *testing.T) {
+		migrations, err := NewMigrations(up, down)
+		require.NoError(t, err)
+		migrations.Pragmas = []Pragma{{Name: "journal mode", Value: "WAL"}}
+
+		err = migrations.Up(context.Background(), testDb(t))
+		require.EqualError(t, err, "migrate failed: invalid pragma: journal mode=WAL")
+	})
+
+	t.Run("Should support concurrent version migrations under WAL", func(t *testing.T) {
+		migrations, err := NewMigrations(up, down)
+		require.NoError(t, err)
+		migrations.Pragmas = pragmas
+		expected := []string{
+			"CREATE TABLE schema_migrations (version uint64, dirty bool)",
+			"CREATE UNIQUE INDEX version_unique ON schema_migrations (version)",
+			"CREATE TABLE test1 (id integer PRIMARY KEY)",
+			"CREATE TABLE test2 (parent integer REFERENCES test1 (id))",
+		}
+
+		dbPath := filepath.Join(t.TempDir(), "testdb")
+		startChan := make(chan any)
+		wg := &sync.WaitGroup{}
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			db, err := sql.Open("sqlite", dbPath)
+			require.NoError(t, err)
+			go func() {
+				defer wg.Done()
+				defer func() { _ = db.Close() }()
+
+				<-startChan
+				errs <- migrations.Up(context.Background(), db)
+			}()
+		}
+		close(startChan)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		db, err := sql.Open("sqlite", dbPath)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+
+		var journalMode string
+		require.NoError(t, db.QueryRowContext(context.Background(), "PRAGMA journal_mode").Scan(&journalMode))
+		version, err := dbVersion(context.Background(), db)
+		require.NoError(t, err)
+
+		require.Equal(t, "wal", journalMode)
+		require.Equal(t, uint64(2), version)
+		require.Equal(t, expected, dbSchema(t, db))
+	})
+}
+
+func TestMigrationsPerStatement(t *testing.T) {
+	up := []string{
+		"CREATE TABLE test1 (name text, value int);",
+		"CREATE TABLE test2 (name text, value int);\nINSERT INTO test2 VALUES ('a', 1);\n\nINSERT INTO missing\n  VALUES ('b', 2);\nCREATE TABLE test3 (name text, value int);",
+	}
+	down := []string{
+		"DROP TABLE test1;",
+		"DROP TABLE test3; DROP TABLE test2;",
+	}
+
+	t.Run("Should name the statement that failed", func(t *testing.T) {
+		migrations, err := NewMigrations(up, down)
+		require.NoError(t, err)
+		migrations.PerStatement = true
+		db := testDb(t)
+
+		err = migrations.Up(context.Background(), db)
+		require.EqualError(t, err, "migrate failed: migration 2: statement 3 at line 4 failed: SQL logic error: no such table: missing (1): INSERT INTO missing VALUES ('b', 2);")
+		var stmtErr *migrationx.StatementError
+		require.ErrorAs(t, err, &stmtErr)
+		require.Equal(t, uint64(2), stmtErr.Migration)
+		require.Equal(t, 3, stmtErr.Index)
+
+		// The whole migration is rolled back
+		require.Empty(t, dbSchema(t, db))
+	})
+
+	t.Run("Should apply valid migrations statement by statement", func(t *testing.T) {
+		migrations, err := NewMigrations(up[:1], down[:1])
+		require.NoError(t, err)
+		migrations.PerStatement = true
+		db := testDb(t)
+
+		require.NoError(t, migrations.Up(context.Background(), db))
+		require.NoError(t, migrations.Down(context.Background(), db))
+	})
+}
+
+func TestMigrationsHistory(t *testing.T) {
+	up := []string{
+		"CREATE TABLE test1 (name text, value int);",
+		"CREATE TABLE test2 (name text, value int);",
+		"CREATE TABLE test3 (name text, value int);",
+	}
+	down := []string{
+		"DROP TABLE test1;",
+		"DROP TABLE test2;",
+		"DROP TABLE test3;",
+	}
+
+	t.Run("Should not create the history table by default", func(t *testing.T) {
+		migrations, err := NewMigrations(up, down)
+		require.NoError(t, err)
+		db := testDb(t)
+
+		require.NoError(t, migrations.Up(context.Background(), db))
+		require.NotContains(t, dbSchema(t, db), "CREATE TABLE schema_migration_history (version uint64, direction text, applied_at timestamp, duration_ms int, checksum text)")
+	})
+
+	t.Run("Should record a history row per applied step", func(t *testing.T) {
+		migrations, err := NewMigrations(up, down)
+		require.NoError(t, err)
+		migrations.History = true
+		db := testDb(t)
+		before := time.Now()
+
+		require.NoError(t, migrations.Up(context.Background(), db))
+		require.NoError(t, migrations.Migrate(context.Background(), db, 1))
+		// Noop migrations are not recorded
+		require.NoError(t, migrations.Migrate(context.Background(), db, 1))
+
+		expected := []historyRow{
+			{version: 1, direction: migrationx.DirectionUp, checksum: migrationx.Checksum(up[0])},
+			{version: 2, direction: migrationx.DirectionUp, checksum: migrationx.Checksum(up[1])},
+			{version: 3, direction: migrationx.DirectionUp, checksum: migrationx.Checksum(up[2])},
+			{version: 3, direction: migrationx.DirectionDown, checksum: migrationx.Checksum(down[2])},
+			{version: 2, direction: migrationx.DirectionDown, checksum: migrationx.Checksum(down[1])},
+		}
+		rows := history(t, db)
+		require.Len(t, rows, len(expected))
+		for i, row := range rows {
+			require.Equal(t, expected[i].version, row.version)
+			require.Equal(t, expected[i].direction, row.direction)
+			require.Equal(t, expected[i].checksum, row.checksum)
+			require.GreaterOrEqual(t, row.durationMs, int64(0))
+			require.False(t, row.appliedAt.Before(before), "applied at %s", row.appliedAt)
+			require.False(t, row.appliedAt.After(time.Now()), "applied at %s", row.appliedAt)
+		}
+	})
+
+	t.Run("Should roll back the history of a failed migration", func(t *testing.T) {
+		migrations, err := NewMigrations(append(up[:1:1], "INSERT INTO missing VALUES (1);"), down[:2])
+		require.NoError(t, err)
+		migrations.History = true
+		db := testDb(t)
+
+		require.Error(t, migrations.Up(context.Background(), db))
+		require.NoError(t, migrations.Migrate(context.Background(), db, 1))
+
+		rows := history(t, db)
+		require.Len(t, rows, 1)
+		require.Equal(t, uint64(1), rows[0].version)
+	})
+}
+
+type historyRow struct {
+	version    uint64
+	direction  string
+	appliedAt  time.Time
+	durationMs int64
+	checksum   string
+}
+
+func history(t *testing.T, db sqlExecutor) []historyRow {
+	t.Helper()
+
+	result := []historyRow{}
+	rows, err := db.QueryContext(
+		context.Background(),
+		"SELECT version, direction, applied_at, duration_ms, checksum FROM schema_migration_history ORDER BY rowid",
+	)
+	require.NoError(t, err)
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var row historyRow
+		var appliedAt string
+		require.NoError(t, rows.Scan(&row.version, &row.direction, &appliedAt, &row.durationMs, &row.checksum))
+		row.appliedAt, err = time.Parse(time.RFC3339Nano, appliedAt)
+		require.NoError(t, err)
+		result = append(result, row)
+	}
+	require.NoError(t, rows.Err())
+
+	return result
+}
+
+func TestMigrationsRetry(t *testing.T) {
+	up := []string{"CREATE TABLE test1 (name text, value int);"}
+	down := []string{"DROP TABLE test1;"}
+
+	// lockDb opens a file database and holds its write lock until the returned function is called
+	lockDb := func(t *testing.T) (string, func()) {
+		t.Helper()
+		dbPath := filepath.Join(t.TempDir(), "testdb")
+		db, err := sql.Open("sqlite", dbPath)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+		conn, err := db.Conn(context.Background())
+		require.NoError(t, err)
+		_, err = conn.ExecContext(context.Background(), "BEGIN IMMEDIATE")
+		require.NoError(t, err)
+
+		return dbPath, func() {
+			_, err := conn.ExecContext(context.Background(), "COMMIT")
+			require.NoError(t, err)
+			require.NoError(t, conn.Close())
+		}
+	}
+
+	t.Run("Should fail on a busy database without retries", func(t *testing.T) {
+		dbPath, unlock := lockDb(t)
+		defer unlock()
+		migrations, err := NewMigrations(up, down)
+		require.NoError(t, err)
+
+		db, err := sql.Open("sqlite", dbPath)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+
+		err = migrations.Up(context.Background(), db)
+		require.Error(t, err)
+		require.True(t, isBusy(err), err.Error())
+	})
+
+	t.Run("Should retry a busy migration", func(t *testing.T) {
+		dbPath, unlock := lockDb(t)
+		migrations, err := NewMigrations(up, down)
+		require.NoError(t, err)
+		migrations.Retries = 5
+		migrations.RetryBackoff = 20 * time.Millisecond
+
+		db, err := sql.Open("sqlite", dbPath)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+
+		// The first attempt runs into the lock, which is released before the retry
+		time.AfterFunc(10*time.Millisecond, unlock)
+		require.NoError(t, migrations.Up(context.Background(), db))
+
+		version, err := dbVersion(context.Background(), db)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), version)
+	})
+
+	t.Run("Should stop retrying when the context is done", func(t *testing.T) {
+		dbPath, unlock := lockDb(t)
+		defer unlock()
+		migrations, err := NewMigrations(up, down)
+		require.NoError(t, err)
+		migrations.Retries = 5
+		migrations.RetryBackoff = time.Hour
+
+		db, err := sql.Open("sqlite", dbPath)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err = migrations.Up(ctx, db)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("Should not retry other errors", func(t *testing.T) {
+		migrations, err := NewMigrations([]string{"INSERT INTO missing VALUES (1);"}, down)
+		require.NoError(t, err)
+		migrations.Retries = 5
+		migrations.RetryBackoff = time.Hour
+
+		err = migrations.Up(context.Background(), testDb(t))
+		require.Error(t, err)
+		require.False(t, isBusy(err))
+	})
+}
+
 func TestMigrationsUp(t *testing.T) {
 	up := []string{
 		"CREATE TABLE test1 (name text, value int);",
@@ -631,3 +1044,104 @@ func TestMigrationsDown(t *testing.T) {
 	require.Equal(t, expected, statements)
 	require.Equal(t, uint64(0), version)
 }
+
+func TestMigrationsMigrateTx(t *testing.T) {
+	up := []string{
+		"CREATE TABLE test1 (name text, value int);",
+		"CREATE TABLE test2 (name text, value int);",
+	}
+	down := []string{
+		"DROP TABLE test1;",
+		"DROP TABLE test2;",
+	}
+	migrations, err := NewMigrations(up, down)
+	require.NoError(t, err)
+
+	t.Run("Should migrate within the transaction of the caller", func(t *testing.T) {
+		db := testDb(t)
+		db.SetMaxOpenConns(1)
+		ctx := context.Background()
+
+		tx, err := db.BeginTx(ctx, nil)
+		require.NoError(t, err)
+		require.NoError(t, migrations.MigrateTx(ctx, tx, 2))
+		_, err = tx.ExecContext(ctx, "INSERT INTO test2 (name, value) VALUES ('bootstrap', 1)")
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit())
+
+		version, err := dbVersion(ctx, db)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), version)
+		var count int
+		require.NoError(t, db.QueryRowContext(ctx, "SELECT count(*) FROM test2").Scan(&count))
+		require.Equal(t, 1, count)
+	})
+
+	t.Run("Should leave the rollback of the transaction to the caller", func(t *testing.T) {
+		db := testDb(t)
+		db.SetMaxOpenConns(1)
+		ctx := context.Background()
+
+		tx, err := db.BeginTx(ctx, nil)
+		require.NoError(t, err)
+		require.NoError(t, migrations.MigrateTx(ctx, tx, 2))
+		require.NoError(t, tx.Rollback())
+
+		require.Empty(t, dbSchema(t, db))
+	})
+
+	t.Run("Should not commit or roll back the transaction on error", func(t *testing.T) {
+		broken, err := NewMigrations([]string{"CREATE TABLE test1 (name text);", "NOT SQL;"}, []string{"DROP TABLE test1;", ""})
+		require.NoError(t, err)
+		db := testDb(t)
+		db.SetMaxOpenConns(1)
+		ctx := context.Background()
+
+		tx, err := db.BeginTx(ctx, nil)
+		require.NoError(t, err)
+		require.ErrorContains(t, broken.MigrateTx(ctx, tx, 2), "migrate failed: ")
+		// The transaction is still usable by the caller
+		_, err = tx.ExecContext(ctx, "SELECT 1")
+		require.NoError(t, err)
+		require.NoError(t, tx.Rollback())
+	})
+}
+
+func TestMigrationsDisableDown(t *testing.T) {
+	up := []string{
+		"CREATE TABLE test1 (name text, value int);",
+		"CREATE TABLE test2 (name text, value int);",
+	}
+	down := []string{
+		"DROP TABLE test1;",
+		"DROP TABLE test2;",
+	}
+	migrations, err := NewMigrations(up, down)
+	require.NoError(t, err)
+	migrations.DisableDown = true
+
+	t.Run("Should refuse to migrate down", func(t *testing.T) {
+		db := testDb(t)
+		db.SetMaxOpenConns(1)
+		require.NoError(t, migrations.Up(context.Background(), db))
+
+		err := migrations.Down(context.Background(), db)
+		require.ErrorIs(t, err, migrationx.ErrDownDisabled)
+		require.EqualError(t, err, "migrate failed: down migrations are disabled: refusing to migrate from version 2 to 0")
+		version, err := dbVersion(context.Background(), db)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), version)
+		require.Len(t, dbSchema(t, db), 4)
+	})
+
+	t.Run("Should still migrate up", func(t *testing.T) {
+		db := testDb(t)
+		db.SetMaxOpenConns(1)
+		require.NoError(t, migrations.Migrate(context.Background(), db, 1))
+		require.NoError(t, migrations.Up(context.Background(), db))
+
+		version, err := dbVersion(context.Background(), db)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), version)
+	})
+}
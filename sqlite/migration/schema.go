@@ -0,0 +1,109 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Schema returns the CREATE statements of the schema of the database, in the order in which the objects were created
+// It includes the schema_migrations table, and the schema_migration_history table when Migrations.History is set
+// Internal objects without a statement, like the automatic indexes of UNIQUE constraints, are omitted
+// Applied after Up, it returns the final DDL of the migrations, eg: to compare it with a golden file
+func Schema(ctx context.Context, db sqlExecutor) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT sql FROM sqlite_schema WHERE sql IS NOT NULL ORDER BY rowid")
+	if err != nil {
+		return nil, fmt.Errorf("schema failed: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	statements := []string{}
+	for rows.Next() {
+		var stmt string
+		if err := rows.Scan(&stmt); err != nil {
+			return nil, fmt.Errorf("schema failed: %w", err)
+		}
+		statements = append(statements, stmt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("schema failed: %w", err)
+	}
+	return statements, nil
+}
+
+// VerifyRoundTrip checks that the down migrations revert their up migrations
+// It applies all the up migrations, all the down migrations and all the up migrations again, and returns an error
+// if the schema after the down migrations differs from the baseline, or the schemas after both ups differ from each other
+// It modifies the database, and must start from a database at version 0: it is meant for the tests of the migrations
+// It fails with migrationx.ErrDownDisabled when DisableDown is set
+func (m *Migrations) VerifyRoundTrip(ctx context.Context, db *sql.DB) error {
+	version, _, err := m.Status(ctx, db)
+	if err != nil {
+		return fmt.Errorf("round trip failed: %w", err)
+	}
+	if version != 0 {
+		return fmt.Errorf("round trip failed: database version %d is not 0", version)
+	}
+
+	// Creates the version table, so it's part of the baseline
+	if err := m.Migrate(ctx, db, 0); err != nil {
+		return fmt.Errorf("round trip failed: %w", err)
+	}
+	baseline, err := Schema(ctx, db)
+	if err != nil {
+		return fmt.Errorf("round trip failed: %w", err)
+	}
+
+	if err := m.Up(ctx, db); err != nil {
+		return fmt.Errorf("round trip failed: first up: %w", err)
+	}
+	up, err := Schema(ctx, db)
+	if err != nil {
+		return fmt.Errorf("round trip failed: %w", err)
+	}
+
+	if err := m.Down(ctx, db); err != nil {
+		return fmt.Errorf("round trip failed: down: %w", err)
+	}
+	down, err := Schema(ctx, db)
+	if err != nil {
+		return fmt.Errorf("round trip failed: %w", err)
+	}
+	if err := diffSchema(baseline, down); err != nil {
+		return fmt.Errorf("round trip failed: the schema after down differs from the baseline: %w", err)
+	}
+
+	if err := m.Up(ctx, db); err != nil {
+		return fmt.Errorf("round trip failed: second up: %w", err)
+	}
+	again, err := Schema(ctx, db)
+	if err != nil {
+		return fmt.Errorf("round trip failed: %w", err)
+	}
+	if err := diffSchema(up, again); err != nil {
+		return fmt.Errorf("round trip failed: the schema after the second up differs from the first one: %w", err)
+	}
+	return nil
+}
+
+// diffSchema returns an error listing the statements of expected missing from actual, and the unexpected ones
+func diffSchema(expected, actual []string) error {
+	var errs []error
+	for _, stmt := range expected {
+		if !slices.Contains(actual, stmt) {
+			errs = append(errs, fmt.Errorf("missing: %s", stmt))
+		}
+	}
+	for _, stmt := range actual {
+		if !slices.Contains(expected, stmt) {
+			errs = append(errs, fmt.Errorf("unexpected: %s", stmt))
+		}
+	}
+	if len(errs) == 0 && !slices.Equal(expected, actual) {
+		errs = append(errs, fmt.Errorf("different order: %s", strings.Join(actual, "; ")))
+	}
+	return errors.Join(errs...)
+}
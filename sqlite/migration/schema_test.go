@@ -0,0 +1,106 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema(t *testing.T) {
+	up := []string{
+		"CREATE TABLE test1 (name text UNIQUE, value int);",
+		"CREATE TABLE test2 (name text, value int); CREATE INDEX test2_name ON test2 (name);",
+		"ALTER TABLE test1 ADD COLUMN extra text;",
+	}
+	down := []string{
+		"DROP TABLE test1;",
+		"DROP INDEX test2_name; DROP TABLE test2;",
+		"ALTER TABLE test1 DROP COLUMN extra;",
+	}
+
+	t.Run("Should return the schema of the applied migrations in creation order", func(t *testing.T) {
+		migrations, err := NewMigrations(up, down)
+		require.NoError(t, err)
+		db := testDb(t)
+		ctx := context.Background()
+
+		require.NoError(t, migrations.Up(ctx, db))
+
+		schema, err := Schema(ctx, db)
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"CREATE TABLE schema_migrations (version uint64, dirty bool)",
+			"CREATE UNIQUE INDEX version_unique ON schema_migrations (version)",
+			"CREATE TABLE test1 (name text UNIQUE, value int, extra text)",
+			"CREATE TABLE test2 (name text, value int)",
+			"CREATE INDEX test2_name ON test2 (name)",
+		}, schema)
+
+		require.NoError(t, migrations.Migrate(ctx, db, 1))
+		schema, err = Schema(ctx, db)
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"CREATE TABLE schema_migrations (version uint64, dirty bool)",
+			"CREATE UNIQUE INDEX version_unique ON schema_migrations (version)",
+			"CREATE TABLE test1 (name text UNIQUE, value int)",
+		}, schema)
+	})
+
+	t.Run("Should return an empty schema for an empty database", func(t *testing.T) {
+		schema, err := Schema(context.Background(), testDb(t))
+		require.NoError(t, err)
+		require.Empty(t, schema)
+	})
+}
+
+func TestMigrationsVerifyRoundTrip(t *testing.T) {
+	t.Run("Should accept down migrations which revert their up migrations", func(t *testing.T) {
+		migrations, err := NewMigrations(
+			[]string{
+				"CREATE TABLE test1 (name text, value int);",
+				"CREATE INDEX test1_name ON test1 (name);",
+				"ALTER TABLE test1 ADD COLUMN extra text;",
+			},
+			[]string{
+				"DROP TABLE test1;",
+				"DROP INDEX test1_name;",
+				"ALTER TABLE test1 DROP COLUMN extra;",
+			},
+		)
+		require.NoError(t, err)
+		db := testDb(t)
+		db.SetMaxOpenConns(1)
+
+		require.NoError(t, migrations.VerifyRoundTrip(context.Background(), db))
+	})
+
+	t.Run("Should report a down migration which does not revert its up migration", func(t *testing.T) {
+		migrations, err := NewMigrations(
+			[]string{
+				"CREATE TABLE test1 (name text, value int);",
+				"CREATE TABLE test2 (name text, value int); CREATE INDEX test2_name ON test2 (name);",
+			},
+			[]string{
+				"DROP TABLE test1;",
+				"DROP INDEX test2_name;",
+			},
+		)
+		require.NoError(t, err)
+		db := testDb(t)
+		db.SetMaxOpenConns(1)
+
+		err = migrations.VerifyRoundTrip(context.Background(), db)
+		require.EqualError(t, err, "round trip failed: the schema after down differs from the baseline: unexpected: CREATE TABLE test2 (name text, value int)")
+	})
+
+	t.Run("Should refuse a database which is already migrated", func(t *testing.T) {
+		migrations, err := NewMigrations([]string{"CREATE TABLE test1 (name text);"}, []string{"DROP TABLE test1;"})
+		require.NoError(t, err)
+		db := testDb(t)
+		db.SetMaxOpenConns(1)
+		require.NoError(t, migrations.Up(context.Background(), db))
+
+		require.EqualError(t, migrations.VerifyRoundTrip(context.Background(), db), "round trip failed: database version 1 is not 0")
+	})
+}
@@ -0,0 +1,45 @@
+package migrationx
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/fx"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// Checkpoint copies the content of the write-ahead log into the database and truncates it
+// It returns an error if the checkpoint could not complete, for instance because of concurrent readers
+func Checkpoint(conn *sqlite.Conn) error {
+	busy := false
+	err := sqlitex.ExecuteTransient(conn, "PRAGMA wal_checkpoint(TRUNCATE);", &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			busy = stmt.ColumnInt(0) != 0
+			return nil
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("checkpoint failed: %w", err)
+	}
+	if busy {
+		return fmt.Errorf("checkpoint failed: database is busy")
+	}
+	return nil
+}
+
+// CheckpointOnStop registers an OnStop hook which checkpoints the write-ahead log of the database of pool
+// It keeps the -wal file of WAL databases from growing across restarts
+// It must be invoked after the pool is provided, so the hook runs before the pool is closed
+func CheckpointOnStop(lc fx.Lifecycle, pool *sqlitex.Pool) {
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			conn, err := pool.Take(ctx)
+			if err != nil {
+				return fmt.Errorf("checkpoint failed: %w", err)
+			}
+			defer pool.Put(conn)
+			return Checkpoint(conn)
+		},
+	})
+}
@@ -0,0 +1,61 @@
+package migrationx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+func TestCheckpointOnStop(t *testing.T) {
+	t.Run("Should truncate the wal file when the system stops", func(t *testing.T) {
+		dbPath := filepath.Join(t.TempDir(), "testdb")
+		pool, err := sqlitex.NewPool(dbPath, sqlitex.PoolOptions{
+			PoolSize: 2,
+			PrepareConn: func(conn *sqlite.Conn) error {
+				return sqlitex.ExecuteTransient(conn, "PRAGMA journal_mode=WAL;", nil)
+			},
+		})
+		require.NoError(t, err)
+		// The last connection to close checkpoints the database anyway: the pool stays open during the assertions
+		defer func() { _ = pool.Close() }()
+
+		app := fxtest.New(t, fx.Supply(pool), fx.Invoke(CheckpointOnStop))
+		app.RequireStart()
+
+		migrations, err := NewMigrations(
+			[]string{"CREATE TABLE test1 (name text, value int); INSERT INTO test1 VALUES ('a', 1);"},
+			[]string{"DROP TABLE test1;"},
+		)
+		require.NoError(t, err)
+		conn, err := pool.Take(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, migrations.Up(context.Background(), conn))
+		pool.Put(conn)
+
+		info, err := os.Stat(dbPath + "-wal")
+		require.NoError(t, err)
+		require.NotZero(t, info.Size())
+
+		app.RequireStop()
+
+		info, err = os.Stat(dbPath + "-wal")
+		require.NoError(t, err)
+		require.Zero(t, info.Size())
+	})
+
+	t.Run("Should not fail on databases which don't use a wal", func(t *testing.T) {
+		pool, err := sqlitex.NewPool(filepath.Join(t.TempDir(), "testdb"), sqlitex.PoolOptions{PoolSize: 1})
+		require.NoError(t, err)
+		defer func() { _ = pool.Close() }()
+
+		app := fxtest.New(t, fx.Supply(pool), fx.Invoke(CheckpointOnStop))
+		app.RequireStart().RequireStop()
+	})
+}
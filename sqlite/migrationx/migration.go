@@ -2,6 +2,9 @@ package migrationx
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -10,6 +13,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"zombiezen.com/go/sqlite"
 	"zombiezen.com/go/sqlite/sqlitex"
@@ -18,12 +22,39 @@ import (
 const VersionSchema string = `CREATE TABLE IF NOT EXISTS schema_migrations (version uint64, dirty bool);
 CREATE UNIQUE INDEX IF NOT EXISTS version_unique ON schema_migrations (version);`
 
+// HistorySchema is the schema of the table recording each applied migration step, when Migrations.History is set
+const HistorySchema string = `CREATE TABLE IF NOT EXISTS schema_migration_history (version uint64, direction text, applied_at timestamp, duration_ms int, checksum text);`
+
+// Directions of the migration steps recorded in the schema_migration_history table
+const (
+	DirectionUp   = "up"
+	DirectionDown = "down"
+)
+
+// Checksum returns the checksum of a migration script recorded in the schema_migration_history table
+func Checksum(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
 func ensureVersionSchema(conn *sqlite.Conn) (err error) {
 	defer sqlitex.Save(conn)(&err)
 
 	return sqlitex.ExecuteScript(conn, VersionSchema, &sqlitex.ExecOptions{})
 }
 
+func ensureHistorySchema(conn *sqlite.Conn) error {
+	return sqlitex.ExecuteTransient(conn, HistorySchema, nil)
+}
+
+func addHistory(conn *sqlite.Conn, version uint64, direction string, appliedAt time.Time, duration time.Duration, script string) error {
+	return sqlitex.ExecuteTransient(
+		conn,
+		"INSERT INTO schema_migration_history (version, direction, applied_at, duration_ms, checksum) VALUES (?, ?, ?, ?, ?);",
+		&sqlitex.ExecOptions{Args: []any{version, direction, appliedAt.UTC().Format(time.RFC3339Nano), duration.Milliseconds(), Checksum(script)}},
+	)
+}
+
 func dbVersion(conn *sqlite.Conn) (uint64, error) {
 	var version uint64
 	err := sqlitex.ExecuteTransient(
@@ -53,6 +84,26 @@ func setDbVersion(conn *sqlite.Conn, version uint64) error {
 type Migrations struct {
 	UpScripts   []string
 	DownScripts []string
+	// PerStatement runs the statements of a script one by one, still in a single transaction
+	// Errors are then a *StatementError identifying the failed statement,
+	// and statements which can't run in a transaction are rejected up front
+	PerStatement bool
+	// History records each applied step in the schema_migration_history table, which is created on demand
+	History bool
+	// DisableDown refuses to migrate the database down with ErrDownDisabled, to prevent an accidental
+	// destruction of the schema. It is recommended in production
+	DisableDown bool
+}
+
+// ErrDownDisabled is returned when a migration would go down while Migrations.DisableDown is set
+var ErrDownDisabled = errors.New("down migrations are disabled")
+
+// CheckDirection returns ErrDownDisabled when migrating from version to targetVersion is refused by DisableDown
+func (m *Migrations) CheckDirection(version, targetVersion uint64) error {
+	if m.DisableDown && targetVersion < version {
+		return fmt.Errorf("%w: refusing to migrate from version %d to %d", ErrDownDisabled, version, targetVersion)
+	}
+	return nil
 }
 
 func NewMigrations(up []string, down []string) (*Migrations, error) {
@@ -131,6 +182,28 @@ func NewMigrationsFromFS(fsys fs.FS, subpath string) (*Migrations, error) {
 	return output, nil
 }
 
+// NewMigrationsFromMultipleFS concatenates the migrations found in subpaths[i] of each fsys[i], in order
+// Each source is numbered on its own and must pair its up and down migrations:
+// the migrations of a source are renumbered to follow the ones of the previous sources
+func NewMigrationsFromMultipleFS(fsys []fs.FS, subpaths []string) (*Migrations, error) {
+	if len(fsys) != len(subpaths) {
+		return nil, fmt.Errorf("must have a subpath for each filesystem")
+	}
+	output := &Migrations{
+		UpScripts:   []string{},
+		DownScripts: []string{},
+	}
+	for i := range fsys {
+		m, err := NewMigrationsFromFS(fsys[i], subpaths[i])
+		if err != nil {
+			return nil, fmt.Errorf("filesystem %d: %w", i, err)
+		}
+		output.UpScripts = append(output.UpScripts, m.UpScripts...)
+		output.DownScripts = append(output.DownScripts, m.DownScripts...)
+	}
+	return output, nil
+}
+
 var filenameRegex = regexp.MustCompile(`([0-9]+)_.*\.(up|down)\.sql`)
 
 func parseMigration(name string) (*migration, bool) {
@@ -183,6 +256,12 @@ func (m *Migrations) Migrate(ctx context.Context, conn *sqlite.Conn, targetVersi
 		return fmt.Errorf("migrate failed: %w", err)
 	}
 
+	if m.History {
+		if err := ensureHistorySchema(conn); err != nil {
+			return fmt.Errorf("migrate failed: %w", err)
+		}
+	}
+
 	version, err := dbVersion(conn)
 	if err != nil {
 		return fmt.Errorf("migrate failed: %w", err)
@@ -196,15 +275,19 @@ func (m *Migrations) Migrate(ctx context.Context, conn *sqlite.Conn, targetVersi
 		return fmt.Errorf("migrate failed: database version %d is higher than max migration version %d", version, len(m.UpScripts))
 	}
 
+	if err := m.CheckDirection(version, targetVersion); err != nil {
+		return fmt.Errorf("migrate failed: %w", err)
+	}
+
 	if targetVersion < version {
 		for i := int(version - 1); i >= int(targetVersion); i-- {
-			if err := sqlitex.ExecuteScript(conn, m.DownScripts[i], nil); err != nil {
+			if err := m.applyStep(conn, uint64(i+1), DirectionDown, m.DownScripts[i]); err != nil {
 				return fmt.Errorf("migrate failed: %w", err)
 			}
 		}
 	} else {
-		for _, migration := range m.UpScripts[version:targetVersion] {
-			if err := sqlitex.ExecuteScript(conn, migration, nil); err != nil {
+		for i := version; i < targetVersion; i++ {
+			if err := m.applyStep(conn, i+1, DirectionUp, m.UpScripts[i]); err != nil {
 				return fmt.Errorf("migrate failed: %w", err)
 			}
 		}
@@ -215,3 +298,23 @@ func (m *Migrations) Migrate(ctx context.Context, conn *sqlite.Conn, targetVersi
 	}
 	return nil
 }
+
+func (m *Migrations) applyStep(conn *sqlite.Conn, version uint64, direction string, script string) error {
+	start := time.Now()
+	if err := m.execScript(conn, version, script); err != nil {
+		return err
+	}
+	if !m.History {
+		return nil
+	}
+	return addHistory(conn, version, direction, start, time.Since(start), script)
+}
+
+func (m *Migrations) execScript(conn *sqlite.Conn, version uint64, script string) error {
+	if !m.PerStatement {
+		return sqlitex.ExecuteScript(conn, script, nil)
+	}
+	return ExecStatements(version, script, func(sql string) error {
+		return sqlitex.ExecuteTransient(conn, sql, nil)
+	})
+}
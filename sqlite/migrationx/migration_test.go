@@ -2,10 +2,12 @@ package migrationx
 
 import (
 	"context"
+	"io/fs"
 	"path/filepath"
 	"sync"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"zombiezen.com/go/sqlite"
@@ -109,6 +111,77 @@ func TestNewMigrationsFromFS(t *testing.T) {
 	})
 }
 
+func TestNewMigrationsFromMultipleFS(t *testing.T) {
+	base := fstest.MapFS{
+		"migrations/01_initial.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE test1 (name text, value int);")},
+		"migrations/01_initial.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE test1;")},
+		"migrations/02_second.up.sql":    &fstest.MapFile{Data: []byte("CREATE TABLE test2 (name text, value int);")},
+		"migrations/02_second.down.sql":  &fstest.MapFile{Data: []byte("DROP TABLE test2;")},
+	}
+	plugin := fstest.MapFS{
+		"01_plugin.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE test3 (name text, value int);")},
+		"01_plugin.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE test3;")},
+	}
+
+	t.Run("Should return an error if the number of subpaths does not match", func(t *testing.T) {
+		_, err := NewMigrationsFromMultipleFS([]fs.FS{base, plugin}, []string{"migrations"})
+		require.EqualError(t, err, "must have a subpath for each filesystem")
+	})
+
+	t.Run("Should return an error if a filesystem does not pair its migrations", func(t *testing.T) {
+		broken := fstest.MapFS{
+			"01_plugin.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE test3 (name text, value int);")},
+			"02_plugin.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE test3;")},
+		}
+
+		_, err := NewMigrationsFromMultipleFS([]fs.FS{base, broken}, []string{"migrations", "."})
+		require.EqualError(t, err, "filesystem 1: down migration for migration 1 is missing")
+	})
+
+	t.Run("Should renumber the migrations in the order of the filesystems", func(t *testing.T) {
+		migrations, err := NewMigrationsFromMultipleFS([]fs.FS{base, plugin}, []string{"migrations", "."})
+		require.NoError(t, err)
+
+		require.Equal(t, []string{
+			"CREATE TABLE test1 (name text, value int);",
+			"CREATE TABLE test2 (name text, value int);",
+			"CREATE TABLE test3 (name text, value int);",
+		}, migrations.UpScripts)
+		require.Equal(t, []string{
+			"DROP TABLE test1;",
+			"DROP TABLE test2;",
+			"DROP TABLE test3;",
+		}, migrations.DownScripts)
+	})
+
+	t.Run("Should apply the merged migrations", func(t *testing.T) {
+		migrations, err := NewMigrationsFromMultipleFS([]fs.FS{base, plugin}, []string{"migrations", "."})
+		require.NoError(t, err)
+
+		expected := []string{
+			"CREATE TABLE schema_migrations (version uint64, dirty bool)",
+			"CREATE UNIQUE INDEX version_unique ON schema_migrations (version)",
+			"CREATE TABLE test1 (name text, value int)",
+			"CREATE TABLE test2 (name text, value int)",
+			"CREATE TABLE test3 (name text, value int)",
+		}
+		db := testDb(t)
+		ctx := context.Background()
+
+		require.NoError(t, migrations.Up(ctx, db))
+
+		statements := dbSchema(t, db)
+		version, err := dbVersion(db)
+		require.NoError(t, err)
+
+		require.Equal(t, expected, statements)
+		require.Equal(t, uint64(3), version)
+
+		require.NoError(t, migrations.Migrate(ctx, db, 2))
+		require.Equal(t, expected[:4], dbSchema(t, db))
+	})
+}
+
 func TestParseMigration(t *testing.T) {
 	cases := []struct {
 		input  string
@@ -574,6 +647,143 @@ func TestMigrationsMigrate(t *testing.T) {
 	})
 }
 
+func TestMigrationsPerStatement(t *testing.T) {
+	up := []string{
+		"CREATE TABLE test1 (name text, value int);",
+		"CREATE TABLE test2 (name text, value int);\nINSERT INTO test2 VALUES ('a', 1);\n\nINSERT INTO missing\n  VALUES ('b', 2);\nCREATE TABLE test3 (name text, value int);",
+	}
+	down := []string{
+		"DROP TABLE test1;",
+		"DROP TABLE test3; DROP TABLE test2;",
+	}
+
+	t.Run("Should name the statement that failed", func(t *testing.T) {
+		migrations, err := NewMigrations(up, down)
+		require.NoError(t, err)
+		migrations.PerStatement = true
+		conn := testDb(t)
+
+		err = migrations.Up(context.Background(), conn)
+		require.EqualError(t, err, "migrate failed: migration 2: statement 3 at line 4 failed: sqlite: prepare: SQL logic error: no such table: missing: INSERT INTO missing VALUES ('b', 2);")
+		var stmtErr *StatementError
+		require.ErrorAs(t, err, &stmtErr)
+		require.Equal(t, uint64(2), stmtErr.Migration)
+		require.Equal(t, 3, stmtErr.Index)
+
+		// The whole migration is rolled back
+		require.Empty(t, dbSchema(t, conn))
+	})
+
+	t.Run("Should apply valid migrations statement by statement", func(t *testing.T) {
+		migrations, err := NewMigrations(up[:1], down[:1])
+		require.NoError(t, err)
+		migrations.PerStatement = true
+		conn := testDb(t)
+
+		require.NoError(t, migrations.Up(context.Background(), conn))
+		require.NoError(t, migrations.Down(context.Background(), conn))
+	})
+}
+
+func TestMigrationsHistory(t *testing.T) {
+	up := []string{
+		"CREATE TABLE test1 (name text, value int);",
+		"CREATE TABLE test2 (name text, value int);",
+		"CREATE TABLE test3 (name text, value int);",
+	}
+	down := []string{
+		"DROP TABLE test1;",
+		"DROP TABLE test2;",
+		"DROP TABLE test3;",
+	}
+
+	t.Run("Should not create the history table by default", func(t *testing.T) {
+		migrations, err := NewMigrations(up, down)
+		require.NoError(t, err)
+		conn := testDb(t)
+
+		require.NoError(t, migrations.Up(context.Background(), conn))
+		require.NotContains(t, dbSchema(t, conn), "CREATE TABLE schema_migration_history (version uint64, direction text, applied_at timestamp, duration_ms int, checksum text)")
+	})
+
+	t.Run("Should record a history row per applied step", func(t *testing.T) {
+		migrations, err := NewMigrations(up, down)
+		require.NoError(t, err)
+		migrations.History = true
+		conn := testDb(t)
+		before := time.Now()
+
+		require.NoError(t, migrations.Up(context.Background(), conn))
+		require.NoError(t, migrations.Migrate(context.Background(), conn, 1))
+		// Noop migrations are not recorded
+		require.NoError(t, migrations.Migrate(context.Background(), conn, 1))
+
+		expected := []historyRow{
+			{version: 1, direction: DirectionUp, checksum: Checksum(up[0])},
+			{version: 2, direction: DirectionUp, checksum: Checksum(up[1])},
+			{version: 3, direction: DirectionUp, checksum: Checksum(up[2])},
+			{version: 3, direction: DirectionDown, checksum: Checksum(down[2])},
+			{version: 2, direction: DirectionDown, checksum: Checksum(down[1])},
+		}
+		rows := history(t, conn)
+		require.Len(t, rows, len(expected))
+		for i, row := range rows {
+			require.Equal(t, expected[i].version, row.version)
+			require.Equal(t, expected[i].direction, row.direction)
+			require.Equal(t, expected[i].checksum, row.checksum)
+			require.GreaterOrEqual(t, row.durationMs, int64(0))
+			require.False(t, row.appliedAt.Before(before), "applied at %s", row.appliedAt)
+			require.False(t, row.appliedAt.After(time.Now()), "applied at %s", row.appliedAt)
+		}
+	})
+
+	t.Run("Should roll back the history of a failed migration", func(t *testing.T) {
+		migrations, err := NewMigrations(append(up[:1:1], "INSERT INTO missing VALUES (1);"), down[:2])
+		require.NoError(t, err)
+		migrations.History = true
+		conn := testDb(t)
+
+		require.Error(t, migrations.Up(context.Background(), conn))
+		require.NoError(t, migrations.Migrate(context.Background(), conn, 1))
+
+		rows := history(t, conn)
+		require.Len(t, rows, 1)
+		require.Equal(t, uint64(1), rows[0].version)
+	})
+}
+
+type historyRow struct {
+	version    uint64
+	direction  string
+	appliedAt  time.Time
+	durationMs int64
+	checksum   string
+}
+
+func history(t *testing.T, conn *sqlite.Conn) []historyRow {
+	t.Helper()
+
+	rows := []historyRow{}
+	require.NoError(t, sqlitex.ExecuteTransient(conn, "SELECT version, direction, applied_at, duration_ms, checksum FROM schema_migration_history ORDER BY rowid;", &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			appliedAt, err := time.Parse(time.RFC3339Nano, stmt.ColumnText(2))
+			if err != nil {
+				return err
+			}
+			rows = append(rows, historyRow{
+				version:    uint64(stmt.ColumnInt64(0)),
+				direction:  stmt.ColumnText(1),
+				appliedAt:  appliedAt,
+				durationMs: stmt.ColumnInt64(3),
+				checksum:   stmt.ColumnText(4),
+			})
+			return nil
+		},
+	}))
+
+	return rows
+}
+
 func TestMigrationsUp(t *testing.T) {
 	up := []string{
 		"CREATE TABLE test1 (name text, value int);",
@@ -641,3 +851,39 @@ func TestMigrationsDown(t *testing.T) {
 	require.Equal(t, expected, statements)
 	require.Equal(t, uint64(0), version)
 }
+
+func TestMigrationsDisableDown(t *testing.T) {
+	up := []string{
+		"CREATE TABLE test1 (name text, value int);",
+		"CREATE TABLE test2 (name text, value int);",
+	}
+	down := []string{
+		"DROP TABLE test1;",
+		"DROP TABLE test2;",
+	}
+	migrations, err := NewMigrations(up, down)
+	require.NoError(t, err)
+	migrations.DisableDown = true
+
+	t.Run("Should refuse to migrate down", func(t *testing.T) {
+		conn := testDb(t)
+		require.NoError(t, migrations.Up(context.Background(), conn))
+
+		err := migrations.Migrate(context.Background(), conn, 1)
+		require.ErrorIs(t, err, ErrDownDisabled)
+		require.EqualError(t, err, "migrate failed: down migrations are disabled: refusing to migrate from version 2 to 1")
+		version, err := dbVersion(conn)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), version)
+	})
+
+	t.Run("Should still migrate up", func(t *testing.T) {
+		conn := testDb(t)
+		require.NoError(t, migrations.Migrate(context.Background(), conn, 1))
+		require.NoError(t, migrations.Up(context.Background(), conn))
+
+		version, err := dbVersion(conn)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), version)
+	})
+}
@@ -0,0 +1,192 @@
+package migrationx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrNonTransactional is returned for statements which can't run in the migration transaction
+var ErrNonTransactional = errors.New("statement can't run in a transaction")
+
+// Statement is a single SQL statement of a migration script
+type Statement struct {
+	// Line is the line of the script on which the statement starts, starting at 1
+	Line int
+	// SQL is the text of the statement, including the terminating semicolon
+	SQL string
+}
+
+// StatementError identifies the statement of a migration script that failed
+type StatementError struct {
+	// Migration is the version of the migration, starting at 1
+	Migration uint64
+	// Index is the position of the statement in the script, starting at 1
+	Index     int
+	Statement Statement
+	Err       error
+}
+
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("migration %d: statement %d at line %d failed: %v: %s", e.Migration, e.Index, e.Statement.Line, e.Err, snippet(e.Statement.SQL))
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+const snippetLength = 80
+
+// snippet collapses the whitespace of a statement and truncates it, so it fits on a log line
+func snippet(sql string) string {
+	s := strings.Join(strings.Fields(sql), " ")
+	if len(s) > snippetLength {
+		return s[:snippetLength] + "..."
+	}
+	return s
+}
+
+// SplitStatements splits a migration script into its statements
+// Semicolons in strings, quoted identifiers, comments and trigger bodies don't end a statement
+// Comments and whitespace between statements are dropped
+func SplitStatements(script string) []Statement {
+	statements := []Statement{}
+	line, start, startLine := 1, -1, 0
+	// The words of the current statement, used to find the end of triggers
+	words := []string{}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '\n':
+			line++
+			continue
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			// The newline is handled by the next iteration
+			i += end - 1
+			continue
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				end = len(script) - i - 2
+			} else {
+				end += 2
+			}
+			line += strings.Count(script[i:i+2+end], "\n")
+			i += 1 + end
+			continue
+		case unicode.IsSpace(rune(c)):
+			continue
+		}
+
+		if start < 0 {
+			start, startLine = i, line
+		}
+
+		switch {
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			end := strings.IndexByte(script[i+1:], closing)
+			if end < 0 {
+				end = len(script) - i - 1
+			}
+			line += strings.Count(script[i:i+1+end], "\n")
+			// Doubled quotes are escapes, which are handled as 2 consecutive strings
+			i += 1 + end
+		case isWordByte(c):
+			end := i
+			for end < len(script) && isWordByte(script[end]) {
+				end++
+			}
+			words = append(words, strings.ToUpper(script[i:end]))
+			i = end - 1
+		case c == ';':
+			if isTrigger(words) && words[len(words)-1] != "END" {
+				continue
+			}
+			statements = append(statements, Statement{Line: startLine, SQL: script[start : i+1]})
+			start, words = -1, words[:0]
+		}
+	}
+
+	if start >= 0 {
+		statements = append(statements, Statement{Line: startLine, SQL: strings.TrimRightFunc(script[start:], unicode.IsSpace)})
+	}
+	return statements
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isTrigger(words []string) bool {
+	if len(words) < 2 || words[0] != "CREATE" {
+		return false
+	}
+	if words[1] == "TEMP" || words[1] == "TEMPORARY" {
+		return len(words) > 2 && words[2] == "TRIGGER"
+	}
+	return words[1] == "TRIGGER"
+}
+
+// nonTransactional lists the statements which fail or are silently ignored inside a transaction
+var nonTransactional = [][]string{
+	{"BEGIN"},
+	{"COMMIT"},
+	{"END"},
+	{"VACUUM"},
+	{"PRAGMA", "FOREIGN_KEYS"},
+	{"PRAGMA", "JOURNAL_MODE"},
+}
+
+// checkTransactional returns ErrNonTransactional if the statement can't run in the migration transaction
+func checkTransactional(sql string) error {
+	fields := strings.FieldsFunc(strings.ToUpper(sql), func(r rune) bool {
+		return r > unicode.MaxASCII || !isWordByte(byte(r))
+	})
+	for _, prefix := range nonTransactional {
+		if len(fields) < len(prefix) {
+			continue
+		}
+		match := true
+		for i := range prefix {
+			if fields[i] != prefix[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return ErrNonTransactional
+		}
+	}
+	if len(fields) > 0 && fields[0] == "ROLLBACK" && (len(fields) < 2 || fields[1] != "TO") {
+		return ErrNonTransactional
+	}
+	return nil
+}
+
+// ExecStatements runs each statement of the script of the given migration version with exec
+// Statements which can't run in the migration transaction are rejected before anything is executed
+// The returned error is a *StatementError identifying the failed statement
+func ExecStatements(version uint64, script string, exec func(sql string) error) error {
+	statements := SplitStatements(script)
+	for i, s := range statements {
+		if err := checkTransactional(s.SQL); err != nil {
+			return &StatementError{Migration: version, Index: i + 1, Statement: s, Err: err}
+		}
+	}
+	for i, s := range statements {
+		if err := exec(s.SQL); err != nil {
+			return &StatementError{Migration: version, Index: i + 1, Statement: s, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package migrationx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitStatements(t *testing.T) {
+	testCases := []struct {
+		name     string
+		script   string
+		expected []Statement
+	}{
+		{
+			name:     "Should return no statement for an empty script",
+			script:   "  \n-- only a comment\n",
+			expected: []Statement{},
+		},
+		{
+			name:   "Should split statements and record their line",
+			script: "CREATE TABLE test1 (name text);\n\nCREATE TABLE test2 (name text); CREATE TABLE test3 (name text);\n",
+			expected: []Statement{
+				{Line: 1, SQL: "CREATE TABLE test1 (name text);"},
+				{Line: 3, SQL: "CREATE TABLE test2 (name text);"},
+				{Line: 3, SQL: "CREATE TABLE test3 (name text);"},
+			},
+		},
+		{
+			name:   "Should keep a statement without a terminating semicolon",
+			script: "CREATE TABLE test1 (name text);\nDROP TABLE test1\n",
+			expected: []Statement{
+				{Line: 1, SQL: "CREATE TABLE test1 (name text);"},
+				{Line: 2, SQL: "DROP TABLE test1"},
+			},
+		},
+		{
+			name:   "Should ignore semicolons in strings, identifiers and comments",
+			script: "-- a comment; with a semicolon\nINSERT INTO \"a;b\" VALUES ('x;\ny', [c;d], `e;f`); /* multi\nline; */\nSELECT 1;",
+			expected: []Statement{
+				{Line: 2, SQL: "INSERT INTO \"a;b\" VALUES ('x;\ny', [c;d], `e;f`);"},
+				{Line: 5, SQL: "SELECT 1;"},
+			},
+		},
+		{
+			name:   "Should handle escaped quotes",
+			script: "INSERT INTO test VALUES ('it''s; fine');\nSELECT 1;",
+			expected: []Statement{
+				{Line: 1, SQL: "INSERT INTO test VALUES ('it''s; fine');"},
+				{Line: 2, SQL: "SELECT 1;"},
+			},
+		},
+		{
+			name:   "Should keep the body of a trigger in a single statement",
+			script: "CREATE TEMP TRIGGER log AFTER INSERT ON test BEGIN\n  INSERT INTO history VALUES (new.name);\n  DELETE FROM pending;\nEND;\nSELECT 1;",
+			expected: []Statement{
+				{Line: 1, SQL: "CREATE TEMP TRIGGER log AFTER INSERT ON test BEGIN\n  INSERT INTO history VALUES (new.name);\n  DELETE FROM pending;\nEND;"},
+				{Line: 5, SQL: "SELECT 1;"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, SplitStatements(tc.script))
+		})
+	}
+}
+
+func TestExecStatements(t *testing.T) {
+	t.Run("Should report the statement that failed", func(t *testing.T) {
+		script := "CREATE TABLE test1 (name text);\nCREATE TABLE test2 (name text);\n\nINSERT INTO missing\n  VALUES ('x');\nCREATE TABLE test3 (name text);\n"
+		failure := errors.New("no such table: missing")
+		executed := []string{}
+
+		err := ExecStatements(4, script, func(sql string) error {
+			executed = append(executed, sql)
+			if len(executed) == 3 {
+				return failure
+			}
+			return nil
+		})
+
+		require.ErrorIs(t, err, failure)
+		var stmtErr *StatementError
+		require.ErrorAs(t, err, &stmtErr)
+		require.Equal(t, 3, stmtErr.Index)
+		require.Equal(t, 4, stmtErr.Statement.Line)
+		require.EqualError(t, err, "migration 4: statement 3 at line 4 failed: no such table: missing: INSERT INTO missing VALUES ('x');")
+		require.Len(t, executed, 3)
+	})
+
+	t.Run("Should reject statements which can't run in a transaction before executing anything", func(t *testing.T) {
+		for _, sql := range []string{"VACUUM;", "pragma foreign_keys = off;", "PRAGMA journal_mode=WAL;", "COMMIT;", "ROLLBACK;"} {
+			executed := 0
+			err := ExecStatements(1, "CREATE TABLE test1 (name text);\n"+sql, func(string) error {
+				executed++
+				return nil
+			})
+
+			require.ErrorIs(t, err, ErrNonTransactional, sql)
+			require.Zero(t, executed, sql)
+		}
+	})
+
+	t.Run("Should accept savepoints", func(t *testing.T) {
+		err := ExecStatements(1, "SAVEPOINT a; ROLLBACK TO a; RELEASE a;", func(string) error { return nil })
+		require.NoError(t, err)
+	})
+
+	t.Run("Should truncate long statements in the error", func(t *testing.T) {
+		sql := "INSERT INTO test VALUES ('" + strings.Repeat("x", 100) + "');"
+		err := ExecStatements(1, sql, func(string) error { return errors.New("failed") })
+		require.Len(t, err.Error(), len("migration 1: statement 1 at line 1 failed: failed: ")+snippetLength+len("..."))
+	})
+}
@@ -0,0 +1,45 @@
+// Package stellingtest runs a full fx app in a test, for the lifetime of a callback.
+package stellingtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+// DefaultTimeout bounds the start, the callback and the stop of the app run by Run
+const DefaultTimeout = 30 * time.Second
+
+// Run is RunWithTimeout with the DefaultTimeout
+func Run[T any](t testing.TB, fn func(ctx context.Context, deps T) error, opts ...fx.Option) {
+	RunWithTimeout(t, DefaultTimeout, fn, opts...)
+}
+
+// RunWithTimeout starts an app made of opts, calls fn with the populated dependencies and stops the app
+// The dependencies can be a single type, or a struct embedding fx.In to request several of them
+// Each of the start, the callback and the stop is bounded by the timeout: the context given to fn is
+// cancelled when it expires.
+// The test fails when the app cannot be built, started or stopped, or when fn returns an error.
+func RunWithTimeout[T any](t testing.TB, timeout time.Duration, fn func(ctx context.Context, deps T) error, opts ...fx.Option) {
+	t.Helper()
+
+	var deps T
+	app := fxtest.New(t,
+		fx.Options(opts...),
+		fx.Populate(&deps),
+		fx.StartTimeout(timeout),
+		fx.StopTimeout(timeout),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := fn(ctx, deps); err != nil {
+		t.Errorf("stellingtest: callback failed: %v", err)
+	}
+}
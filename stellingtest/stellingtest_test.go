@@ -0,0 +1,75 @@
+package stellingtest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/exoscale/stelling/fxgrpc/grpctest"
+	"github.com/exoscale/stelling/stellingtest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	pb "google.golang.org/grpc/examples/route_guide/routeguide"
+)
+
+type routeGuideServer struct {
+	pb.UnimplementedRouteGuideServer
+}
+
+func (s *routeGuideServer) GetFeature(ctx context.Context, p *pb.Point) (*pb.Feature, error) {
+	return &pb.Feature{Name: "stelling", Location: p}, nil
+}
+
+func newRouteGuideServer() pb.RouteGuideServer {
+	return &routeGuideServer{}
+}
+
+type deps struct {
+	fx.In
+
+	Client pb.RouteGuideClient
+	Logger *zap.Logger
+}
+
+func TestRun(t *testing.T) {
+	t.Run("Should run a grpc round-trip against the started app", func(t *testing.T) {
+		stellingtest.Run(t, func(ctx context.Context, d deps) error {
+			feature, err := d.Client.GetFeature(ctx, &pb.Point{Latitude: 1, Longitude: 2})
+			if err != nil {
+				return err
+			}
+			require.Equal(t, "stelling", feature.Name)
+			require.Equal(t, int32(1), feature.Location.Latitude)
+			d.Logger.Info("Round-trip done")
+			return nil
+		},
+			grpctest.Module,
+			fx.Supply(zaptest.NewLogger(t)),
+			fx.Provide(newRouteGuideServer, pb.NewRouteGuideClient),
+			fx.Invoke(pb.RegisterRouteGuideServer),
+		)
+	})
+
+	t.Run("Should fail the test when the callback returns an error", func(t *testing.T) {
+		tb := &recordingTB{TB: t}
+		stellingtest.Run(tb, func(ctx context.Context, logger *zap.Logger) error {
+			return errors.New("boom")
+		}, fx.Supply(zaptest.NewLogger(t)))
+
+		require.Len(t, tb.errors, 1)
+		require.Contains(t, tb.errors[0], "boom")
+	})
+}
+
+// recordingTB records the errors reported by the helper instead of failing the test
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}